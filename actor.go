@@ -0,0 +1,381 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"sync"
+)
+
+// Actor owns a FSM and processes the events sent to it strictly one at a time,
+// on a goroutine of its own. Events of the mailbox are processed in order of
+// the EventDesc.Priority of their transition from the state the FSM is in
+// when they are sent, and in the order they were sent for equal priorities,
+// so that a control event such as "abort" jumps ahead of bulk events.
+//
+// Callbacks can send further events to the actor with Send. They are
+// processed after the current one, instead of failing with an
+// InTransitionError as calling FSM.Event from a callback does.
+//
+// An actor can also be driven from a select loop, with EventChan,
+// Notifications and Done:
+//
+//	notifications := a.Notifications()
+//	for {
+//		select {
+//		case event := <-events:
+//			select {
+//			case a.EventChan() <- fsm.EventMsg{Event: event}:
+//			case <-a.Done():
+//				return
+//			}
+//		case t, ok := <-notifications:
+//			if !ok {
+//				return
+//			}
+//			log.Printf("%s -> %s", t.Src, t.Dst)
+//		}
+//	}
+type Actor struct {
+	// OnError is called on the actor goroutine with the errors of the events
+	// given to Send. It may be nil, and must be set before events are sent.
+	OnError func(event string, err error)
+
+	fsm    *FSM
+	size   int
+	events chan EventMsg
+	done   chan struct{}
+
+	// boxMu guards mailbox, idle and room. mailbox holds the messages not
+	// processed yet, by decreasing priority. idle is set while the actor
+	// waits for a message, which makes room for one in an empty mailbox even
+	// if size is zero, as for an unbuffered channel. room is closed and
+	// replaced when room is made, to wake up Ask.
+	boxMu   sync.Mutex
+	mailbox []message
+	idle    bool
+	room    chan struct{}
+
+	// ready signals the actor that a message has been put in the mailbox.
+	ready chan struct{}
+
+	// closing is closed by Close, which makes the actor drain the mailbox and
+	// stop.
+	closing chan struct{}
+
+	// mu guards closed and notifications, and is held by Send and Ask while
+	// putting a message in the mailbox, so that the messages sent before
+	// Close are drained. It is never held while blocking.
+	mu     sync.RWMutex
+	closed bool
+
+	// notifications is the subscription of Notifications, canceled once the
+	// actor is stopped.
+	notifications <-chan Transition
+	unsubscribe   func()
+}
+
+// EventMsg is an event sent to an Actor with EventChan.
+type EventMsg struct {
+	// Ctx is given to FSM.EventCtx. It defaults to context.Background().
+	Ctx context.Context
+
+	Event string
+	Args  []interface{}
+
+	// Result receives the error of the event, which may be nil, once it has
+	// been processed. It should be buffered, since the actor waits until it
+	// is received. If Result is nil the error is given to OnError.
+	Result chan<- error
+}
+
+// message is an event in the mailbox of an Actor.
+type message struct {
+	ctx      context.Context
+	event    string
+	args     []interface{}
+	result   chan<- error
+	priority int
+}
+
+// NewActor starts an actor for f, with room for size events in its mailbox.
+// The FSM should not be used directly while the actor is running.
+func NewActor(f *FSM, size int) *Actor {
+	a := &Actor{
+		fsm:     f,
+		size:    size,
+		events:  make(chan EventMsg),
+		done:    make(chan struct{}),
+		closing: make(chan struct{}),
+		room:    make(chan struct{}),
+		ready:   make(chan struct{}, 1),
+	}
+	go a.run()
+	return a
+}
+
+// FSM returns the FSM of the actor.
+func (a *Actor) FSM() *FSM {
+	return a.fsm
+}
+
+// Send puts the event in the mailbox and returns without waiting for it to be
+// processed. Its error is given to OnError.
+//
+// Send does not block, so it can be called from callbacks. It returns a
+// MailboxFullError if the mailbox is full and an ActorClosedError if the actor
+// is closed.
+func (a *Actor) Send(event string, args ...interface{}) error {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if a.closed {
+		return ActorClosedError{event}
+	}
+	if _, ok := a.put(message{ctx: context.Background(), event: event, args: args}); !ok {
+		return MailboxFullError{event}
+	}
+	return nil
+}
+
+// EventChan returns a channel to send events to the actor, for select loops.
+// A send blocks until the actor receives the event, between the events of the
+// mailbox, and returns without waiting for it to be processed; its error is
+// given to EventMsg.Result.
+//
+// The channel is never closed. Once the actor is stopped it is no longer
+// received from, so sends should select on Done as well. Like Ask, sending on
+// it must not be done from a callback.
+func (a *Actor) EventChan() chan<- EventMsg {
+	return a.events
+}
+
+// Notifications returns a channel receiving the transitions of the FSM, as
+// subscribed with FSM.Subscribe and an empty StateFilter. The subscription is
+// made by the first call, and the same channel is returned by the later ones.
+// It is canceled, closing the channel, once the actor is stopped and the
+// events of the mailbox have been processed.
+//
+// As for Subscribe, transitions are dropped while SubscriptionBuffer of them
+// are waiting to be received.
+func (a *Actor) Notifications() <-chan Transition {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.notifications == nil {
+		a.notifications, a.unsubscribe = a.fsm.Subscribe(StateFilter{})
+		select {
+		case <-a.done:
+			a.unsubscribe()
+		default:
+		}
+	}
+	return a.notifications
+}
+
+// Done returns a channel closed once the actor is stopped by Close and the
+// events of the mailbox have been processed.
+func (a *Actor) Done() <-chan struct{} {
+	return a.done
+}
+
+// Ask puts the event in the mailbox, waiting for room if needed, and returns
+// the error of the event once it has been processed, with ctx given to
+// FSM.EventCtx. If ctx is done first, its error is returned, and the event is
+// processed anyway if it was already in the mailbox. If the actor is closed
+// before the event is processed, an ActorClosedError is returned.
+//
+// Ask must not be called from a callback, since the event would wait for the
+// event being processed and the other way around.
+func (a *Actor) Ask(ctx context.Context, event string, args ...interface{}) error {
+	result := make(chan error, 1)
+
+	for {
+		a.mu.RLock()
+		if a.closed {
+			a.mu.RUnlock()
+			return ActorClosedError{event}
+		}
+		room, ok := a.put(message{ctx: ctx, event: event, args: args, result: result})
+		a.mu.RUnlock()
+		if ok {
+			break
+		}
+		select {
+		case <-room:
+		case <-a.closing:
+			return ActorClosedError{event}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	select {
+	case err := <-result:
+		return err
+	case <-a.done:
+		// The result is sent before done is closed, but select may pick
+		// either.
+		select {
+		case err := <-result:
+			return err
+		default:
+			return ActorClosedError{event}
+		}
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close stops accepting events, waits for the events in the mailbox to be
+// processed and stops the actor. Events sent by callbacks while the mailbox is
+// drained are rejected like any other.
+func (a *Actor) Close() {
+	a.mu.Lock()
+	if !a.closed {
+		a.closed = true
+		close(a.closing)
+	}
+	a.mu.Unlock()
+	<-a.done
+}
+
+// put puts m in the mailbox, after the messages with the same or a higher
+// priority, and returns true if there was room for it. Otherwise it returns
+// a channel closed once room is made.
+func (a *Actor) put(m message) (<-chan struct{}, bool) {
+	m.priority = a.priority(m.event)
+
+	a.boxMu.Lock()
+	defer a.boxMu.Unlock()
+
+	n := len(a.mailbox)
+	if n >= a.size && !(a.idle && n == 0) {
+		return a.room, false
+	}
+	i := n
+	for i > 0 && a.mailbox[i-1].priority < m.priority {
+		i--
+	}
+	a.mailbox = append(a.mailbox, message{})
+	copy(a.mailbox[i+1:], a.mailbox[i:])
+	a.mailbox[i] = m
+
+	select {
+	case a.ready <- struct{}{}:
+	default:
+	}
+	return nil, true
+}
+
+// priority returns the priority of the transition for event from the current
+// state of the FSM, or zero if there is none.
+func (a *Actor) priority(event string) int {
+	desc, _ := a.fsm.Lookup(event, a.fsm.Current())
+	return desc.Priority
+}
+
+// take takes the first message of the mailbox, and returns false if it is
+// empty. The actor is then idle until it takes one.
+func (a *Actor) take() (message, bool) {
+	a.boxMu.Lock()
+	defer a.boxMu.Unlock()
+
+	if len(a.mailbox) == 0 {
+		if !a.idle {
+			a.idle = true
+			a.makeRoom()
+		}
+		return message{}, false
+	}
+	m := a.mailbox[0]
+	a.mailbox[0] = message{}
+	a.mailbox = a.mailbox[1:]
+	a.idle = false
+	a.makeRoom()
+	return m, true
+}
+
+// makeRoom wakes up the calls to Ask waiting for room. boxMu must be locked.
+func (a *Actor) makeRoom() {
+	close(a.room)
+	a.room = make(chan struct{})
+}
+
+// run processes the mailbox and the events of EventChan until the actor is
+// closed and the mailbox is drained. An event of EventChan is received after
+// each event of the mailbox, if one is waiting.
+func (a *Actor) run() {
+	defer a.stopped()
+	for {
+		if m, ok := a.take(); ok {
+			a.process(m)
+			select {
+			case m := <-a.events:
+				a.receive(m)
+			default:
+			}
+			continue
+		}
+		select {
+		case <-a.ready:
+		case m := <-a.events:
+			a.receive(m)
+		case <-a.closing:
+			for {
+				m, ok := a.take()
+				if !ok {
+					return
+				}
+				a.process(m)
+			}
+		}
+	}
+}
+
+// receive processes an event of EventChan.
+func (a *Actor) receive(m EventMsg) {
+	a.boxMu.Lock()
+	a.idle = false
+	a.boxMu.Unlock()
+
+	ctx := m.Ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	a.process(message{ctx: ctx, event: m.Event, args: m.Args, result: m.Result})
+}
+
+// stopped marks the actor as stopped and cancels the subscription of
+// Notifications, if any.
+func (a *Actor) stopped() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	close(a.done)
+	if a.unsubscribe != nil {
+		a.unsubscribe()
+	}
+}
+
+// process fires the event of m and reports its error.
+func (a *Actor) process(m message) {
+	err := a.fsm.EventCtx(m.ctx, m.event, m.args...)
+	if m.result != nil {
+		m.result <- err
+	} else if err != nil && a.OnError != nil {
+		a.OnError(m.event, err)
+	}
+}
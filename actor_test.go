@@ -0,0 +1,351 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestActor(t *testing.T) {
+	var a *Actor
+	var visited []string
+	fsm := NewFSM(
+		"start",
+		Events{
+			{EvtName: "run", SrcStates: []string{"start"}, DstStates: "middle"},
+			{EvtName: "finish", SrcStates: []string{"middle"}, DstStates: "end"},
+		},
+		Callbacks{
+			"enter_state": func(action string, e *Event) {
+				visited = append(visited, e.Dst)
+			},
+			"enter_middle": func(action string, e *Event) {
+				if err := a.Send("finish"); err != nil {
+					t.Errorf("expected no error from a callback, got %v", err)
+				}
+			},
+		},
+	)
+	a = NewActor(fsm, 4)
+
+	var errs []string
+	a.OnError = func(event string, err error) {
+		errs = append(errs, err.Error())
+	}
+
+	if err := a.Send("run"); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	if _, ok := a.Ask(context.Background(), "run").(InvalidEventError); !ok {
+		t.Error("expected InvalidEventError")
+	}
+	a.Close()
+
+	if fsm.Current() != "end" || fmt.Sprint(visited) != "[middle end]" {
+		t.Errorf("expected the events in order, got %s %v", fsm.Current(), visited)
+	}
+	if len(errs) != 0 {
+		t.Errorf("unexpected errors %v", errs)
+	}
+	if _, ok := a.Send("run").(ActorClosedError); !ok {
+		t.Error("expected ActorClosedError")
+	}
+	if _, ok := a.Ask(context.Background(), "run").(ActorClosedError); !ok {
+		t.Error("expected ActorClosedError")
+	}
+	a.Close()
+}
+
+func TestActorAsk(t *testing.T) {
+	fsm := NewFSM(
+		"start",
+		Events{
+			{EvtName: "run", SrcStates: []string{"start"}, DstStates: "end"},
+		},
+		Callbacks{},
+	)
+	a := NewActor(fsm, 0)
+	defer a.Close()
+
+	var wg sync.WaitGroup
+	errs := make([]error, 10)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = a.Ask(context.Background(), "run")
+		}(i)
+	}
+	wg.Wait()
+
+	ok := 0
+	for _, err := range errs {
+		if err == nil {
+			ok++
+		} else if _, invalid := err.(InvalidEventError); !invalid {
+			t.Errorf("unexpected error %v", err)
+		}
+	}
+	if ok != 1 {
+		t.Errorf("expected exactly one event to succeed, got %d", ok)
+	}
+
+	var sendErr error
+	a.OnError = func(event string, err error) {
+		sendErr = err
+	}
+	a.Send("bogus")
+	a.Ask(context.Background(), "run")
+	if _, ok := sendErr.(UnknownEventError); !ok {
+		t.Errorf("expected UnknownEventError from OnError, got %v", sendErr)
+	}
+}
+
+func TestActorPriority(t *testing.T) {
+	block := make(chan struct{})
+	var events []string
+	fsm := NewFSM(
+		"idle",
+		Events{
+			{EvtName: "start", SrcStates: []string{"idle"}, DstStates: "running"},
+			{EvtName: "data", SrcStates: []string{"running"}, DstStates: "running"},
+			{EvtName: "abort", SrcStates: []string{"running"}, DstStates: "running", Priority: 10},
+			{EvtName: "pause", SrcStates: []string{"running"}, DstStates: "running", Priority: 5},
+		},
+		Callbacks{
+			"enter_running": func(action string, e *Event) {
+				if e.Event == "start" {
+					<-block
+				}
+			},
+			"after_event": func(action string, e *Event) {
+				events = append(events, e.Event)
+			},
+		},
+	)
+	a := NewActor(fsm, 8)
+
+	if err := a.Send("start"); err != nil {
+		t.Fatal(err)
+	}
+	// Wait for the actor to block on start, then fill the mailbox.
+	for fsm.Current() != "running" {
+		time.Sleep(time.Millisecond)
+	}
+	for _, event := range []string{"data", "data", "pause", "data", "abort", "pause"} {
+		if err := a.Send(event); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(block)
+	a.Close()
+
+	if fmt.Sprint(events) != "[start abort pause pause data data data]" {
+		t.Errorf("expected the events by priority, got %v", events)
+	}
+}
+
+func TestActorMailboxFull(t *testing.T) {
+	block := make(chan struct{})
+	fsm := NewFSM(
+		"start",
+		Events{
+			{EvtName: "run", SrcStates: []string{"start"}, DstStates: "end"},
+		},
+		Callbacks{
+			"enter_end": func(action string, e *Event) {
+				<-block
+			},
+		},
+	)
+	a := NewActor(fsm, 1)
+	defer a.Close()
+
+	started := make(chan struct{})
+	go func() {
+		close(started)
+		a.Ask(context.Background(), "run")
+	}()
+	<-started
+
+	// Wait for the actor to take the event, then fill the mailbox.
+	for fsm.Current() != "end" {
+		time.Sleep(time.Millisecond)
+	}
+	if err := a.Send("run"); err != nil {
+		t.Errorf("expected room for one event, got %v", err)
+	}
+	if _, ok := a.Send("run").(MailboxFullError); !ok {
+		t.Error("expected MailboxFullError")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := a.Ask(ctx, "run"); err != context.DeadlineExceeded {
+		t.Errorf("expected DeadlineExceeded, got %v", err)
+	}
+	close(block)
+}
+
+func TestActorCloseWhileAskBlocked(t *testing.T) {
+	var a *Actor
+	block := make(chan struct{})
+	fsm := NewFSM(
+		"start",
+		Events{
+			{EvtName: "run", SrcStates: []string{"start"}, DstStates: "middle"},
+			{EvtName: "tick", SrcStates: []string{"middle"}, DstStates: "middle"},
+		},
+		Callbacks{
+			"enter_middle": func(action string, e *Event) {
+				<-block
+				a.Send("tick")
+			},
+		},
+	)
+	a = NewActor(fsm, 1)
+
+	go a.Ask(context.Background(), "run")
+	for fsm.Current() != "middle" {
+		time.Sleep(time.Millisecond)
+	}
+	if err := a.Send("tick"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The mailbox is full, so this Ask waits for room.
+	asked := make(chan error, 1)
+	go func() {
+		asked <- a.Ask(context.Background(), "tick")
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	closed := make(chan struct{})
+	go func() {
+		a.Close()
+		close(closed)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(block)
+
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("expected Close to return")
+	}
+	if err := <-asked; err != nil {
+		if _, ok := err.(ActorClosedError); !ok {
+			t.Errorf("expected the event to be processed or ActorClosedError, got %v", err)
+		}
+	}
+}
+
+func TestActorEventChan(t *testing.T) {
+	fsm := NewFSM(
+		"start",
+		Events{
+			{EvtName: "run", SrcStates: []string{"start"}, DstStates: "middle"},
+			{EvtName: "finish", SrcStates: []string{"middle"}, DstStates: "end"},
+		},
+		Callbacks{},
+	)
+	a := NewActor(fsm, 4)
+	var errs []string
+	a.OnError = func(event string, err error) {
+		errs = append(errs, event)
+	}
+	notifications := a.Notifications()
+	if a.Notifications() != notifications {
+		t.Error("expected the same notifications channel")
+	}
+
+	result := make(chan error, 1)
+	a.EventChan() <- EventMsg{Event: "run", Result: result}
+	if err := <-result; err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	a.EventChan() <- EventMsg{Event: "run"}
+	a.EventChan() <- EventMsg{Ctx: context.Background(), Event: "finish"}
+
+	var seen []string
+	for len(seen) < 2 {
+		select {
+		case tr := <-notifications:
+			seen = append(seen, tr.Src+" "+tr.Dst)
+		case <-time.After(time.Second):
+			t.Fatalf("expected notifications, got %v", seen)
+		}
+	}
+	if fmt.Sprint(seen) != "[start middle middle end]" {
+		t.Errorf("expected the transitions in order, got %v", seen)
+	}
+
+	a.Close()
+	if fmt.Sprint(errs) != "[run]" {
+		t.Errorf("expected the error of the second run, got %v", errs)
+	}
+	select {
+	case <-a.Done():
+	default:
+		t.Error("expected the actor to be done")
+	}
+	if _, ok := <-notifications; ok {
+		t.Error("expected the notifications to be closed")
+	}
+	if _, ok := <-a.Notifications(); ok {
+		t.Error("expected new notifications to be closed")
+	}
+	select {
+	case a.EventChan() <- EventMsg{Event: "run"}:
+		t.Error("expected the event not to be received once stopped")
+	case <-a.Done():
+	}
+}
+
+func TestActorNotificationsWithoutLocking(t *testing.T) {
+	fsm := NewFSM(
+		"off",
+		Events{
+			{EvtName: "toggle", SrcStates: []string{"off"}, DstStates: "on"},
+			{EvtName: "toggle", SrcStates: []string{"on"}, DstStates: "off"},
+		},
+		Callbacks{},
+		WithoutLocking(),
+	)
+	a := NewActor(fsm, 16)
+
+	// Notifications subscribes from this goroutine while the actor
+	// notifies the subscriptions from its own, see go test -race.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			a.Send("toggle")
+		}
+	}()
+	notifications := a.Notifications()
+	for i := 0; i < 10; i++ {
+		_, unsubscribe := fsm.Subscribe(StateFilter{})
+		unsubscribe()
+	}
+	<-done
+	a.Close()
+	for range notifications {
+	}
+}
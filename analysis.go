@@ -0,0 +1,90 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import "sort"
+
+// Reachable returns the states that can be reached from the state from by any
+// sequence of events, including from itself, in sorted order. Guards are not
+// taken into account.
+func (f *FSM) Reachable(from string) []string {
+	reached := f.reach(from)
+	states := make([]string, 0, len(reached))
+	for state := range reached {
+		states = append(states, state)
+	}
+	sort.Strings(states)
+	return states
+}
+
+// Unreachable returns the states of the FSM that can not be reached from the
+// initial state, in sorted order, nil if there are none. They typically come
+// from events whose source states are misspelled or no longer used.
+func (f *FSM) Unreachable() []string {
+	reached := f.reach(f.initial)
+	var states []string
+	for _, state := range f.sortedStates() {
+		if !reached[state] {
+			states = append(states, state)
+		}
+	}
+	return states
+}
+
+// DeadEnds returns the states of the FSM without any event to leave them,
+// other than the final states given to WithFinalStates, in sorted order, nil
+// if there are none. The FSM is stuck once it enters one of them, which in a
+// large machine is often an accident.
+func (f *FSM) DeadEnds() []string {
+	f.stateMu.RLock()
+	sources := make(map[string]bool)
+	f.table.each(func(_, src, _ string, _ *EventDesc) {
+		sources[src] = true
+	})
+	f.stateMu.RUnlock()
+
+	var states []string
+	for _, state := range f.sortedStates() {
+		if !sources[state] && !f.finals[state] {
+			states = append(states, state)
+		}
+	}
+	return states
+}
+
+// reach returns the set of states reachable from the state from.
+func (f *FSM) reach(from string) map[string]bool {
+	f.stateMu.RLock()
+	defer f.stateMu.RUnlock()
+
+	next := make(map[string][]string)
+	f.table.each(func(event, src, _ string, _ *EventDesc) {
+		next[src] = append(next[src], f.dsts(eKey{event, src})...)
+	})
+
+	reached := map[string]bool{from: true}
+	queue := []string{from}
+	for len(queue) > 0 {
+		state := queue[0]
+		queue = queue[1:]
+		for _, dst := range next[state] {
+			if !reached[dst] {
+				reached[dst] = true
+				queue = append(queue, dst)
+			}
+		}
+	}
+	return reached
+}
@@ -0,0 +1,93 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"reflect"
+	"testing"
+)
+
+func newAnalysisFSM() *FSM {
+	return NewFSM(
+		"draft",
+		Events{
+			{EvtName: "submit", SrcStates: []string{"draft"}, DstStates: "review"},
+			{EvtName: "approve", SrcStates: []string{"review"}, DstStates: "published"},
+			{EvtName: "reject", SrcStates: []string{"review"}, DstStates: "draft"},
+			{EvtName: "archive", SrcStates: []string{"published", "retired"}, DstStates: "archived"},
+			{EvtName: "restore", SrcStates: []string{"archived"}, DstStates: "published"},
+		},
+		Callbacks{},
+	)
+}
+
+func TestReachable(t *testing.T) {
+	fsm := newAnalysisFSM()
+
+	expected := []string{"archived", "draft", "published", "review"}
+	if got := fsm.Reachable("draft"); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+	expected = []string{"archived", "published"}
+	if got := fsm.Reachable("archived"); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestUnreachable(t *testing.T) {
+	fsm := newAnalysisFSM()
+	fsm.Event("submit")
+
+	// Unreachable is computed from the initial state, not the current one.
+	expected := []string{"retired"}
+	if got := fsm.Unreachable(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	door := NewFSM(
+		"closed",
+		Events{
+			{EvtName: "open", SrcStates: []string{"closed"}, DstStates: "open"},
+			{EvtName: "close", SrcStates: []string{"open"}, DstStates: "closed"},
+		},
+		Callbacks{},
+	)
+	if got := door.Unreachable(); got != nil {
+		t.Errorf("expected no unreachable states, got %v", got)
+	}
+}
+
+func TestDeadEnds(t *testing.T) {
+	fsm := NewFSM(
+		"pending",
+		Events{
+			{EvtName: "pay", SrcStates: []string{"pending"}, DstStates: "paid"},
+			{EvtName: "ship", SrcStates: []string{"paid"}, DstStates: "shipped"},
+			{EvtName: "cancel", SrcStates: []string{"pending", "paid"}, DstStates: "canceled"},
+			{EvtName: "fail", SrcStates: []string{"paid"}, DstStates: "failed"},
+		},
+		Callbacks{},
+		WithFinalStates("shipped", "canceled"),
+	)
+
+	expected := []string{"failed"}
+	if got := fsm.DeadEnds(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	if got := newAnalysisFSM().DeadEnds(); got != nil {
+		t.Errorf("expected no dead ends, got %v", got)
+	}
+}
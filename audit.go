@@ -0,0 +1,101 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"time"
+)
+
+// AuditRecord is a record of an attempted transition, sent to an AuditSink.
+type AuditRecord struct {
+	// ID is the instance ID given to WithAudit.
+	ID string
+
+	// Event is the event name.
+	Event string
+
+	// Src is the state the event was sent in.
+	Src string
+
+	// Dst is the destination of the transition, empty if the event is not
+	// valid in Src.
+	Dst string
+
+	// Time is when the attempt started.
+	Time time.Time
+
+	// Duration is how long the attempt took.
+	Duration time.Duration
+
+	// Err is the error returned for the event, nil if the transition
+	// happened.
+	Err error
+
+	// Metadata is the metadata of the context of the event, see
+	// ContextWithAuditMetadata.
+	Metadata map[string]interface{}
+
+	// Codec is the codec given to WithCodec, or JSONCodec, with which a sink
+	// persisting the record should encode Metadata.
+	Codec Codec
+}
+
+// AuditSink receives a record of every attempted transition of a FSM, see
+// WithAudit, including those rejected, canceled or failed.
+//
+// An asynchronous transition is recorded twice: once with an AsyncError when
+// it starts, and once with the result of FSM.Transition when it completes.
+// Forwarded, queued and timer events are recorded too.
+//
+// Audit is called while the FSM handles the event, so it must not send events
+// to the FSM and should not block.
+type AuditSink interface {
+	Audit(r AuditRecord)
+}
+
+// AuditFunc is an AuditSink calling itself.
+type AuditFunc func(r AuditRecord)
+
+// Audit calls fn(r).
+func (fn AuditFunc) Audit(r AuditRecord) {
+	fn(r)
+}
+
+// auditMetadataKey is the context key of the audit metadata.
+type auditMetadataKey struct{}
+
+// ContextWithAuditMetadata returns a copy of ctx carrying metadata, added to
+// the audit records of the events sent with it, for example the user or
+// request behind the event.
+func ContextWithAuditMetadata(ctx context.Context, metadata map[string]interface{}) context.Context {
+	return context.WithValue(ctx, auditMetadataKey{}, metadata)
+}
+
+// auditEvent sends the record of an attempted transition to the audit sink.
+func (f *FSM) auditEvent(ctx context.Context, event, src, dst string, start time.Time, err error) {
+	metadata, _ := ctx.Value(auditMetadataKey{}).(map[string]interface{})
+	f.audit.Audit(AuditRecord{
+		ID:       f.auditID,
+		Event:    event,
+		Src:      src,
+		Dst:      dst,
+		Time:     start,
+		Duration: time.Since(start),
+		Err:      err,
+		Metadata: metadata,
+		Codec:    f.codecOf(),
+	})
+}
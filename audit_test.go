@@ -0,0 +1,72 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestAudit(t *testing.T) {
+	var records []AuditRecord
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{EvtName: "open", SrcStates: []string{"closed"}, DstStates: "open"},
+			{EvtName: "close", SrcStates: []string{"open"}, DstStates: "closed"},
+			{EvtName: "lock", SrcStates: []string{"closed"}, DstStates: "locked"},
+		},
+		Callbacks{
+			"before_lock": func(_ string, e *Event) {
+				e.Cancel(errors.New("no key"))
+			},
+			"leave_open": func(_ string, e *Event) {
+				e.Async()
+			},
+		},
+		WithAudit(AuditFunc(func(r AuditRecord) {
+			records = append(records, r)
+		}), "door-1"),
+	)
+
+	ctx := ContextWithAuditMetadata(context.Background(), map[string]interface{}{"user": "alice"})
+	fsm.EventCtx(ctx, "open")
+	fsm.Event("open")
+	fsm.Event("close")
+	fsm.Transition()
+	fsm.Event("lock")
+
+	if len(records) != 5 {
+		t.Fatalf("expected 5 records, got %d", len(records))
+	}
+	r := records[0]
+	if r.ID != "door-1" || r.Event != "open" || r.Src != "closed" || r.Dst != "open" ||
+		r.Err != nil || r.Time.IsZero() || r.Metadata["user"] != "alice" {
+		t.Errorf("unexpected record %+v", r)
+	}
+	if _, ok := records[1].Err.(InvalidEventError); !ok || records[1].Dst != "" {
+		t.Errorf("expected a rejected event, got %+v", records[1])
+	}
+	if _, ok := records[2].Err.(AsyncError); !ok {
+		t.Errorf("expected an asynchronous transition, got %+v", records[2])
+	}
+	if r := records[3]; r.Event != "close" || r.Src != "open" || r.Dst != "closed" || r.Err != nil {
+		t.Errorf("expected the completed transition, got %+v", r)
+	}
+	if _, ok := records[4].Err.(CanceledError); !ok || records[4].Metadata != nil {
+		t.Errorf("expected a canceled event, got %+v", records[4])
+	}
+}
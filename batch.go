@@ -0,0 +1,171 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"time"
+)
+
+// Events fires events in order as one unit, see EventsCtx.
+func (f *FSM) Events(events ...string) error {
+	return f.EventsCtx(context.Background(), events...)
+}
+
+// EventsCtx fires events in order as one unit, so that a multi-step
+// progression does not leave the FSM half-way.
+//
+// The batch is first checked against the transitions: if an event has no
+// transition from the state the previous ones lead to, nothing is fired. The
+// check stops at the first event whose destination is chosen when it occurs,
+// see EventDesc.DstChoices, and the events after it are only checked when
+// they are fired.
+//
+// If an event then fails, for example because of a guard or a callback, or
+// starts an asynchronous transition, the state and the metadata are rolled
+// back to what they were before the batch without calling any callbacks, as
+// with Restore. The effects of the callbacks of the events already fired are
+// not undone.
+//
+// The transitions of the batch are only saved in the store, appended to the
+// log and recorded in the history once every event has succeeded, so that a
+// failed batch leaves no trace in them. If the store or the log then refuses
+// a transition, the FSM is rolled back to the last transition written, and
+// the error is returned for the event of the refused transition.
+//
+// The metrics, the observers and the subscribers are only notified of the
+// transitions of the batch once it succeeds, or of those written before the
+// store or the log refused one, so that they never see a transition that is
+// rolled back, nor a sequence number given to two transitions. The enter_ and
+// after_ callbacks are called as the events are fired.
+//
+// The error of the failed event is returned in a BatchError. The middleware
+// added with Use is not applied to the events of a batch. EventsCtx must not
+// be called from a callback.
+func (f *FSM) EventsCtx(ctx context.Context, events ...string) error {
+	f.eventMu.Lock()
+	defer f.eventMu.Unlock()
+
+	if f.transition != nil {
+		if len(events) == 0 {
+			return nil
+		}
+		return BatchError{0, events[0], InTransitionError{events[0]}}
+	}
+
+	f.stateMu.RLock()
+	state, seq := f.current, f.seq
+	for i, event := range events {
+		dst, desc, ok := f.table.find(event, state)
+		if !ok {
+			err := f.invalidEvent(event, state)
+			f.stateMu.RUnlock()
+			return BatchError{i, event, err}
+		}
+		if desc != nil && (desc.Choose != nil || len(desc.DstChoices) > 0) {
+			break
+		}
+		state = dst
+	}
+	src, last := f.current, f.last
+	f.stateMu.RUnlock()
+	metadata := f.copyMetadata()
+
+	b := &batch{}
+	f.batch = b
+	defer func() {
+		f.batch = nil
+		f.notifyBatch(b)
+	}()
+	for i, event := range events {
+		f.batch.index = i
+		if err := f.dispatch(ctx, event, nil); err != nil {
+			if f.Sequence() != seq || f.transition != nil {
+				f.rollback(src, seq, last, metadata)
+			}
+			return BatchError{i, event, err}
+		}
+	}
+
+	for i, w := range f.batch.writes {
+		if err := f.write(ctx, w.t, w.metadata); err != nil {
+			if i == 0 {
+				f.rollback(src, seq, last, metadata)
+			} else {
+				prev := f.batch.writes[i-1]
+				if f.store == nil {
+					prev.metadata = f.copyMetadata()
+				}
+				f.rollback(prev.t.Dst, prev.t.Sequence, Edge{prev.t.Event, prev.t.Src, prev.t.Dst}, prev.metadata)
+			}
+			return BatchError{w.index, w.t.Event, err}
+		}
+		if f.history != nil {
+			f.history.add(w.recorded)
+		}
+	}
+	return nil
+}
+
+// batch holds the transitions of a batch until it succeeds.
+type batch struct {
+	// index is the index of the event being fired.
+	index         int
+	writes        []batchWrite
+	notifications []batchNotification
+}
+
+// batchNotification is a transition of a batch, to be sent to the metrics,
+// observers and subscribers, with the time it took.
+type batchNotification struct {
+	event, src, dst string
+	args            []interface{}
+	seq             uint64
+	d               time.Duration
+}
+
+// notifyBatch notifies the metrics, observers and subscribers of the
+// transitions of b that have not been rolled back.
+func (f *FSM) notifyBatch(b *batch) {
+	seq := f.Sequence()
+	for _, n := range b.notifications {
+		if n.seq > seq {
+			break
+		}
+		if f.metrics != nil {
+			f.metrics.TransitionCompleted(n.event, n.src, n.dst, n.d)
+		}
+		f.notifyObservers(n.src, n.dst, n.event, n.args, n.seq)
+	}
+}
+
+// batchWrite is a transition of a batch, fired by the event at index, as
+// recorded in the history, with the metadata after it if the FSM has a store.
+type batchWrite struct {
+	index    int
+	t        Transition
+	recorded Transition
+	metadata map[string]interface{}
+}
+
+// rollback restores the state, the sequence number, the last transition and
+// the metadata of the FSM without calling any callbacks.
+func (f *FSM) rollback(state string, seq uint64, last Edge, metadata map[string]interface{}) {
+	f.restore(state, seq, nil)
+	f.setMetadata(metadata)
+	f.stateMu.Lock()
+	f.last = last
+	f.stateMu.Unlock()
+}
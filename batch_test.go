@@ -0,0 +1,217 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func newOrderFSM(callbacks Callbacks, opts ...Option) *FSM {
+	return NewFSM(
+		"cart",
+		Events{
+			{EvtName: "checkout", SrcStates: []string{"cart"}, DstStates: "checkout"},
+			{EvtName: "pay", SrcStates: []string{"checkout"}, DstStates: "paid"},
+			{EvtName: "ship", SrcStates: []string{"paid"}, DstStates: "shipped"},
+		},
+		callbacks,
+		opts...,
+	)
+}
+
+func TestEvents(t *testing.T) {
+	fsm := newOrderFSM(Callbacks{})
+	if err := fsm.Events("checkout", "pay", "ship"); err != nil {
+		t.Error(err)
+	}
+	if fsm.Current() != "shipped" || fsm.Sequence() != 3 {
+		t.Error("expected state to be 'shipped' after 3 transitions")
+	}
+}
+
+func TestEventsRejected(t *testing.T) {
+	var entered int
+	fsm := newOrderFSM(Callbacks{
+		"enter_state": func(action string, e *Event) {
+			entered++
+		},
+	})
+	err := fsm.Events("checkout", "ship")
+	if e, ok := err.(BatchError); !ok || e.Index != 1 {
+		t.Error("expected 'BatchError' for the second event")
+	}
+	if _, ok := errors.Unwrap(err).(InvalidEventError); !ok {
+		t.Error("expected 'InvalidEventError'")
+	}
+	if fsm.Current() != "cart" || entered != 0 {
+		t.Error("expected nothing to be fired")
+	}
+}
+
+func TestEventsRollback(t *testing.T) {
+	fsm := newOrderFSM(Callbacks{
+		"enter_checkout": func(action string, e *Event) {
+			e.FSM.SetMetadata("total", 10)
+		},
+		"before_pay": func(action string, e *Event) {
+			e.Cancel()
+		},
+	})
+	err := fsm.Events("checkout", "pay", "ship")
+	if e, ok := err.(BatchError); !ok || e.Index != 1 || e.Event != "pay" {
+		t.Error("expected 'BatchError' for pay")
+	}
+	if fsm.Current() != "cart" {
+		t.Error("expected state to be rolled back to 'cart'")
+	}
+	if _, ok := fsm.Metadata("total"); ok {
+		t.Error("expected metadata to be rolled back")
+	}
+	if fsm.Sequence() != 0 {
+		t.Error("expected sequence to be rolled back")
+	}
+}
+
+func TestEventsNotifications(t *testing.T) {
+	var observed []string
+	cancelPay := true
+	m := &recordingMetrics{}
+	fsm := newOrderFSM(Callbacks{
+		"before_pay": func(action string, e *Event) {
+			if cancelPay {
+				e.Cancel()
+			}
+		},
+	}, WithMetrics(m))
+	fsm.AddObserver(ObserverFunc(func(src, dst, event string) {
+		observed = append(observed, event)
+	}))
+	ch, cancel := fsm.Subscribe(StateFilter{})
+	defer cancel()
+
+	if _, ok := fsm.Events("checkout", "pay").(BatchError); !ok {
+		t.Fatal("expected 'BatchError' for pay")
+	}
+	if len(observed) != 0 || len(ch) != 0 {
+		t.Errorf("expected no notification of a rolled back batch, got %v", observed)
+	}
+	for _, call := range m.calls {
+		if strings.HasPrefix(call, "completed") {
+			t.Errorf("expected no completed transition in the metrics, got %v", m.calls)
+		}
+	}
+
+	cancelPay = false
+	if err := fsm.Events("checkout", "pay"); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(observed) != "[checkout pay]" {
+		t.Errorf("expected the observers notified once the batch succeeds, got %v", observed)
+	}
+	for seq := uint64(1); seq <= 2; seq++ {
+		if tr := <-ch; tr.Sequence != seq {
+			t.Errorf("expected sequence %d, got %+v", seq, tr)
+		}
+	}
+	if len(ch) != 0 {
+		t.Error("expected each sequence number to be sent once")
+	}
+}
+
+func TestEventsRollbackPersistence(t *testing.T) {
+	ctx := context.Background()
+	log := &MemoryLog{}
+	store := NewMemoryStore()
+	events := Events{
+		{EvtName: "a", SrcStates: []string{"s0"}, DstStates: "s1"},
+		{EvtName: "b", SrcStates: []string{"s1"}, DstStates: "s2"},
+		{EvtName: "c", SrcStates: []string{"s0"}, DstStates: "s3"},
+	}
+	callbacks := Callbacks{
+		"before_b": func(action string, e *Event) {
+			e.Cancel()
+		},
+	}
+	fsm := NewFSM("s0", events, callbacks, WithLog(log), WithStore(store, "o"), WithHistory(10))
+
+	if _, ok := fsm.Events("a", "b").(BatchError); !ok {
+		t.Fatal("expected 'BatchError' for b")
+	}
+	if entries, _ := log.Entries(ctx); len(entries) != 0 || len(fsm.History(0)) != 0 {
+		t.Error("expected nothing recorded for the failed batch")
+	}
+	if _, err := store.Load(ctx, "o"); !errors.Is(err, ErrNotFound) {
+		t.Error("expected nothing saved for the failed batch")
+	}
+
+	if err := fsm.Event("c"); err != nil {
+		t.Fatal(err)
+	}
+	replayed, err := ReplayFSM(ctx, "s0", events, Callbacks{}, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replayed.Current() != "s3" || replayed.Sequence() != 1 {
+		t.Error("expected the log to replay to s3")
+	}
+
+	// A successful batch is written in order.
+	fsm = NewFSM("s0", events[:2], Callbacks{}, WithLog(log), WithStore(store, "p"), WithHistory(10))
+	if err := fsm.Events("a", "b"); err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := store.Load(ctx, "p"); s.State != "s2" || s.Sequence != 2 || len(fsm.History(0)) != 2 {
+		t.Errorf("expected the batch to be written, got %+v", s)
+	}
+}
+
+func TestEventsRollbackStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	if err := store.Save(ctx, "o", Snapshot{State: "x", Sequence: 1}); err != nil {
+		t.Fatal(err)
+	}
+	fsm := newOrderFSM(Callbacks{}, WithStore(store, "o"))
+	err := fsm.Events("checkout", "pay")
+	if e, ok := err.(BatchError); !ok || e.Index != 0 || !errors.Is(err, ErrConflict) {
+		t.Errorf("expected 'BatchError' with a ConflictError for checkout, got %v", err)
+	}
+	if fsm.Current() != "cart" || fsm.Sequence() != 0 {
+		t.Error("expected state to be rolled back to 'cart'")
+	}
+}
+
+func TestEventsChoice(t *testing.T) {
+	fsm := NewFSM(
+		"cart",
+		Events{
+			{EvtName: "checkout", SrcStates: []string{"cart"}, DstStates: "checkout", DstChoices: []string{"review"},
+				Choose: func(e *Event) string { return "review" }},
+			{EvtName: "approve", SrcStates: []string{"review"}, DstStates: "checkout"},
+			{EvtName: "pay", SrcStates: []string{"checkout"}, DstStates: "paid"},
+		},
+		Callbacks{},
+	)
+	if err := fsm.Events("checkout", "approve", "pay"); err != nil {
+		t.Fatal(err)
+	}
+	if fsm.Current() != "paid" {
+		t.Errorf("expected state paid, got %s", fsm.Current())
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"strconv"
+	"sync/atomic"
+	"testing"
+)
+
+// newRingFSM returns a FSM with n states in a ring, where "next" moves to the
+// following state and "reset" from any state back to the first one.
+func newRingFSM(n int, callbacks Callbacks) *FSM {
+	events := make(Events, 0, n+1)
+	reset := EventDesc{EvtName: "reset", DstStates: "s0"}
+	for i := 0; i < n; i++ {
+		src := "s" + strconv.Itoa(i)
+		events = append(events, EventDesc{EvtName: "next", SrcStates: []string{src}, DstStates: "s" + strconv.Itoa((i+1)%n)})
+		reset.SrcStates = append(reset.SrcStates, src)
+	}
+	events = append(events, reset)
+	return NewFSM("s0", events, callbacks)
+}
+
+func TestAllocs(t *testing.T) {
+	large := newRingFSM(10000, Callbacks{})
+	door := newRingFSM(2, Callbacks{})
+	tests := []struct {
+		name   string
+		fn     func()
+		allocs float64
+	}{
+		{"Event", func() { door.Event("next") }, 0},
+		{"EventLarge", func() { large.Event("next") }, 0},
+		{"Current", func() { door.Current() }, 0},
+		{"Can", func() { door.Can("next") }, 0},
+		{"AvailableTransitions", func() { door.AvailableTransitions() }, 2},
+	}
+	for _, test := range tests {
+		if allocs := testing.AllocsPerRun(100, test.fn); allocs > test.allocs {
+			t.Errorf("%s: expected at most %v allocations, got %v", test.name, test.allocs, allocs)
+		}
+	}
+}
+
+func BenchmarkEventCallbacks(b *testing.B) {
+	noop := func(action string, e *Event) {}
+	fsm := newRingFSM(2, Callbacks{
+		"before_event": noop,
+		"leave_state":  noop,
+		"enter_state":  noop,
+		"after_event":  noop,
+	})
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		fsm.Event("next")
+	}
+}
+
+func BenchmarkEventLarge(b *testing.B) {
+	fsm := newRingFSM(10000, Callbacks{})
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		fsm.Event("next")
+	}
+}
+
+func BenchmarkAvailableTransitions(b *testing.B) {
+	fsm := newRingFSM(2, Callbacks{})
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		fsm.AvailableTransitions()
+	}
+}
+
+func BenchmarkAvailableTransitionsLarge(b *testing.B) {
+	fsm := newRingFSM(10000, Callbacks{})
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		fsm.AvailableTransitions()
+	}
+}
+
+func BenchmarkNewFSMLarge(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		newRingFSM(10000, Callbacks{})
+	}
+}
+
+// BenchmarkManager compares managers with one shard and with the default
+// number of shards, with goroutines getting instances and creating and
+// deleting others. Run it with -cpu to see how each scales across cores.
+func BenchmarkManager(b *testing.B) {
+	def := NewDefinition(Events{
+		{EvtName: "next", SrcStates: []string{"s0"}, DstStates: "s1"},
+	}, Callbacks{})
+	ids := make([]string, 10000)
+	for i := range ids {
+		ids[i] = "instance-" + strconv.Itoa(i)
+	}
+
+	for _, shards := range []int{1, DefaultManagerShards} {
+		b.Run("shards="+strconv.Itoa(shards), func(b *testing.B) {
+			m := NewManager(def, "s0", ManagerShards(shards))
+			for _, id := range ids {
+				m.Create(context.Background(), id)
+			}
+			var worker int64
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				w := strconv.FormatInt(atomic.AddInt64(&worker, 1), 10)
+				for i := 0; pb.Next(); i++ {
+					if i%10 == 0 {
+						id := "worker-" + w + "-" + strconv.Itoa(i%100)
+						m.Create(context.Background(), id)
+						m.Delete(id)
+						continue
+					}
+					m.Get(ids[i%len(ids)])
+				}
+			})
+		})
+	}
+}
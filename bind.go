@@ -0,0 +1,119 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"reflect"
+	"strings"
+)
+
+// bindPrefixes maps the prefixes of the method names bound by BindCallbacks to
+// the types of callbacks, and to the name that stands for all events or states.
+var bindPrefixes = []struct {
+	prefix       string
+	callbackType int
+	all          string
+}{
+	{"Before", callbackBeforeEvent, "Event"},
+	{"OnLeave", callbackLeaveState, "State"},
+	{"Leave", callbackLeaveState, "State"},
+	{"OnEnter", callbackEnterState, "State"},
+	{"Enter", callbackEnterState, "State"},
+	{"After", callbackAfterEvent, "Event"},
+	{"OnUnhandled", callbackUnhandled, "State"},
+	{"Unhandled", callbackUnhandled, "State"},
+}
+
+// BindCallbacks adds the exported methods of target named after an event or a
+// state as callbacks, instead of listing them in the Callbacks given to NewFSM:
+//
+//	type Door struct {
+//		FSM *fsm.FSM
+//	}
+//
+//	func (d *Door) BeforeOpen(e *fsm.Event)    { ... } // before_open
+//	func (d *Door) OnEnterClosed(e *fsm.Event) { ... } // enter_closed
+//
+//	d.FSM = fsm.NewFSM("closed", events, nil, fsm.BindCallbacks(d))
+//
+// The methods are named Before<EVENT>, After<EVENT>, OnLeave<STATE>,
+// OnEnter<STATE> and OnUnhandled<STATE>, where the On is optional, and take
+// either an *Event, or an action and an *Event like a Callback. BeforeEvent,
+// AfterEvent, OnLeaveState, OnEnterState and OnUnhandledState are called for
+// all events or states.
+//
+// The name of the event or state is matched ignoring case, underscores and
+// dashes, so that OnEnterPaymentPending is called when entering the state
+// payment_pending. Like the callbacks given to NewFSM, methods for events or
+// states that the FSM does not have are ignored, as are other methods. The
+// callbacks are called after the ones already set for the same key.
+func BindCallbacks(target interface{}) Option {
+	return func(f *FSM) {
+		names := make(map[string][]string)
+		for _, event := range f.table.eventNames() {
+			key := bindName(event)
+			names[key] = append(names[key], event)
+		}
+		for state := range f.allStates {
+			key := bindName(state)
+			names[key] = append(names[key], state)
+		}
+
+		v := reflect.ValueOf(target)
+		for i := 0; i < v.NumMethod(); i++ {
+			name := v.Type().Method(i).Name
+			cb := bindMethod(v.Method(i))
+			if cb == nil {
+				continue
+			}
+			for _, p := range bindPrefixes {
+				if !strings.HasPrefix(name, p.prefix) {
+					continue
+				}
+				rest := strings.TrimPrefix(name, p.prefix)
+				if rest == p.all {
+					f.addCallback(cKey{"", p.callbackType}, cb)
+				} else {
+					for _, target := range names[bindName(rest)] {
+						key := cKey{target, p.callbackType}
+						if f.hasTarget(key) {
+							f.addCallback(key, cb)
+						}
+					}
+				}
+				break
+			}
+		}
+	}
+}
+
+// bindMethod returns m as a Callback, or nil if it does not have the signature
+// of one.
+func bindMethod(m reflect.Value) Callback {
+	switch fn := m.Interface().(type) {
+	case func(*Event):
+		return func(_ string, e *Event) {
+			fn(e)
+		}
+	case func(string, *Event):
+		return fn
+	}
+	return nil
+}
+
+// bindName returns name in lower case without underscores and dashes.
+func bindName(name string) string {
+	return strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(name))
+}
@@ -0,0 +1,56 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"fmt"
+	"testing"
+)
+
+type boundDoor struct {
+	calls []string
+}
+
+func (d *boundDoor) BeforeOpen(e *Event)                  { d.record("BeforeOpen " + e.Event) }
+func (d *boundDoor) BeforeEvent(e *Event)                 { d.record("BeforeEvent " + e.Event) }
+func (d *boundDoor) OnLeaveClosed(e *Event)               { d.record("OnLeaveClosed " + e.Src) }
+func (d *boundDoor) OnEnterState(action string, e *Event) { d.record(action + " " + e.Dst) }
+func (d *boundDoor) EnterHalfOpen(e *Event)               { d.record("EnterHalfOpen " + e.Dst) }
+func (d *boundDoor) AfterOpen(e *Event)                   { d.record("AfterOpen " + e.Event) }
+func (d *boundDoor) OnEnterNowhere(e *Event)              { d.record("OnEnterNowhere") }
+func (d *boundDoor) AfterClosed(e *Event)                 { d.record("AfterClosed") }
+func (d *boundDoor) OnEnterHalfOpen()                     { d.record("OnEnterHalfOpen") }
+func (d *boundDoor) record(call string)                   { d.calls = append(d.calls, call) }
+
+func TestBindCallbacks(t *testing.T) {
+	d := &boundDoor{}
+	f := NewFSM(
+		"closed",
+		Events{
+			{EvtName: "open", SrcStates: []string{"closed"}, DstStates: "half_open"},
+		},
+		Callbacks{
+			"before_open": func(action string, e *Event) { d.record("before_open") },
+		},
+		BindCallbacks(d),
+	)
+	if err := f.Event("open"); err != nil {
+		t.Fatal(err)
+	}
+	expected := "[before_open BeforeOpen open BeforeEvent open OnLeaveClosed closed EnterHalfOpen half_open EnteringState half_open AfterOpen open]"
+	if fmt.Sprint(d.calls) != expected {
+		t.Errorf("expected calls %s, got %v", expected, d.calls)
+	}
+}
@@ -0,0 +1,231 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import "runtime"
+
+// Builder constructs a FSM with a fluent API, as an alternative to the Events
+// literal given to NewFSM:
+//
+//	f, err := fsm.Build("start").
+//		On("run").From("start").To("end").Guard(ready).
+//		On("reset").From("end").To("start").
+//		Done()
+//
+// Each event is validated when the next one is started or Done is called,
+// with the callbacks added for it. The first error is kept and returned by
+// Done, with the position of the call that caused it, and the calls after it
+// have no effect.
+type Builder struct {
+	initial   string
+	events    Events
+	callbacks Callbacks
+	err       error
+
+	// defined holds the index of the event defining each transition, to
+	// check the conflicts of each event as it is added.
+	defined map[eKey]int
+}
+
+// EventBuilder defines an event of a Builder. It is returned by Builder.On.
+type EventBuilder struct {
+	b    *Builder
+	desc EventDesc
+	dst  bool
+
+	// at is the position of the call to On, and callbacks the keys of the
+	// callbacks added for the event, with the position of their call.
+	at        position
+	callbacks []builderCallback
+}
+
+// position is the position of a call to a Builder.
+type position struct {
+	file string
+	line int
+}
+
+// builderCallback is the key of a callback added with EventBuilder.Callback.
+type builderCallback struct {
+	key string
+	at  position
+}
+
+// caller returns the position of the call to the Builder method calling it.
+func caller() position {
+	_, file, line, _ := runtime.Caller(2)
+	return position{file, line}
+}
+
+// buildError returns a BuildError for event at the position at.
+func buildError(at position, event, msg string, err error) BuildError {
+	return BuildError{Event: event, Msg: msg, File: at.file, Line: at.line, Err: err}
+}
+
+// Build starts building a FSM with the initial state.
+func Build(initial string) *Builder {
+	b := &Builder{initial: initial, callbacks: make(Callbacks), defined: make(map[eKey]int)}
+	if initial == "" {
+		b.err = buildError(caller(), "", "no initial state", nil)
+	}
+	return b
+}
+
+// On starts the definition of an event.
+func (b *Builder) On(event string) *EventBuilder {
+	return b.on(event, caller())
+}
+
+// on starts the definition of an event, called by On at the position at.
+func (b *Builder) on(event string, at position) *EventBuilder {
+	if b.err == nil && event == "" {
+		b.err = buildError(at, "", "event without name", nil)
+	}
+	return &EventBuilder{b: b, desc: EventDesc{EvtName: event}, at: at}
+}
+
+// Callback adds a callback, with a key as for NewFSM. Callbacks added with the
+// same key are chained and called in the order they were added, see Chain.
+func (b *Builder) Callback(key string, cb Callback) *Builder {
+	if prev, ok := b.callbacks[key]; ok {
+		cb = Chain(prev, cb)
+	}
+	b.callbacks[key] = cb
+	return b
+}
+
+// Done returns the FSM, constructed with opts as for NewFSM, or the first
+// error found while building it.
+func (b *Builder) Done(opts ...Option) (*FSM, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	return NewFSM(b.initial, b.events, b.callbacks, opts...), nil
+}
+
+// From adds source states of the event.
+func (e *EventBuilder) From(states ...string) *EventBuilder {
+	e.desc.SrcStates = append(e.desc.SrcStates, states...)
+	return e
+}
+
+// To sets the destination state of the event.
+func (e *EventBuilder) To(state string) *EventBuilder {
+	if e.b.err == nil && e.dst {
+		e.b.err = buildError(caller(), e.desc.EvtName, "destination state set twice", nil)
+	}
+	e.desc.DstStates = state
+	e.dst = true
+	return e
+}
+
+// Choose adds destination states that choose can select when the event
+// occurs. See EventDesc.Choose.
+func (e *EventBuilder) Choose(choose func(e *Event) string, states ...string) *EventBuilder {
+	e.desc.Choose = choose
+	e.desc.DstChoices = append(e.desc.DstChoices, states...)
+	return e
+}
+
+// Action sets the action of the event. See EventDesc.Action.
+func (e *EventBuilder) Action(action func(e *Event) error) *EventBuilder {
+	e.desc.Action = action
+	return e
+}
+
+// Describe sets the description and adds tags of the event. See
+// EventDesc.Description and EventDesc.Tags.
+func (e *EventBuilder) Describe(description string, tags ...string) *EventBuilder {
+	e.desc.Description = description
+	e.desc.Tags = append(e.desc.Tags, tags...)
+	return e
+}
+
+// Internal marks the event as an internal transition, which then needs no
+// destination state. See EventDesc.Internal.
+func (e *EventBuilder) Internal() *EventBuilder {
+	e.desc.Internal = true
+	return e
+}
+
+// Guard adds guards of the event. See EventDesc.Guards.
+func (e *EventBuilder) Guard(guards ...Guard) *EventBuilder {
+	e.desc.Guards = append(e.desc.Guards, guards...)
+	return e
+}
+
+// WhilePending sets the PendingPolicy of the event.
+func (e *EventBuilder) WhilePending(policy PendingPolicy) *EventBuilder {
+	e.desc.WhilePending = policy
+	return e
+}
+
+// Callback adds a callback, like Builder.Callback. Its key must be for the
+// event, its states or all of them, such as enter_state.
+func (e *EventBuilder) Callback(key string, cb Callback) *EventBuilder {
+	e.callbacks = append(e.callbacks, builderCallback{key, caller()})
+	e.b.Callback(key, cb)
+	return e
+}
+
+// On ends the definition of the event and starts the next one.
+func (e *EventBuilder) On(event string) *EventBuilder {
+	return e.end().on(event, caller())
+}
+
+// Done ends the definition of the event and returns the FSM, like
+// Builder.Done.
+func (e *EventBuilder) Done(opts ...Option) (*FSM, error) {
+	return e.end().Done(opts...)
+}
+
+// end validates the event and adds it to the builder.
+func (e *EventBuilder) end() *Builder {
+	b := e.b
+	if b.err != nil {
+		return b
+	}
+
+	switch {
+	case len(e.desc.SrcStates) == 0:
+		b.err = buildError(e.at, e.desc.EvtName, "no source state", nil)
+		return b
+	case e.desc.DstStates == "" && !e.desc.Internal:
+		b.err = buildError(e.at, e.desc.EvtName, "no destination state", nil)
+		return b
+	}
+
+	events := map[string]bool{e.desc.EvtName: true}
+	states := make(map[string]bool)
+	for _, state := range e.desc.SrcStates {
+		states[state] = true
+	}
+	for _, state := range e.desc.destinations() {
+		states[state] = true
+	}
+	for _, c := range e.callbacks {
+		if target, callbackType, _ := parseCallback(c.key, events, states); callbackType == callbackNone {
+			err := UnknownCallbackError{Callback: c.key, Target: target}
+			b.err = buildError(c.at, "", err.Error(), err)
+			return b
+		}
+	}
+
+	b.events = append(b.events, e.desc)
+	if err := checkConflict(b.events, len(b.events)-1, b.defined); err != nil {
+		b.err = buildError(e.at, "", err.Error(), err)
+	}
+	return b
+}
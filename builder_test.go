@@ -0,0 +1,167 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestBuild(t *testing.T) {
+	ready := false
+	entered := false
+	fsm, err := Build("start").
+		Callback("enter_end", func(action string, e *Event) { entered = true }).
+		On("run").From("start").To("end").Guard(Guard{Name: "ready", Check: func(e *Event) bool { return ready }}).
+		On("reset").From("end", "failed").To("start").
+		On("fail").From("start").To("failed").WhilePending(AcceptWhilePending).
+		Done()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := fsm.Event("run").(GuardFailedError); !ok {
+		t.Error("expected the guard to be used")
+	}
+	ready = true
+	if err := fsm.Event("run"); err != nil || !entered {
+		t.Error("expected the transition and callback to be used")
+	}
+	if err := fsm.Event("reset"); err != nil || fsm.Current() != "start" {
+		t.Error("expected reset to return to start")
+	}
+	if desc, _ := fsm.Lookup("fail", "start"); desc.WhilePending != AcceptWhilePending {
+		t.Error("expected the pending policy to be used")
+	}
+}
+
+func TestBuildCallbackChain(t *testing.T) {
+	var calls []string
+	fsm, err := Build("a").
+		Callback("enter_b", func(action string, e *Event) { calls = append(calls, "first") }).
+		On("run").From("a").To("b").
+		Callback("enter_b", func(action string, e *Event) { calls = append(calls, "second") }).
+		Done()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsm.Event("run")
+	if fmt.Sprint(calls) != "[first second]" {
+		t.Errorf("expected both callbacks in order, got %v", calls)
+	}
+}
+
+func TestBuildErrors(t *testing.T) {
+	tests := []struct {
+		b        func() (*FSM, error)
+		expected string
+	}{
+		{func() (*FSM, error) { return Build("").On("run").From("a").To("b").Done() }, "no initial state"},
+		{func() (*FSM, error) { return Build("a").On("").From("a").To("b").Done() }, "event without name"},
+		{func() (*FSM, error) { return Build("a").On("run").To("b").Done() }, "event run: no source state"},
+		{func() (*FSM, error) { return Build("a").On("run").From("a").On("stop").Done() }, "event run: no destination state"},
+		{func() (*FSM, error) { return Build("a").On("run").From("a").To("b").To("c").Done() }, "event run: destination state set twice"},
+		{func() (*FSM, error) {
+			return Build("a").On("run").From("a").To("b").On("run").From("c", "a").To("c").Done()
+		}, "event run from state a has conflicting transitions: events[0] to b and events[1] to c with different DstStates"},
+	}
+	for _, test := range tests {
+		fsm, err := test.b()
+		e, ok := err.(BuildError)
+		if fsm != nil || !ok || filepath.Base(e.File) != "builder_test.go" || e.Line == 0 {
+			t.Errorf("expected a BuildError with its position for %q, got %v", test.expected, err)
+			continue
+		}
+		e.File = ""
+		if e.Error() != test.expected {
+			t.Errorf("expected %q, got %v", test.expected, e)
+		}
+	}
+}
+
+func TestBuildErrorPosition(t *testing.T) {
+	b := Build("a").On("run").From("a").To("b")
+	_, _, line, _ := runtime.Caller(0)
+	_, err := b.On("run").From("a").To("c").Done()
+	expected := fmt.Sprintf("builder_test.go:%d: event run from state a has conflicting transitions: events[0] to b and events[1] to c with different DstStates", line+1)
+	if fmt.Sprint(err) != expected {
+		t.Errorf("expected %q, got %v", expected, err)
+	}
+	var conflict ConflictingTransitionError
+	if !errors.As(err, &conflict) || conflict.Field != "DstStates" {
+		t.Error("expected the BuildError to wrap the ConflictingTransitionError")
+	}
+
+	b = Build("a").On("run").From("a").To("b").Callback("enter_b", func(string, *Event) {})
+	_, _, line, _ = runtime.Caller(0)
+	_, err = b.Callback("leave_c", func(string, *Event) {}).Done()
+	expected = fmt.Sprintf("builder_test.go:%d: callback leave_c for unknown event or state c", line+1)
+	if fmt.Sprint(err) != expected {
+		t.Errorf("expected %q, got %v", expected, err)
+	}
+	if !errors.Is(err, ErrUnknownCallback) {
+		t.Error("expected the BuildError to wrap the UnknownCallbackError")
+	}
+}
+
+func TestBuildOptions(t *testing.T) {
+	f, err := Build("a").
+		On("run").From("a").To("b").
+		Done(WithFinalStates("b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.DeadEnds()) != 0 {
+		t.Errorf("expected the options to be used, got dead ends %v", f.DeadEnds())
+	}
+}
+
+func TestBuildChoose(t *testing.T) {
+	f, err := Build("draft").
+		On("submit").From("draft").To("approved").
+		Choose(func(e *Event) string { return "needs_review" }, "needs_review").
+		Done()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Event("submit"); err != nil {
+		t.Error(err)
+	}
+	if f.Current() != "needs_review" {
+		t.Error("expected state to be 'needs_review'")
+	}
+	if !strings.Contains(f.ToDOT(), `"draft" -> "approved"`) {
+		t.Error("expected the default destination in the graph")
+	}
+}
+
+func TestBuildInternal(t *testing.T) {
+	f, err := Build("open").
+		On("ping").From("open").Internal().
+		Done()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Event("ping"); err != nil {
+		t.Error(err)
+	}
+	if f.Current() != "open" {
+		t.Error("expected state to be 'open'")
+	}
+}
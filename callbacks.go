@@ -0,0 +1,115 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+// registration is a callback added with one of FSM.OnBefore, FSM.OnLeave,
+// FSM.OnEnter and FSM.OnEvent. It is a pointer so that the same callback can
+// be added twice and removed once.
+type registration struct {
+	cb Callback
+}
+
+// registered holds the callbacks added for a key after construction, and the
+// callback the key had before them.
+type registered struct {
+	base Callback
+	regs []*registration
+}
+
+// OnBefore adds fn as a before_<EVENT> callback of event, or as a before_event
+// callback if event is empty. It is called after the callbacks already set for
+// the same key, and can be removed by calling the returned function.
+//
+// Callbacks added after construction let plugins loaded later attach behavior
+// to a running FSM. Unlike the callbacks given to NewFSM, they are not
+// checked against the events and states of the FSM.
+//
+// OnBefore must not be called from a callback.
+func (f *FSM) OnBefore(event string, fn Callback) (remove func()) {
+	return f.register(cKey{event, callbackBeforeEvent}, fn)
+}
+
+// OnLeave adds fn as a leave_<STATE> callback of state, or as a leave_state
+// callback if state is empty, as for OnBefore.
+func (f *FSM) OnLeave(state string, fn Callback) (remove func()) {
+	return f.register(cKey{state, callbackLeaveState}, fn)
+}
+
+// OnEnter adds fn as an enter_<STATE> callback of state, or as an enter_state
+// callback if state is empty, as for OnBefore.
+func (f *FSM) OnEnter(state string, fn Callback) (remove func()) {
+	return f.register(cKey{state, callbackEnterState}, fn)
+}
+
+// OnEvent adds fn as an after_<EVENT> callback of event, or as an after_event
+// callback if event is empty, as for OnBefore.
+func (f *FSM) OnEvent(event string, fn Callback) (remove func()) {
+	return f.register(cKey{event, callbackAfterEvent}, fn)
+}
+
+// register adds cb for key, after the callbacks already set, and returns the
+// function that removes it.
+func (f *FSM) register(key cKey, cb Callback) func() {
+	f.eventMu.Lock()
+	defer f.eventMu.Unlock()
+
+	if f.registered == nil {
+		f.registered = make(map[cKey]*registered)
+	}
+	r, ok := f.registered[key]
+	if !ok {
+		r = &registered{base: f.callbacks[key]}
+		f.registered[key] = r
+	}
+	reg := &registration{cb}
+	r.regs = append(r.regs, reg)
+	f.setRegistered(key)
+
+	return func() {
+		f.eventMu.Lock()
+		defer f.eventMu.Unlock()
+		for i, other := range r.regs {
+			if other == reg {
+				r.regs = append(r.regs[:i:i], r.regs[i+1:]...)
+				f.setRegistered(key)
+				return
+			}
+		}
+	}
+}
+
+// setRegistered sets the callback for key to its base callback followed by
+// the callbacks registered for it. eventMu must be locked.
+func (f *FSM) setRegistered(key cKey) {
+	f.stateMu.Lock()
+	f.own()
+	f.stateMu.Unlock()
+
+	r := f.registered[key]
+	if len(r.regs) == 0 {
+		if r.base == nil {
+			delete(f.callbacks, key)
+		} else {
+			f.callbacks[key] = r.base
+		}
+		return
+	}
+	callbacks := make([]Callback, 0, len(r.regs)+1)
+	callbacks = append(callbacks, r.base)
+	for _, reg := range r.regs {
+		callbacks = append(callbacks, reg.cb)
+	}
+	f.callbacks[key] = Chain(callbacks...)
+}
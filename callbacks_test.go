@@ -0,0 +1,110 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRegisterCallbacks(t *testing.T) {
+	var called []string
+	record := func(name string) Callback {
+		return func(action string, e *Event) {
+			called = append(called, name)
+		}
+	}
+
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{EvtName: "open", SrcStates: []string{"closed"}, DstStates: "open"},
+			{EvtName: "close", SrcStates: []string{"open"}, DstStates: "closed"},
+		},
+		Callbacks{
+			"enter_open": record("enter_open"),
+		},
+	)
+
+	removeBefore := fsm.OnBefore("open", record("on_before_open"))
+	removeLeave := fsm.OnLeave("", record("on_leave_state"))
+	removeEnter := fsm.OnEnter("open", record("on_enter_open"))
+	removeEvent := fsm.OnEvent("open", record("on_after_open"))
+
+	if err := fsm.Event("open"); err != nil {
+		t.Fatal(err)
+	}
+	expected := "[on_before_open on_leave_state enter_open on_enter_open on_after_open]"
+	if fmt.Sprint(called) != expected {
+		t.Errorf("expected %s, got %v", expected, called)
+	}
+
+	removeBefore()
+	removeLeave()
+	removeEnter()
+	removeEnter()
+	removeEvent()
+	called = nil
+	fsm.Event("close")
+	fsm.Event("open")
+	if fmt.Sprint(called) != "[enter_open]" {
+		t.Errorf("expected only 'enter_open' after removal, got %v", called)
+	}
+}
+
+func TestRegisterCallbacksCancel(t *testing.T) {
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{EvtName: "open", SrcStates: []string{"closed"}, DstStates: "open"},
+		},
+		Callbacks{},
+	)
+
+	remove := fsm.OnBefore("", func(action string, e *Event) {
+		e.Cancel()
+	})
+	if _, ok := fsm.Event("open").(CanceledError); !ok {
+		t.Error("expected 'CanceledError'")
+	}
+	remove()
+	if err := fsm.Event("open"); err != nil || fsm.Current() != "open" {
+		t.Error("expected transition to 'open' once the callback is removed")
+	}
+}
+
+func TestRegisterCallbacksInstance(t *testing.T) {
+	def := NewDefinition(
+		Events{
+			{EvtName: "open", SrcStates: []string{"closed"}, DstStates: "open"},
+		},
+		Callbacks{},
+	)
+	a := def.NewInstance("closed")
+	b := def.NewInstance("closed")
+
+	called := false
+	a.OnEnter("open", func(action string, e *Event) {
+		called = true
+	})
+	b.Event("open")
+	if called {
+		t.Error("expected the callback not to be shared with other instances")
+	}
+	a.Event("open")
+	if !called {
+		t.Error("expected the callback to be called")
+	}
+}
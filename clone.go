@@ -0,0 +1,102 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import "time"
+
+// Clone returns a new FSM with the same definition as f, for example to
+// create one machine per connection or order from a prototype, as it is
+// cheaper than NewFSM.
+//
+// The clone shares the events, states and callbacks of f, which are copied by
+// either machine if it changes them, and gets its own copy of the argument
+// transformers, forwarding states, timeouts, middleware and options of f,
+// including its codec. It starts in the current state of f, with a copy of
+// its metadata and sequence number, and the timers of that state running. It
+// has no asynchronous transition in progress, no queued events and no
+// observers, and an empty history.
+//
+// The clone does not save its state in the store of f, nor append to the log
+// of f, as instances must not share them. Use opts, applied to the clone, to
+// set them or to replace other options.
+//
+// Clone must not be called from a callback.
+func (f *FSM) Clone(opts ...Option) *FSM {
+	f.eventMu.Lock()
+	defer f.eventMu.Unlock()
+
+	c := &FSM{
+		transitionerObj:  f.transitionerObj,
+		allStates:        f.allStates,
+		initial:          f.initial,
+		finals:           f.finals,
+		table:            f.table,
+		eventDescs:       f.eventDescs,
+		stateDescs:       f.stateDescs,
+		names:            f.names,
+		callbacks:        f.callbacks,
+		shared:           true,
+		recoverPanics:    f.recoverPanics,
+		errorTrace:       f.errorTrace,
+		restoreCallbacks: f.restoreCallbacks,
+		codec:            f.codec,
+		audit:            f.audit,
+		auditID:          f.auditID,
+		metrics:          f.metrics,
+		logger:           f.logger,
+		metadata:         f.copyMetadata(),
+	}
+	if f.transformers != nil {
+		c.transformers = make(map[string][]ArgTransformer, len(f.transformers))
+		for event, ts := range f.transformers {
+			c.transformers[event] = append([]ArgTransformer(nil), ts...)
+		}
+	}
+	if f.forwards != nil {
+		c.forwards = make(map[string][]string, len(f.forwards))
+		for state, events := range f.forwards {
+			c.forwards[state] = events
+		}
+	}
+	if f.timeouts != nil {
+		c.timeouts = make(map[string][]timeout, len(f.timeouts))
+		for state, ts := range f.timeouts {
+			c.timeouts[state] = append([]timeout(nil), ts...)
+		}
+	}
+	if f.history != nil {
+		c.history = &history{transitions: make([]Transition, len(f.history.transitions))}
+	}
+	if f.dedup != nil {
+		c.dedup = &dedup{window: f.dedup.window, key: f.dedup.key, seen: make(map[[2]string]time.Time)}
+	}
+
+	f.shared = true
+
+	f.stateMu.RLock()
+	c.setCurrent(f.current)
+	c.seq = f.seq
+	c.last = f.last
+	f.stateMu.RUnlock()
+
+	for _, opt := range opts {
+		opt(c)
+	}
+	if len(f.middleware) > 0 {
+		c.Use(f.middleware...)
+	}
+	c.startTimeouts()
+	return c
+}
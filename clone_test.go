@@ -0,0 +1,53 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import "testing"
+
+func TestClone(t *testing.T) {
+	var entered []string
+	proto := newOrderFSM(Callbacks{
+		"enter_state": func(action string, e *Event) {
+			entered = append(entered, e.FSM.Current())
+		},
+	}, WithHistory(2))
+	proto.SetMetadata("currency", "EUR")
+
+	a := proto.Clone()
+	b := proto.Clone(WithHistory(5))
+	if err := a.Event("checkout"); err != nil {
+		t.Error(err)
+	}
+	a.SetMetadata("currency", "SEK")
+
+	if proto.Current() != "cart" || b.Current() != "cart" {
+		t.Error("expected the other machines to stay in 'cart'")
+	}
+	if a.Current() != "checkout" || a.Sequence() != 1 || len(entered) != 1 {
+		t.Error("expected the clone to move to 'checkout'")
+	}
+	if v, _ := proto.Metadata("currency"); v != "EUR" {
+		t.Error("expected metadata to be copied")
+	}
+	if len(proto.History(0)) != 0 || len(a.History(0)) != 1 {
+		t.Error("expected the clone to have its own history")
+	}
+	if err := b.Events("checkout", "pay", "ship"); err != nil {
+		t.Error(err)
+	}
+	if len(b.History(0)) != 3 {
+		t.Error("expected the options to be applied to the clone")
+	}
+}
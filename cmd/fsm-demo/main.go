@@ -0,0 +1,196 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Fsm-demo serves a traffic light driven by timers, with a live diagram of
+// its state machine, as a quick start and an example of the timer,
+// visualization, HTTP and subscription features working together.
+//
+// Usage:
+//
+//	fsm-demo [-addr :8080] [-red 4s] [-green 3s] [-yellow 1s]
+//
+// The page at / shows the diagram, rendered with Mermaid and updated as the
+// light changes. The light can be put out of order and back with the buttons
+// of the page, or with the REST API of fsmhttp under /api/, for example:
+//
+//	curl -X POST localhost:8080/api/events/fault
+//
+// The transitions are streamed as server-sent events at /updates.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/papiguy/fsm"
+	"github.com/papiguy/fsm/fsmhttp"
+)
+
+func main() {
+	addr := flag.String("addr", ":8080", "address to listen on")
+	red := flag.Duration("red", 4*time.Second, "duration of the red light")
+	green := flag.Duration("green", 3*time.Second, "duration of the green light")
+	yellow := flag.Duration("yellow", time.Second, "duration of the yellow light")
+	flag.Parse()
+
+	light, err := newLight(*red, *green, *yellow)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "fsm-demo:", err)
+		os.Exit(1)
+	}
+	log.Printf("serving the traffic light on %s", *addr)
+	if err := http.ListenAndServe(*addr, newServer(light)); err != nil {
+		fmt.Fprintln(os.Stderr, "fsm-demo:", err)
+		os.Exit(1)
+	}
+}
+
+// newLight returns a traffic light that cycles from red to green to yellow,
+// staying in each for the given duration. It can be put out of order, where
+// it flashes until it is reset to red.
+func newLight(red, green, yellow time.Duration) (*fsm.FSM, error) {
+	f, err := fsm.NewFSMStrict(
+		"red",
+		fsm.Events{
+			{EvtName: "go", SrcStates: []string{"red"}, DstStates: "green"},
+			{EvtName: "slow", SrcStates: []string{"green"}, DstStates: "yellow"},
+			{EvtName: "stop", SrcStates: []string{"yellow"}, DstStates: "red"},
+			{EvtName: "fault", SrcStates: []string{"red", "green", "yellow"}, DstStates: "flashing",
+				Description: "the light is out of order"},
+			{EvtName: "reset", SrcStates: []string{"flashing"}, DstStates: "red"},
+		},
+		fsm.Callbacks{},
+	)
+	if err != nil {
+		return nil, err
+	}
+	timeouts := []struct {
+		state string
+		d     time.Duration
+		event string
+	}{
+		{"red", red, "go"},
+		{"green", green, "slow"},
+		{"yellow", yellow, "stop"},
+	}
+	for _, t := range timeouts {
+		if err := f.Timeout(t.state, t.d, t.event); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// update is the data of a server-sent event.
+type update struct {
+	State    string `json:"state"`
+	Event    string `json:"event,omitempty"`
+	Sequence uint64 `json:"sequence"`
+	Diagram  string `json:"diagram"`
+}
+
+// newServer returns the handler of the demo serving f.
+func newServer(f *fsm.FSM) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/api/", http.StripPrefix("/api", fsmhttp.NewHandler(f)))
+	mux.HandleFunc("/updates", func(w http.ResponseWriter, r *http.Request) {
+		serveUpdates(w, r, f)
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		page.Execute(w, f.ToMermaid())
+	})
+	return mux
+}
+
+// serveUpdates streams the state of f as server-sent events, starting with
+// the current one, until the client goes away.
+func serveUpdates(w http.ResponseWriter, r *http.Request, f *fsm.FSM) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	transitions, cancel := f.Subscribe(fsm.StateFilter{})
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	send := func(u update) bool {
+		u.Diagram = f.ToMermaid()
+		data, err := json.Marshal(u)
+		if err != nil {
+			return false
+		}
+		if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+			return false
+		}
+		flusher.Flush()
+		return true
+	}
+
+	if !send(update{State: f.Current(), Sequence: f.Sequence()}) {
+		return
+	}
+	for {
+		select {
+		case t := <-transitions:
+			if !send(update{State: t.Dst, Event: t.Event, Sequence: t.Sequence}) {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+var page = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>fsm demo</title>
+<script type="module">
+import mermaid from "https://cdn.jsdelivr.net/npm/mermaid@10/dist/mermaid.esm.min.mjs";
+mermaid.initialize({startOnLoad: false});
+const diagram = document.getElementById("diagram");
+const status = document.getElementById("status");
+let renders = 0;
+new EventSource("updates").onmessage = async (msg) => {
+	const u = JSON.parse(msg.data);
+	status.textContent = u.state + (u.event ? " (" + u.event + ")" : "");
+	const {svg} = await mermaid.render("graph" + renders++, u.diagram);
+	diagram.innerHTML = svg;
+};
+for (const button of document.querySelectorAll("button")) {
+	button.onclick = () => fetch("api/events/" + button.name, {method: "POST"});
+}
+</script>
+</head>
+<body>
+<h1>Traffic light: <span id="status"></span></h1>
+<p><button name="fault">Fault</button> <button name="reset">Reset</button></p>
+<pre id="diagram">{{.}}</pre>
+</body>
+</html>
+`))
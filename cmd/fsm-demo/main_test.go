@@ -0,0 +1,115 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDemo(t *testing.T) {
+	light, err := newLight(20*time.Millisecond, 20*time.Millisecond, 20*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(newServer(light))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected the page, got %s", resp.Status)
+	}
+
+	resp, err = http.Get(server.URL + "/updates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("expected an event stream, got %q", ct)
+	}
+
+	updates := make(chan update)
+	go func() {
+		defer close(updates)
+		scanner := bufio.NewScanner(resp.Body)
+		scanner.Buffer(nil, 1<<20)
+		for scanner.Scan() {
+			data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+			if !ok {
+				continue
+			}
+			var u update
+			if err := json.Unmarshal([]byte(data), &u); err != nil {
+				t.Error(err)
+				return
+			}
+			updates <- u
+		}
+	}()
+
+	// The timers cycle the light, and the updates follow it.
+	var events []string
+	for len(events) < 4 {
+		select {
+		case u := <-updates:
+			if !strings.HasPrefix(u.Diagram, "stateDiagram-v2") {
+				t.Errorf("expected a Mermaid diagram, got %q", u.Diagram)
+			}
+			events = append(events, u.Event)
+		case <-time.After(time.Second):
+			t.Fatalf("expected updates, got %v", events)
+		}
+	}
+	if !strings.Contains("go slow stop go slow", strings.Join(events[1:], " ")) {
+		t.Errorf("expected the light to cycle, got %v", events)
+	}
+
+	resp, err = http.Post(server.URL+"/api/events/fault", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected the fault to be accepted, got %s", resp.Status)
+	}
+	for {
+		select {
+		case u := <-updates:
+			if u.Event != "fault" {
+				continue
+			}
+			if u.State != "flashing" {
+				t.Errorf("expected the light to flash, got %q", u.State)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("expected the fault to be streamed")
+		}
+		break
+	}
+	time.Sleep(50 * time.Millisecond)
+	if light.Current() != "flashing" {
+		t.Errorf("expected the light to stay flashing, got %q", light.Current())
+	}
+}
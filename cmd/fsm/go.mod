@@ -0,0 +1,15 @@
+module github.com/papiguy/fsm/cmd/fsm
+
+go 1.21
+
+require (
+	github.com/papiguy/fsm v0.0.0
+	github.com/papiguy/fsm/fsmyaml v0.0.0
+)
+
+require gopkg.in/yaml.v3 v3.0.1 // indirect
+
+replace (
+	github.com/papiguy/fsm => ../../
+	github.com/papiguy/fsm/fsmyaml => ../../fsmyaml
+)
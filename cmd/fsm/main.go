@@ -0,0 +1,142 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Fsm checks and visualizes state machine definitions, so that they can be
+// verified in build pipelines without writing Go.
+//
+// Usage:
+//
+//	fsm validate definition
+//	fsm dot definition
+//	fsm mermaid definition
+//	fsm simulate definition event...
+//
+// The definition is read with fsm.ImportJSON, fsmyaml.Import, fsm.ImportDOT
+// or fsm.ImportSCXML, depending on its extension: .json, .yaml or .yml, .dot
+// or .gv, or .scxml.
+//
+// Validate checks that the definition can be read and has no conflicting
+// transitions. Dot and mermaid print the graph of the machine in Graphviz or
+// Mermaid format. Simulate fires the events in order from the initial state
+// and prints each transition, failing on the first event that is rejected.
+//
+// It is a separate module so that the fsm package does not depend on a YAML
+// library.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/papiguy/fsm"
+	"github.com/papiguy/fsm/fsmyaml"
+)
+
+const usage = `usage:
+	fsm validate definition
+	fsm dot definition
+	fsm mermaid definition
+	fsm simulate definition event...`
+
+// errUsage is returned by run for invalid arguments.
+var errUsage = errors.New(usage)
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "fsm:", err)
+		if err == errUsage {
+			os.Exit(2)
+		}
+		os.Exit(1)
+	}
+}
+
+// run runs the command in args, writing its output to w.
+func run(args []string, w io.Writer) error {
+	if len(args) < 2 {
+		return errUsage
+	}
+	cmd, input, events := args[0], args[1], args[2:]
+	if cmd != "simulate" && len(events) > 0 {
+		return errUsage
+	}
+
+	f, err := load(input)
+	if err != nil {
+		return err
+	}
+
+	switch cmd {
+	case "validate":
+		fmt.Fprintf(w, "%s: ok\n", input)
+	case "dot":
+		io.WriteString(w, f.ToDOT())
+	case "mermaid":
+		io.WriteString(w, f.ToMermaid())
+	case "simulate":
+		return simulate(f, events, w)
+	default:
+		return errUsage
+	}
+	return nil
+}
+
+// load reads the definition in the file input, in the format given by its
+// extension.
+func load(input string) (*fsm.FSM, error) {
+	file, err := os.Open(input)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var initial string
+	var events fsm.Events
+	switch ext := filepath.Ext(input); strings.ToLower(ext) {
+	case ".json":
+		initial, events, err = fsm.ImportJSON(file)
+	case ".yaml", ".yml":
+		initial, events, err = fsmyaml.Import(file)
+	case ".dot", ".gv":
+		initial, events, err = fsm.ImportDOT(file)
+	case ".scxml":
+		initial, events, err = fsm.ImportSCXML(file)
+	default:
+		return nil, fmt.Errorf("unknown definition format %q", ext)
+	}
+	if err == nil {
+		var f *fsm.FSM
+		if f, err = fsm.NewFSMStrict(initial, events, fsm.Callbacks{}); err == nil {
+			return f, nil
+		}
+	}
+	return nil, fmt.Errorf("%s: %w", input, err)
+}
+
+// simulate fires events on f in order, writing each transition to w.
+func simulate(f *fsm.FSM, events []string, w io.Writer) error {
+	fmt.Fprintln(w, f.Current())
+	for _, event := range events {
+		src := f.Current()
+		if err := f.Event(event); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%s: %s -> %s\n", event, src, f.Current())
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/papiguy/fsm"
+)
+
+func TestRun(t *testing.T) {
+	for _, c := range []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"validate", "testdata/door.yaml"}, "testdata/door.yaml: ok\n"},
+		{[]string{"simulate", "testdata/door.yaml", "open", "close"}, "closed\nopen: closed -> open\nclose: open -> closed\n"},
+		{[]string{"mermaid", "testdata/door.yaml"}, `stateDiagram-v2
+    state "closed" as s0
+    state "open" as s1
+    s0 --> s1: open
+    s1 --> s0: close
+    classDef current fill:lightgrey
+    class s0 current
+`},
+	} {
+		var buf bytes.Buffer
+		if err := run(c.args, &buf); err != nil {
+			t.Errorf("%v: %v", c.args, err)
+		}
+		if buf.String() != c.expected {
+			t.Errorf("%v: expected %q, got %q", c.args, c.expected, buf.String())
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := run([]string{"dot", "testdata/door.yaml"}, &buf); err != nil || !bytes.HasPrefix(buf.Bytes(), []byte("digraph")) {
+		t.Errorf("expected a Graphviz graph, got %v %q", err, buf.String())
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	var buf bytes.Buffer
+	for _, args := range [][]string{
+		nil,
+		{"validate"},
+		{"draw", "testdata/door.yaml"},
+		{"dot", "testdata/door.yaml", "open"},
+	} {
+		if err := run(args, &buf); err != errUsage {
+			t.Errorf("%v: expected usage error, got %v", args, err)
+		}
+	}
+
+	err := run([]string{"simulate", "testdata/door.yaml", "open", "open"}, &buf)
+	if _, ok := err.(fsm.InvalidEventError); !ok {
+		t.Errorf("expected InvalidEventError, got %v", err)
+	}
+
+	err = run([]string{"validate", "testdata/conflict.json"}, &buf)
+	if err == nil || err.Error() != "testdata/conflict.json: event open from state closed has conflicting transitions: events[0] to open and events[1] to ajar with different DstStates" {
+		t.Errorf("expected the conflicting transitions to be reported, got %v", err)
+	}
+
+	if err := run([]string{"validate", "testdata/door.txt"}, &buf); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
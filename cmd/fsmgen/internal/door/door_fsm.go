@@ -0,0 +1,60 @@
+// Code generated by fsmgen from door.json; DO NOT EDIT.
+
+package door
+
+import "github.com/papiguy/fsm"
+
+// States of Door.
+const (
+	DoorStateClosed = "closed"
+	DoorStateLocked = "locked"
+	DoorStateOpen   = "open"
+)
+
+// Events of Door.
+const (
+	DoorEventClose     = "close"
+	DoorEventForceOpen = "force_open"
+	DoorEventLock      = "lock"
+	DoorEventOpen      = "open"
+)
+
+// Door is the state machine defined in door.json.
+type Door struct {
+	*fsm.FSM
+}
+
+// NewDoor returns a Door in its initial state, DoorStateClosed.
+func NewDoor(callbacks fsm.Callbacks) *Door {
+	return &Door{fsm.NewFSM(DoorStateClosed, doorEvents(), callbacks)}
+}
+
+// doorEvents returns the events of Door.
+func doorEvents() fsm.Events {
+	return fsm.Events{
+		{EvtName: DoorEventOpen, SrcStates: []string{DoorStateClosed}, DstStates: DoorStateOpen},
+		{EvtName: DoorEventClose, SrcStates: []string{DoorStateOpen}, DstStates: DoorStateClosed},
+		{EvtName: DoorEventForceOpen, SrcStates: []string{DoorStateClosed, DoorStateLocked}, DstStates: DoorStateOpen},
+		{EvtName: DoorEventLock, SrcStates: []string{DoorStateClosed}, DstStates: DoorStateLocked},
+	}
+}
+
+// FireClose fires the event close.
+func (m *Door) FireClose(args ...interface{}) error {
+	return m.Event(DoorEventClose, args...)
+}
+
+// FireForceOpen fires the event force_open.
+func (m *Door) FireForceOpen(args ...interface{}) error {
+	return m.Event(DoorEventForceOpen, args...)
+}
+
+// FireLock fires the event lock.
+func (m *Door) FireLock(args ...interface{}) error {
+	return m.Event(DoorEventLock, args...)
+}
+
+// FireOpen fires the event open.
+func (m *Door) FireOpen(args ...interface{}) error {
+	return m.Event(DoorEventOpen, args...)
+}
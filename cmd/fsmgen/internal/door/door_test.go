@@ -0,0 +1,37 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package door
+
+import (
+	"testing"
+
+	"github.com/papiguy/fsm"
+)
+
+func TestDoor(t *testing.T) {
+	d := NewDoor(fsm.Callbacks{})
+	if !d.Is(DoorStateClosed) {
+		t.Error("expected state to be closed")
+	}
+	if err := d.FireLock(); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	if err := d.FireOpen(); err == nil {
+		t.Error("expected open to fail when locked")
+	}
+	if err := d.FireForceOpen(); err != nil || d.Current() != DoorStateOpen {
+		t.Error("expected force_open to open the door")
+	}
+}
@@ -0,0 +1,276 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Fsmgen generates Go code for a state machine from a definition file, with
+// constants for its states and events and a Fire<Event> method per event.
+//
+// Usage:
+//
+//	fsmgen -type Door [-package name] [-o file] definition
+//
+// The definition is read with fsm.ImportJSON, fsm.ImportDOT or
+// fsm.ImportSCXML, depending on its extension: .json, .dot or .gv, or .scxml.
+// It is typically run by go generate:
+//
+//	//go:generate go run github.com/papiguy/fsm/cmd/fsmgen -type Door door.json
+//
+// For the type Door, the generated code has the constants DoorState<State>
+// and DoorEvent<Event>, the type Door embedding *fsm.FSM, the constructor
+// NewDoor(callbacks) and the methods Fire<Event>(args...). The output is
+// written to door_fsm.go unless -o is given, in the package given by -package
+// or else by $GOPACKAGE.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"github.com/papiguy/fsm"
+)
+
+func main() {
+	typeName := flag.String("type", "", "name of the generated type (required)")
+	pkg := flag.String("package", os.Getenv("GOPACKAGE"), "package of the generated code")
+	output := flag.String("o", "", "output file (default <type>_fsm.go)")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: fsmgen -type Name [-package name] [-o file] definition")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *typeName == "" || flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *output == "" {
+		*output = strings.ToLower(*typeName) + "_fsm.go"
+	}
+
+	if err := run(flag.Arg(0), *typeName, *pkg, *output); err != nil {
+		fmt.Fprintln(os.Stderr, "fsmgen:", err)
+		os.Exit(1)
+	}
+}
+
+// run generates the code for the definition in the file input.
+func run(input, typeName, pkg, output string) error {
+	if pkg == "" {
+		return fmt.Errorf("no package name, use -package")
+	}
+
+	f, err := os.Open(input)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	initial, events, err := load(filepath.Ext(input), f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", input, err)
+	}
+
+	src, err := generate(config{
+		Source:  filepath.Base(input),
+		Package: pkg,
+		Type:    typeName,
+		Initial: initial,
+		Events:  events,
+	})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(output, src, 0o644)
+}
+
+// load reads a definition in the format given by the file extension ext.
+func load(ext string, r io.Reader) (string, fsm.Events, error) {
+	switch strings.ToLower(ext) {
+	case ".json":
+		return fsm.ImportJSON(r)
+	case ".dot", ".gv":
+		return fsm.ImportDOT(r)
+	case ".scxml":
+		return fsm.ImportSCXML(r)
+	}
+	return "", nil, fmt.Errorf("unknown definition format %q", ext)
+}
+
+// config is the input of generate.
+type config struct {
+	Source  string
+	Package string
+	Type    string
+	Initial string
+	Events  fsm.Events
+}
+
+// name is a state or event with the identifier generated for it.
+type name struct {
+	Value string
+	Ident string
+}
+
+// generate returns the formatted code for the machine in cfg.
+func generate(cfg config) ([]byte, error) {
+	seen := make(map[string]bool)
+	var stateNames []string
+	addState := func(s string) {
+		if !seen[s] {
+			seen[s] = true
+			stateNames = append(stateNames, s)
+		}
+	}
+	addState(cfg.Initial)
+	var eventNames []string
+	eventSeen := make(map[string]bool)
+	for _, e := range cfg.Events {
+		for _, s := range e.SrcStates {
+			addState(s)
+		}
+		addState(e.DstStates)
+		if !eventSeen[e.EvtName] {
+			eventSeen[e.EvtName] = true
+			eventNames = append(eventNames, e.EvtName)
+		}
+	}
+	sort.Strings(stateNames)
+	sort.Strings(eventNames)
+
+	states, err := identifiers("state", stateNames)
+	if err != nil {
+		return nil, err
+	}
+	events, err := identifiers("event", eventNames)
+	if err != nil {
+		return nil, err
+	}
+
+	stateIdent := make(map[string]string)
+	for _, s := range states {
+		stateIdent[s.Value] = cfg.Type + "State" + s.Ident
+	}
+	eventIdent := make(map[string]string)
+	for _, e := range events {
+		eventIdent[e.Value] = cfg.Type + "Event" + e.Ident
+	}
+
+	funcs := template.FuncMap{
+		"state": func(s string) string { return stateIdent[s] },
+		"event": func(e string) string { return eventIdent[e] },
+		"lower": func(s string) string {
+			r := []rune(s)
+			r[0] = unicode.ToLower(r[0])
+			return string(r)
+		},
+	}
+	tmpl, err := template.New("fsm").Funcs(funcs).Parse(codeTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, struct {
+		config
+		States []name
+		Names  []name
+	}{cfg, states, events})
+	if err != nil {
+		return nil, err
+	}
+	return format.Source(buf.Bytes())
+}
+
+// identifiers converts names to the exported Go identifiers used in the
+// generated code, e.g. "in_progress" to "InProgress". It returns a
+// fsm.NameCollisionError if two names give the same identifier.
+func identifiers(kind string, names []string) ([]name, error) {
+	used := make(map[string]bool)
+	result := make([]name, 0, len(names))
+	for _, n := range names {
+		var b strings.Builder
+		upper := true
+		for _, r := range n {
+			if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+				upper = true
+				continue
+			}
+			if upper {
+				r = unicode.ToUpper(r)
+				upper = false
+			}
+			b.WriteRune(r)
+		}
+		ident := b.String()
+		if ident == "" || used[ident] {
+			return nil, fsm.NameCollisionError{Kind: kind, Name: ident}
+		}
+		used[ident] = true
+		result = append(result, name{n, ident})
+	}
+	return result, nil
+}
+
+const codeTemplate = `// Code generated by fsmgen from {{.Source}}; DO NOT EDIT.
+
+package {{.Package}}
+
+import "github.com/papiguy/fsm"
+
+// States of {{.Type}}.
+const (
+{{- range .States}}
+	{{state .Value}} = {{printf "%q" .Value}}
+{{- end}}
+)
+
+// Events of {{.Type}}.
+const (
+{{- range .Names}}
+	{{event .Value}} = {{printf "%q" .Value}}
+{{- end}}
+)
+
+// {{.Type}} is the state machine defined in {{.Source}}.
+type {{.Type}} struct {
+	*fsm.FSM
+}
+
+// New{{.Type}} returns a {{.Type}} in its initial state, {{state .Initial}}.
+func New{{.Type}}(callbacks fsm.Callbacks) *{{.Type}} {
+	return &{{.Type}}{fsm.NewFSM({{state .Initial}}, {{lower .Type}}Events(), callbacks)}
+}
+
+// {{lower .Type}}Events returns the events of {{.Type}}.
+func {{lower .Type}}Events() fsm.Events {
+	return fsm.Events{
+{{- range .Events}}
+		{EvtName: {{event .EvtName}}, SrcStates: []string{ {{- range $i, $s := .SrcStates}}{{if $i}}, {{end}}{{state $s}}{{end -}} }, DstStates: {{state .DstStates}}},
+{{- end}}
+	}
+}
+{{range .Names}}
+// Fire{{.Ident}} fires the event {{.Value}}.
+func (m *{{$.Type}}) Fire{{.Ident}}(args ...interface{}) error {
+	return m.Event({{event .Value}}, args...)
+}
+{{end}}`
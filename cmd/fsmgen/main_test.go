@@ -0,0 +1,75 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/papiguy/fsm"
+)
+
+func TestGenerate(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "door_fsm.go")
+	if err := run("internal/door/door.json", "Door", "door", output); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := os.ReadFile("internal/door/door_fsm.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(expected) {
+		t.Errorf("expected the output to match internal/door/door_fsm.go, got:\n%s", got)
+	}
+}
+
+func TestGenerateFormats(t *testing.T) {
+	tests := map[string]string{
+		".dot":   `digraph { a -> b [label="go"] }`,
+		".scxml": `<scxml><state id="a"><transition event="go" target="b"/></state><state id="b"/></scxml>`,
+	}
+	for ext, src := range tests {
+		initial, events, err := load(ext, strings.NewReader(src))
+		if err != nil {
+			t.Fatal(err)
+		}
+		code, err := generate(config{Source: "m" + ext, Package: "m", Type: "M", Initial: initial, Events: events})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(code), "func (m *M) FireGo(") {
+			t.Errorf("expected FireGo for %s, got:\n%s", ext, code)
+		}
+	}
+	if _, _, err := load(".txt", strings.NewReader("")); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
+
+func TestGenerateCollision(t *testing.T) {
+	_, err := generate(config{Package: "m", Type: "M", Initial: "a", Events: fsm.Events{
+		{EvtName: "go-on", SrcStates: []string{"a"}, DstStates: "b"},
+		{EvtName: "go_on", SrcStates: []string{"b"}, DstStates: "a"},
+	}})
+	if e, ok := err.(fsm.NameCollisionError); !ok || e.Name != "GoOn" {
+		t.Errorf("expected NameCollisionError for GoOn, got %v", err)
+	}
+}
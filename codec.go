@@ -0,0 +1,88 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// Codec serializes event arguments and other values when they are persisted,
+// for example in snapshots, stores and event logs. See WithCodec.
+//
+// JSONCodec is used when none is given. Other formats, such as msgpack or
+// protocol buffers, can be plugged in by implementing Codec outside of this
+// package.
+type Codec interface {
+	// Marshal returns the encoding of v.
+	Marshal(v interface{}) ([]byte, error)
+
+	// Unmarshal decodes data into the value pointed to by v.
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// JSONCodec is a Codec using encoding/json.
+type JSONCodec struct{}
+
+// Marshal returns the JSON encoding of v.
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal decodes the JSON in data into the value pointed to by v.
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// codecKey is the context key of the codec.
+type codecKey struct{}
+
+// ContextWithCodec returns a copy of ctx carrying c. A FSM created with
+// WithCodec passes its codec this way to its Store and Log, which should
+// encode with CodecFromContext.
+func ContextWithCodec(ctx context.Context, c Codec) context.Context {
+	return context.WithValue(ctx, codecKey{}, c)
+}
+
+// CodecFromContext returns the codec carried by ctx, or JSONCodec if none.
+func CodecFromContext(ctx context.Context) Codec {
+	if c, ok := contextCodec(ctx); ok {
+		return c
+	}
+	return JSONCodec{}
+}
+
+// contextCodec returns the codec carried by ctx, if any.
+func contextCodec(ctx context.Context) (Codec, bool) {
+	c, ok := ctx.Value(codecKey{}).(Codec)
+	return c, ok
+}
+
+// codecOf returns the codec given to WithCodec, or JSONCodec if none.
+func (f *FSM) codecOf() Codec {
+	if f.codec != nil {
+		return f.codec
+	}
+	return JSONCodec{}
+}
+
+// codecContext returns ctx carrying the codec given to WithCodec, if any, to
+// be passed to the store and the log.
+func (f *FSM) codecContext(ctx context.Context) context.Context {
+	if f.codec == nil {
+		return ctx
+	}
+	return ContextWithCodec(ctx, f.codec)
+}
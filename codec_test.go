@@ -0,0 +1,130 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestJSONCodec(t *testing.T) {
+	type payload struct {
+		Name string
+		Data []byte
+	}
+
+	in := payload{"door", []byte{0, 1, 255}}
+	data, err := JSONCodec{}.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out payload
+	if err := (JSONCodec{}).Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Name != in.Name || string(out.Data) != string(in.Data) {
+		t.Errorf("expected %v, got %v", in, out)
+	}
+}
+
+// prefixCodec is a JSONCodec prefixing its encodings, to tell them apart.
+type prefixCodec struct{}
+
+func (prefixCodec) Marshal(v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	return append([]byte("fsm:"), data...), err
+}
+
+func (prefixCodec) Unmarshal(data []byte, v interface{}) error {
+	if !bytes.HasPrefix(data, []byte("fsm:")) {
+		return errors.New("missing prefix")
+	}
+	return json.Unmarshal(data[4:], v)
+}
+
+func TestWithCodec(t *testing.T) {
+	ctx := context.Background()
+	events := Events{
+		{EvtName: "open", SrcStates: []string{"closed"}, DstStates: "open"},
+		{EvtName: "close", SrcStates: []string{"open"}, DstStates: "closed"},
+	}
+	store := NewMemoryStore()
+	log := &MemoryLog{}
+	var records []AuditRecord
+	fsm := NewFSM("closed", events, Callbacks{},
+		WithCodec(prefixCodec{}),
+		WithStore(store, "door-1"),
+		WithLog(log),
+		WithHistory(10),
+		WithAudit(AuditFunc(func(r AuditRecord) { records = append(records, r) }), "door-1"),
+	)
+	if err := fsm.Event("open", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if h := fsm.History(0); len(h) != 1 || !reflect.DeepEqual(h[0].Args, []interface{}{1.0}) {
+		t.Errorf("expected the arguments decoded from the history, got %+v", h)
+	}
+	if len(records) != 1 || records[0].Codec != (prefixCodec{}) {
+		t.Errorf("expected the codec in the audit record, got %+v", records)
+	}
+
+	if s, err := store.Load(ctx, "door-1"); err != nil || s.State != "open" {
+		t.Errorf("expected state open in the store, got %+v, %v", s, err)
+	}
+	entries, err := log.Entries(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || !reflect.DeepEqual(entries[0].Args, []interface{}{1.0}) {
+		t.Errorf("expected the arguments decoded from the log, got %+v", entries)
+	}
+
+	replica := NewFSM("closed", events, Callbacks{}, WithCodec(prefixCodec{}), WithStore(store, "door-1"))
+	if err := replica.Load(ctx); err != nil || replica.Current() != "open" {
+		t.Errorf("expected the replica loaded in state open, got %s, %v", replica.Current(), err)
+	}
+	replayed := NewFSM("closed", events, Callbacks{})
+	if err := replayed.Replay(ctx, log); err != nil || replayed.Current() != "open" {
+		t.Errorf("expected the log replayed to state open, got %s, %v", replayed.Current(), err)
+	}
+
+	data, err := fsm.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, []byte("fsm:")) {
+		t.Errorf("expected the snapshot encoded by the codec, got %q", data)
+	}
+	if err := replica.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewFSM("closed", events, Callbacks{}).UnmarshalBinary(data); err == nil {
+		t.Error("expected an error decoding without the codec")
+	}
+
+	data, err = json.Marshal(fsm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := NewFSM("closed", events, Callbacks{}, WithCodec(prefixCodec{}))
+	if err := json.Unmarshal(data, decoded); err != nil || decoded.Current() != "open" {
+		t.Errorf("expected the FSM decoded from JSON in state open, got %s, %v", decoded.Current(), err)
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package looplab is a compatibility layer for code written against the
+// upstream github.com/looplab/fsm package.
+//
+// It exposes the upstream field names (Name, Src, Dst) and the upstream
+// callback signature func(*Event), and maps them onto this fork. Migrating
+// projects only have to change their import:
+//
+//	import fsm "github.com/papiguy/fsm/compat/looplab"
+//
+// The FSM, Event and error types are aliases of the ones in this fork, so an
+// *Event received in a callback and the errors returned by Event() can be used
+// with both packages.
+//
+// One difference remains: a transition to the current state returns the
+// callback error (usually nil) instead of a NoTransitionError, as this fork
+// does.
+package looplab
+
+import (
+	"strings"
+
+	"github.com/papiguy/fsm"
+)
+
+// FSM is the state machine that holds the current state.
+type FSM = fsm.FSM
+
+// Event is the info that get passed as a reference in the callbacks.
+type Event = fsm.Event
+
+// Errors returned by FSM.Event() and FSM.Transition().
+type (
+	InvalidEventError    = fsm.InvalidEventError
+	UnknownEventError    = fsm.UnknownEventError
+	InTransitionError    = fsm.InTransitionError
+	NotInTransitionError = fsm.NotInTransitionError
+	NoTransitionError    = fsm.NoTransitionError
+	CanceledError        = fsm.CanceledError
+	AsyncError           = fsm.AsyncError
+	InternalError        = fsm.InternalError
+	CallbackError        = fsm.CallbackError
+)
+
+// EventDesc represents an event when initializing the FSM, using the upstream
+// field names.
+type EventDesc struct {
+	// Name is the event name used when calling for a transition.
+	Name string
+
+	// Src is a slice of source states that the FSM must be in to perform a
+	// state transition.
+	Src []string
+
+	// Dst is the destination state that the FSM will be in if the transition
+	// succeds.
+	Dst string
+}
+
+// Callback is the upstream callback signature.
+type Callback func(*Event)
+
+// Events is a shorthand for defining the transition map in NewFSM.
+type Events []EventDesc
+
+// Callbacks is a shorthand for defining the callbacks in NewFSM.
+type Callbacks map[string]Callback
+
+// NewFSM constructs a FSM from events and callbacks using the upstream types.
+//
+// See fsm.NewFSM for how the callback keys are interpreted. The short form
+// <NEW_STATE> callbacks are only called when entering the state, as upstream
+// does, and not when an event is received in that state.
+func NewFSM(initial string, events []EventDesc, callbacks map[string]Callback) *FSM {
+	evts := make(fsm.Events, 0, len(events))
+	for _, e := range events {
+		evts = append(evts, fsm.EventDesc{EvtName: e.Name, SrcStates: e.Src, DstStates: e.Dst})
+	}
+
+	cbs := make(fsm.Callbacks, len(callbacks))
+	for name, fn := range callbacks {
+		cbs[name] = adapt(name, fn)
+	}
+
+	return fsm.NewFSM(initial, evts, cbs)
+}
+
+// Visualize outputs a visualization of a FSM in Graphviz format.
+func Visualize(f *FSM) string {
+	return fsm.Visualize(f)
+}
+
+// adapt wraps an upstream callback in the callback signature of this fork.
+func adapt(name string, fn Callback) fsm.Callback {
+	for _, prefix := range []string{"before_", "leave_", "enter_", "after_"} {
+		if strings.HasPrefix(name, prefix) {
+			return func(action string, e *fsm.Event) { fn(e) }
+		}
+	}
+	// Short form callbacks for states are also called with ActionOnEvent
+	// when leaving the state, which upstream knows nothing about.
+	return func(action string, e *fsm.Event) {
+		if action == fsm.ActionOnEvent {
+			return
+		}
+		fn(e)
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package looplab
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestUpstreamCallbacks(t *testing.T) {
+	var calls []string
+
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+			{Name: "close", Src: []string{"open"}, Dst: "closed"},
+		},
+		Callbacks{
+			"before_open": func(e *Event) {
+				calls = append(calls, "before_open")
+			},
+			"leave_closed": func(e *Event) {
+				calls = append(calls, "leave_closed")
+			},
+			"closed": func(e *Event) {
+				calls = append(calls, "closed")
+			},
+			"open": func(e *Event) {
+				calls = append(calls, "open "+e.FSM.Current())
+			},
+		},
+	)
+
+	if err := fsm.Event("open"); err != nil {
+		t.Error("expected no error")
+	}
+	if fsm.Current() != "open" {
+		t.Error("expected state to be 'open'")
+	}
+	if fmt.Sprint(calls) != "[before_open leave_closed open open]" {
+		t.Errorf("unexpected callbacks %v", calls)
+	}
+
+	calls = nil
+	fsm.Event("close")
+	if fmt.Sprint(calls) != "[closed]" {
+		t.Errorf("unexpected callbacks %v", calls)
+	}
+}
+
+func TestUpstreamErrors(t *testing.T) {
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{Name: "open", Src: []string{"closed"}, Dst: "open"},
+		},
+		Callbacks{
+			"before_open": func(e *Event) {
+				e.Cancel()
+			},
+		},
+	)
+	if _, ok := fsm.Event("open").(CanceledError); !ok {
+		t.Error("expected 'CanceledError'")
+	}
+	if _, ok := fsm.Event("lock").(UnknownEventError); !ok {
+		t.Error("expected 'UnknownEventError'")
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+// DataCallback is a callback of a DataFSM, which gets the data of the FSM
+// along with the event.
+type DataCallback[D any] func(action string, e *Event, data *D)
+
+// DataFSM is a FSM carrying extended state of a user defined type D, such as
+// the items of an order or a retry count, given to its callbacks.
+//
+// It embeds the FSM, so all its methods are available. It has to be created
+// with NewDataFSM to function properly.
+type DataFSM[D any] struct {
+	*FSM
+
+	data *D
+}
+
+// NewDataFSM constructs a DataFSM from events and callbacks as for NewFSM,
+// with data as the initial extended state.
+func NewDataFSM[D any](initial string, events []EventDesc, callbacks map[string]DataCallback[D], data D, opts ...Option) *DataFSM[D] {
+	f := &DataFSM[D]{data: &data}
+	cbs := make(Callbacks, len(callbacks))
+	for key, cb := range callbacks {
+		cb := cb
+		cbs[key] = func(action string, e *Event) {
+			cb(action, e, f.data)
+		}
+	}
+	f.FSM = NewFSM(initial, events, cbs, opts...)
+	return f
+}
+
+// Data returns the extended state of the FSM.
+//
+// Like the FSM, callbacks are called one at a time, so they can use the data
+// freely. It is not guarded otherwise: outside of callbacks, only use it while
+// no event is in progress, or guard it with a lock of its own.
+func (f *DataFSM[D]) Data() *D {
+	return f.data
+}
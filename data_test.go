@@ -0,0 +1,59 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import "testing"
+
+type order struct {
+	Items   []string
+	Retries int
+}
+
+func TestDataFSM(t *testing.T) {
+	fsm := NewDataFSM(
+		"cart",
+		Events{
+			{EvtName: "add", SrcStates: []string{"cart"}, DstStates: "cart"},
+			{EvtName: "pay", SrcStates: []string{"cart"}, DstStates: "paid"},
+		},
+		map[string]DataCallback[order]{
+			"before_add": func(action string, e *Event, o *order) {
+				o.Items = append(o.Items, e.Args[0].(string))
+			},
+			"before_pay": func(action string, e *Event, o *order) {
+				if len(o.Items) == 0 {
+					o.Retries++
+					e.Cancel()
+				}
+			},
+		},
+		order{},
+	)
+
+	if err := fsm.Event("pay"); err == nil {
+		t.Error("expected an empty order to be rejected")
+	}
+	fsm.Event("add", "book")
+	fsm.Event("add", "pen")
+	if err := fsm.Event("pay"); err != nil {
+		t.Error(err)
+	}
+	if fsm.Current() != "paid" {
+		t.Error("expected state to be 'paid'")
+	}
+	if d := fsm.Data(); len(d.Items) != 2 || d.Retries != 1 {
+		t.Error("expected 2 items and 1 retry, got", d)
+	}
+}
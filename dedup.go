@@ -0,0 +1,100 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import "time"
+
+// DedupKey returns the key that identifies an event among the events with the
+// same name, for WithDeduplication. It typically returns a message or
+// request ID found in args.
+type DedupKey func(event string, args []interface{}) string
+
+// dedup drops duplicate events, see WithDeduplication.
+type dedup struct {
+	window time.Duration
+	key    DedupKey
+
+	// seen maps events and their keys to when they were last handled, and
+	// expiry holds them in the order they were handled, so that the events
+	// handled before the window are forgotten without scanning seen.
+	seen   map[[2]string]time.Time
+	expiry []seenEvent
+}
+
+// seenEvent is an event handled at time.
+type seenEvent struct {
+	id   [2]string
+	time time.Time
+}
+
+// WithDeduplication drops an event, returning a DuplicateEventError, if an
+// identical event is already queued, see QueueWhilePending, or was handled
+// successfully within window. Events are identical when they have the same
+// name and the same key, as returned by key. If key is nil all events with
+// the same name are identical.
+//
+// It protects the FSM from messages delivered more than once upstream. An
+// event that fails is not remembered, so that it can be sent again.
+func WithDeduplication(window time.Duration, key DedupKey) Option {
+	return func(f *FSM) {
+		f.dedup = &dedup{window: window, key: key, seen: make(map[[2]string]time.Time)}
+	}
+}
+
+// id returns the identity of the event.
+func (d *dedup) id(event string, args []interface{}) [2]string {
+	if d.key == nil {
+		return [2]string{event, ""}
+	}
+	return [2]string{event, d.key(event, args)}
+}
+
+// duplicate returns true if the event is queued or was handled within the
+// window.
+func (f *FSM) duplicate(event string, args []interface{}) bool {
+	d := f.dedup
+	id := d.id(event, args)
+	if t, ok := d.seen[id]; ok && time.Since(t) < d.window {
+		return true
+	}
+	for _, q := range f.queue {
+		if d.id(q.event, q.args) == id {
+			return true
+		}
+	}
+	return false
+}
+
+// handled records that the event was handled with err, forgetting the events
+// handled before the window.
+func (f *FSM) handled(event string, args []interface{}, err error) {
+	d := f.dedup
+	if _, ok := err.(AsyncError); err != nil && !ok {
+		return
+	}
+	now := time.Now()
+	for len(d.expiry) > 0 && now.Sub(d.expiry[0].time) >= d.window {
+		s := d.expiry[0]
+		d.expiry[0] = seenEvent{}
+		d.expiry = d.expiry[1:]
+		// The event may have been handled again since.
+		if d.seen[s.id].Equal(s.time) {
+			delete(d.seen, s.id)
+		}
+	}
+	id := d.id(event, args)
+	d.seen[id] = now
+	d.expiry = append(d.expiry, seenEvent{id, now})
+}
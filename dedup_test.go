@@ -0,0 +1,124 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDeduplication(t *testing.T) {
+	fsm := NewFSM(
+		"idle",
+		Events{
+			{EvtName: "charge", SrcStates: []string{"idle", "charged"}, DstStates: "charged"},
+		},
+		Callbacks{
+			"before_charge": func(action string, e *Event) {
+				if e.Args[0] == "bad" {
+					e.Cancel()
+				}
+			},
+		},
+		WithDeduplication(50*time.Millisecond, func(event string, args []interface{}) string {
+			return args[0].(string)
+		}),
+	)
+
+	if err := fsm.Event("charge", "m1"); err != nil {
+		t.Error(err)
+	}
+	if _, ok := fsm.Event("charge", "m1").(DuplicateEventError); !ok {
+		t.Error("expected 'DuplicateEventError'")
+	}
+	if err := fsm.Event("charge", "m2"); err != nil {
+		t.Error(err)
+	}
+
+	if _, ok := fsm.Event("charge", "bad").(CanceledError); !ok {
+		t.Error("expected 'CanceledError'")
+	}
+	if _, ok := fsm.Event("charge", "bad").(CanceledError); !ok {
+		t.Error("expected a failed event not to be remembered")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if err := fsm.Event("charge", "m1"); err != nil {
+		t.Error("expected the event to be accepted after the window, got", err)
+	}
+}
+
+func TestDeduplicationForgets(t *testing.T) {
+	fsm := NewFSM(
+		"idle",
+		Events{
+			{EvtName: "charge", SrcStates: []string{"idle", "charged"}, DstStates: "charged"},
+		},
+		Callbacks{},
+		WithDeduplication(10*time.Millisecond, func(event string, args []interface{}) string {
+			return args[0].(string)
+		}),
+	)
+
+	for _, key := range []string{"m1", "m2", "m3"} {
+		if err := fsm.Event("charge", key); err != nil {
+			t.Error(err)
+		}
+	}
+	time.Sleep(15 * time.Millisecond)
+	if err := fsm.Event("charge", "m2"); err != nil {
+		t.Error(err)
+	}
+	if err := fsm.Event("charge", "m4"); err != nil {
+		t.Error(err)
+	}
+	if len(fsm.dedup.seen) != 2 || len(fsm.dedup.expiry) != 2 {
+		t.Errorf("expected the events handled before the window to be forgotten, got %v", fsm.dedup.seen)
+	}
+	if _, ok := fsm.Event("charge", "m2").(DuplicateEventError); !ok {
+		t.Error("expected an event handled again to be remembered")
+	}
+}
+
+func TestDeduplicationQueued(t *testing.T) {
+	fsm := NewFSM(
+		"start",
+		Events{
+			{EvtName: "run", SrcStates: []string{"start"}, DstStates: "end"},
+			{EvtName: "finish", SrcStates: []string{"start", "end"}, DstStates: "finished", WhilePending: QueueWhilePending},
+		},
+		Callbacks{
+			"leave_start": func(action string, e *Event) {
+				e.Async()
+			},
+		},
+		WithDeduplication(time.Minute, nil),
+	)
+
+	fsm.Event("run")
+	if _, ok := fsm.Event("finish").(QueuedError); !ok {
+		t.Error("expected 'QueuedError'")
+	}
+	if _, ok := fsm.Event("finish").(DuplicateEventError); !ok {
+		t.Error("expected 'DuplicateEventError' for a queued event")
+	}
+	fsm.Transition()
+	if fsm.Current() != "finished" {
+		t.Error("expected state to be 'finished'")
+	}
+	if _, ok := fsm.Event("finish").(DuplicateEventError); !ok {
+		t.Error("expected 'DuplicateEventError' for a handled event")
+	}
+}
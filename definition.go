@@ -0,0 +1,158 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import "sort"
+
+// Definition is the compiled form of the events and callbacks of a FSM. It is
+// created once with NewDefinition, and shared by the machines created with
+// NewInstance, which is much cheaper than NewFSM when a service creates many
+// short-lived machines.
+//
+// A Definition is immutable and safe for concurrent use.
+type Definition struct {
+	allStates  map[string]bool
+	table      *table
+	eventDescs map[string]string
+	callbacks  map[cKey]Callback
+
+	// names holds the state names shared by the instances, see
+	// FSM.setCurrent.
+	names map[string]*string
+}
+
+// NewDefinition compiles events and callbacks, given as for NewFSM.
+func NewDefinition(events []EventDesc, callbacks map[string]Callback) *Definition {
+	d := &Definition{
+		allStates:  make(map[string]bool),
+		table:      newTable(),
+		eventDescs: make(map[string]string),
+		callbacks:  make(map[cKey]Callback),
+	}
+
+	// Build transition map and store sets of all events and states.
+	allEvents := make(map[string]bool)
+	for i := range events {
+		e := events[i]
+		for _, src := range e.SrcStates {
+			dst := e.DstStates
+			if e.Internal {
+				dst = src
+			}
+			d.table.add(e.EvtName, src, dst, &e)
+			d.allStates[src] = true
+			for _, dst := range e.destinations() {
+				d.allStates[dst] = true
+			}
+		}
+		allEvents[e.EvtName] = true
+		if _, ok := d.eventDescs[e.EvtName]; !ok && e.Description != "" {
+			d.eventDescs[e.EvtName] = e.Description
+		}
+	}
+
+	// Map all callbacks to events/states, in a stable order.
+	names := make([]string, 0, len(callbacks))
+	for name := range callbacks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		target, callbackType, shorthand := parseCallback(name, allEvents, d.allStates)
+		if callbackType == callbackNone {
+			continue
+		}
+		key := cKey{target, callbackType}
+		if _, ok := d.callbacks[key]; ok && shorthand {
+			continue
+		}
+		d.callbacks[key] = callbacks[name]
+	}
+
+	d.names = make(map[string]*string, len(d.allStates))
+	for state := range d.allStates {
+		state := state
+		d.names[state] = &state
+	}
+
+	return d
+}
+
+// NewInstance returns a FSM of the definition in the initial state, with the
+// options applied in order as for NewFSM.
+//
+// The FSM shares the maps of the definition, and only copies them if it has
+// to change them, for example for the options WithStates.
+func (d *Definition) NewInstance(initial string, opts ...Option) *FSM {
+	f := d.instance(initial)
+	f.shared = true
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f
+}
+
+// instance returns a FSM of the definition in the initial state, which owns
+// the maps of the definition.
+func (d *Definition) instance(initial string) *FSM {
+	f := &FSM{
+		transitionerObj: &transitionerStruct{},
+		initial:         initial,
+		allStates:       d.allStates,
+		table:           d.table,
+		eventDescs:      d.eventDescs,
+		callbacks:       d.callbacks,
+		names:           d.names,
+	}
+	f.setCurrent(initial)
+	return f
+}
+
+// own copies the maps that the FSM shares with its definition or prototype
+// before they are changed.
+func (f *FSM) own() {
+	if !f.shared {
+		return
+	}
+	f.shared = false
+
+	allStates := make(map[string]bool, len(f.allStates))
+	for state := range f.allStates {
+		allStates[state] = true
+	}
+	f.allStates = allStates
+
+	f.table = f.table.clone()
+
+	eventDescs := make(map[string]string, len(f.eventDescs))
+	for event, desc := range f.eventDescs {
+		eventDescs[event] = desc
+	}
+	f.eventDescs = eventDescs
+
+	callbacks := make(map[cKey]Callback, len(f.callbacks))
+	for key, cb := range f.callbacks {
+		callbacks[key] = cb
+	}
+	f.callbacks = callbacks
+
+	if f.stateDescs != nil {
+		stateDescs := make(map[string]*StateDesc, len(f.stateDescs))
+		for state, desc := range f.stateDescs {
+			stateDescs[state] = desc
+		}
+		f.stateDescs = stateDescs
+	}
+}
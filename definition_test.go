@@ -0,0 +1,83 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import "testing"
+
+func TestDefinition(t *testing.T) {
+	var entered []string
+	def := NewDefinition(
+		Events{
+			{EvtName: "open", SrcStates: []string{"closed"}, DstStates: "open"},
+			{EvtName: "close", SrcStates: []string{"open"}, DstStates: "closed"},
+		},
+		Callbacks{
+			"enter_state": func(action string, e *Event) {
+				entered = append(entered, e.Dst)
+			},
+		},
+	)
+
+	a := def.NewInstance("closed")
+	b := def.NewInstance("open", WithStates(States{
+		{Name: "closed", OnEnter: func(e *Event) { entered = append(entered, "OnEnter") }},
+		{Name: "broken"},
+	}))
+
+	if err := a.Event("open"); err != nil {
+		t.Error(err)
+	}
+	if err := b.Event("close"); err != nil {
+		t.Error(err)
+	}
+	if a.Current() != "open" || b.Current() != "closed" {
+		t.Error("expected independent states")
+	}
+	if err := a.Event("close"); err != nil {
+		t.Error(err)
+	}
+	if len(entered) != 4 || entered[1] != "OnEnter" {
+		t.Error("expected the state actions only on b, got", entered)
+	}
+	if def.allStates["broken"] || len(a.Unreachable()) != 0 {
+		t.Error("expected the definition to be unchanged")
+	}
+}
+
+func BenchmarkNewFSM(b *testing.B) {
+	events := Events{
+		{EvtName: "open", SrcStates: []string{"closed"}, DstStates: "open"},
+		{EvtName: "close", SrcStates: []string{"open"}, DstStates: "closed"},
+	}
+	callbacks := Callbacks{"enter_state": func(action string, e *Event) {}}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		NewFSM("closed", events, callbacks)
+	}
+}
+
+func BenchmarkNewInstance(b *testing.B) {
+	def := NewDefinition(
+		Events{
+			{EvtName: "open", SrcStates: []string{"closed"}, DstStates: "open"},
+			{EvtName: "close", SrcStates: []string{"open"}, DstStates: "closed"},
+		},
+		Callbacks{"enter_state": func(action string, e *Event) {}},
+	)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		def.NewInstance("closed")
+	}
+}
@@ -0,0 +1,537 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"io"
+	"strings"
+	"unicode"
+)
+
+// ImportDOT builds the events of a FSM from a Graphviz DOT graph, such as the
+// ones written by Visualize and GetDotRep.
+//
+// Nodes are states, named by their label attribute if they have one and by
+// their ID otherwise. Edges are transitions, and their label attribute is the
+// name of the event. Edges with the same label and destination are combined
+// into one EventDesc with several source states, in the order they appear.
+//
+// The initial state is the destination of the edge leaving a node with the
+// attribute shape=point, which is a common way to mark it in diagrams and is
+// not a state itself. Without such a node, the source of the first edge is the
+// initial state.
+//
+// Subgraphs are flattened, and graph, node and edge default attributes are
+// ignored. An ImportError is returned if the graph can not be parsed or if an
+// edge has no label.
+func ImportDOT(r io.Reader) (string, Events, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", nil, err
+	}
+
+	p := &dotParser{
+		lexer: dotLexer{src: []rune(string(data)), line: 1},
+		nodes: make(map[string]map[string]string),
+	}
+	if err := p.parseGraph(); err != nil {
+		return "", nil, err
+	}
+
+	return p.events()
+}
+
+// dotEdge is an edge between two node IDs.
+type dotEdge struct {
+	src, dst string
+	attrs    map[string]string
+	line     int
+}
+
+// dotParser parses a DOT graph into nodes and edges.
+type dotParser struct {
+	lexer dotLexer
+	tok   dotToken
+
+	// nodes maps node IDs to their attributes.
+	nodes map[string]map[string]string
+
+	edges []dotEdge
+}
+
+// events converts the parsed graph into an initial state and events.
+func (p *dotParser) events() (string, Events, error) {
+	name := func(id string) string {
+		if label, ok := p.nodes[id]["label"]; ok {
+			return label
+		}
+		return id
+	}
+	isMarker := func(id string) bool {
+		return p.nodes[id]["shape"] == "point"
+	}
+
+	initial := ""
+	var events Events
+	index := make(map[[2]string]int)
+	for _, e := range p.edges {
+		if isMarker(e.src) {
+			continue
+		}
+		if initial == "" {
+			initial = name(e.src)
+		}
+
+		label, ok := e.attrs["label"]
+		if !ok || label == "" {
+			return "", nil, ImportError{"dot", e.line, "edge " + e.src + " -> " + e.dst + " has no label"}
+		}
+		key := [2]string{label, name(e.dst)}
+		if i, ok := index[key]; ok {
+			events[i].SrcStates = append(events[i].SrcStates, name(e.src))
+			continue
+		}
+		index[key] = len(events)
+		events = append(events, EventDesc{EvtName: label, SrcStates: []string{name(e.src)}, DstStates: name(e.dst)})
+	}
+
+	// Prefer the start marker over the first edge, wherever it appears.
+	for _, e := range p.edges {
+		if isMarker(e.src) {
+			initial = name(e.dst)
+			break
+		}
+	}
+
+	return initial, events, nil
+}
+
+func (p *dotParser) next() error {
+	tok, err := p.lexer.next()
+	p.tok = tok
+	return err
+}
+
+func (p *dotParser) errorf(msg string) error {
+	return ImportError{"dot", p.tok.line, msg}
+}
+
+// expect consumes the punctuation s or returns an error.
+func (p *dotParser) expect(s string) error {
+	if p.tok.kind != dotPunct || p.tok.text != s {
+		return p.errorf("expected " + s + ", found " + p.tok.String())
+	}
+	return p.next()
+}
+
+// isKeyword reports whether the current token is the keyword kw.
+func (p *dotParser) isKeyword(kw string) bool {
+	return p.tok.kind == dotID && strings.EqualFold(p.tok.text, kw)
+}
+
+func (p *dotParser) isPunct(s string) bool {
+	return p.tok.kind == dotPunct && p.tok.text == s
+}
+
+// parseGraph parses: [strict] (graph | digraph) [ID] '{' stmt_list '}'
+func (p *dotParser) parseGraph() error {
+	if err := p.next(); err != nil {
+		return err
+	}
+	if p.isKeyword("strict") {
+		if err := p.next(); err != nil {
+			return err
+		}
+	}
+	if !p.isKeyword("graph") && !p.isKeyword("digraph") {
+		return p.errorf("expected graph or digraph, found " + p.tok.String())
+	}
+	if err := p.next(); err != nil {
+		return err
+	}
+	if p.tok.kind == dotID || p.tok.kind == dotQuoted {
+		if err := p.next(); err != nil {
+			return err
+		}
+	}
+	if err := p.expect("{"); err != nil {
+		return err
+	}
+	if err := p.parseStmtList(); err != nil {
+		return err
+	}
+	if err := p.expect("}"); err != nil {
+		return err
+	}
+	if p.tok.kind != dotEOF {
+		return p.errorf("unexpected " + p.tok.String() + " after graph")
+	}
+	return nil
+}
+
+// parseStmtList parses statements until a closing brace.
+func (p *dotParser) parseStmtList() error {
+	for !p.isPunct("}") {
+		if p.tok.kind == dotEOF {
+			return p.errorf("unexpected end of graph")
+		}
+		if err := p.parseStmt(); err != nil {
+			return err
+		}
+		if p.isPunct(";") {
+			if err := p.next(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// parseStmt parses a single statement.
+func (p *dotParser) parseStmt() error {
+	switch {
+	case p.isKeyword("graph") || p.isKeyword("node") || p.isKeyword("edge"):
+		if err := p.next(); err != nil {
+			return err
+		}
+		_, err := p.parseAttrList()
+		return err
+	case p.isKeyword("subgraph") || p.isPunct("{"):
+		if p.isKeyword("subgraph") {
+			if err := p.next(); err != nil {
+				return err
+			}
+			if !p.isPunct("{") {
+				if err := p.next(); err != nil {
+					return err
+				}
+			}
+		}
+		if err := p.expect("{"); err != nil {
+			return err
+		}
+		if err := p.parseStmtList(); err != nil {
+			return err
+		}
+		return p.expect("}")
+	case p.tok.kind != dotID && p.tok.kind != dotQuoted:
+		return p.errorf("unexpected " + p.tok.String())
+	}
+
+	line := p.tok.line
+	id, err := p.parseNodeID()
+	if err != nil {
+		return err
+	}
+
+	// Graph attribute: ID '=' ID
+	if p.isPunct("=") {
+		if err := p.next(); err != nil {
+			return err
+		}
+		if p.tok.kind != dotID && p.tok.kind != dotQuoted {
+			return p.errorf("expected attribute value, found " + p.tok.String())
+		}
+		return p.next()
+	}
+
+	ids := []string{id}
+	for p.isPunct("->") || p.isPunct("--") {
+		if err := p.next(); err != nil {
+			return err
+		}
+		if p.tok.kind != dotID && p.tok.kind != dotQuoted {
+			return p.errorf("expected node, found " + p.tok.String())
+		}
+		id, err := p.parseNodeID()
+		if err != nil {
+			return err
+		}
+		ids = append(ids, id)
+	}
+
+	attrs, err := p.parseAttrList()
+	if err != nil {
+		return err
+	}
+
+	if len(ids) == 1 {
+		p.addNode(id)
+		for k, v := range attrs {
+			p.nodes[id][k] = v
+		}
+		return nil
+	}
+	for i := 0; i < len(ids)-1; i++ {
+		p.addNode(ids[i])
+		p.addNode(ids[i+1])
+		p.edges = append(p.edges, dotEdge{ids[i], ids[i+1], attrs, line})
+	}
+	return nil
+}
+
+// parseNodeID parses a node ID, skipping any port.
+func (p *dotParser) parseNodeID() (string, error) {
+	id := p.tok.text
+	if err := p.next(); err != nil {
+		return "", err
+	}
+	for p.isPunct(":") {
+		if err := p.next(); err != nil {
+			return "", err
+		}
+		if p.tok.kind != dotID && p.tok.kind != dotQuoted {
+			return "", p.errorf("expected port, found " + p.tok.String())
+		}
+		if err := p.next(); err != nil {
+			return "", err
+		}
+	}
+	return id, nil
+}
+
+// parseAttrList parses zero or more bracketed attribute lists.
+func (p *dotParser) parseAttrList() (map[string]string, error) {
+	attrs := make(map[string]string)
+	for p.isPunct("[") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		for !p.isPunct("]") {
+			if p.tok.kind != dotID && p.tok.kind != dotQuoted {
+				return nil, p.errorf("expected attribute, found " + p.tok.String())
+			}
+			key := p.tok.text
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+			value := "true"
+			if p.isPunct("=") {
+				if err := p.next(); err != nil {
+					return nil, err
+				}
+				if p.tok.kind != dotID && p.tok.kind != dotQuoted {
+					return nil, p.errorf("expected attribute value, found " + p.tok.String())
+				}
+				value = p.tok.text
+				if err := p.next(); err != nil {
+					return nil, err
+				}
+			}
+			attrs[key] = value
+			if p.isPunct(",") || p.isPunct(";") {
+				if err := p.next(); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+	}
+	return attrs, nil
+}
+
+// addNode adds the node id, if it is new.
+func (p *dotParser) addNode(id string) {
+	if _, ok := p.nodes[id]; !ok {
+		p.nodes[id] = make(map[string]string)
+	}
+}
+
+const (
+	dotEOF = iota
+	dotID
+	dotQuoted
+	dotPunct
+)
+
+// dotToken is a token of the DOT language.
+type dotToken struct {
+	kind int
+	text string
+	line int
+}
+
+func (t dotToken) String() string {
+	switch t.kind {
+	case dotEOF:
+		return "end of input"
+	case dotQuoted:
+		return "\"" + t.text + "\""
+	}
+	return t.text
+}
+
+// dotLexer splits a DOT graph into tokens.
+type dotLexer struct {
+	src  []rune
+	pos  int
+	line int
+}
+
+func (l *dotLexer) peek(offset int) rune {
+	if l.pos+offset >= len(l.src) {
+		return 0
+	}
+	return l.src[l.pos+offset]
+}
+
+// skip skips white space and comments.
+func (l *dotLexer) skip() error {
+	atLineStart := l.pos == 0
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case c == '\n':
+			l.line++
+			l.pos++
+			atLineStart = true
+		case unicode.IsSpace(c):
+			l.pos++
+		case c == '/' && l.peek(1) == '/', c == '#' && atLineStart:
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+				l.pos++
+			}
+		case c == '/' && l.peek(1) == '*':
+			start := l.line
+			l.pos += 2
+			for l.pos < len(l.src) && !(l.src[l.pos] == '*' && l.peek(1) == '/') {
+				if l.src[l.pos] == '\n' {
+					l.line++
+				}
+				l.pos++
+			}
+			if l.pos >= len(l.src) {
+				return ImportError{"dot", start, "unterminated comment"}
+			}
+			l.pos += 2
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+// next returns the next token.
+func (l *dotLexer) next() (dotToken, error) {
+	if err := l.skip(); err != nil {
+		return dotToken{}, err
+	}
+	if l.pos >= len(l.src) {
+		return dotToken{kind: dotEOF, line: l.line}, nil
+	}
+
+	line := l.line
+	c := l.src[l.pos]
+	switch {
+	case c == '-' && (l.peek(1) == '>' || l.peek(1) == '-'):
+		l.pos += 2
+		return dotToken{dotPunct, string([]rune{c, l.src[l.pos-1]}), line}, nil
+	case strings.ContainsRune("{}[];,=:", c):
+		l.pos++
+		return dotToken{dotPunct, string(c), line}, nil
+	case c == '"':
+		return l.quoted()
+	case c == '<':
+		return l.html()
+	case c == '_' || c == '.' || c == '-' || unicode.IsLetter(c) || unicode.IsDigit(c):
+		start := l.pos
+		for l.pos < len(l.src) {
+			c := l.src[l.pos]
+			if c != '_' && c != '.' && !unicode.IsLetter(c) && !unicode.IsDigit(c) &&
+				!(c == '-' && l.pos == start) {
+				break
+			}
+			l.pos++
+		}
+		return dotToken{dotID, string(l.src[start:l.pos]), line}, nil
+	}
+	return dotToken{}, ImportError{"dot", line, "unexpected character " + string(c)}
+}
+
+// quoted lexes a double quoted string, with \" escapes and + concatenation.
+func (l *dotLexer) quoted() (dotToken, error) {
+	line := l.line
+	var b strings.Builder
+	for {
+		l.pos++ // opening quote
+		for {
+			if l.pos >= len(l.src) {
+				return dotToken{}, ImportError{"dot", line, "unterminated string"}
+			}
+			c := l.src[l.pos]
+			if c == '"' {
+				l.pos++
+				break
+			}
+			if c == '\\' && l.peek(1) == '"' {
+				b.WriteRune('"')
+				l.pos += 2
+				continue
+			}
+			if c == '\\' && l.peek(1) == '\n' {
+				l.line++
+				l.pos += 2
+				continue
+			}
+			if c == '\n' {
+				l.line++
+			}
+			b.WriteRune(c)
+			l.pos++
+		}
+
+		// "a" + "b" concatenates strings.
+		save, saveLine := l.pos, l.line
+		if err := l.skip(); err != nil {
+			return dotToken{}, err
+		}
+		if l.peek(0) == '+' {
+			l.pos++
+			if err := l.skip(); err != nil {
+				return dotToken{}, err
+			}
+			if l.peek(0) == '"' {
+				continue
+			}
+		}
+		l.pos, l.line = save, saveLine
+		return dotToken{dotQuoted, b.String(), line}, nil
+	}
+}
+
+// html lexes an HTML string delimited by matching angle brackets.
+func (l *dotLexer) html() (dotToken, error) {
+	line := l.line
+	start := l.pos + 1
+	depth := 0
+	for l.pos < len(l.src) {
+		switch l.src[l.pos] {
+		case '<':
+			depth++
+		case '>':
+			depth--
+			if depth == 0 {
+				l.pos++
+				return dotToken{dotQuoted, string(l.src[start : l.pos-1]), line}, nil
+			}
+		case '\n':
+			l.line++
+		}
+		l.pos++
+	}
+	return dotToken{}, ImportError{"dot", line, "unterminated HTML string"}
+}
@@ -0,0 +1,121 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestImportDOTVisualize(t *testing.T) {
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{EvtName: "open", SrcStates: []string{"closed"}, DstStates: "open"},
+			{EvtName: "close", SrcStates: []string{"open"}, DstStates: "closed"},
+			{EvtName: "kick", SrcStates: []string{"closed", "open"}, DstStates: "broken"},
+			{EvtName: "fix", SrcStates: []string{"broken"}, DstStates: "closed"},
+		},
+		Callbacks{},
+	)
+
+	initial, events, err := ImportDOT(strings.NewReader(Visualize(fsm)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if initial != "closed" {
+		t.Errorf("expected initial state 'closed', got %q", initial)
+	}
+	imported := NewFSM(initial, events, Callbacks{})
+	if Visualize(imported) != Visualize(fsm) {
+		t.Errorf("expected the same graph, got:\n%s", Visualize(imported))
+	}
+	if fmt.Sprint(events[0].SrcStates) != "[closed open]" {
+		t.Errorf("expected kick edges to be combined, got %v", events)
+	}
+}
+
+func TestImportDOTGetDotRep(t *testing.T) {
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{EvtName: "open", SrcStates: []string{"closed"}, DstStates: "open"},
+			{EvtName: "close", SrcStates: []string{"open"}, DstStates: "closed"},
+		},
+		Callbacks{},
+	)
+
+	initial, events, err := ImportDOT(strings.NewReader(fsm.GetDotRep("door")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	imported := NewFSM(initial, events, Callbacks{})
+	if imported.GetDotRep("door") != fsm.GetDotRep("door") {
+		t.Errorf("expected the same graph, got:\n%s", imported.GetDotRep("door"))
+	}
+}
+
+func TestImportDOTStartMarker(t *testing.T) {
+	src := `
+# A door.
+strict digraph "door" {
+	rankdir = LR;
+	node [shape=circle];
+	subgraph cluster_0 {
+		label = "inside";
+		a [label="closed"]; b [label=<<b>open</b>>]
+	}
+	a -> b [label="open", color=blue] // opening
+	b:e -> a:w [label=close]
+	/* The start marker comes last. */
+	start [shape=point]
+	start -> b
+}`
+	initial, events, err := ImportDOT(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if initial != "<b>open</b>" {
+		t.Errorf("expected initial state from the start marker, got %q", initial)
+	}
+	if len(events) != 2 || events[1].EvtName != "close" || events[1].DstStates != "closed" {
+		t.Errorf("unexpected events %v", events)
+	}
+}
+
+func TestImportDOTErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		line int
+	}{
+		{"graph {\n a -> b\n}", 2},
+		{"digraph {\n a -> b [label=\"x\"]", 2},
+		{"digraph {\n a -> [label=x]\n}", 2},
+		{"digraph {\n a -> b [label=\"x]\n}", 2},
+		{"tree { }", 1},
+	}
+	for _, test := range tests {
+		_, _, err := ImportDOT(strings.NewReader(test.src))
+		e, ok := err.(ImportError)
+		if !ok {
+			t.Errorf("expected ImportError for %q, got %v", test.src, err)
+			continue
+		}
+		if e.Format != "dot" || e.Line != test.line {
+			t.Errorf("expected line %d for %q, got %v", test.line, test.src, e)
+		}
+	}
+}
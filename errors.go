@@ -14,26 +14,97 @@
 
 package fsm
 
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Sentinel errors matching the error types of the package with errors.Is, so
+// that callers can test the kind of an error, even wrapped, without a type
+// assertion. The error types can still be extracted with errors.As for their
+// fields.
+var (
+	ErrInvalidEvent    = errors.New("event inappropriate in current state")
+	ErrUnknownEvent    = errors.New("event does not exist")
+	ErrInTransition    = errors.New("transition in progress")
+	ErrGuardFailed     = errors.New("guard failed")
+	ErrQueued          = errors.New("event queued")
+	ErrNotInTransition = errors.New("no transition in progress")
+	ErrNoTransition    = errors.New("no transition")
+	ErrCanceled        = errors.New("transition canceled")
+	ErrAsync           = errors.New("async started")
+	ErrForwardCycle    = errors.New("forwarding cycle")
+	ErrMailboxFull     = errors.New("mailbox full")
+	ErrActorClosed     = errors.New("actor closed")
+	ErrDebounced       = errors.New("event debounced")
+	ErrDuplicateEvent  = errors.New("duplicate event")
+	ErrThrottled       = errors.New("event throttled")
+	ErrNotFound        = errors.New("instance not found")
+	ErrConflict        = errors.New("sequence already saved")
+	ErrInvalidChoice   = errors.New("invalid destination choice")
+	ErrAborted         = errors.New("transition aborted")
+	ErrUnknownState    = errors.New("state does not exist")
+	ErrInstanceExists  = errors.New("instance already exists")
+	ErrUnknownCallback = errors.New("callback for unknown event or state")
+	ErrInternal        = errors.New("internal error")
+
+	ErrConflictingTransition = errors.New("conflicting transitions")
+	ErrManagerStopped        = errors.New("manager stopped")
+	ErrShutdown              = errors.New("instances not stopped")
+	ErrStateLimit            = errors.New("state limit reached")
+)
+
 // InvalidEventError is returned by FSM.Event() when the event cannot be called
 // in the current state.
 type InvalidEventError struct {
 	Event string
 	State string
+
+	// Description is the description of the event, if it has one.
+	Description string
+
+	// Available are the events that can occur in State, in sorted order.
+	Available []string
 }
 
 func (e InvalidEventError) Error() string {
-	return "event " + e.Event + " inappropriate in current state " + e.State
+	msg := "event " + e.Event + " inappropriate in current state " + e.State
+	if e.Description != "" {
+		msg = "event " + e.Event + " (" + e.Description + ") inappropriate in current state " + e.State
+	}
+	if len(e.Available) > 0 {
+		msg += ", available events: " + strings.Join(e.Available, ", ")
+	}
+	return msg
+}
+
+func (e InvalidEventError) Is(target error) bool {
+	return target == ErrInvalidEvent
 }
 
 // UnknownEventError is returned by FSM.Event() when the event is not defined.
 type UnknownEventError struct {
 	Event string
+
+	// Suggestions are the events with the closest names, closest first, for
+	// example when Event is misspelled.
+	Suggestions []string
 }
 
 func (e UnknownEventError) Error() string {
+	if len(e.Suggestions) > 0 {
+		return "event " + e.Event + " does not exist, did you mean " + strings.Join(e.Suggestions, ", ") + "?"
+	}
 	return "event " + e.Event + " does not exist"
 }
 
+func (e UnknownEventError) Is(target error) bool {
+	return target == ErrUnknownEvent
+}
+
 // InTransitionError is returned by FSM.Event() when an asynchronous transition
 // is already in progress.
 type InTransitionError struct {
@@ -44,6 +115,42 @@ func (e InTransitionError) Error() string {
 	return "event " + e.Event + " inappropriate because previous transition did not complete"
 }
 
+func (e InTransitionError) Is(target error) bool {
+	return target == ErrInTransition
+}
+
+// GuardFailedError is returned by FSM.Event() when a guard of the transition
+// does not hold.
+type GuardFailedError struct {
+	Event string
+	State string
+
+	// Guard is the name of the guard that rejected the transition.
+	Guard string
+}
+
+func (e GuardFailedError) Error() string {
+	return "event " + e.Event + " in state " + e.State + " rejected by guard " + e.Guard
+}
+
+func (e GuardFailedError) Is(target error) bool {
+	return target == ErrGuardFailed
+}
+
+// QueuedError is returned by FSM.Event() when the event has been queued to run
+// after the asynchronous transition in progress. See QueueWhilePending.
+type QueuedError struct {
+	Event string
+}
+
+func (e QueuedError) Error() string {
+	return "event " + e.Event + " queued until the transition in progress completes"
+}
+
+func (e QueuedError) Is(target error) bool {
+	return target == ErrQueued
+}
+
 // NotInTransitionError is returned by FSM.Transition() when an asynchronous
 // transition is not in progress.
 type NotInTransitionError struct{}
@@ -52,6 +159,10 @@ func (e NotInTransitionError) Error() string {
 	return "transition inappropriate because no state change in progress"
 }
 
+func (e NotInTransitionError) Is(target error) bool {
+	return target == ErrNotInTransition
+}
+
 // NoTransitionError is returned by FSM.Event() when no transition have happened,
 // for example if the source and destination states are the same.
 type NoTransitionError struct {
@@ -65,10 +176,23 @@ func (e NoTransitionError) Error() string {
 	return "no transition"
 }
 
+func (e NoTransitionError) Is(target error) bool {
+	return target == ErrNoTransition
+}
+
+// Unwrap returns the error set by a callback, if any.
+func (e NoTransitionError) Unwrap() error {
+	return e.Err
+}
+
 // CanceledError is returned by FSM.Event() when a callback have canceled a
 // transition.
 type CanceledError struct {
 	Err error
+
+	// Trace lists the callbacks that were called before the transition was
+	// canceled, including the one that canceled it.
+	Trace []Phase
 }
 
 func (e CanceledError) Error() string {
@@ -78,6 +202,53 @@ func (e CanceledError) Error() string {
 	return "transition canceled"
 }
 
+func (e CanceledError) Is(target error) bool {
+	return target == ErrCanceled
+}
+
+// Unwrap returns the error given to Event.Cancel, if any.
+func (e CanceledError) Unwrap() error {
+	return e.Err
+}
+
+// CallbackError is returned by FSM.Event() when a callback has set Event.Err,
+// if the FSM was created with WithErrorTrace or the error was set with
+// Event.Fail. Otherwise the error is returned unchanged. Its message is the one
+// of Err.
+type CallbackError struct {
+	Err error
+
+	// Trace lists the callbacks that were called during the transition,
+	// including the one that set the error.
+	Trace []Phase
+
+	// Class is the classification given to Event.Fail, or Unclassified.
+	Class ErrorClass
+}
+
+func (e CallbackError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the error set by the callback.
+func (e CallbackError) Unwrap() error {
+	return e.Err
+}
+
+// IsRetryable returns true if err is, or wraps, a CallbackError classified as
+// Retryable.
+func IsRetryable(err error) bool {
+	var e CallbackError
+	return errors.As(err, &e) && e.Class == Retryable
+}
+
+// IsTerminal returns true if err is, or wraps, a CallbackError classified as
+// Terminal.
+func IsTerminal(err error) bool {
+	var e CallbackError
+	return errors.As(err, &e) && e.Class == Terminal
+}
+
 // AsyncError is returned by FSM.Event() when a callback have initiated an
 // asynchronous state transition.
 type AsyncError struct {
@@ -91,6 +262,528 @@ func (e AsyncError) Error() string {
 	return "async started"
 }
 
+func (e AsyncError) Is(target error) bool {
+	return target == ErrAsync
+}
+
+// Unwrap returns the error set by the callback that started the transition, if any.
+func (e AsyncError) Unwrap() error {
+	return e.Err
+}
+
+// DuplicateTransitionError describes two event descriptions defining a
+// transition for the same event and source state, as reported by
+// Events.Validate. NewFSMStrict only refuses those that are not identical,
+// with a ConflictingTransitionError.
+type DuplicateTransitionError struct {
+	Event string
+	Src   string
+
+	// First and Second are the indexes of the two event descriptions.
+	First  int
+	Second int
+
+	// FirstDst and SecondDst are the destinations of the two event
+	// descriptions.
+	FirstDst  string
+	SecondDst string
+}
+
+func (e DuplicateTransitionError) Error() string {
+	return fmt.Sprintf("event %s from state %s defined twice: events[%d] to %s and events[%d] to %s",
+		e.Event, e.Src, e.First, e.FirstDst, e.Second, e.SecondDst)
+}
+
+// ConflictingTransitionError is returned by NewFSMStrict() when two event
+// descriptions that are not identical define a transition for the same event
+// and source state, so that which one applies would depend on their order.
+type ConflictingTransitionError struct {
+	Event string
+	Src   string
+
+	// First and Second are the indexes of the two event descriptions.
+	First  int
+	Second int
+
+	// FirstDst and SecondDst are the destinations of the two event
+	// descriptions, DstStates followed by DstChoices.
+	FirstDst  []string
+	SecondDst []string
+
+	// Field is the first field of EventDesc in which the two event
+	// descriptions differ, such as "DstStates" or "Guards".
+	Field string
+}
+
+func (e ConflictingTransitionError) Error() string {
+	msg := fmt.Sprintf("event %s from state %s has conflicting transitions: events[%d] to %s and events[%d] to %s",
+		e.Event, e.Src, e.First, strings.Join(e.FirstDst, "|"), e.Second, strings.Join(e.SecondDst, "|"))
+	if e.Field != "" {
+		msg += " with different " + e.Field
+	}
+	return msg
+}
+
+func (e ConflictingTransitionError) Is(target error) bool {
+	return target == ErrConflictingTransition
+}
+
+// ManagerStoppedError is returned by Manager.Create and Manager.Load once the
+// manager is shut down, see Manager.Shutdown.
+type ManagerStoppedError struct {
+	ID string
+}
+
+func (e ManagerStoppedError) Error() string {
+	return "instance " + e.ID + " not added to stopped manager"
+}
+
+func (e ManagerStoppedError) Is(target error) bool {
+	return target == ErrManagerStopped
+}
+
+// ShutdownError is returned by Manager.Shutdown when instances could not be
+// stopped, with the error of each by ID.
+type ShutdownError struct {
+	Errors map[string]error
+}
+
+func (e ShutdownError) Error() string {
+	ids := make([]string, 0, len(e.Errors))
+	for id := range e.Errors {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	msgs := make([]string, len(ids))
+	for i, id := range ids {
+		msgs[i] = id + ": " + e.Errors[id].Error()
+	}
+	return fmt.Sprintf("%d instances not stopped: %s", len(ids), strings.Join(msgs, "; "))
+}
+
+func (e ShutdownError) Is(target error) bool {
+	return target == ErrShutdown
+}
+
+// Unwrap returns the errors of the instances, so that errors.Is and errors.As
+// match them.
+func (e ShutdownError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// StateLimitError is returned by FSM.Event() when the instance of a Manager
+// can not enter a state that already has as many instances as allowed by
+// ManagerStateLimit.
+type StateLimitError struct {
+	State string
+	Limit int
+}
+
+func (e StateLimitError) Error() string {
+	return fmt.Sprintf("state %s has reached its limit of %d instances", e.State, e.Limit)
+}
+
+func (e StateLimitError) Is(target error) bool {
+	return target == ErrStateLimit
+}
+
+// NameCollisionError is returned by NewTypedFSM() when two different states or
+// two different events have the same name.
+type NameCollisionError struct {
+	// Kind is either "state" or "event".
+	Kind string
+	Name string
+}
+
+func (e NameCollisionError) Error() string {
+	return "more than one " + e.Kind + " named " + e.Name
+}
+
+// ImportError is returned when a FSM definition can not be imported from
+// another format.
+type ImportError struct {
+	// Format is the name of the format, e.g. "dot".
+	Format string
+
+	// Line is the line of the input where the error was found, or 0.
+	Line int
+
+	Msg string
+}
+
+func (e ImportError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("%s import: line %d: %s", e.Format, e.Line, e.Msg)
+	}
+	return e.Format + " import: " + e.Msg
+}
+
+// ForwardCycleError is returned by FSM.Event() when forwarding enters a
+// forwarding state a second time. See FSM.Forward.
+type ForwardCycleError struct {
+	State string
+}
+
+func (e ForwardCycleError) Error() string {
+	return "forwarding loops back to state " + e.State
+}
+
+func (e ForwardCycleError) Is(target error) bool {
+	return target == ErrForwardCycle
+}
+
+// BuildError is returned by Builder.Done when the FSM is incomplete.
+type BuildError struct {
+	// Event is the event with the error, if any.
+	Event string
+
+	Msg string
+
+	// File and Line are the position of the call to the Builder that caused
+	// the error, such as On for an event without destination state.
+	File string
+	Line int
+
+	// Err is the error found, if any, such as a ConflictingTransitionError.
+	Err error
+}
+
+func (e BuildError) Error() string {
+	msg := e.Msg
+	if e.Event != "" {
+		msg = "event " + e.Event + ": " + msg
+	}
+	if e.File != "" {
+		msg = fmt.Sprintf("%s:%d: %s", filepath.Base(e.File), e.Line, msg)
+	}
+	return msg
+}
+
+func (e BuildError) Unwrap() error {
+	return e.Err
+}
+
+// CallbackPanicError is returned by FSM.Event() when a callback panics and the
+// FSM was created with WithPanicRecovery.
+type CallbackPanicError struct {
+	// Callback is the key of the callback, e.g. "enter_state".
+	Callback string
+
+	// Action is the action the callback was called with.
+	Action string
+
+	// Value is the value given to panic.
+	Value interface{}
+
+	// Stack is the stack trace of the panic.
+	Stack []byte
+}
+
+func (e CallbackPanicError) Error() string {
+	return fmt.Sprintf("callback %s panicked: %v", e.Callback, e.Value)
+}
+
+// Unwrap returns the value given to panic if it is an error.
+func (e CallbackPanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// MailboxFullError is returned by Actor.Send when the mailbox of the actor is
+// full.
+type MailboxFullError struct {
+	Event string
+}
+
+func (e MailboxFullError) Error() string {
+	return "event " + e.Event + " dropped: mailbox full"
+}
+
+func (e MailboxFullError) Is(target error) bool {
+	return target == ErrMailboxFull
+}
+
+// ActorClosedError is returned by Actor.Send and Actor.Ask when the actor is
+// closed.
+type ActorClosedError struct {
+	Event string
+}
+
+func (e ActorClosedError) Error() string {
+	return "event " + e.Event + " sent to closed actor"
+}
+
+func (e ActorClosedError) Is(target error) bool {
+	return target == ErrActorClosed
+}
+
+// DebouncedError is returned by FSM.Event() when the event is delayed by the
+// Debounce middleware.
+type DebouncedError struct {
+	Event string
+}
+
+func (e DebouncedError) Error() string {
+	return "event " + e.Event + " debounced"
+}
+
+func (e DebouncedError) Is(target error) bool {
+	return target == ErrDebounced
+}
+
+// DuplicateEventError is returned by FSM.Event() when the event is dropped as
+// a duplicate, see WithDeduplication.
+type DuplicateEventError struct {
+	Event string
+}
+
+func (e DuplicateEventError) Error() string {
+	return "event " + e.Event + " is a duplicate"
+}
+
+func (e DuplicateEventError) Is(target error) bool {
+	return target == ErrDuplicateEvent
+}
+
+// ThrottledError is returned by FSM.Event() when the event is rejected by the
+// Throttle middleware.
+type ThrottledError struct {
+	Event string
+}
+
+func (e ThrottledError) Error() string {
+	return "event " + e.Event + " throttled"
+}
+
+func (e ThrottledError) Is(target error) bool {
+	return target == ErrThrottled
+}
+
+// SnapshotError is returned by FSM.Restore() when the snapshot does not match
+// the definition of the FSM.
+type SnapshotError struct {
+	Msg string
+}
+
+func (e SnapshotError) Error() string {
+	return "invalid snapshot: " + e.Msg
+}
+
+// NotFoundError is returned by Store.Load() when no state is saved for the
+// instance.
+type NotFoundError struct {
+	ID string
+}
+
+func (e NotFoundError) Error() string {
+	return "instance " + e.ID + " not found"
+}
+
+func (e NotFoundError) Is(target error) bool {
+	return target == ErrNotFound
+}
+
+// ConflictError is returned by Store.Save() when the state saved for the
+// instance is not the one just before the state to save, typically because
+// another process driving the same instance saved a transition first.
+type ConflictError struct {
+	ID       string
+	Sequence uint64
+}
+
+func (e ConflictError) Error() string {
+	return fmt.Sprintf("instance %s: sequence %d already saved", e.ID, e.Sequence)
+}
+
+func (e ConflictError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+// StoreError is returned by FSM.Event() when the state after the transition
+// could not be saved. The transition is not committed: the FSM stays in the
+// old state.
+type StoreError struct {
+	ID  string
+	Err error
+}
+
+func (e StoreError) Error() string {
+	return "store instance " + e.ID + ": " + e.Err.Error()
+}
+
+func (e StoreError) Unwrap() error {
+	return e.Err
+}
+
+// LogError is returned by FSM.Event() when the transition could not be
+// appended to the log. The transition is not committed: the FSM stays in the
+// old state.
+type LogError struct {
+	Sequence uint64
+	Err      error
+}
+
+func (e LogError) Error() string {
+	return fmt.Sprintf("log sequence %d: %s", e.Sequence, e.Err)
+}
+
+func (e LogError) Unwrap() error {
+	return e.Err
+}
+
+// HistoryError is returned by FSM.Event() when the arguments of the transition
+// could not be recorded in the history by the codec given to WithCodec. The
+// transition is not committed: the FSM stays in the old state.
+type HistoryError struct {
+	Sequence uint64
+	Err      error
+}
+
+func (e HistoryError) Error() string {
+	return fmt.Sprintf("history sequence %d: %s", e.Sequence, e.Err)
+}
+
+func (e HistoryError) Unwrap() error {
+	return e.Err
+}
+
+// ReplayError is returned by FSM.Replay() when a log entry does not match the
+// definition of the FSM or the entries before it.
+type ReplayError struct {
+	Sequence uint64
+	Msg      string
+}
+
+func (e ReplayError) Error() string {
+	return fmt.Sprintf("replay sequence %d: %s", e.Sequence, e.Msg)
+}
+
+// InvalidChoiceError is returned by FSM.Event() when the Choose function of
+// the event selects a state that is not one of its destinations, and by
+// Event.SetDst for such a state.
+type InvalidChoiceError struct {
+	Event string
+	Dst   string
+}
+
+func (e InvalidChoiceError) Error() string {
+	return "event " + e.Event + " chose unknown destination " + e.Dst
+}
+
+func (e InvalidChoiceError) Is(target error) bool {
+	return target == ErrInvalidChoice
+}
+
+// AbortedError is returned by FSM.EventCtx and FSM.Transition when the
+// context given to FSM.EventCtx is done during the transition. The context is
+// checked before each callback and before the state changes, and once it is
+// done no further callback is called.
+//
+// If Committed is false the transition was aborted before the state changed,
+// as if it had been canceled. If it is true the state had already changed, and
+// only some of the enter_ and after_ callbacks were skipped.
+type AbortedError struct {
+	Event string
+
+	// Err is the error of the context, context.Canceled or
+	// context.DeadlineExceeded.
+	Err error
+
+	// Committed is true if the state had changed.
+	Committed bool
+
+	// Trace lists the callbacks that were called before the transition was
+	// aborted.
+	Trace []Phase
+}
+
+func (e AbortedError) Error() string {
+	if e.Committed {
+		return "event " + e.Event + " aborted after the state changed: " + e.Err.Error()
+	}
+	return "event " + e.Event + " aborted: " + e.Err.Error()
+}
+
+func (e AbortedError) Is(target error) bool {
+	return target == ErrAborted
+}
+
+// Unwrap returns the error of the context.
+func (e AbortedError) Unwrap() error {
+	return e.Err
+}
+
+// BatchError is returned by FSM.Events() when an event of the batch fails.
+type BatchError struct {
+	// Index is the position of the event in the batch.
+	Index int
+
+	// Event is the event that failed.
+	Event string
+
+	// Err is the error of the event.
+	Err error
+}
+
+func (e BatchError) Error() string {
+	return fmt.Sprintf("batch event %d (%s) failed: %v", e.Index, e.Event, e.Err)
+}
+
+// Unwrap returns the error of the event.
+func (e BatchError) Unwrap() error {
+	return e.Err
+}
+
+// UnknownStateError is returned by FSM.ForceState() and TypedFSM.SetState()
+// when the state is not a state of the FSM.
+type UnknownStateError struct {
+	State string
+}
+
+func (e UnknownStateError) Error() string {
+	return "state " + e.State + " does not exist"
+}
+
+func (e UnknownStateError) Is(target error) bool {
+	return target == ErrUnknownState
+}
+
+// InstanceExistsError is returned by Manager.Create when the manager already
+// has an instance with the ID.
+type InstanceExistsError struct {
+	ID string
+}
+
+func (e InstanceExistsError) Error() string {
+	return "instance " + e.ID + " already exists"
+}
+
+func (e InstanceExistsError) Is(target error) bool {
+	return target == ErrInstanceExists
+}
+
+// UnknownCallbackError is returned by NewFSMHooks when a hook is for an event
+// or state that the FSM does not have.
+type UnknownCallbackError struct {
+	// Callback is the key of the hook, e.g. "enter_closed".
+	Callback string
+
+	// Target is the unknown event or state.
+	Target string
+}
+
+func (e UnknownCallbackError) Error() string {
+	return "callback " + e.Callback + " for unknown event or state " + e.Target
+}
+
+func (e UnknownCallbackError) Is(target error) bool {
+	return target == ErrUnknownCallback
+}
+
 // InternalError is returned by FSM.Event() and should never occur. It is a
 // probably because of a bug.
 type InternalError struct{}
@@ -98,3 +791,7 @@ type InternalError struct{}
 func (e InternalError) Error() string {
 	return "internal error on state transition"
 }
+
+func (e InternalError) Is(target error) bool {
+	return target == ErrInternal
+}
@@ -15,7 +15,9 @@
 package fsm
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"testing"
 )
 
@@ -26,6 +28,14 @@ func TestInvalidEventError(t *testing.T) {
 	if e.Error() != "event "+e.Event+" inappropriate in current state "+e.State {
 		t.Error("InvalidEventError string mismatch")
 	}
+	e.Description = "open the door"
+	if e.Error() != "event "+e.Event+" (open the door) inappropriate in current state "+e.State {
+		t.Error("InvalidEventError string mismatch")
+	}
+	e.Available = []string{"close", "lock"}
+	if e.Error() != "event "+e.Event+" (open the door) inappropriate in current state "+e.State+", available events: close, lock" {
+		t.Error("InvalidEventError string mismatch")
+	}
 }
 
 func TestUnknownEventError(t *testing.T) {
@@ -34,6 +44,10 @@ func TestUnknownEventError(t *testing.T) {
 	if e.Error() != "event "+e.Event+" does not exist" {
 		t.Error("UnknownEventError string mismatch")
 	}
+	e.Suggestions = []string{"open", "opened"}
+	if e.Error() != "event "+e.Event+" does not exist, did you mean open, opened?" {
+		t.Error("UnknownEventError string mismatch")
+	}
 }
 
 func TestInTransitionError(t *testing.T) {
@@ -44,6 +58,20 @@ func TestInTransitionError(t *testing.T) {
 	}
 }
 
+func TestGuardFailedError(t *testing.T) {
+	e := GuardFailedError{Event: "approve", State: "submitted", Guard: "is_manager"}
+	if e.Error() != "event approve in state submitted rejected by guard is_manager" {
+		t.Error("GuardFailedError string mismatch")
+	}
+}
+
+func TestQueuedError(t *testing.T) {
+	e := QueuedError{Event: "ping"}
+	if e.Error() != "event "+e.Event+" queued until the transition in progress completes" {
+		t.Error("QueuedError string mismatch")
+	}
+}
+
 func TestNotInTransitionError(t *testing.T) {
 	e := NotInTransitionError{}
 	if e.Error() != "transition inappropriate because no state change in progress" {
@@ -73,6 +101,33 @@ func TestCanceledError(t *testing.T) {
 	}
 }
 
+func TestCallbackErrorType(t *testing.T) {
+	err := errors.New("callback")
+	e := CallbackError{Err: err}
+	if e.Error() != "callback" {
+		t.Error("CallbackError string mismatch")
+	}
+	if !errors.Is(e, err) {
+		t.Error("CallbackError should unwrap to the callback error")
+	}
+}
+
+func TestErrorClass(t *testing.T) {
+	err := errors.New("callback")
+	if IsRetryable(err) || IsTerminal(err) {
+		t.Error("expected plain errors to be unclassified")
+	}
+	if IsRetryable(CallbackError{Err: err}) || IsTerminal(CallbackError{Err: err}) {
+		t.Error("expected CallbackError to be unclassified")
+	}
+	if !IsRetryable(CallbackError{Err: err, Class: Retryable}) || IsTerminal(CallbackError{Err: err, Class: Retryable}) {
+		t.Error("expected CallbackError to be retryable")
+	}
+	if IsRetryable(CallbackError{Err: err, Class: Terminal}) || !IsTerminal(CallbackError{Err: err, Class: Terminal}) {
+		t.Error("expected CallbackError to be terminal")
+	}
+}
+
 func TestAsyncError(t *testing.T) {
 	e := AsyncError{}
 	if e.Error() != "async started" {
@@ -84,9 +139,316 @@ func TestAsyncError(t *testing.T) {
 	}
 }
 
+func TestDuplicateTransitionError(t *testing.T) {
+	e := DuplicateTransitionError{Event: "run", Src: "start", First: 0, Second: 2, FirstDst: "end", SecondDst: "failed"}
+	if e.Error() != "event run from state start defined twice: events[0] to end and events[2] to failed" {
+		t.Error("DuplicateTransitionError string mismatch")
+	}
+}
+
+func TestConflictingTransitionError(t *testing.T) {
+	e := ConflictingTransitionError{Event: "pick", Src: "start", First: 0, Second: 2, FirstDst: []string{"a", "b"}, SecondDst: []string{"a"}}
+	if e.Error() != "event pick from state start has conflicting transitions: events[0] to a|b and events[2] to a" {
+		t.Error("ConflictingTransitionError string mismatch")
+	}
+	e.Field = "DstChoices"
+	if e.Error() != "event pick from state start has conflicting transitions: events[0] to a|b and events[2] to a with different DstChoices" {
+		t.Error("ConflictingTransitionError string mismatch")
+	}
+}
+
+func TestManagerStoppedError(t *testing.T) {
+	e := ManagerStoppedError{ID: "a"}
+	if e.Error() != "instance a not added to stopped manager" {
+		t.Error("ManagerStoppedError string mismatch")
+	}
+}
+
+func TestShutdownError(t *testing.T) {
+	e := ShutdownError{Errors: map[string]error{"b": InTransitionError{"pay"}, "a": context.DeadlineExceeded}}
+	if e.Error() != "2 instances not stopped: a: context deadline exceeded; b: event pay inappropriate because previous transition did not complete" {
+		t.Error("ShutdownError string mismatch")
+	}
+}
+
+func TestStateLimitError(t *testing.T) {
+	e := StateLimitError{State: "processing", Limit: 50}
+	if e.Error() != "state processing has reached its limit of 50 instances" {
+		t.Error("StateLimitError string mismatch")
+	}
+}
+
+func TestNameCollisionError(t *testing.T) {
+	e := NameCollisionError{Kind: "state", Name: "open"}
+	if e.Error() != "more than one state named open" {
+		t.Error("NameCollisionError string mismatch")
+	}
+}
+
+func TestImportError(t *testing.T) {
+	e := ImportError{Format: "dot", Msg: "bad"}
+	if e.Error() != "dot import: bad" {
+		t.Error("ImportError string mismatch")
+	}
+	e.Line = 3
+	if e.Error() != "dot import: line 3: bad" {
+		t.Error("ImportError string mismatch")
+	}
+}
+
+func TestForwardCycleError(t *testing.T) {
+	e := ForwardCycleError{State: "retry"}
+	if e.Error() != "forwarding loops back to state retry" {
+		t.Error("ForwardCycleError string mismatch")
+	}
+}
+
+func TestBuildError(t *testing.T) {
+	e := BuildError{Msg: "no initial state"}
+	if e.Error() != "no initial state" {
+		t.Error("BuildError string mismatch")
+	}
+	e = BuildError{Event: "run", Msg: "no source state"}
+	if e.Error() != "event run: no source state" {
+		t.Error("BuildError string mismatch")
+	}
+	e = BuildError{Event: "run", Msg: "no source state", File: "/src/door/door.go", Line: 12}
+	if e.Error() != "door.go:12: event run: no source state" {
+		t.Error("BuildError string mismatch")
+	}
+}
+
+func TestCallbackPanicError(t *testing.T) {
+	e := CallbackPanicError{Callback: "enter_state", Value: "boom"}
+	if e.Error() != "callback enter_state panicked: boom" {
+		t.Error("CallbackPanicError string mismatch")
+	}
+	if e.Unwrap() != nil {
+		t.Error("expected no wrapped error")
+	}
+	err := errors.New("boom")
+	if !errors.Is(CallbackPanicError{Value: err}, err) {
+		t.Error("expected the panic value to be wrapped")
+	}
+}
+
+func TestMailboxFullError(t *testing.T) {
+	e := MailboxFullError{Event: "run"}
+	if e.Error() != "event run dropped: mailbox full" {
+		t.Error("MailboxFullError string mismatch")
+	}
+}
+
+func TestActorClosedError(t *testing.T) {
+	e := ActorClosedError{Event: "run"}
+	if e.Error() != "event run sent to closed actor" {
+		t.Error("ActorClosedError string mismatch")
+	}
+}
+
+func TestDebouncedError(t *testing.T) {
+	e := DebouncedError{Event: "input"}
+	if e.Error() != "event input debounced" {
+		t.Error("DebouncedError string mismatch")
+	}
+}
+
+func TestThrottledError(t *testing.T) {
+	e := ThrottledError{Event: "input"}
+	if e.Error() != "event input throttled" {
+		t.Error("ThrottledError string mismatch")
+	}
+}
+
+func TestSnapshotError(t *testing.T) {
+	e := SnapshotError{Msg: "unknown state foo"}
+	if e.Error() != "invalid snapshot: unknown state foo" {
+		t.Error("SnapshotError string mismatch")
+	}
+}
+
+func TestNotFoundError(t *testing.T) {
+	e := NotFoundError{ID: "door-1"}
+	if e.Error() != "instance door-1 not found" {
+		t.Error("NotFoundError string mismatch")
+	}
+}
+
+func TestConflictError(t *testing.T) {
+	e := ConflictError{ID: "door-1", Sequence: 2}
+	if e.Error() != "instance door-1: sequence 2 already saved" {
+		t.Error("ConflictError string mismatch")
+	}
+}
+
+func TestStoreError(t *testing.T) {
+	err := errors.New("down")
+	e := StoreError{ID: "door-1", Err: err}
+	if e.Error() != "store instance door-1: down" {
+		t.Error("StoreError string mismatch")
+	}
+	if !errors.Is(e, err) {
+		t.Error("expected StoreError to unwrap")
+	}
+}
+
+func TestHistoryError(t *testing.T) {
+	err := errors.New("unsupported type")
+	e := HistoryError{Sequence: 3, Err: err}
+	if e.Error() != "history sequence 3: unsupported type" {
+		t.Error("HistoryError string mismatch")
+	}
+	if !errors.Is(e, err) {
+		t.Error("expected HistoryError to unwrap")
+	}
+}
+
+func TestLogError(t *testing.T) {
+	err := errors.New("disk full")
+	e := LogError{Sequence: 3, Err: err}
+	if e.Error() != "log sequence 3: disk full" {
+		t.Error("LogError string mismatch")
+	}
+	if !errors.Is(e, err) {
+		t.Error("expected LogError to unwrap")
+	}
+}
+
+func TestReplayError(t *testing.T) {
+	e := ReplayError{Sequence: 3, Msg: "unknown event open"}
+	if e.Error() != "replay sequence 3: unknown event open" {
+		t.Error("ReplayError string mismatch")
+	}
+}
+
+func TestInvalidChoiceError(t *testing.T) {
+	e := InvalidChoiceError{Event: "submit", Dst: "lost"}
+	if e.Error() != "event submit chose unknown destination lost" {
+		t.Error("InvalidChoiceError string mismatch")
+	}
+}
+
+func TestDuplicateEventError(t *testing.T) {
+	e := DuplicateEventError{Event: "pay"}
+	if e.Error() != "event pay is a duplicate" {
+		t.Error("DuplicateEventError string mismatch")
+	}
+}
+
+func TestAbortedError(t *testing.T) {
+	e := AbortedError{Event: "pay", Err: context.Canceled}
+	if e.Error() != "event pay aborted: context canceled" {
+		t.Error("AbortedError string mismatch")
+	}
+	e.Committed = true
+	if e.Error() != "event pay aborted after the state changed: context canceled" {
+		t.Error("AbortedError string mismatch")
+	}
+	if !errors.Is(e, context.Canceled) {
+		t.Error("expected the error of the context")
+	}
+}
+
+func TestBatchError(t *testing.T) {
+	e := BatchError{Index: 1, Event: "pay", Err: UnknownEventError{Event: "pay"}}
+	if e.Error() != "batch event 1 (pay) failed: event pay does not exist" {
+		t.Error("BatchError string mismatch")
+	}
+	if _, ok := e.Unwrap().(UnknownEventError); !ok {
+		t.Error("expected the error of the event")
+	}
+}
+
+func TestUnknownStateError(t *testing.T) {
+	e := UnknownStateError{State: "lost"}
+	if e.Error() != "state lost does not exist" {
+		t.Error("UnknownStateError string mismatch")
+	}
+}
+
+func TestInstanceExistsError(t *testing.T) {
+	e := InstanceExistsError{ID: "order-1"}
+	if e.Error() != "instance order-1 already exists" {
+		t.Error("InstanceExistsError string mismatch")
+	}
+}
+
+func TestUnknownCallbackError(t *testing.T) {
+	e := UnknownCallbackError{Callback: "before_rn", Target: "rn"}
+	if e.Error() != "callback before_rn for unknown event or state rn" {
+		t.Error("UnknownCallbackError string mismatch")
+	}
+}
+
 func TestInternalError(t *testing.T) {
 	e := InternalError{}
 	if e.Error() != "internal error on state transition" {
 		t.Error("InternalError string mismatch")
 	}
 }
+
+func TestSentinelErrors(t *testing.T) {
+	tests := []struct {
+		err      error
+		sentinel error
+	}{
+		{InvalidEventError{Event: "open", State: "open"}, ErrInvalidEvent},
+		{UnknownEventError{Event: "fly"}, ErrUnknownEvent},
+		{InTransitionError{Event: "open"}, ErrInTransition},
+		{GuardFailedError{Event: "open"}, ErrGuardFailed},
+		{QueuedError{Event: "open"}, ErrQueued},
+		{NotInTransitionError{}, ErrNotInTransition},
+		{NoTransitionError{}, ErrNoTransition},
+		{CanceledError{}, ErrCanceled},
+		{AsyncError{}, ErrAsync},
+		{ForwardCycleError{State: "a"}, ErrForwardCycle},
+		{MailboxFullError{Event: "open"}, ErrMailboxFull},
+		{ActorClosedError{Event: "open"}, ErrActorClosed},
+		{DebouncedError{Event: "open"}, ErrDebounced},
+		{DuplicateEventError{Event: "open"}, ErrDuplicateEvent},
+		{ThrottledError{Event: "open"}, ErrThrottled},
+		{NotFoundError{ID: "a"}, ErrNotFound},
+		{ConflictError{ID: "a"}, ErrConflict},
+		{InvalidChoiceError{Event: "open"}, ErrInvalidChoice},
+		{AbortedError{Event: "open", Err: context.Canceled}, ErrAborted},
+		{UnknownStateError{State: "a"}, ErrUnknownState},
+		{InstanceExistsError{ID: "a"}, ErrInstanceExists},
+		{UnknownCallbackError{Callback: "enter_a", Target: "a"}, ErrUnknownCallback},
+		{ConflictingTransitionError{Event: "go", Src: "a"}, ErrConflictingTransition},
+		{ManagerStoppedError{ID: "a"}, ErrManagerStopped},
+		{ShutdownError{}, ErrShutdown},
+		{StateLimitError{State: "a"}, ErrStateLimit},
+		{InternalError{}, ErrInternal},
+	}
+	for _, test := range tests {
+		if !errors.Is(test.err, test.sentinel) {
+			t.Errorf("expected %T to match %v", test.err, test.sentinel)
+		}
+		if wrapped := fmt.Errorf("wrapped: %w", test.err); !errors.Is(wrapped, test.sentinel) {
+			t.Errorf("expected wrapped %T to match %v", test.err, test.sentinel)
+		}
+		for _, other := range tests {
+			if other.sentinel != test.sentinel && errors.Is(test.err, other.sentinel) {
+				t.Errorf("expected %T not to match %v", test.err, other.sentinel)
+			}
+		}
+	}
+}
+
+func TestErrorsAs(t *testing.T) {
+	err := fmt.Errorf("order 1: %w", BatchError{Index: 2, Event: "pay", Err: InvalidEventError{Event: "pay", State: "cart"}})
+	var invalid InvalidEventError
+	if !errors.As(err, &invalid) || invalid.State != "cart" {
+		t.Error("expected InvalidEventError to be extracted from the batch error")
+	}
+	if !errors.Is(err, ErrInvalidEvent) {
+		t.Error("expected the batch error to match ErrInvalidEvent")
+	}
+
+	reason := errors.New("out of stock")
+	for _, err := range []error{CanceledError{Err: reason}, NoTransitionError{Err: reason}, AsyncError{Err: reason}} {
+		if !errors.Is(err, reason) {
+			t.Errorf("expected %T to wrap the error of the callback", err)
+		}
+	}
+}
@@ -14,6 +14,12 @@
 
 package fsm
 
+import (
+	"context"
+	"sync"
+	"time"
+)
+
 // Event is the info that get passed as a reference in the callbacks.
 type Event struct {
 	// FSM is a reference to the current FSM.
@@ -39,17 +45,144 @@ type Event struct {
 
 	// async is an internal flag set if the transition should be asynchronous
 	async bool
+
+	// ctx is the context of the transition, canceled if the transition is.
+	// It is only created when needed, as a child of parent, and guarded by
+	// ctxMu.
+	ctx    context.Context
+	parent context.Context
+	ctxMu  sync.Mutex
+
+	// released is set once the transition is over, and parentDone if the
+	// parent context was canceled before that.
+	released   bool
+	parentDone bool
+
+	// cancelCtx cancels ctx.
+	cancelCtx context.CancelFunc
+
+	// stopCtx stops canceling ctx when the parent context is canceled.
+	stopCtx func() bool
+
+	// trace records the callbacks called so far during the transition.
+	trace []Phase
+
+	// class is the classification of Err given to Fail.
+	class ErrorClass
+
+	// start is when the transition started, set if the FSM has metrics.
+	start time.Time
+
+	// exposed is set once the event is given to a callback or other user
+	// code, which may keep it, so that it is not recycled.
+	exposed bool
+
+	// aborted is the error of the parent context, set if it was done before
+	// a callback, see done.
+	aborted error
+
+	// forced is set for the transitions of ForceState, which do not call the
+	// event callbacks nor the action of a transition.
+	forced bool
+}
+
+// eventPool holds events for reuse, so that transitions that never expose
+// their event do not allocate one.
+var eventPool = sync.Pool{
+	New: func() interface{} {
+		return new(Event)
+	},
+}
+
+// newEvent returns an event from the pool.
+func newEvent(f *FSM, event, src, dst string, args []interface{}) *Event {
+	e := eventPool.Get().(*Event)
+	e.FSM, e.Event, e.Src, e.Dst, e.Args = f, event, src, dst, args
+	return e
+}
+
+// recycle puts e back in the pool, unless it was exposed. The transition of
+// e must be over.
+func (e *Event) recycle() {
+	if e.exposed {
+		return
+	}
+	*e = Event{}
+	eventPool.Put(e)
+}
+
+// ErrorClass classifies an error set by a callback, so that callers can tell
+// failures worth retrying from permanent ones.
+type ErrorClass int
+
+const (
+	// Unclassified is the class of errors set directly on Event.Err.
+	Unclassified ErrorClass = iota
+
+	// Retryable errors are transient, for example a failed network call, and
+	// the event may succeed if sent again.
+	Retryable
+
+	// Terminal errors are permanent, for example a validation failure, and
+	// sending the event again will not help.
+	Terminal
+)
+
+// Phase is a callback that was called during a transition.
+type Phase struct {
+	// Action is the action the callback was called with, e.g.
+	// ActionBeforeEvent.
+	Action string
+
+	// Callback is the full version of the key of the callback, e.g.
+	// before_event or enter_open.
+	Callback string
+
+	// Duration is how long the callback took.
+	Duration time.Duration
 }
 
 // Cancel can be called in before_<EVENT> or leave_<STATE> to cancel the
 // current transition before it happens. It takes an opitonal error, which will
 // overwrite e.Err if set before.
+//
+// Canceling the transition also cancels the context returned by Context.
 func (e *Event) Cancel(err ...error) {
+	e.ctxMu.Lock()
 	e.canceled = true
+	cancel := e.cancelCtx
+	e.ctxMu.Unlock()
 
 	if len(err) > 0 {
 		e.Err = err[0]
 	}
+
+	if cancel != nil {
+		cancel()
+	}
+}
+
+// Fail sets e.Err to err, classified as class. The classification is returned
+// with the error by FSM.Event in a CallbackError, see IsRetryable and
+// IsTerminal.
+//
+// As with setting e.Err directly, the transition does not happen if Fail is
+// called before the state has changed.
+func (e *Event) Fail(err error, class ErrorClass) {
+	e.Err = err
+	e.class = class
+}
+
+// SetDst can be called in before_<EVENT> to redirect the current transition
+// to another destination of the event, either EventDesc.DstStates or one of
+// EventDesc.DstChoices. It returns an InvalidChoiceError and leaves e.Dst
+// unchanged for any other state.
+func (e *Event) SetDst(state string) error {
+	if !e.FSM.isDst(eKey{e.Event, e.Src}, state) {
+		return InvalidChoiceError{e.Event, state}
+	}
+	e.Dst = state
+	return nil
 }
 
 // Async can be called in leave_<STATE> to do an asynchronous state transition.
@@ -60,3 +193,100 @@ func (e *Event) Cancel(err ...error) {
 func (e *Event) Async() {
 	e.async = true
 }
+
+// Context returns the context of the transition.
+//
+// The context carries the values of the context given to FSM.EventCtx. It is
+// canceled when the transition is canceled, either by a call to Cancel or to
+// FSM.CancelTransition, or when the context given to FSM.EventCtx is canceled
+// while the transition is in progress. Background work started by a callback,
+// typically after calling Async, should watch it and stop instead of calling
+// Transition on a machine that has already moved on.
+func (e *Event) Context() context.Context {
+	e.ctxMu.Lock()
+	defer e.ctxMu.Unlock()
+	if e.ctx == nil {
+		if e.parent == nil {
+			return context.Background()
+		}
+		e.newContext()
+	}
+	return e.ctx
+}
+
+// Canceled returns a channel that is closed when the transition is canceled.
+//
+// Long running callbacks, or work they started, can select on it to abort
+// early. It is the same as e.Context().Done().
+func (e *Event) Canceled() <-chan struct{} {
+	return e.Context().Done()
+}
+
+// done returns true if the context given to FSM.EventCtx is done, in which
+// case the transition is aborted and no further callback is called.
+func (e *Event) done() bool {
+	if e.aborted != nil {
+		return true
+	}
+	if e.parent == nil {
+		return false
+	}
+	e.aborted = e.parent.Err()
+	return e.aborted != nil
+}
+
+// abortedError returns the AbortedError for e, which was aborted.
+func (e *Event) abortedError(committed bool) AbortedError {
+	return AbortedError{Event: e.Event, Err: e.aborted, Committed: committed, Trace: e.trace}
+}
+
+// setContext sets parent as the parent of the context of the transition, that
+// is detached from it with release once the transition is over.
+//
+// The context is only created by Context, as most transitions never use it.
+func (e *Event) setContext(parent context.Context) {
+	e.ctxMu.Lock()
+	e.ctx, e.cancelCtx, e.stopCtx = nil, nil, nil
+	e.parent, e.released, e.parentDone = parent, false, false
+	e.ctxMu.Unlock()
+}
+
+// newContext creates the context of the transition, as it would be had it
+// been created by setContext. ctxMu must be held.
+func (e *Event) newContext() {
+	ctx, cancel := context.WithCancel(context.WithoutCancel(e.parent))
+	e.ctx = transitionContext{ctx, e.parent}
+	e.cancelCtx = cancel
+	switch {
+	case e.canceled || e.parentDone:
+		cancel()
+	case !e.released:
+		e.stopCtx = context.AfterFunc(e.parent, cancel)
+	}
+}
+
+// release detaches the context of the transition from its parent.
+func (e *Event) release() {
+	e.ctxMu.Lock()
+	defer e.ctxMu.Unlock()
+	if e.released {
+		return
+	}
+	e.released = true
+	if e.stopCtx != nil {
+		e.stopCtx()
+	} else if e.ctx == nil && e.parent != nil {
+		e.parentDone = e.parent.Err() != nil
+	}
+}
+
+// transitionContext is the context of a transition. It reports the deadline
+// of its parent, which cancels it through context.AfterFunc.
+type transitionContext struct {
+	context.Context
+	parent context.Context
+}
+
+func (c transitionContext) Deadline() (time.Time, bool) {
+	return c.parent.Deadline()
+}
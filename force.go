@@ -0,0 +1,127 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"time"
+)
+
+// ForcedEvent is the event name of the transitions of FSM.ForceState, unless
+// given with ForceEvent.
+const ForcedEvent = "force"
+
+// ForceOption configures FSM.ForceState.
+type ForceOption func(*forceConfig)
+
+type forceConfig struct {
+	ctx   context.Context
+	event string
+	args  []interface{}
+}
+
+// ForceEvent sets the event name of the forced transition, as seen by the
+// callbacks, the observers and in the history. It is ForcedEvent by default.
+func ForceEvent(event string) ForceOption {
+	return func(c *forceConfig) {
+		c.event = event
+	}
+}
+
+// ForceArgs sets the arguments of the forced transition.
+func ForceArgs(args ...interface{}) ForceOption {
+	return func(c *forceConfig) {
+		c.args = args
+	}
+}
+
+// ForceContext sets the context of the forced transition, see EventCtx.
+func ForceContext(ctx context.Context) ForceOption {
+	return func(c *forceConfig) {
+		c.ctx = ctx
+	}
+}
+
+// ForceState moves the FSM to state from any state, for example to repair an
+// instance by hand. Unlike SetState it is a transition like any other: the
+// leave_ and enter_ state callbacks are called, the observers are notified,
+// and the transition is recorded by the history, log, store, audit sink,
+// metrics and logger of the FSM. The event callbacks, that is the before_ and
+// after_ callbacks and the <STATE> callbacks called on events, are not
+// called, nor the guards and the action of a transition defined for the
+// event in the current state.
+//
+// The leave_ callbacks can not stop the transition: Cancel, Async and errors
+// set on Event.Err are ignored. An asynchronous transition in progress is
+// canceled, and the queued events are dropped. It returns an
+// UnknownStateError if state is not a state of the FSM.
+//
+// ForceState must not be called from a callback.
+func (f *FSM) ForceState(state string, opts ...ForceOption) error {
+	c := forceConfig{ctx: context.Background(), event: ForcedEvent}
+	for _, opt := range opts {
+		opt(&c)
+	}
+
+	f.eventMu.Lock()
+	defer f.eventMu.Unlock()
+
+	if !f.allStates[state] {
+		return UnknownStateError{state}
+	}
+	f.cancelPending()
+	f.queue = nil
+
+	start := time.Now()
+	e := &Event{FSM: f, Event: c.event, Src: f.Current(), Dst: state, Args: c.args, forced: true}
+	if f.metrics != nil {
+		e.start = start
+		f.metrics.TransitionStarted(e.Event, e.Src, e.Dst)
+	}
+	err := f.force(c.ctx, e)
+	if f.audit != nil {
+		f.auditEvent(c.ctx, e.Event, e.Src, e.Dst, start, err)
+	}
+	return err
+}
+
+// force performs the forced transition e.
+func (f *FSM) force(ctx context.Context, e *Event) error {
+	e.setContext(ctx)
+	if e.Src != e.Dst {
+		for _, key := range []cKey{{e.Src, callbackLeaveState}, {"", callbackLeaveState}} {
+			f.call(key, ActionLeavingState, e)
+		}
+	}
+	if p, ok := e.Err.(CallbackPanicError); ok {
+		e.release()
+		return p
+	}
+	if e.canceled {
+		// Cancel canceled the context of the transition.
+		e.release()
+		e.setContext(ctx)
+	}
+	e.Err, e.canceled, e.async = nil, false, false
+	defer e.release()
+
+	if err := f.commit(e); err != nil {
+		return err
+	}
+	if e.Err != nil {
+		return f.callbackError(e)
+	}
+	return nil
+}
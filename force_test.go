@@ -0,0 +1,100 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestForceState(t *testing.T) {
+	var called []string
+	var observed []string
+	fsm := newOrderFSM(Callbacks{
+		"leave_cart": func(action string, e *Event) {
+			called = append(called, "leave_cart")
+			e.Cancel()
+		},
+		"enter_paid": func(action string, e *Event) {
+			called = append(called, fmt.Sprint("enter_paid:", e.Event, e.Args))
+		},
+		"before_event": func(action string, e *Event) {
+			called = append(called, "before_event")
+		},
+	}, WithHistory(4))
+	fsm.AddObserver(ObserverFunc(func(src, dst, event string) {
+		observed = append(observed, src+">"+dst)
+	}))
+
+	if err := fsm.ForceState("paid", ForceArgs("ticket-1")); err != nil {
+		t.Error(err)
+	}
+	if fsm.Current() != "paid" {
+		t.Error("expected state to be 'paid'")
+	}
+	if fmt.Sprint(called) != "[leave_cart enter_paid:force[ticket-1]]" {
+		t.Error("expected state callbacks, got", called)
+	}
+	if fmt.Sprint(observed) != "[cart>paid]" {
+		t.Error("expected observers to be notified, got", observed)
+	}
+	if h := fsm.History(1); len(h) != 1 || h[0].Event != ForcedEvent || h[0].Src != "cart" {
+		t.Error("expected the transition in the history, got", h)
+	}
+
+	if err := fsm.ForceState("checkout", ForceEvent("repair")); err != nil {
+		t.Error(err)
+	}
+	if h := fsm.History(1); h[0].Event != "repair" {
+		t.Error("expected the event name to be 'repair'")
+	}
+
+	if _, ok := fsm.ForceState("lost").(UnknownStateError); !ok {
+		t.Error("expected 'UnknownStateError'")
+	}
+}
+
+func TestForceStateSkipsEventCallbacks(t *testing.T) {
+	var called []string
+	record := func(name string) Callback {
+		return func(action string, e *Event) {
+			called = append(called, name+":"+action)
+		}
+	}
+	fsm := NewFSM(
+		"checkout",
+		Events{
+			{EvtName: "pay", SrcStates: []string{"checkout"}, DstStates: "paid", Action: func(e *Event) error {
+				called = append(called, "action")
+				return nil
+			}},
+		},
+		Callbacks{
+			"before_event": record("before_event"),
+			"after_event":  record("after_event"),
+			"after_pay":    record("after_pay"),
+			"checkout":     record("checkout"),
+			"leave_state":  record("leave_state"),
+			"enter_state":  record("enter_state"),
+		},
+	)
+
+	if err := fsm.ForceState("paid", ForceEvent("pay")); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(called) != "[leave_state:LeavingState enter_state:EnteringState]" {
+		t.Error("expected only the state callbacks, got", called)
+	}
+}
@@ -25,9 +25,19 @@
 package fsm
 
 import (
-	"github.com/emicklei/dot"
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"runtime/debug"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
 )
 
 // transitioner is an interface for the FSM's transition function.
@@ -41,25 +51,143 @@ type transitioner interface {
 type FSM struct {
 	allStates map[string]bool
 
+	// initial is the state that the FSM was constructed in.
+	initial string
+
+	// finals are the final states, set by WithFinalStates.
+	finals map[string]bool
+
 	// current is the state that the FSM is currently in.
 	current string
 
-	// transitions maps events and source states to destination states.
-	transitions map[eKey]string
+	// currentName points to current, for Current and Is to read without
+	// locking. It is set with setCurrent, to a name from names if possible
+	// so that changing states does not allocate.
+	currentName atomic.Pointer[string]
+	names       map[string]*string
+
+	// seq is the sequence number of the last committed transition.
+	seq uint64
+
+	// last is the last committed transition, if the state was not set since.
+	last Edge
+
+	// epoch is incremented each time the current state changes, so that
+	// timers can tell whether the state they were started in was left.
+	epoch uint64
+
+	// table holds the transitions, with the event descriptions that define
+	// them.
+	table *table
 
 	// callbacks maps events and targers to callback functions.
 	callbacks map[cKey]Callback
 
-	// transition is the internal transition functions used either directly
-	// or when Transition is called in an asynchronous state transition.
-	transition func() error
+	// registered holds the callbacks added by OnBefore, OnLeave, OnEnter and
+	// OnEvent, which are chained into callbacks.
+	registered map[cKey]*registered
+
+	// shared is set while the states, transitions and callbacks are shared
+	// with a Definition or another FSM, see own.
+	shared bool
+
+	// transformers maps events to the transformers of their arguments.
+	transformers map[string][]ArgTransformer
+
+	// forwards maps forwarding states to the events fired on entering them.
+	forwards map[string][]string
+
+	// timeouts maps states to the timeouts started on entering them.
+	timeouts map[string][]timeout
+
+	// timers are the timers running, guarded by timerMu.
+	timers  map[*stateTimer]struct{}
+	timerMu sync.Mutex
+
+	// recoverPanics is set by WithPanicRecovery.
+	recoverPanics bool
+
+	// errorTrace is set by WithErrorTrace.
+	errorTrace bool
+
+	// restoreCallbacks is set by WithRestoreCallbacks.
+	restoreCallbacks bool
+
+	// occupant counts the FSM in the states limited by the Manager it belongs
+	// to, see ManagerStateLimit.
+	occupant *occupant
+
+	// store saves the state of the FSM as instance storeID, set by WithStore.
+	store   Store
+	storeID string
+
+	// log records the committed transitions, set by WithLog.
+	log Log
+
+	// codec encodes what the FSM persists, set by WithCodec.
+	codec Codec
+
+	// history records the last committed transitions, set by WithHistory.
+	history *history
+
+	// batch holds the transitions of the batch in progress, written to the
+	// store, the log and the history once it succeeds, see EventsCtx.
+	batch *batch
+
+	// audit receives the attempted transitions of instance auditID, set by
+	// WithAudit.
+	audit   AuditSink
+	auditID string
+
+	// metrics records the transitions, set by WithMetrics. waits is metrics
+	// if it is a WaitMetrics.
+	metrics Metrics
+	waits   WaitMetrics
+
+	// logger logs the transitions, set by WithLogger.
+	logger *slog.Logger
+
+	// observers and subscriptions are notified of the transitions, guarded
+	// by observerMu and replaced rather than modified. observerMu is not
+	// turned off by WithoutLocking, since Actor.Notifications subscribes
+	// from another goroutine than the one handling the events.
+	observers     []Observer
+	subscriptions []*subscription
+	observerMu    sync.Mutex
+
+	// dedup drops duplicate events, set by WithDeduplication.
+	dedup *dedup
+
+	// eventDescs maps events to the first description given to them.
+	eventDescs map[string]string
+	// stateDescs maps states to their descriptors given to WithStates.
+	stateDescs map[string]*StateDesc
+
+	// metadata is set by SetMetadata, guarded by metadataMu.
+	metadata   map[string]interface{}
+	metadataMu rwMutex
+
+	// middleware is added by Use, and handler is the composed chain, whose
+	// innermost middleware calls tail.
+	middleware []Middleware
+	handler    atomic.Pointer[TransitionFunc]
+	tail       *link
+
+	// transition is the event whose transition is set up, completed by commit
+	// either directly or when Transition is called in an asynchronous state
+	// transition.
+	transition *Event
 	// transitionerObj calls the FSM's transition() function.
 	transitionerObj transitioner
+	// pending is the event of the transition in progress, if any.
+	pending *Event
+	// queue holds the events to run once the transition in progress is done.
+	queue []queuedEvent
 
 	// stateMu guards access to the current state.
-	stateMu sync.RWMutex
+	stateMu rwMutex
 	// eventMu guards access to Event() and Transition().
-	eventMu sync.Mutex
+	eventMu mutex
 }
 
 // EventDesc represents an event when initializing the FSM.
@@ -78,24 +206,158 @@ type EventDesc struct {
 	// DstStates is the destination state that the FSM will be in if the transition
 	// succeds.
 	DstStates string
+
+	// DstChoices are other destination states that Choose can select.
+	DstChoices []string
+
+	// Choose selects the destination state when the event occurs, for
+	// example from the arguments of the event: DstStates or one of
+	// DstChoices, or the empty string for DstStates. It is called after the
+	// arguments are transformed and before the guards, which see the
+	// selected state in Event.Dst. Any other state rejects the event with an
+	// InvalidChoiceError.
+	Choose func(e *Event) string
+
+	// Action is called for the transition once the state callbacks before
+	// it are done and right before the state changes, between the leave_ and
+	// enter_ callbacks. If it returns an error the transition does not happen
+	// and FSM.Event returns the error as if it was set on Event.Err.
+	Action func(e *Event) error
+
+	// Description documents the event. It is shown in the diagrams of
+	// ToDOT and in InvalidEventError.
+	Description string
+
+	// Tags are labels of the event, such as "admin" or "billing", shown in
+	// the diagrams of ToDOT.
+	Tags []string
+
+	// Internal marks the event as an internal transition: the FSM stays in
+	// each of the source states, and only the before_ and after_ event
+	// callbacks are called, never the leave_, enter_ or on_ state callbacks.
+	// DstStates, DstChoices and Choose are ignored.
+	Internal bool
+
+	// Guards are conditions that must all hold for the transition to happen,
+	// evaluated in order. See Guard.
+	Guards []Guard
+
+	// WhilePending controls whether the event is accepted while an
+	// asynchronous transition is in progress. It is rejected by default.
+	WhilePending PendingPolicy
+
+	// Priority orders the events queued with QueueWhilePending, and those of
+	// the mailbox of an Actor: the event runs before the queued events with
+	// a lower priority, and after those with the same or a higher one. The
+	// default priority is 0, and it can be negative for bulk events.
+	Priority int
+}
+
+// StateDesc declares the entry and exit actions of a state, given to
+// WithStates.
+type StateDesc struct {
+	// Name is the state name.
+	Name string
+
+	// OnEnter is called after entering the state, as an enter_<STATE>
+	// callback. With WithRestoreCallbacks it is also called for a FSM
+	// restored in the state, with an Event with no name.
+	OnEnter func(e *Event)
+
+	// NonReplayable makes OnEnter skipped for a FSM restored in the state,
+	// as NonReplayable does for callbacks, for entry actions with external
+	// side effects such as sending an email.
+	NonReplayable bool
+
+	// OnExit is called before leaving the state, as a leave_<STATE>
+	// callback. It can cancel the transition or make it asynchronous.
+	OnExit func(e *Event)
+
+	// Description documents the state. It is shown in the diagrams of ToDOT
+	// and ToMermaid.
+	Description string
+
+	// Tags are labels of the state, shown in the diagrams of ToDOT.
+	Tags []string
 }
 
+// PendingPolicy controls how an event is handled while an asynchronous
+// transition is in progress.
+type PendingPolicy int
+
+const (
+	// RejectWhilePending rejects the event with an InTransitionError.
+	RejectWhilePending PendingPolicy = iota
+
+	// AcceptWhilePending handles the event right away. The transition in
+	// progress is resumed afterwards, unless the event changed the state or
+	// started an asynchronous transition of its own, in which case it is
+	// canceled as with CancelTransition.
+	AcceptWhilePending
+
+	// QueueWhilePending queues the event, and returns a QueuedError. Queued
+	// events run in order of EventDesc.Priority, then in the order they were
+	// queued, as soon as the transition in progress completes or is canceled.
+	QueueWhilePending
+)
+
 const ActionBeforeEvent = "BeforeEvent"
 const ActionLeavingState = "LeavingState"
 const ActionEnteringState = "EnteringState"
 const ActionOnEvent = "OnEvent"
 const ActionAfterEvent = "AfterEvent"
+const ActionUnhandled = "Unhandled"
+const ActionRestoringState = "RestoringState"
 
 // Callback is a function type that callbacks should use. Event is the current
 // event info as the callback happens.
 type Callback func(string, *Event)
 
+// Chain returns a callback that calls callbacks in order, so that several
+// handlers, such as instrumentation and business logic, can be registered for
+// the same key:
+//
+//	fsm.Callbacks{
+//		"enter_state": fsm.Chain(logTransition, saveOrder),
+//	}
+//
+// If a callback cancels the event, the ones after it are not called.
+func Chain(callbacks ...Callback) Callback {
+	return func(action string, e *Event) {
+		for _, cb := range callbacks {
+			if cb == nil {
+				continue
+			}
+			cb(action, e)
+			if e.canceled {
+				return
+			}
+		}
+	}
+}
+
+// ArgTransformer is a function that transforms the arguments of an event, for
+// example decoding a payload or redacting personal data. It returns the new
+// arguments, or an error to reject the event.
+type ArgTransformer func(args []interface{}) ([]interface{}, error)
+
+// TransitionFunc handles an event sent to the FSM with EventCtx.
+type TransitionFunc func(ctx context.Context, event string, args []interface{}) error
+
+// Middleware wraps the handling of events, to add cross-cutting concerns such
+// as logging, metrics or authorization. It returns a TransitionFunc that
+// usually calls next, but may also reject the event or change its arguments.
+type Middleware func(next TransitionFunc) TransitionFunc
+
 // Events is a shorthand for defining the transition map in NewFSM.
 type Events []EventDesc
 
 // Callbacks is a shorthand for defining the callbacks in NewFSM.a
 type Callbacks map[string]Callback
 
+// States is a shorthand for declaring states in WithStates.
+type States []StateDesc
+
 // NewFSM constructs a FSM from events and callbacks.
 //
 // The events and transitions are specified as a slice of Event structs
@@ -128,130 +390,371 @@ type Callbacks map[string]Callback
 //
 // 2. <EVENT> - called after event named <EVENT>
 //
-// If both a shorthand version and a full version is specified it is undefined
-// which version of the callback will end up in the internal map. This is due
-// to the psuedo random nature of Go maps. No checking for multiple keys is
-// currently performed.
-func NewFSM(initial string, events []EventDesc, callbacks map[string]Callback) *FSM {
-	f := &FSM{
-		transitionerObj: &transitionerStruct{},
-		current:         initial,
-		transitions:     make(map[eKey]string),
-		callbacks:       make(map[cKey]Callback),
-	}
-
-	// Build transition map and store sets of all events and states.
-	allEvents := make(map[string]bool)
-	f.allStates = make(map[string]bool)
-	for _, e := range events {
-		for _, src := range e.SrcStates {
-			f.transitions[eKey{e.EvtName, src}] = e.DstStates
-			f.allStates[src] = true
-			f.allStates[e.DstStates] = true
-		}
-		allEvents[e.EvtName] = true
-	}
-
-	// Map all callbacks to events/states.
-	for name, fn := range callbacks {
-		var target string
-		var callbackType int
-
-		switch {
-		case strings.HasPrefix(name, "before_"):
-			target = strings.TrimPrefix(name, "before_")
-			if target == "event" {
-				target = ""
-				callbackType = callbackBeforeEvent
-			} else if _, ok := allEvents[target]; ok {
-				callbackType = callbackBeforeEvent
-			}
-		case strings.HasPrefix(name, "leave_"):
-			target = strings.TrimPrefix(name, "leave_")
-			if target == "state" {
-				target = ""
-				callbackType = callbackLeaveState
-			} else if _, ok := f.allStates[target]; ok {
-				callbackType = callbackLeaveState
-			}
-		case strings.HasPrefix(name, "enter_"):
-			target = strings.TrimPrefix(name, "enter_")
-			if target == "state" {
-				target = ""
-				callbackType = callbackEnterState
-			} else if _, ok := f.allStates[target]; ok {
-				callbackType = callbackEnterState
-			}
-		case strings.HasPrefix(name, "after_"):
-			target = strings.TrimPrefix(name, "after_")
-			if target == "event" {
-				target = ""
-				callbackType = callbackAfterEvent
-			} else if _, ok := allEvents[target]; ok {
-				callbackType = callbackAfterEvent
-			}
-		default:
-			target = name
-			if _, ok := f.allStates[target]; ok {
-				callbackType = callbackOnState
-			} else if _, ok := allEvents[target]; ok {
-				callbackType = callbackAfterEvent
+// If both the shorthand and the full version are specified for an event, the
+// full version is used. For a state both are called, enter_<NEW_STATE> first.
+//
+// Events without a transition from the current state are handled by:
+//
+// 1. unhandled_<STATE> - called for such events in <STATE>
+//
+// 2. unhandled_state - called for such events in all states
+//
+// They get e.Err set to the InvalidEventError or UnknownEventError that the
+// event would fail with, and FSM.Event returns e.Err once they are called. A
+// callback can replace the error, or set it to nil to accept the event
+// without a transition.
+//
+// When two event descriptions define the same event from the same source
+// state, NewFSM silently uses the last one. NewFSMStrict reports them with a
+// ConflictingTransitionError unless they are identical.
+//
+// The options are applied in order after the FSM is constructed.
+func NewFSM(initial string, events []EventDesc, callbacks map[string]Callback, opts ...Option) *FSM {
+	f := NewDefinition(events, callbacks).instance(initial)
+	for _, opt := range opts {
+		opt(f)
+	}
+
+	return f
+}
+
+// parseCallback returns the target and type of the callback name, and whether
+// it is a short form callback, given the events and states defined. The type is
+// callbackNone if the target is not defined.
+func parseCallback(name string, allEvents, allStates map[string]bool) (target string, callbackType int, shorthand bool) {
+	switch {
+	case strings.HasPrefix(name, "before_"):
+		target = strings.TrimPrefix(name, "before_")
+		if target == "event" {
+			target = ""
+			callbackType = callbackBeforeEvent
+		} else if _, ok := allEvents[target]; ok {
+			callbackType = callbackBeforeEvent
+		}
+	case strings.HasPrefix(name, "leave_"):
+		target = strings.TrimPrefix(name, "leave_")
+		if target == "state" {
+			target = ""
+			callbackType = callbackLeaveState
+		} else if _, ok := allStates[target]; ok {
+			callbackType = callbackLeaveState
+		}
+	case strings.HasPrefix(name, "enter_"):
+		target = strings.TrimPrefix(name, "enter_")
+		if target == "state" {
+			target = ""
+			callbackType = callbackEnterState
+		} else if _, ok := allStates[target]; ok {
+			callbackType = callbackEnterState
+		}
+	case strings.HasPrefix(name, "unhandled_"):
+		target = strings.TrimPrefix(name, "unhandled_")
+		if target == "state" {
+			target = ""
+			callbackType = callbackUnhandled
+		} else if _, ok := allStates[target]; ok {
+			callbackType = callbackUnhandled
+		}
+	case strings.HasPrefix(name, "after_"):
+		target = strings.TrimPrefix(name, "after_")
+		if target == "event" {
+			target = ""
+			callbackType = callbackAfterEvent
+		} else if _, ok := allEvents[target]; ok {
+			callbackType = callbackAfterEvent
+		}
+	default:
+		target = name
+		shorthand = true
+		if _, ok := allStates[target]; ok {
+			callbackType = callbackOnState
+		} else if _, ok := allEvents[target]; ok {
+			callbackType = callbackAfterEvent
+		}
+	}
+	return target, callbackType, shorthand
+}
+
+// addCallback adds cb for key, after the callback already set for key if any.
+func (f *FSM) addCallback(key cKey, cb Callback) {
+	f.own()
+	if prev, ok := f.callbacks[key]; ok {
+		cb = Chain(prev, cb)
+	}
+	f.callbacks[key] = cb
+}
+
+// destinations returns the destination state of the event followed by its
+// choices, or nil for an internal event.
+func (e EventDesc) destinations() []string {
+	if e.Internal {
+		return nil
+	}
+	return append([]string{e.DstStates}, e.DstChoices...)
+}
+
+// dsts returns the destination states of the transition key, see
+// EventDesc.destinations. It returns nil if there is no such transition.
+func (f *FSM) dsts(key eKey) []string {
+	dst, desc, ok := f.table.find(key.event, key.src)
+	if !ok {
+		return nil
+	}
+	if desc.Internal {
+		return []string{dst}
+	}
+	return append([]string{dst}, desc.DstChoices...)
+}
+
+// isDst returns true if dst is a destination of the transition key, either
+// its destination or one of its choices.
+func (f *FSM) isDst(key eKey, dst string) bool {
+	for _, d := range f.dsts(key) {
+		if d == dst {
+			return true
+		}
+	}
+	return false
+}
+
+// NewFSMStrict constructs a FSM like NewFSM, but returns a
+// ConflictingTransitionError instead of silently using the last definition
+// when two event descriptions define the same event from the same source state
+// differently. Only identical descriptions, which differ at most in their
+// other source states, may define the same transition, see
+// ConflictingTransitionError.Field.
+//
+// NewFSM can not return the error, as its signature predates it, and keeps
+// using the last definition. Use NewFSMStrict, or Events.Validate in tests, to
+// detect conflicts.
+func NewFSMStrict(initial string, events []EventDesc, callbacks map[string]Callback, opts ...Option) (*FSM, error) {
+	if err := checkConflicts(events); err != nil {
+		return nil, err
+	}
+	return NewFSM(initial, events, callbacks, opts...), nil
+}
+
+// checkConflicts returns a ConflictingTransitionError for the first transition
+// that is defined by two different event descriptions.
+func checkConflicts(events []EventDesc) error {
+	defined := make(map[eKey]int)
+	for i := range events {
+		if err := checkConflict(events, i, defined); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkConflict checks events[i] against the transitions defined by the
+// events before it, recorded in defined by event and source state, and
+// records its own.
+func checkConflict(events []EventDesc, i int, defined map[eKey]int) error {
+	e := events[i]
+	for _, src := range e.SrcStates {
+		key := eKey{e.EvtName, src}
+		if j, ok := defined[key]; ok && j != i {
+			if field := conflictingField(events[j], e); field != "" {
+				return ConflictingTransitionError{
+					Event:     e.EvtName,
+					Src:       src,
+					First:     j,
+					Second:    i,
+					FirstDst:  events[j].destinationsFrom(src),
+					SecondDst: e.destinationsFrom(src),
+					Field:     field,
+				}
 			}
 		}
+		defined[key] = i
+	}
+	return nil
+}
+
+// destinationsFrom returns the destinations of the event from src, in order,
+// which is src itself for an internal transition.
+func (e EventDesc) destinationsFrom(src string) []string {
+	if e.Internal {
+		return []string{src}
+	}
+	return e.destinations()
+}
+
+// conflictingField returns the name of the first field of EventDesc, other
+// than EvtName and SrcStates, in which a and b differ, or the empty string if
+// they are identical. Functions are compared by their code, and slices in
+// order.
+func conflictingField(a, b EventDesc) string {
+	switch {
+	case a.Internal != b.Internal:
+		return "Internal"
+	case a.DstStates != b.DstStates:
+		return "DstStates"
+	case !sameStrings(a.DstChoices, b.DstChoices):
+		return "DstChoices"
+	case !sameFunc(a.Choose, b.Choose):
+		return "Choose"
+	case !sameGuards(a.Guards, b.Guards):
+		return "Guards"
+	case !sameFunc(a.Action, b.Action):
+		return "Action"
+	case a.WhilePending != b.WhilePending:
+		return "WhilePending"
+	case a.Priority != b.Priority:
+		return "Priority"
+	case a.Description != b.Description:
+		return "Description"
+	case !sameStrings(a.Tags, b.Tags):
+		return "Tags"
+	}
+	return ""
+}
+
+// sameStrings returns true if a and b have the same elements in the same
+// order.
+func sameStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
 
-		if callbackType != callbackNone {
-			f.callbacks[cKey{target, callbackType}] = fn
+// sameGuards returns true if a and b are the same guards in the same order.
+func sameGuards(a, b []Guard) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Name != b[i].Name || !sameFunc(a[i].Check, b[i].Check) ||
+			!sameGuards(a[i].all, b[i].all) || !sameGuards(a[i].any, b[i].any) {
+			return false
 		}
 	}
+	return true
+}
 
-	return f
+// sameFunc returns true if the functions a and b, possibly nil, have the same
+// code.
+func sameFunc(a, b interface{}) bool {
+	return reflect.ValueOf(a).Pointer() == reflect.ValueOf(b).Pointer()
 }
 
 // Current returns the current state of the FSM.
+//
+// Current does not lock the FSM, so that frequent readers do not contend with
+// transitions.
 func (f *FSM) Current() string {
-	f.stateMu.RLock()
-	defer f.stateMu.RUnlock()
-	return f.current
+	if p := f.currentName.Load(); p != nil {
+		return *p
+	}
+	return ""
+}
+
+// setCurrent sets the current state. stateMu must be locked.
+func (f *FSM) setCurrent(state string) {
+	f.current = state
+	if p, ok := f.names[state]; ok {
+		f.currentName.Store(p)
+	} else {
+		name := state
+		f.currentName.Store(&name)
+	}
 }
 
 // Is returns true if state is the current state.
 func (f *FSM) Is(state string) bool {
+	return state == f.Current()
+}
+
+// IsAny returns true if the current state is one of states.
+func (f *FSM) IsAny(states ...string) bool {
+	current := f.Current()
+	for _, state := range states {
+		if state == current {
+			return true
+		}
+	}
+	return false
+}
+
+// IsNot returns true if the current state is none of states. It is a
+// convenience method to help code read nicely.
+func (f *FSM) IsNot(states ...string) bool {
+	return !f.IsAny(states...)
+}
+
+// Sequence returns the sequence number of the last committed transition.
+//
+// Every transition that changes the current state, including transitions to
+// the same state, increments the sequence number by one, starting from zero.
+// Consumers of transitions can use it to detect duplicates and gaps.
+func (f *FSM) Sequence() uint64 {
 	f.stateMu.RLock()
 	defer f.stateMu.RUnlock()
-	return state == f.current
+	return f.seq
 }
 
 // SetState allows the user to move to the given state from current state.
 // The call does not trigger any callbacks, if defined.
+//
+// Timers of the previous state, see Timeout, are stopped. Those of the new
+// state are not started.
 func (f *FSM) SetState(state string) {
 	f.stateMu.Lock()
-	defer f.stateMu.Unlock()
-	f.current = state
-	return
+	changed := f.current != state
+	f.setCurrent(state)
+	f.last = Edge{}
+	if changed {
+		f.epoch++
+	}
+	f.stateMu.Unlock()
+
+	if changed {
+		f.stopTimers()
+		if f.occupant != nil {
+			f.occupant.move(state)
+		}
+	}
 }
 
 // Can returns true if event can occur in the current state.
 func (f *FSM) Can(event string) bool {
 	f.stateMu.RLock()
 	defer f.stateMu.RUnlock()
-	_, ok := f.transitions[eKey{event, f.current}]
-	return ok && (f.transition == nil)
+	_, desc, ok := f.table.find(event, f.current)
+	return ok && (f.transition == nil || desc.WhilePending == AcceptWhilePending)
 }
 
-// AvailableTransitions returns a list of transitions avilable in the
+// AvailableTransitions returns a sorted list of transitions avilable in the
 // current state.
 func (f *FSM) AvailableTransitions() []string {
 	f.stateMu.RLock()
 	defer f.stateMu.RUnlock()
-	var transitions []string
-	for key := range f.transitions {
-		if key.src == f.current {
-			transitions = append(transitions, key.event)
-		}
+	transitions := f.table.from(f.current)
+	if len(transitions) == 0 {
+		return nil
 	}
+	sort.Strings(transitions)
 	return transitions
 }
 
+// Lookup returns the event description that defines the transition for event
+// from state, and whether there is one. Guards are not evaluated.
+func (f *FSM) Lookup(event, state string) (EventDesc, bool) {
+	f.stateMu.RLock()
+	defer f.stateMu.RUnlock()
+	_, desc, ok := f.table.find(event, state)
+	if !ok {
+		return EventDesc{}, false
+	}
+	return *desc, true
+}
+
 // Cannot returns true if event can not occure in the current state.
 // It is a convenience method to help code read nicely.
 func (f *FSM) Cannot(event string) bool {
@@ -261,107 +764,637 @@ func (f *FSM) Cannot(event string) bool {
 // Event initiates a state transition with the named event.
 //
 // The call takes a variable number of arguments that will be passed to the
-// callback, if defined.
+// callback, if defined, after being transformed by the transformers added with
+// AddArgTransformer.
 //
 // It will return nil if the state change is ok or one of these errors:
 //
 // - event X inappropriate because previous transition did not complete
 //
+// - event X queued until the transition in progress completes
+//
 // - event X inappropriate in current state Y
 //
 // - event X does not exist
 //
+// - event X in state Y rejected by guard Z
+//
+// - forwarding loops back to state X
+//
+// - log sequence N: ..., when the transition could not be logged
+//
+// - store instance X: ..., when the new state could not be saved
+//
 // - internal error on state transition
 //
 // The last error should never occur in this situation and is a sign of an
 // internal bug.
 func (f *FSM) Event(event string, args ...interface{}) error {
+	return f.EventCtx(context.Background(), event, args...)
+}
+
+// EventAsync initiates a state transition with the named event, like Event,
+// on a goroutine of its own. It returns without waiting for the callbacks, and
+// the error of the event is sent on the returned channel, which has room for
+// it so that it can be ignored.
+//
+// Events fired with EventAsync are handled in no particular order, use an
+// Actor to handle them in the order they are sent. This is unrelated to
+// asynchronous transitions, see Event.Async.
+func (f *FSM) EventAsync(event string, args ...interface{}) <-chan error {
+	result := make(chan error, 1)
+	go func() {
+		result <- f.Event(event, args...)
+	}()
+	return result
+}
+
+// EventCtx initiates a state transition with the named event, like Event.
+//
+// The context of the transition, returned by Event.Context in the callbacks,
+// carries the values of ctx and is canceled when ctx is. Once ctx is done, no
+// further callback is called and an AbortedError tells whether the state
+// changed.
+func (f *FSM) EventCtx(ctx context.Context, event string, args ...interface{}) error {
+	if h := f.handler.Load(); h != nil {
+		return (*h)(ctx, event, args)
+	}
+	return f.eventCtx(ctx, event, args)
+}
+
+// Use adds middleware around Event and EventCtx. The first middleware added
+// is the outermost, and sees the event first.
+//
+// Each middleware is called once, when it is added, so that middleware
+// keeping state, such as Debounce and Throttle, keeps it when more is added.
+// Middleware added later runs inside the middleware added before, including
+// for the events it passes on later, such as debounced events.
+//
+// The middleware runs before the FSM is locked for the event, so it may call
+// methods of the FSM. Events fired by forwarding or run from the queue, and
+// transitions completed by Transition, are part of the call that caused them
+// and do not go through the middleware again.
+func (f *FSM) Use(middleware ...Middleware) {
 	f.eventMu.Lock()
 	defer f.eventMu.Unlock()
 
+	for _, m := range middleware {
+		l := &link{}
+		inner := TransitionFunc(f.eventCtx)
+		l.next.Store(&inner)
+		h := m(l.call)
+		if f.tail == nil {
+			f.handler.Store(&h)
+		} else {
+			f.tail.next.Store(&h)
+		}
+		f.tail = l
+	}
+	f.middleware = append(f.middleware, middleware...)
+}
+
+// link is the next handler of a middleware, which is the middleware added
+// after it, if any, so that adding middleware does not compose again the
+// middleware already added.
+type link struct {
+	next atomic.Pointer[TransitionFunc]
+}
+
+// call calls the next handler.
+func (l *link) call(ctx context.Context, event string, args []interface{}) error {
+	return (*l.next.Load())(ctx, event, args)
+}
+
+// eventCtx performs EventCtx without middleware.
+func (f *FSM) eventCtx(ctx context.Context, event string, args []interface{}) error {
+	if f.waits != nil {
+		start := time.Now()
+		f.eventMu.Lock()
+		f.waits.LockWaited(event, time.Since(start))
+	} else {
+		f.eventMu.Lock()
+	}
+	defer f.eventMu.Unlock()
+	return f.dispatch(ctx, event, args)
+}
+
+// dispatch handles an event without locking eventMu.
+func (f *FSM) dispatch(ctx context.Context, event string, args []interface{}) error {
+	if f.dedup != nil && f.duplicate(event, args) {
+		return DuplicateEventError{event}
+	}
+	if f.transition != nil {
+		err := f.eventWhilePending(ctx, event, args)
+		if f.dedup != nil {
+			f.handled(event, args, err)
+		}
+		return err
+	}
+	err := f.event(ctx, event, args...)
+	if f.dedup != nil {
+		f.handled(event, args, err)
+	}
+	if err != nil {
+		return err
+	}
+	return f.forward(ctx)
+}
+
+// event performs EventCtx without locking eventMu, recording the attempt in
+// the metrics, the logger and the audit sink, if any.
+func (f *FSM) event(ctx context.Context, event string, args ...interface{}) error {
+	if f.audit == nil && f.metrics == nil && f.logger == nil {
+		return f.doEvent(ctx, event, args...)
+	}
+	start := time.Now()
 	f.stateMu.RLock()
-	defer f.stateMu.RUnlock()
+	src, seq := f.current, f.seq
+	f.stateMu.RUnlock()
+
+	err := f.doEvent(ctx, event, args...)
+
+	f.stateMu.RLock()
+	dst, _, _ := f.table.find(event, src)
+	committed := f.seq != seq
+	if committed {
+		dst = f.current
+	}
+	f.stateMu.RUnlock()
+
+	if _, ok := err.(AsyncError); err != nil && !committed && !ok {
+		if f.metrics != nil {
+			f.metrics.TransitionRejected(event, src, dst, err)
+		}
+		if f.logger != nil {
+			f.logRejected(ctx, event, src, err)
+		}
+	}
+	if f.audit != nil {
+		f.auditEvent(ctx, event, src, dst, start, err)
+	}
+	return err
+}
+
+// doEvent performs EventCtx without locking eventMu.
+func (f *FSM) doEvent(ctx context.Context, event string, args ...interface{}) error {
+	var err error
 
 	if f.transition != nil {
 		return InTransitionError{event}
 	}
 
-	dst, ok := f.transitions[eKey{event, f.current}]
+	// stateMu is not held while the callbacks run, so that they can call
+	// Can, Sequence and the like even when SetState waits for it.
+	f.stateMu.RLock()
+	src := f.current
+	dst, desc, ok := f.table.find(event, src)
+	f.stateMu.RUnlock()
 	if !ok {
-		for ekey := range f.transitions {
-			if ekey.event == event {
-				return InvalidEventError{event, f.current}
+		err = f.unknownEvent(event)
+		if f.table.hasEvent(event) {
+			err = f.invalidEvent(event, src)
+		}
+		return f.unhandledCallbacks(ctx, event, args, err)
+	}
+
+	for _, t := range f.transformers[event] {
+		if args, err = t(args); err != nil {
+			return err
+		}
+	}
+
+	e := newEvent(f, event, src, dst, args)
+	e.setContext(ctx)
+	defer func() {
+		if f.pending != e {
+			e.release()
+			e.recycle()
+		}
+	}()
+	if desc.Choose != nil && !desc.Internal {
+		e.exposed = true
+		if choice := desc.Choose(e); choice != "" {
+			if !f.isDst(eKey{event, src}, choice) {
+				return InvalidChoiceError{event, choice}
 			}
+			dst, e.Dst = choice, choice
 		}
-		return UnknownEventError{event}
+	}
+	if f.metrics != nil {
+		e.start = time.Now()
+		f.metrics.TransitionStarted(event, e.Src, dst)
 	}
 
-	e := &Event{f, event, f.current, dst, nil, args, false, false}
+	err = f.checkGuards(e)
+	if err != nil {
+		return err
+	}
 
-	err := f.beforeEventCallbacks(e)
+	err = f.beforeEventCallbacks(e)
 	if err != nil {
 		return err
 	}
+	dst = e.Dst
 
 	// Setup the transition, call it later.
-	f.transition = func() error {
-
-		dontSendStateCallbacks := false
-		if f.current == dst {
-			dontSendStateCallbacks = true
-		}
+	f.transition = e
 
-		if err = f.onStateCallbacks(e); err != nil {
+	if src != dst {
+		if err = f.leaveStateCallbacks(e); err != nil {
+			if _, ok := err.(AsyncError); ok {
+				f.pending = e
+			} else {
+				f.transition = nil
+			}
 			return err
 		}
+	}
 
-		if e.Err != nil {
-			return nil
-		}
+	// Perform the rest of the transition, if not asynchronous.
+	err = f.doTransition()
 
-		if e.canceled {
-			e.Err = CanceledError{e.Err}
-			return nil
-		}
+	if p, ok := err.(CallbackPanicError); ok {
+		return p
+	}
+	if s, ok := err.(StoreError); ok {
+		return s
+	}
+	if l, ok := err.(LogError); ok {
+		return l
+	}
+	if h, ok := err.(HistoryError); ok {
+		return h
+	}
+	if a, ok := err.(AbortedError); ok {
+		return a
+	}
+	if l, ok := err.(StateLimitError); ok {
+		return l
+	}
+	if err != nil {
+		return InternalError{}
+	}
+
+	if e.Err == nil {
+		return nil
+	}
+	if _, ok := e.Err.(CanceledError); ok {
+		return e.Err
+	}
+	return f.callbackError(e)
+}
+
+// callbackError returns the error set on e by a callback, in a CallbackError
+// if the FSM was created with WithErrorTrace or the error was set with
+// Event.Fail.
+func (f *FSM) callbackError(e *Event) error {
+	if !f.errorTrace && e.class == Unclassified {
+		return e.Err
+	}
+	return CallbackError{Err: e.Err, Trace: e.trace, Class: e.class}
+}
 
-		f.stateMu.Lock()
-		f.current = dst
-		f.stateMu.Unlock()
+// commit performs the rest of the transition of e once its leave_<STATE>
+// callbacks are done, either directly or when Transition is called.
+func (f *FSM) commit(e *Event) error {
+	dontSendStateCallbacks := false
+	if f.current == e.Dst {
+		dontSendStateCallbacks = true
+	}
 
-		if !dontSendStateCallbacks {
-			f.enterStateCallbacks(e)
+	if _, desc, _ := f.table.find(e.Event, e.Src); !e.forced && (desc == nil || !desc.Internal) {
+		if err := f.onStateCallbacks(e); err != nil {
+			return err
 		}
-		f.afterEventCallbacks(e)
+	}
 
+	if p, ok := e.Err.(CallbackPanicError); ok {
+		return p
+	}
+	if e.Err != nil {
 		return nil
 	}
 
-	if f.current != dst {
-		if err = f.leaveStateCallbacks(e); err != nil {
-			if _, ok := err.(CanceledError); ok {
-				f.transition = nil
+	if e.canceled {
+		e.Err = CanceledError{Err: e.Err, Trace: e.trace}
+		return nil
+	}
+	if e.done() {
+		return e.abortedError(false)
+	}
+
+	if !e.forced {
+		f.runAction(e)
+	}
+	if p, ok := e.Err.(CallbackPanicError); ok {
+		return p
+	}
+	if e.Err != nil {
+		return nil
+	}
+
+	var t, recorded Transition
+	if f.history != nil || f.log != nil || f.store != nil {
+		t = f.transitionOf(e)
+	}
+	if f.history != nil {
+		var err error
+		if recorded, err = recordTransition(t, f.codec); err != nil {
+			return err
+		}
+	}
+
+	// Reserve room in the destination state, if limited, and save the
+	// transition before committing it, so that the FSM does not get ahead of
+	// its store and log when they refuse it.
+	var entered func(committed bool)
+	if f.occupant != nil && !dontSendStateCallbacks {
+		var err error
+		if entered, err = f.occupant.enter(e.Context(), e.Dst); err != nil {
+			return err
+		}
+	}
+	if f.history != nil || f.log != nil || f.store != nil {
+		if err := f.persist(e.Context(), t, recorded); err != nil {
+			if entered != nil {
+				entered(false)
 			}
 			return err
 		}
 	}
 
-	// Perform the rest of the transition, if not asynchronous.
-	f.stateMu.RUnlock()
-	err = f.doTransition()
-	f.stateMu.RLock()
+	f.stateMu.Lock()
+	f.setCurrent(e.Dst)
+	f.last = Edge{e.Event, e.Src, e.Dst}
+	f.seq++
+	seq := f.seq
+	if !dontSendStateCallbacks {
+		f.epoch++
+	}
+	f.stateMu.Unlock()
+	if entered != nil {
+		entered(true)
+	}
 
-	if err != nil {
-		return InternalError{}
+	// During a batch, the metrics, observers and subscribers are only
+	// notified once it succeeds, see EventsCtx.
+	if f.batch != nil {
+		f.batch.notifications = append(f.batch.notifications, batchNotification{e.Event, e.Src, e.Dst, e.Args, seq, time.Since(e.start)})
+	} else if f.metrics != nil {
+		f.metrics.TransitionCompleted(e.Event, e.Src, e.Dst, time.Since(e.start))
+	}
+	if f.logger != nil {
+		f.logTransition(e)
+	}
+	if f.history != nil && f.batch == nil {
+		f.history.add(recorded)
 	}
 
-	return e.Err
+	if !dontSendStateCallbacks {
+		f.stopTimers()
+		f.startTimeouts()
+	}
+
+	if !dontSendStateCallbacks {
+		f.enterStateCallbacks(e)
+	}
+	if !e.forced {
+		f.afterEventCallbacks(e)
+	}
+	if f.batch == nil {
+		f.notifyObservers(e.Src, e.Dst, e.Event, e.Args, seq)
+	}
+
+	if p, ok := e.Err.(CallbackPanicError); ok {
+		return p
+	}
+	if e.aborted != nil {
+		return e.abortedError(true)
+	}
+	return nil
+}
+
+// AddArgTransformer registers a transformer for the arguments of event.
+//
+// The transformers of an event run in the order they were added, each getting
+// the arguments returned by the previous one, once the event has been found
+// valid in the current state and before any callback is called. If a
+// transformer returns an error the event is rejected with that error.
+//
+// AddArgTransformer must not be called from a callback.
+func (f *FSM) AddArgTransformer(event string, t ArgTransformer) {
+	f.eventMu.Lock()
+	defer f.eventMu.Unlock()
+	if f.transformers == nil {
+		f.transformers = make(map[string][]ArgTransformer)
+	}
+	f.transformers[event] = append(f.transformers[event], t)
 }
 
 // Transition wraps transitioner.transition.
+//
+// Events queued while the transition was in progress run right after it.
 func (f *FSM) Transition() error {
 	f.eventMu.Lock()
 	defer f.eventMu.Unlock()
-	return f.doTransition()
+
+	ctx := context.Background()
+	start := time.Now()
+	pending := f.pending
+	if pending != nil {
+		ctx = pending.Context()
+	}
+	seq := f.Sequence()
+	err := f.doTransition()
+	if pending != nil && err != nil && f.metrics != nil && f.Sequence() == seq {
+		f.metrics.TransitionRejected(pending.Event, pending.Src, pending.Dst, err)
+	}
+	if pending != nil && f.audit != nil {
+		f.auditEvent(ctx, pending.Event, pending.Src, pending.Dst, start, err)
+	}
+	if err == nil {
+		err = f.forward(ctx)
+	}
+	f.runQueue()
+	return err
+}
+
+// Forward makes state a forwarding state: when the FSM enters it with an
+// event, the first of events that is not rejected by a guard is fired right
+// after the after_<EVENT> callbacks, with no arguments. If every event is
+// rejected the FSM stays in state.
+//
+// Forwarding continues through further forwarding states until one of them is
+// entered a second time, which returns a ForwardCycleError and leaves the FSM
+// in that state. Errors of forwarded events are returned by the event that
+// started forwarding. A forwarded event that starts an asynchronous transition
+// continues forwarding when Transition completes it.
+//
+// Each event must be valid in state, otherwise an InvalidEventError is
+// returned. Calling Forward without events makes state a normal state again.
+// Forward must not be called from a callback.
+func (f *FSM) Forward(state string, events ...string) error {
+	f.eventMu.Lock()
+	defer f.eventMu.Unlock()
+
+	for _, event := range events {
+		if _, _, ok := f.table.find(event, state); !ok {
+			return f.invalidEvent(event, state)
+		}
+	}
+	if len(events) == 0 {
+		delete(f.forwards, state)
+		return nil
+	}
+	if f.forwards == nil {
+		f.forwards = make(map[string][]string)
+	}
+	f.forwards[state] = append([]string(nil), events...)
+	return nil
+}
+
+// forward fires the events of the forwarding states the FSM enters, until it
+// reaches a normal state or starts an asynchronous transition.
+func (f *FSM) forward(ctx context.Context) error {
+	visited := make(map[string]bool)
+	for f.transition == nil {
+		state := f.Current()
+		events := f.forwards[state]
+		if len(events) == 0 {
+			return nil
+		}
+		if visited[state] {
+			return ForwardCycleError{state}
+		}
+		visited[state] = true
+
+		fired := false
+		for _, event := range events {
+			err := f.event(ctx, event)
+			if _, ok := err.(GuardFailedError); ok {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			fired = true
+			break
+		}
+		if !fired {
+			return nil
+		}
+	}
+	return nil
+}
+
+// CancelTransition cancels an asynchronous state transition in progress.
+//
+// The FSM stays in the current state and the context of the pending event is
+// canceled, so background work started for it can stop. It returns
+// NotInTransitionError if no asynchronous transition is in progress.
+//
+// Events queued while the transition was in progress run right after it is
+// canceled.
+func (f *FSM) CancelTransition() error {
+	f.eventMu.Lock()
+	defer f.eventMu.Unlock()
+
+	if f.transition == nil {
+		return NotInTransitionError{}
+	}
+
+	if e := f.pending; e != nil && f.metrics != nil {
+		f.metrics.TransitionRejected(e.Event, e.Src, e.Dst, CanceledError{})
+	}
+	f.cancelPending()
+	f.runQueue()
+	return nil
+}
+
+// cancelPending cancels the asynchronous transition in progress.
+func (f *FSM) cancelPending() {
+	if f.pending != nil {
+		f.pending.Cancel()
+		f.pending.release()
+	}
+	f.transition = nil
+	f.pending = nil
+}
+
+// eventWhilePending handles an event while an asynchronous transition is in
+// progress, according to the PendingPolicy of the event.
+func (f *FSM) eventWhilePending(ctx context.Context, event string, args []interface{}) error {
+	f.stateMu.RLock()
+	src := f.current
+	_, desc, ok := f.table.find(event, src)
+	f.stateMu.RUnlock()
+
+	if !ok || desc.WhilePending == RejectWhilePending {
+		return InTransitionError{event}
+	}
+
+	if desc.WhilePending == QueueWhilePending {
+		f.enqueue(queuedEvent{ctx: ctx, event: event, args: args, time: time.Now(), priority: desc.Priority})
+		return QueuedError{event}
+	}
+
+	// Put the pending transition aside while handling the event, and resume
+	// it unless the event moved the FSM on.
+	transition, pending := f.transition, f.pending
+	f.transition, f.pending = nil, nil
+
+	err := f.event(ctx, event, args...)
+	if err == nil {
+		err = f.forward(ctx)
+	}
+
+	if f.transition == nil && f.Current() == src {
+		f.transition, f.pending = transition, pending
+		return err
+	}
+	if pending != nil {
+		pending.Cancel()
+		pending.release()
+	}
+	f.runQueue()
+	return err
+}
+
+// enqueue adds q to the queue, after the events with the same or a higher
+// priority.
+func (f *FSM) enqueue(q queuedEvent) {
+	i := len(f.queue)
+	for i > 0 && f.queue[i-1].priority < q.priority {
+		i--
+	}
+	f.queue = append(f.queue, queuedEvent{})
+	copy(f.queue[i+1:], f.queue[i:])
+	f.queue[i] = q
+}
+
+// runQueue runs the queued events, until one of them starts an asynchronous
+// transition. Their errors are discarded.
+func (f *FSM) runQueue() {
+	for len(f.queue) > 0 && f.transition == nil {
+		q := f.queue[0]
+		f.queue = f.queue[1:]
+		if q.timer != nil && f.left(q.timer) {
+			continue
+		}
+		if f.waits != nil {
+			f.waits.QueueWaited(q.event, time.Since(q.time))
+		}
+		err := f.event(q.ctx, q.event, q.args...)
+		if f.dedup != nil {
+			f.handled(q.event, q.args, err)
+		}
+		if err == nil {
+			f.forward(q.ctx)
+		}
+		if q.timer != nil {
+			f.rearm(q.timer)
+		}
+	}
 }
 
 // doTransition wraps transitioner.transition.
@@ -381,25 +1414,111 @@ func (t transitionerStruct) transition(f *FSM) error {
 	if f.transition == nil {
 		return NotInTransitionError{}
 	}
-	err := f.transition()
+	err := f.commit(f.transition)
+	if f.pending != nil {
+		f.pending.release()
+	}
 	f.transition = nil
+	f.pending = nil
 	return err
 }
 
+// checkGuards returns a GuardFailedError if a guard of the transition does not
+// hold.
+func (f *FSM) checkGuards(e *Event) error {
+	_, desc, ok := f.table.find(e.Event, e.Src)
+	if !ok {
+		return nil
+	}
+	return guardsError(desc, e)
+}
+
+// guardsError returns a GuardFailedError if a guard of desc does not hold for
+// e.
+func guardsError(desc *EventDesc, e *Event) error {
+	for _, g := range desc.Guards {
+		e.exposed = true
+		if name, rejected := g.reject(e); rejected {
+			return GuardFailedError{Event: e.Event, State: e.Src, Guard: name}
+		}
+	}
+	return nil
+}
+
+// call calls the callback for key, if there is one, and records it in the
+// trace of e. It returns true if a callback was called.
+func (f *FSM) call(key cKey, action string, e *Event) (called bool) {
+	fn, ok := f.callbacks[key]
+	if !ok {
+		return false
+	}
+	if _, ok := e.Err.(CallbackPanicError); ok {
+		return false
+	}
+	if e.done() {
+		return false
+	}
+	start := time.Now()
+	defer func() {
+		phase := Phase{Action: action, Callback: key.String(), Duration: time.Since(start)}
+		e.trace = append(e.trace, phase)
+		if f.logger != nil {
+			f.logPhase(e, phase)
+		}
+	}()
+	if f.recoverPanics {
+		defer f.recoverCallback(key, action, e)
+	}
+	called = true
+	e.exposed = true
+	fn(action, e)
+	return called
+}
+
+// recoverCallback recovers a panic in the callback key, and stops the event
+// with a CallbackPanicError.
+func (f *FSM) recoverCallback(key cKey, action string, e *Event) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	e.Cancel(CallbackPanicError{Callback: key.String(), Action: action, Value: r, Stack: debug.Stack()})
+	e.async = false
+}
+
+// runAction calls the Action of the event description of e, if any, and sets
+// its error as e.Err.
+func (f *FSM) runAction(e *Event) {
+	_, desc, _ := f.table.find(e.Event, e.Src)
+	if desc == nil || desc.Action == nil {
+		return
+	}
+	if f.recoverPanics {
+		defer func() {
+			if r := recover(); r != nil {
+				e.Err = CallbackPanicError{Callback: "action of " + e.Event, Value: r, Stack: debug.Stack()}
+			}
+		}()
+	}
+	e.exposed = true
+	if err := desc.Action(e); err != nil {
+		e.Err = err
+	}
+}
+
 // beforeEventCallbacks calls the before_ callbacks, first the named then the
 // general version.
 func (f *FSM) beforeEventCallbacks(e *Event) error {
-	if fn, ok := f.callbacks[cKey{e.Event, callbackBeforeEvent}]; ok {
-		fn(ActionBeforeEvent, e)
-		if e.canceled {
-			return CanceledError{e.Err}
+	for _, key := range []cKey{{e.Event, callbackBeforeEvent}, {"", callbackBeforeEvent}} {
+		if f.call(key, ActionBeforeEvent, e) && e.canceled {
+			if p, ok := e.Err.(CallbackPanicError); ok {
+				return p
+			}
+			return CanceledError{Err: e.Err, Trace: e.trace}
 		}
 	}
-	if fn, ok := f.callbacks[cKey{"", callbackBeforeEvent}]; ok {
-		fn(ActionBeforeEvent, e)
-		if e.canceled {
-			return CanceledError{e.Err}
-		}
+	if e.aborted != nil {
+		return e.abortedError(false)
 	}
 	return nil
 }
@@ -407,103 +1526,165 @@ func (f *FSM) beforeEventCallbacks(e *Event) error {
 // leaveStateCallbacks calls the leave_ callbacks, first the named then the
 // general version.
 func (f *FSM) leaveStateCallbacks(e *Event) error {
-	if fn, ok := f.callbacks[cKey{f.current, callbackLeaveState}]; ok {
-		fn(ActionLeavingState, e)
-		if e.canceled {
-			return CanceledError{e.Err}
-		} else if e.async {
-			return AsyncError{e.Err}
+	for _, key := range []cKey{{f.current, callbackLeaveState}, {"", callbackLeaveState}} {
+		if !f.call(key, ActionLeavingState, e) {
+			continue
 		}
-	}
-	if fn, ok := f.callbacks[cKey{"", callbackLeaveState}]; ok {
-		fn(ActionLeavingState, e)
-		if e.canceled {
-			return CanceledError{e.Err}
+		if p, ok := e.Err.(CallbackPanicError); ok {
+			return p
+		} else if e.canceled {
+			return CanceledError{Err: e.Err, Trace: e.trace}
 		} else if e.async {
 			return AsyncError{e.Err}
 		}
 	}
+	if e.aborted != nil {
+		return e.abortedError(false)
+	}
 	return nil
 }
 
 // enterStateCallbacks calls the enter_ callbacks, first the named then the
 // general version.
 func (f *FSM) enterStateCallbacks(e *Event) {
-	if fn, ok := f.callbacks[cKey{f.current, callbackEnterState}]; ok {
-		fn(ActionEnteringState, e)
-	}
-
-	if fn, ok := f.callbacks[cKey{f.current, callbackOnState}]; ok {
-		fn(ActionEnteringState, e)
-	}
+	f.call(cKey{f.current, callbackEnterState}, ActionEnteringState, e)
+	f.call(cKey{f.current, callbackOnState}, ActionEnteringState, e)
+	f.call(cKey{"", callbackEnterState}, ActionEnteringState, e)
+}
 
-	if fn, ok := f.callbacks[cKey{"", callbackEnterState}]; ok {
-		fn(ActionEnteringState, e)
+// restoredStateCallbacks calls the enter callbacks of the current state with
+// ActionRestoringState, once the FSM has been restored from src, if it has
+// WithRestoreCallbacks.
+func (f *FSM) restoredStateCallbacks(ctx context.Context, src string) {
+	if !f.restoreCallbacks {
+		return
 	}
+	e := &Event{FSM: f, Src: src, Dst: f.current}
+	e.setContext(ctx)
+	defer e.release()
+	f.call(cKey{f.current, callbackEnterState}, ActionRestoringState, e)
+	f.call(cKey{f.current, callbackOnState}, ActionRestoringState, e)
+	f.call(cKey{"", callbackEnterState}, ActionRestoringState, e)
 }
 
 func (f *FSM) onStateCallbacks(e *Event) error {
-	if fn, ok := f.callbacks[cKey{f.current, callbackOnState}]; ok {
-		fn(ActionOnEvent, e)
+	f.call(cKey{f.current, callbackOnState}, ActionOnEvent, e)
+	f.call(cKey{"", callbackOnState}, ActionOnEvent, e)
+	return nil
+}
+
+// unhandledCallbacks calls the unhandled_ callbacks for an event without a
+// transition from the current state, first the named then the general
+// version, and returns the error they leave in e.Err.
+func (f *FSM) unhandledCallbacks(ctx context.Context, event string, args []interface{}, err error) error {
+	keys := []cKey{{f.current, callbackUnhandled}, {"", callbackUnhandled}}
+	if _, ok := f.callbacks[keys[0]]; !ok {
+		if _, ok := f.callbacks[keys[1]]; !ok {
+			return err
+		}
 	}
-	if fn, ok := f.callbacks[cKey{"", callbackOnState}]; ok {
-		fn(ActionOnEvent, e)
+	e := &Event{FSM: f, Event: event, Src: f.current, Args: args, Err: err}
+	e.setContext(ctx)
+	defer e.release()
+	for _, key := range keys {
+		f.call(key, ActionUnhandled, e)
 	}
-
-	return nil
+	return e.Err
 }
 
 // afterEventCallbacks calls the after_ callbacks, first the named then the
 // general version.
 func (f *FSM) afterEventCallbacks(e *Event) {
-	if fn, ok := f.callbacks[cKey{e.Event, callbackAfterEvent}]; ok {
-		fn(ActionAfterEvent, e)
-	}
-	if fn, ok := f.callbacks[cKey{"", callbackAfterEvent}]; ok {
-		fn(ActionAfterEvent, e)
-	}
+	f.call(cKey{e.Event, callbackAfterEvent}, ActionAfterEvent, e)
+	f.call(cKey{"", callbackAfterEvent}, ActionAfterEvent, e)
 }
 
 func (f *FSM) GetDotRep(name string) string {
-
-	g := dot.NewGraph(dot.Directed)
-	g.ID(name)
-	g.Label(name)
-	nodes := make(map[string]dot.Node, len(f.allStates))
-
-	g.Attr("rankdir", "TB")
-	g.Attr("splines", "true")
-	g.Attr("overlap", "false")
-	g.Attr("ratio", "auto")
-	g.Attr("ranksep", ".75")
-	g.Attr("concentrate", "false")
-	g.Attr("ordering", "out")
-
-	nodes[f.current] = g.Node(f.current)
-	nodes[f.current].Attr("shape", "Mrecord")
-	nodes[f.current].Attr("color", "black")
-	nodes[f.current].Attr("fixedsize","true")
-	nodes[f.current].Attr("width","2.5")
-
-	for state, _ := range f.allStates {
+	var buf bytes.Buffer
+
+	buf.WriteString("digraph " + dotGraphID(name) + " {\n\t")
+
+	attrs := [][2]string{
+		{"concentrate", "false"},
+		{"label", name},
+		{"ordering", "out"},
+		{"overlap", "false"},
+		{"rankdir", "TB"},
+		{"ranksep", ".75"},
+		{"ratio", "auto"},
+		{"splines", "true"},
+	}
+	for _, a := range attrs {
+		buf.WriteString(a[0] + "=" + strconv.Quote(a[1]) + ";")
+	}
+	buf.WriteString("\n\t")
+
+	// Nodes are numbered with the current state first, and written sorted
+	// by state.
+	states := f.sortedStates()
+	ids := make(map[string]int, len(states))
+	ids[f.current] = 1
+	for _, state := range states {
+		if _, ok := ids[state]; !ok {
+			ids[state] = len(ids) + 1
+		}
+	}
+	for _, state := range states {
+		shape, width := "circle", "1.5"
 		if state == f.current {
-			continue
+			shape, width = "Mrecord", "2.5"
 		}
-		nodes[state] = g.Node(state)
-		nodes[state].Attr("shape", "circle")
-		nodes[state].Attr("color", "black")
-		nodes[state].Attr("fixedsize","true")
-		nodes[state].Attr("width","1.5")
+		buf.WriteString(fmt.Sprintf("n%d[color=\"black\",fixedsize=\"true\",label=%s,shape=%q,width=%q];\n\t",
+			ids[state], strconv.Quote(state), shape, width))
 	}
 
+	for _, ekey := range f.sortedTransitionKeys() {
+		dst, _, _ := f.table.find(ekey.event, ekey.src)
+		buf.WriteString(fmt.Sprintf("n%d->n%d[color=\"blue\",label=%s];\n\t",
+			ids[ekey.src], ids[dst], strconv.Quote(ekey.event)))
+	}
 
+	buf.WriteString("\n}\n")
+	return buf.String()
+}
 
-	for ekey, destination := range f.transitions {
-		g.Edge(nodes[ekey.src], nodes[destination], ekey.event).Attr("color", "blue")
+// dotGraphID returns s as a Graphviz ID, quoted unless it is a plain identifier.
+func dotGraphID(s string) string {
+	for i, r := range s {
+		if r != '_' && !unicode.IsLetter(r) && (i == 0 || !unicode.IsDigit(r)) {
+			return dotQuote(s)
+		}
+	}
+	if s == "" {
+		return `""`
 	}
+	return s
+}
 
+// sortedStates returns all states of the FSM in sorted order.
+func (f *FSM) sortedStates() []string {
+	states := make([]string, 0, len(f.allStates))
+	for state := range f.allStates {
+		states = append(states, state)
+	}
+	sort.Strings(states)
+	return states
+}
 
-	return g.String()
+// sortedTransitionKeys returns the keys of the transitions sorted by source
+// state and then by event, so that output built from them is stable.
+func (f *FSM) sortedTransitionKeys() []eKey {
+	keys := make([]eKey, 0, f.table.len())
+	f.table.each(func(event, src, _ string, _ *EventDesc) {
+		keys = append(keys, eKey{event, src})
+	})
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].src != keys[j].src {
+			return keys[i].src < keys[j].src
+		}
+		return keys[i].event < keys[j].event
+	})
+	return keys
 }
 
 const (
@@ -513,6 +1694,7 @@ const (
 	callbackEnterState
 	callbackOnState
 	callbackAfterEvent
+	callbackUnhandled
 )
 
 // cKey is a struct key used for keeping the callbacks mapped to a target.
@@ -526,6 +1708,41 @@ type cKey struct {
 	callbackType int
 }
 
+// String returns the callback key that the cKey is parsed from, in its full
+// version.
+func (k cKey) String() string {
+	prefix, general := "", ""
+	switch k.callbackType {
+	case callbackBeforeEvent:
+		prefix, general = "before_", "event"
+	case callbackLeaveState:
+		prefix, general = "leave_", "state"
+	case callbackEnterState:
+		prefix, general = "enter_", "state"
+	case callbackAfterEvent:
+		prefix, general = "after_", "event"
+	case callbackUnhandled:
+		prefix, general = "unhandled_", "state"
+	}
+	if k.target == "" {
+		return prefix + general
+	}
+	return prefix + k.target
+}
+
+// queuedEvent is an event waiting for the transition in progress to complete.
+type queuedEvent struct {
+	ctx      context.Context
+	event    string
+	args     []interface{}
+	time     time.Time
+	priority int
+
+	// timer is the timer that fired the event, if any, which is dropped if
+	// its state has been left.
+	timer *stateTimer
+}
+
 // eKey is a struct key used for storing the transition map.
 type eKey struct {
 	// event is the name of the event that the keys refers to.
@@ -15,8 +15,12 @@
 package fsm
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"sort"
+	"reflect"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -43,6 +47,107 @@ func TestSameState(t *testing.T) {
 	}
 }
 
+func TestStrictDuplicateTransition(t *testing.T) {
+	_, err := NewFSMStrict(
+		"start",
+		Events{
+			{EvtName: "run", SrcStates: []string{"start"}, DstStates: "end"},
+			{EvtName: "stop", SrcStates: []string{"end"}, DstStates: "start"},
+			{EvtName: "run", SrcStates: []string{"idle", "start"}, DstStates: "failed"},
+		},
+		Callbacks{},
+	)
+	e, ok := err.(ConflictingTransitionError)
+	if !ok {
+		t.Fatal("expected 'ConflictingTransitionError'")
+	}
+	if e.Event != "run" || e.Src != "start" || e.First != 0 || e.Second != 2 ||
+		!reflect.DeepEqual(e.FirstDst, []string{"end"}) || !reflect.DeepEqual(e.SecondDst, []string{"failed"}) {
+		t.Error("expected error to name both definitions")
+	}
+
+	fsm, err := NewFSMStrict(
+		"start",
+		Events{
+			{EvtName: "run", SrcStates: []string{"start"}, DstStates: "end"},
+			{EvtName: "stop", SrcStates: []string{"end"}, DstStates: "start"},
+		},
+		Callbacks{},
+	)
+	if err != nil {
+		t.Error("expected no error")
+	}
+	if fsm.Event("run") != nil || fsm.Current() != "end" {
+		t.Error("expected state to be 'end'")
+	}
+}
+
+func TestStrictIdenticalTransition(t *testing.T) {
+	ready := Guard{Name: "ready", Check: func(e *Event) bool { return true }}
+	action := func(e *Event) error { return nil }
+	_, err := NewFSMStrict(
+		"start",
+		Events{
+			{EvtName: "run", SrcStates: []string{"start"}, DstStates: "end", Guards: []Guard{ready}, Action: action},
+			{EvtName: "run", SrcStates: []string{"idle", "start"}, DstStates: "end", Guards: []Guard{ready}, Action: action},
+			{EvtName: "ping", SrcStates: []string{"start"}, Internal: true},
+			{EvtName: "ping", SrcStates: []string{"start", "end"}, Internal: true},
+		},
+		Callbacks{},
+	)
+	if err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
+
+func TestStrictConflictingFields(t *testing.T) {
+	ready := Guard{Name: "ready", Check: func(e *Event) bool { return true }}
+	for _, c := range []struct {
+		second EventDesc
+		field  string
+	}{
+		{EventDesc{DstStates: "b", DstChoices: []string{"a"}}, "DstStates"},
+		{EventDesc{DstStates: "a", DstChoices: []string{"b", "c"}}, "DstChoices"},
+		{EventDesc{DstStates: "a", DstChoices: []string{"b"}, Choose: func(e *Event) string { return "b" }}, "Choose"},
+		{EventDesc{DstStates: "a", DstChoices: []string{"b"}, Guards: []Guard{ready}}, "Guards"},
+		{EventDesc{DstStates: "a", DstChoices: []string{"b"}, Action: func(e *Event) error { return nil }}, "Action"},
+		{EventDesc{DstStates: "a", DstChoices: []string{"b"}, Priority: 1}, "Priority"},
+		{EventDesc{Internal: true}, "Internal"},
+	} {
+		second := c.second
+		second.EvtName, second.SrcStates = "pick", []string{"a"}
+		_, err := NewFSMStrict(
+			"a",
+			Events{{EvtName: "pick", SrcStates: []string{"a"}, DstStates: "a", DstChoices: []string{"b"}}, second},
+			Callbacks{},
+		)
+		if e, ok := err.(ConflictingTransitionError); !ok || e.Field != c.field {
+			t.Errorf("expected a conflict in %s, got %v", c.field, err)
+		}
+	}
+}
+
+func TestStrictConflictingChoices(t *testing.T) {
+	_, err := NewFSMStrict(
+		"start",
+		Events{
+			{EvtName: "pick", SrcStates: []string{"start"}, DstStates: "a", DstChoices: []string{"b"}},
+			{EvtName: "pick", SrcStates: []string{"start"}, DstStates: "a"},
+		},
+		Callbacks{},
+	)
+	e, ok := err.(ConflictingTransitionError)
+	if !ok {
+		t.Fatalf("expected 'ConflictingTransitionError', got %v", err)
+	}
+	if !reflect.DeepEqual(e.FirstDst, []string{"a", "b"}) || !reflect.DeepEqual(e.SecondDst, []string{"a"}) {
+		t.Error("expected error to name both destination sets")
+	}
+	if !errors.Is(err, ErrConflictingTransition) {
+		t.Error("expected error to match ErrConflictingTransition")
+	}
+}
+
 func TestSetState(t *testing.T) {
 	fsm := NewFSM(
 		"walking",
@@ -61,6 +166,32 @@ func TestSetState(t *testing.T) {
 	}
 }
 
+func TestSequence(t *testing.T) {
+	fsm := NewFSM(
+		"start",
+		Events{
+			{EvtName: "run", SrcStates: []string{"start"}, DstStates: "end"},
+			{EvtName: "wait", SrcStates: []string{"end"}, DstStates: "end"},
+			{EvtName: "reset", SrcStates: []string{"end"}, DstStates: "start"},
+		},
+		Callbacks{
+			"before_reset": func(action string, e *Event) {
+				e.Cancel()
+			},
+		},
+	)
+	if fsm.Sequence() != 0 {
+		t.Error("expected sequence to start at 0")
+	}
+	fsm.Event("run")
+	fsm.Event("wait")
+	fsm.Event("reset")
+	fsm.Event("run")
+	if fsm.Sequence() != 2 {
+		t.Error("expected sequence to count committed transitions only")
+	}
+}
+
 func TestBadTransition(t *testing.T) {
 	fsm := NewFSM(
 		"start",
@@ -261,6 +392,54 @@ func TestSpecificCallbacksShortform(t *testing.T) {
 	}
 }
 
+func TestFullCallbackOverridesShortform(t *testing.T) {
+	called := ""
+
+	fsm := NewFSM(
+		"start",
+		Events{
+			{EvtName: "run", SrcStates: []string{"start"}, DstStates: "end"},
+		},
+		Callbacks{
+			"run": func(action string, e *Event) {
+				called = "run"
+			},
+			"after_run": func(action string, e *Event) {
+				called = "after_run"
+			},
+		},
+	)
+
+	fsm.Event("run")
+	if called != "after_run" {
+		t.Error("expected the full version of the callback to be called")
+	}
+}
+
+func TestStateShortformAndFullVersion(t *testing.T) {
+	var called []string
+
+	fsm := NewFSM(
+		"start",
+		Events{
+			{EvtName: "run", SrcStates: []string{"start"}, DstStates: "end"},
+		},
+		Callbacks{
+			"end": func(action string, e *Event) {
+				called = append(called, "end")
+			},
+			"enter_end": func(action string, e *Event) {
+				called = append(called, "enter_end")
+			},
+		},
+	)
+
+	fsm.Event("run")
+	if fmt.Sprint(called) != "[enter_end end]" {
+		t.Errorf("expected both versions of the state callback, got %v", called)
+	}
+}
+
 func TestBeforeEventWithoutTransition(t *testing.T) {
 	beforeEvent := true
 
@@ -456,166 +635,1054 @@ func TestAsyncTransitionInProgress(t *testing.T) {
 	}
 }
 
-func TestAsyncTransitionNotInProgress(t *testing.T) {
+func TestAcceptWhilePending(t *testing.T) {
+	pings := 0
+	var pending *Event
 	fsm := NewFSM(
 		"start",
 		Events{
 			{EvtName: "run", SrcStates: []string{"start"}, DstStates: "end"},
-			{EvtName: "reset", SrcStates: []string{"end"}, DstStates: "start"},
+			{EvtName: "ping", SrcStates: []string{"start", "end"}, DstStates: "start", WhilePending: AcceptWhilePending},
+			{EvtName: "abort", SrcStates: []string{"start"}, DstStates: "aborted", WhilePending: AcceptWhilePending},
+			{EvtName: "reset", SrcStates: []string{"start"}, DstStates: "start"},
+		},
+		Callbacks{
+			"leave_start": func(action string, e *Event) {
+				if e.Event == "run" {
+					pending = e
+					e.Async()
+				}
+			},
+			"after_ping": func(action string, e *Event) {
+				pings++
+			},
 		},
-		Callbacks{},
 	)
-	err := fsm.Transition()
-	if _, ok := err.(NotInTransitionError); !ok {
+
+	fsm.Event("run")
+	if !fsm.Can("ping") || fsm.Can("reset") {
+		t.Error("expected only 'ping' and 'abort' to be possible")
+	}
+	if err := fsm.Event("ping"); err != nil {
+		t.Error("expected 'ping' to be accepted")
+	}
+	if _, ok := fsm.Event("reset").(InTransitionError); !ok {
+		t.Error("expected 'InTransitionError'")
+	}
+	if pings != 1 || fsm.Current() != "start" {
+		t.Error("expected 'ping' to be handled")
+	}
+	if err := fsm.Transition(); err != nil {
+		t.Error("expected pending transition to be resumed")
+	}
+	if fsm.Current() != "end" {
+		t.Error("expected state to be 'end'")
+	}
+
+	fsm.Event("ping")
+	fsm.Event("run")
+	if err := fsm.Event("abort"); err != nil {
+		t.Error("expected 'abort' to be accepted")
+	}
+	if fsm.Current() != "aborted" {
+		t.Error("expected state to be 'aborted'")
+	}
+	if pending.Context().Err() == nil {
+		t.Error("expected pending transition to be canceled")
+	}
+	if _, ok := fsm.Transition().(NotInTransitionError); !ok {
 		t.Error("expected 'NotInTransitionError'")
 	}
 }
 
-func TestCallbackNoError(t *testing.T) {
+func TestQueueWhilePending(t *testing.T) {
+	var order []string
 	fsm := NewFSM(
 		"start",
 		Events{
 			{EvtName: "run", SrcStates: []string{"start"}, DstStates: "end"},
+			{EvtName: "finish", SrcStates: []string{"start", "end"}, DstStates: "finished", WhilePending: QueueWhilePending},
 		},
 		Callbacks{
-			"run": func(action string, e *Event) {
+			"leave_start": func(action string, e *Event) {
+				if e.Event == "run" {
+					e.Async()
+				}
+			},
+			"enter_state": func(action string, e *Event) {
+				order = append(order, e.Dst)
 			},
 		},
 	)
-	e := fsm.Event("run")
-	if e != nil {
-		t.Error("expected no error")
+
+	fsm.Event("run")
+	if _, ok := fsm.Event("finish").(QueuedError); !ok {
+		t.Error("expected 'QueuedError'")
+	}
+	if fsm.Current() != "start" {
+		t.Error("expected state to be 'start'")
+	}
+	fsm.Transition()
+	if fmt.Sprint(order) != "[end finished]" {
+		t.Error("expected queued event to run after the transition")
+	}
+
+	fsm.SetState("start")
+	order = nil
+	fsm.Event("run")
+	fsm.Event("finish")
+	fsm.CancelTransition()
+	if _, ok := fsm.Event("finish").(InvalidEventError); !ok || fmt.Sprint(order) != "[finished]" {
+		t.Error("expected queued event to run after the cancellation")
 	}
 }
 
-func TestCallbackError(t *testing.T) {
+func TestQueuePriority(t *testing.T) {
+	var order []string
 	fsm := NewFSM(
 		"start",
 		Events{
-			{EvtName: "run", SrcStates: []string{"start"}, DstStates: "end"},
+			{EvtName: "run", SrcStates: []string{"start"}, DstStates: "running"},
+			{EvtName: "data", SrcStates: []string{"start", "running"}, DstStates: "running", WhilePending: QueueWhilePending},
+			{EvtName: "log", SrcStates: []string{"start", "running"}, DstStates: "running", WhilePending: QueueWhilePending, Priority: -1},
+			{EvtName: "abort", SrcStates: []string{"start", "running"}, DstStates: "running", WhilePending: QueueWhilePending, Priority: 10},
 		},
 		Callbacks{
-			"run": func(action string, e *Event) {
-				e.Err = fmt.Errorf("error")
+			"leave_start": func(action string, e *Event) {
+				if e.Event == "run" {
+					e.Async()
+				}
+			},
+			"after_event": func(action string, e *Event) {
+				order = append(order, e.Event+fmt.Sprint(e.Args...))
 			},
 		},
 	)
-	e := fsm.Event("run")
-	if e.Error() != "error" {
-		t.Error("expected error to be 'error'")
+
+	fsm.Event("run")
+	fsm.Event("log", 1)
+	fsm.Event("data", 1)
+	fsm.Event("abort", 1)
+	fsm.Event("data", 2)
+	fsm.Event("abort", 2)
+	fsm.Transition()
+	if fmt.Sprint(order) != "[run abort1 abort2 data1 data2 log1]" {
+		t.Error("expected queued events to run by priority, got", order)
 	}
 }
 
-func TestCallbackArgs(t *testing.T) {
+func TestAsyncTransitionNotInProgress(t *testing.T) {
 	fsm := NewFSM(
 		"start",
 		Events{
 			{EvtName: "run", SrcStates: []string{"start"}, DstStates: "end"},
+			{EvtName: "reset", SrcStates: []string{"end"}, DstStates: "start"},
 		},
-		Callbacks{
-			"run": func(action string, e *Event) {
-				if len(e.Args) != 1 {
-					t.Error("too few arguments")
-				}
-				arg, ok := e.Args[0].(string)
-				if !ok {
-					t.Error("not a string argument")
-				}
-				if arg != "test" {
-					t.Error("incorrect argument")
-				}
-			},
-		},
+		Callbacks{},
 	)
-	fsm.Event("run", "test")
+	err := fsm.Transition()
+	if _, ok := err.(NotInTransitionError); !ok {
+		t.Error("expected 'NotInTransitionError'")
+	}
 }
 
-func TestNoDeadLock(t *testing.T) {
-	var fsm *FSM
-	fsm = NewFSM(
+func TestCancelAsyncTransition(t *testing.T) {
+	done := make(chan error)
+	fsm := NewFSM(
 		"start",
 		Events{
 			{EvtName: "run", SrcStates: []string{"start"}, DstStates: "end"},
 		},
 		Callbacks{
-			"run": func(action string, e *Event) {
-				fsm.Current() // Should not result in a panic / deadlock
+			"leave_start": func(action string, e *Event) {
+				e.Async()
+				go func() {
+					<-e.Context().Done()
+					done <- e.Context().Err()
+				}()
 			},
 		},
 	)
 	fsm.Event("run")
+	if err := fsm.CancelTransition(); err != nil {
+		t.Error("expected no error")
+	}
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Error("expected context to be canceled")
+		}
+	case <-time.After(time.Second):
+		t.Error("expected async work to learn about the cancellation")
+	}
+	if fsm.Current() != "start" {
+		t.Error("expected state to be 'start'")
+	}
+	if _, ok := fsm.Transition().(NotInTransitionError); !ok {
+		t.Error("expected 'NotInTransitionError'")
+	}
+	if _, ok := fsm.CancelTransition().(NotInTransitionError); !ok {
+		t.Error("expected 'NotInTransitionError'")
+	}
+	if _, ok := fsm.Event("run").(AsyncError); !ok {
+		t.Error("expected new transition to be accepted")
+	}
 }
 
-func TestThreadSafetyRaceCondition(t *testing.T) {
+func TestCanceledCheckpoint(t *testing.T) {
+	aborted := make(chan bool)
 	fsm := NewFSM(
 		"start",
 		Events{
 			{EvtName: "run", SrcStates: []string{"start"}, DstStates: "end"},
 		},
 		Callbacks{
-			"run": func(action string, e *Event) {
+			"leave_start": func(action string, e *Event) {
+				e.Async()
+				go func() {
+					for {
+						select {
+						case <-e.Canceled():
+							aborted <- true
+							return
+						case <-time.After(time.Millisecond):
+							// Do some more work.
+						}
+					}
+				}()
 			},
 		},
 	)
-	var wg sync.WaitGroup
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		_ = fsm.Current()
-	}()
 	fsm.Event("run")
-	wg.Wait()
+	fsm.CancelTransition()
+	select {
+	case <-aborted:
+	case <-time.After(time.Second):
+		t.Error("expected long running work to abort")
+	}
 }
 
-func TestDoubleTransition(t *testing.T) {
-	var fsm *FSM
-	var wg sync.WaitGroup
-	wg.Add(2)
-	fsm = NewFSM(
+func TestEventCtx(t *testing.T) {
+	type key struct{}
+	var transitionCtx context.Context
+	fsm := NewFSM(
 		"start",
 		Events{
 			{EvtName: "run", SrcStates: []string{"start"}, DstStates: "end"},
 		},
 		Callbacks{
-			"before_run": func(action string, e *Event) {
-				wg.Done()
-				// Imagine a concurrent event coming in of the same type while
-				// the data access mutex is unlocked because the current transition
-				// is running its event callbacks, getting around the "active"
-				// transition checks
-				if len(e.Args) == 0 {
-					// Must be concurrent so the test may pass when we add a mutex that synchronizes
-					// calls to Event(...). It will then fail as an inappropriate transition as we
-					// have changed state.
-					go func() {
-						if err := fsm.Event("run", "second run"); err != nil {
-							fmt.Println(err)
-							wg.Done() // It should fail, and then we unfreeze the test.
-						}
-					}()
-					time.Sleep(20 * time.Millisecond)
-				} else {
-					panic("Was able to reissue an event mid-transition")
-				}
+			"leave_start": func(action string, e *Event) {
+				transitionCtx = e.Context()
+				e.Async()
 			},
 		},
 	)
-	if err := fsm.Event("run"); err != nil {
-		fmt.Println(err)
+
+	ctx, cancel := context.WithTimeout(context.WithValue(context.Background(), key{}, "value"), time.Hour)
+	fsm.EventCtx(ctx, "run")
+	if transitionCtx.Value(key{}) != "value" {
+		t.Error("expected context values to be passed to callbacks")
+	}
+	if deadline, ok := transitionCtx.Deadline(); !ok || time.Until(deadline) < time.Minute {
+		t.Error("expected the deadline of the context to be passed to callbacks")
+	}
+	if transitionCtx.Err() != nil {
+		t.Error("expected context not to be canceled")
+	}
+	cancel()
+	select {
+	case <-transitionCtx.Done():
+	case <-time.After(time.Second):
+		t.Error("expected canceling the caller's context to cancel the transition context")
 	}
-	wg.Wait()
 }
 
-func TestNoTransition(t *testing.T) {
+func TestEventCtxDone(t *testing.T) {
+	var transitionCtx context.Context
 	fsm := NewFSM(
 		"start",
 		Events{
-			{EvtName: "run", SrcStates: []string{"start"}, DstStates: "start"},
+			{EvtName: "run", SrcStates: []string{"start"}, DstStates: "end"},
 		},
-		Callbacks{},
-	)
-	err := fsm.Event("run")
-	if err == nil {
+		Callbacks{
+			"run": func(action string, e *Event) {
+				transitionCtx = e.Context()
+			},
+		},
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	fsm.EventCtx(ctx, "run")
+	cancel()
+	time.Sleep(10 * time.Millisecond)
+	if transitionCtx.Err() != nil {
+		t.Error("expected a completed transition to be detached from the caller's context")
+	}
+}
+
+func TestEventCtxAbort(t *testing.T) {
+	var called []string
+	ctx, cancel := context.WithCancel(context.Background())
+	record := func(action string, e *Event) {
+		called = append(called, e.FSM.Current()+":"+action)
+	}
+	fsm := NewFSM(
+		"start",
+		Events{
+			{EvtName: "run", SrcStates: []string{"start"}, DstStates: "end"},
+			{EvtName: "reset", SrcStates: []string{"end"}, DstStates: "start"},
+		},
+		Callbacks{
+			"before_run": func(action string, e *Event) {
+				record(action, e)
+				cancel()
+			},
+			"leave_start": record,
+			"enter_end":   record,
+		},
+	)
+
+	err := fsm.EventCtx(ctx, "run")
+	if e, ok := err.(AbortedError); !ok || e.Committed || e.Event != "run" || len(e.Trace) != 1 {
+		t.Errorf("expected uncommitted 'AbortedError', got %v", err)
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Error("expected the error to wrap context.Canceled")
+	}
+	if fsm.Current() != "start" || fmt.Sprint(called) != "[start:"+ActionBeforeEvent+"]" {
+		t.Errorf("expected no transition and no further callbacks, got %v", called)
+	}
+
+	called = nil
+	ctx, cancel = context.WithCancel(context.Background())
+	fsm.SetState("end")
+	fsm.OnEnter("start", func(action string, e *Event) {
+		cancel()
+	})
+	fsm.OnEnter("", record)
+	err = fsm.EventCtx(ctx, "reset")
+	if e, ok := err.(AbortedError); !ok || !e.Committed {
+		t.Errorf("expected committed 'AbortedError', got %v", err)
+	}
+	if fsm.Current() != "start" || called != nil {
+		t.Errorf("expected the transition without the remaining callbacks, got %v", called)
+	}
+
+	err = fsm.EventCtx(ctx, "run")
+	if e, ok := err.(AbortedError); !ok || e.Committed {
+		t.Errorf("expected an event with a done context to be aborted, got %v", err)
+	}
+	if err := NewFSM("start", Events{{EvtName: "run", SrcStates: []string{"start"}, DstStates: "end"}},
+		Callbacks{}).EventCtx(ctx, "run"); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected an event without callbacks to be aborted too, got %v", err)
+	}
+}
+
+func TestCancelCancelsContext(t *testing.T) {
+	var ctx context.Context
+	fsm := NewFSM(
+		"start",
+		Events{
+			{EvtName: "run", SrcStates: []string{"start"}, DstStates: "end"},
+		},
+		Callbacks{
+			"before_run": func(action string, e *Event) {
+				ctx = e.Context()
+				e.Cancel()
+			},
+		},
+	)
+	fsm.Event("run")
+	if ctx.Err() != context.Canceled {
+		t.Error("expected context to be canceled")
+	}
+}
+
+func TestCallbackNoError(t *testing.T) {
+	fsm := NewFSM(
+		"start",
+		Events{
+			{EvtName: "run", SrcStates: []string{"start"}, DstStates: "end"},
+		},
+		Callbacks{
+			"run": func(action string, e *Event) {
+			},
+		},
+	)
+	e := fsm.Event("run")
+	if e != nil {
+		t.Error("expected no error")
+	}
+}
+
+func TestCallbackError(t *testing.T) {
+	fsm := NewFSM(
+		"start",
+		Events{
+			{EvtName: "run", SrcStates: []string{"start"}, DstStates: "end"},
+		},
+		Callbacks{
+			"run": func(action string, e *Event) {
+				e.Err = fmt.Errorf("error")
+			},
+		},
+	)
+	e := fsm.Event("run")
+	if e.Error() != "error" {
+		t.Error("expected error to be 'error'")
+	}
+}
+
+func TestCallbackErrorUnchanged(t *testing.T) {
+	callbackErr := fmt.Errorf("error")
+	fsm := NewFSM(
+		"start",
+		Events{
+			{EvtName: "run", SrcStates: []string{"start"}, DstStates: "end"},
+		},
+		Callbacks{
+			"before_run": func(action string, e *Event) {
+				e.Err = callbackErr
+			},
+		},
+	)
+	if err := fsm.Event("run"); err != callbackErr {
+		t.Errorf("expected the callback error unchanged, got %#v", err)
+	}
+}
+
+func TestCallbackErrorTrace(t *testing.T) {
+	callbackErr := fmt.Errorf("error")
+	fsm := NewFSM(
+		"start",
+		Events{
+			{EvtName: "run", SrcStates: []string{"start"}, DstStates: "end"},
+		},
+		Callbacks{
+			"before_run":  func(action string, e *Event) {},
+			"leave_state": func(action string, e *Event) {},
+			"start": func(action string, e *Event) {
+				time.Sleep(time.Millisecond)
+				e.Err = callbackErr
+			},
+			"enter_end": func(action string, e *Event) {},
+		},
+		WithErrorTrace(),
+	)
+	err := fsm.Event("run")
+	e, ok := err.(CallbackError)
+	if !ok || e.Err != callbackErr {
+		t.Fatal("expected 'CallbackError' with the callback error")
+	}
+	var callbacks []string
+	for _, p := range e.Trace {
+		callbacks = append(callbacks, p.Callback+"/"+p.Action)
+	}
+	if fmt.Sprint(callbacks) != "[before_run/BeforeEvent leave_state/LeavingState start/OnEvent]" {
+		t.Errorf("unexpected trace %v", callbacks)
+	}
+	if e.Trace[2].Duration < time.Millisecond {
+		t.Error("expected the duration of the callback to be recorded")
+	}
+	if fsm.Current() != "start" {
+		t.Error("expected state to be 'start'")
+	}
+}
+
+func TestCallbackFail(t *testing.T) {
+	fsm := NewFSM(
+		"start",
+		Events{
+			{EvtName: "run", SrcStates: []string{"start"}, DstStates: "end"},
+		},
+		Callbacks{
+			"before_run": func(action string, e *Event) {
+				if len(e.Args) > 0 {
+					e.Fail(fmt.Errorf("invalid"), Terminal)
+				} else {
+					e.Fail(fmt.Errorf("unavailable"), Retryable)
+				}
+			},
+		},
+	)
+	err := fsm.Event("run")
+	if !IsRetryable(err) || err.Error() != "unavailable" {
+		t.Error("expected a retryable error")
+	}
+	err = fsm.Event("run", "bad")
+	if !IsTerminal(err) || err.Error() != "invalid" {
+		t.Error("expected a terminal error")
+	}
+	if fsm.Current() != "start" {
+		t.Error("expected state to be 'start'")
+	}
+}
+
+func TestCanceledErrorTrace(t *testing.T) {
+	fsm := NewFSM(
+		"start",
+		Events{
+			{EvtName: "run", SrcStates: []string{"start"}, DstStates: "end"},
+		},
+		Callbacks{
+			"before_event": func(action string, e *Event) {},
+			"leave_start": func(action string, e *Event) {
+				e.Cancel()
+			},
+		},
+	)
+	e, ok := fsm.Event("run").(CanceledError)
+	if !ok {
+		t.Fatal("expected 'CanceledError'")
+	}
+	if len(e.Trace) != 2 || e.Trace[0].Callback != "before_event" || e.Trace[1].Callback != "leave_start" {
+		t.Error("expected the trace to list the called callbacks")
+	}
+}
+
+func TestCallbackArgs(t *testing.T) {
+	fsm := NewFSM(
+		"start",
+		Events{
+			{EvtName: "run", SrcStates: []string{"start"}, DstStates: "end"},
+		},
+		Callbacks{
+			"run": func(action string, e *Event) {
+				if len(e.Args) != 1 {
+					t.Error("too few arguments")
+				}
+				arg, ok := e.Args[0].(string)
+				if !ok {
+					t.Error("not a string argument")
+				}
+				if arg != "test" {
+					t.Error("incorrect argument")
+				}
+			},
+		},
+	)
+	fsm.Event("run", "test")
+}
+
+func TestArgTransformers(t *testing.T) {
+	type order struct {
+		ID   int
+		Card string
+	}
+	var received []interface{}
+
+	fsm := NewFSM(
+		"start",
+		Events{
+			{EvtName: "run", SrcStates: []string{"start"}, DstStates: "end"},
+		},
+		Callbacks{
+			"before_run": func(action string, e *Event) {
+				received = e.Args
+			},
+		},
+	)
+	fsm.AddArgTransformer("run", func(args []interface{}) ([]interface{}, error) {
+		var o order
+		if err := json.Unmarshal(args[0].([]byte), &o); err != nil {
+			return nil, err
+		}
+		return []interface{}{o}, nil
+	})
+	fsm.AddArgTransformer("run", func(args []interface{}) ([]interface{}, error) {
+		o := args[0].(order)
+		o.Card = "****"
+		return []interface{}{o}, nil
+	})
+
+	if err := fsm.Event("run", []byte("not json")); err == nil {
+		t.Error("expected transformer error")
+	}
+	if received != nil || fsm.Current() != "start" {
+		t.Error("expected event to be rejected before any callback")
+	}
+
+	if err := fsm.Event("run", []byte(`{"ID": 1, "Card": "4111111111111111"}`)); err != nil {
+		t.Error("expected no error")
+	}
+	if len(received) != 1 || received[0] != (order{ID: 1, Card: "****"}) {
+		t.Error("expected callbacks to receive the transformed arguments")
+	}
+}
+
+func TestLookup(t *testing.T) {
+	fsm := NewFSM(
+		"start",
+		Events{
+			{EvtName: "run", SrcStates: []string{"start", "paused"}, DstStates: "end"},
+		},
+		Callbacks{},
+	)
+	desc, ok := fsm.Lookup("run", "paused")
+	if !ok || desc.EvtName != "run" || desc.DstStates != "end" || len(desc.SrcStates) != 2 {
+		t.Errorf("expected the event description of run, got %v", desc)
+	}
+	if _, ok := fsm.Lookup("run", "end"); ok {
+		t.Error("expected no event description from end")
+	}
+}
+
+func TestChain(t *testing.T) {
+	var calls []string
+	record := func(name string) Callback {
+		return func(action string, e *Event) {
+			calls = append(calls, name)
+		}
+	}
+	fsm := NewFSM(
+		"start",
+		Events{
+			{EvtName: "run", SrcStates: []string{"start"}, DstStates: "end"},
+		},
+		Callbacks{
+			"before_run": Chain(record("audit"), func(action string, e *Event) {
+				calls = append(calls, "deny")
+				e.Cancel()
+			}, record("never")),
+		},
+	)
+
+	if _, ok := fsm.Event("run").(CanceledError); !ok {
+		t.Error("expected CanceledError")
+	}
+	if fmt.Sprint(calls) != "[audit deny]" {
+		t.Errorf("expected the chain to stop when canceled, got %v", calls)
+	}
+
+	calls = nil
+	fsm = NewFSM(
+		"start",
+		Events{
+			{EvtName: "run", SrcStates: []string{"start"}, DstStates: "end"},
+		},
+		Callbacks{
+			"enter_end": Chain(record("log"), nil, record("save")),
+		},
+	)
+	fsm.Event("run")
+	if fmt.Sprint(calls) != "[log save]" {
+		t.Errorf("expected the callbacks in order, got %v", calls)
+	}
+}
+
+func TestEventAsync(t *testing.T) {
+	release := make(chan struct{})
+	fsm := NewFSM(
+		"start",
+		Events{
+			{EvtName: "run", SrcStates: []string{"start"}, DstStates: "end"},
+		},
+		Callbacks{
+			"enter_end": func(action string, e *Event) {
+				<-release
+			},
+		},
+	)
+
+	result := fsm.EventAsync("run")
+	select {
+	case <-result:
+		t.Fatal("expected EventAsync not to wait for the callbacks")
+	case <-time.After(10 * time.Millisecond):
+	}
+	close(release)
+	if err := <-result; err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	if _, ok := (<-fsm.EventAsync("run")).(InvalidEventError); !ok {
+		t.Error("expected InvalidEventError")
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	var calls []string
+	fsm := NewFSM(
+		"start",
+		Events{
+			{EvtName: "run", SrcStates: []string{"start"}, DstStates: "end"},
+			{EvtName: "reset", SrcStates: []string{"end"}, DstStates: "start"},
+		},
+		Callbacks{
+			"enter_end": func(action string, e *Event) {
+				calls = append(calls, fmt.Sprint("enter_end ", e.Args))
+			},
+		},
+	)
+	fsm.Use(func(next TransitionFunc) TransitionFunc {
+		return func(ctx context.Context, event string, args []interface{}) error {
+			calls = append(calls, "log "+event+" from "+fsm.Current())
+			err := next(ctx, event, args)
+			calls = append(calls, fmt.Sprint("log ", err))
+			return err
+		}
+	}, func(next TransitionFunc) TransitionFunc {
+		return func(ctx context.Context, event string, args []interface{}) error {
+			if event == "reset" {
+				return errors.New("reset not allowed")
+			}
+			return next(ctx, event, append(args, "checked"))
+		}
+	})
+
+	if err := fsm.Event("run", "a"); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	if err := fsm.Event("reset"); err == nil || err.Error() != "reset not allowed" {
+		t.Errorf("expected the middleware to reject reset, got %v", err)
+	}
+	expected := "[log run from start enter_end [a checked] log <nil> log reset from end log reset not allowed]"
+	if fmt.Sprint(calls) != expected {
+		t.Errorf("unexpected calls %v", calls)
+	}
+}
+
+func TestPanicRecovery(t *testing.T) {
+	for _, key := range []string{"before_run", "leave_start", "start"} {
+		after := false
+		fsm := NewFSM(
+			"start",
+			Events{
+				{EvtName: "run", SrcStates: []string{"start"}, DstStates: "end"},
+			},
+			Callbacks{
+				key: func(action string, e *Event) {
+					e.Async()
+					panic("boom")
+				},
+				"after_event": func(action string, e *Event) {
+					after = true
+				},
+			},
+			WithPanicRecovery(),
+		)
+
+		err := fsm.Event("run")
+		e, ok := err.(CallbackPanicError)
+		if !ok || e.Callback != key || e.Value != "boom" || len(e.Stack) == 0 {
+			t.Errorf("expected CallbackPanicError for %s, got %v", key, err)
+		}
+		if fsm.Current() != "start" || after {
+			t.Errorf("expected the transition to stop for %s", key)
+		}
+		if err := fsm.Transition(); err == nil {
+			t.Errorf("expected no transition in progress after %s", key)
+		}
+	}
+}
+
+func TestPanicRecoveryAfterStateChange(t *testing.T) {
+	var calls []string
+	fsm := NewFSM(
+		"start",
+		Events{
+			{EvtName: "run", SrcStates: []string{"start"}, DstStates: "end"},
+		},
+		Callbacks{
+			"leave_start": func(action string, e *Event) {
+				e.Async()
+			},
+			"enter_end": func(action string, e *Event) {
+				panic(errors.New("boom"))
+			},
+			"enter_state": func(action string, e *Event) {
+				calls = append(calls, "enter_state")
+			},
+		},
+		WithPanicRecovery(),
+	)
+
+	if _, ok := fsm.Event("run").(AsyncError); !ok {
+		t.Error("expected AsyncError")
+	}
+	err := fsm.Transition()
+	if _, ok := err.(CallbackPanicError); !ok || err.Error() != "callback enter_end panicked: boom" {
+		t.Errorf("expected CallbackPanicError from Transition, got %v", err)
+	}
+	if fsm.Current() != "end" || len(calls) != 0 {
+		t.Errorf("expected the state to change and the other callbacks to be skipped, got %s %v", fsm.Current(), calls)
+	}
+	if err := fsm.Transition(); err == nil {
+		t.Error("expected no transition in progress")
+	}
+}
+
+func TestForward(t *testing.T) {
+	approve := true
+	var entered []string
+	fsm := NewFSM(
+		"draft",
+		Events{
+			{EvtName: "submit", SrcStates: []string{"draft"}, DstStates: "submitted"},
+			{EvtName: "approve", SrcStates: []string{"submitted"}, DstStates: "notified",
+				Guards: []Guard{{Name: "approved", Check: func(e *Event) bool { return approve }}}},
+			{EvtName: "reject", SrcStates: []string{"submitted"}, DstStates: "draft"},
+			{EvtName: "done", SrcStates: []string{"notified"}, DstStates: "published"},
+		},
+		Callbacks{
+			"enter_state": func(action string, e *Event) {
+				entered = append(entered, e.Dst)
+			},
+		},
+	)
+	if err := fsm.Forward("submitted", "approve", "reject"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsm.Forward("notified", "done"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := fsm.Event("submit"); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	if fsm.Current() != "published" {
+		t.Errorf("expected state to be 'published', got %q", fsm.Current())
+	}
+	if fmt.Sprint(entered) != "[submitted notified published]" {
+		t.Errorf("expected forwarding through every state, got %v", entered)
+	}
+
+	approve = false
+	fsm.SetState("draft")
+	fsm.Event("submit")
+	if fsm.Current() != "draft" {
+		t.Errorf("expected the guard to select 'reject', got %q", fsm.Current())
+	}
+
+	if err := fsm.Forward("draft", "done"); err == nil {
+		t.Error("expected InvalidEventError for an event not valid in the state")
+	}
+}
+
+func TestForwardCycle(t *testing.T) {
+	fsm := NewFSM(
+		"idle",
+		Events{
+			{EvtName: "start", SrcStates: []string{"idle"}, DstStates: "ping"},
+			{EvtName: "pong", SrcStates: []string{"ping"}, DstStates: "pong"},
+			{EvtName: "ping", SrcStates: []string{"pong"}, DstStates: "ping"},
+		},
+		Callbacks{},
+	)
+	fsm.Forward("ping", "pong")
+	fsm.Forward("pong", "ping")
+
+	err := fsm.Event("start")
+	if e, ok := err.(ForwardCycleError); !ok || e.State != "ping" {
+		t.Errorf("expected ForwardCycleError for 'ping', got %v", err)
+	}
+	if fsm.Current() != "ping" {
+		t.Errorf("expected state to be 'ping', got %q", fsm.Current())
+	}
+
+	fsm.Forward("pong")
+	fsm.SetState("idle")
+	if err := fsm.Event("start"); err != nil || fsm.Current() != "pong" {
+		t.Errorf("expected forwarding to stop in 'pong', got %q %v", fsm.Current(), err)
+	}
+}
+
+func TestForwardAsync(t *testing.T) {
+	fsm := NewFSM(
+		"start",
+		Events{
+			{EvtName: "run", SrcStates: []string{"start"}, DstStates: "check"},
+			{EvtName: "pass", SrcStates: []string{"check"}, DstStates: "end"},
+		},
+		Callbacks{
+			"leave_start": func(action string, e *Event) {
+				e.Async()
+			},
+		},
+	)
+	fsm.Forward("check", "pass")
+
+	if _, ok := fsm.Event("run").(AsyncError); !ok {
+		t.Error("expected AsyncError")
+	}
+	if err := fsm.Transition(); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	if fsm.Current() != "end" {
+		t.Errorf("expected Transition to forward to 'end', got %q", fsm.Current())
+	}
+}
+
+func TestNoDeadLock(t *testing.T) {
+	var fsm *FSM
+	fsm = NewFSM(
+		"start",
+		Events{
+			{EvtName: "run", SrcStates: []string{"start"}, DstStates: "end"},
+		},
+		Callbacks{
+			"run": func(action string, e *Event) {
+				fsm.Current() // Should not result in a panic / deadlock
+			},
+		},
+	)
+	fsm.Event("run")
+}
+
+func TestNoDeadLockWithSetState(t *testing.T) {
+	var fsm *FSM
+	fsm = NewFSM(
+		"start",
+		Events{
+			{EvtName: "run", SrcStates: []string{"start"}, DstStates: "end"},
+			{EvtName: "stop", SrcStates: []string{"start", "end"}, DstStates: "start"},
+		},
+		Callbacks{
+			"before_run": func(action string, e *Event) {
+				set := make(chan struct{})
+				go func() {
+					fsm.SetState("start")
+					close(set)
+				}()
+				// Give SetState time to wait for the lock, if it is held.
+				time.Sleep(10 * time.Millisecond)
+				fsm.Can("stop")
+				fsm.CanWithArgs("stop")
+				fsm.Sequence()
+				if _, err := fsm.EventAfter(time.Hour, "stop"); err != nil {
+					t.Errorf("expected no error, got %v", err)
+				}
+				<-set
+			},
+		},
+	)
+
+	done := make(chan struct{})
+	go func() {
+		fsm.Event("run")
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected callbacks to read the FSM while SetState waits")
+	}
+	fsm.StopTimers()
+}
+
+func TestThreadSafetyRaceCondition(t *testing.T) {
+	fsm := NewFSM(
+		"start",
+		Events{
+			{EvtName: "run", SrcStates: []string{"start"}, DstStates: "end"},
+		},
+		Callbacks{
+			"run": func(action string, e *Event) {
+			},
+		},
+	)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_ = fsm.Current()
+	}()
+	fsm.Event("run")
+	wg.Wait()
+}
+
+func TestDoubleTransition(t *testing.T) {
+	var fsm *FSM
+	var wg sync.WaitGroup
+	wg.Add(2)
+	fsm = NewFSM(
+		"start",
+		Events{
+			{EvtName: "run", SrcStates: []string{"start"}, DstStates: "end"},
+		},
+		Callbacks{
+			"before_run": func(action string, e *Event) {
+				wg.Done()
+				// Imagine a concurrent event coming in of the same type while
+				// the data access mutex is unlocked because the current transition
+				// is running its event callbacks, getting around the "active"
+				// transition checks
+				if len(e.Args) == 0 {
+					// Must be concurrent so the test may pass when we add a mutex that synchronizes
+					// calls to Event(...). It will then fail as an inappropriate transition as we
+					// have changed state.
+					go func() {
+						if err := fsm.Event("run", "second run"); err != nil {
+							fmt.Println(err)
+							wg.Done() // It should fail, and then we unfreeze the test.
+						}
+					}()
+					time.Sleep(20 * time.Millisecond)
+				} else {
+					panic("Was able to reissue an event mid-transition")
+				}
+			},
+		},
+	)
+	if err := fsm.Event("run"); err != nil {
+		fmt.Println(err)
+	}
+	wg.Wait()
+}
+
+func TestDotRepIsStable(t *testing.T) {
+	newFSM := func() *FSM {
+		return NewFSM(
+			"closed",
+			Events{
+				{EvtName: "open", SrcStates: []string{"closed"}, DstStates: "open"},
+				{EvtName: "close", SrcStates: []string{"open"}, DstStates: "closed"},
+				{EvtName: "kick", SrcStates: []string{"closed", "open"}, DstStates: "broken"},
+				{EvtName: "fix", SrcStates: []string{"broken"}, DstStates: "closed"},
+			},
+			Callbacks{},
+		)
+	}
+	expected := newFSM().GetDotRep("door")
+	for i := 0; i < 20; i++ {
+		if newFSM().GetDotRep("door") != expected {
+			t.Fatal("expected the same output for the same FSM")
+		}
+	}
+}
+
+func TestDotRep(t *testing.T) {
+	fsm := NewFSM(
+		"open",
+		Events{
+			{EvtName: "open", SrcStates: []string{"closed"}, DstStates: "open"},
+			{EvtName: "close", SrcStates: []string{"open"}, DstStates: "closed"},
+		},
+		Callbacks{},
+	)
+	expected := `digraph "front door" {
+	concentrate="false";label="front door";ordering="out";overlap="false";rankdir="TB";ranksep=".75";ratio="auto";splines="true";
+	n2[color="black",fixedsize="true",label="closed",shape="circle",width="1.5"];
+	n1[color="black",fixedsize="true",label="open",shape="Mrecord",width="2.5"];
+	n2->n1[color="blue",label="open"];
+	n1->n2[color="blue",label="close"];
+	
+}
+`
+	if got := fsm.GetDotRep("front door"); got != expected {
+		t.Errorf("unexpected output:\n%s", got)
+	}
+}
+
+func TestNoTransition(t *testing.T) {
+	fsm := NewFSM(
+		"start",
+		Events{
+			{EvtName: "run", SrcStates: []string{"start"}, DstStates: "start"},
+		},
+		Callbacks{},
+	)
+	err := fsm.Event("run")
+	if err == nil {
 		return
 	}
 	if _, ok := err.(NoTransitionError); ok {
@@ -623,6 +1690,399 @@ func TestNoTransition(t *testing.T) {
 	}
 }
 
+func TestChoose(t *testing.T) {
+	var entered string
+	fsm := NewFSM(
+		"draft",
+		Events{
+			{EvtName: "submit", SrcStates: []string{"draft"}, DstStates: "approved",
+				DstChoices: []string{"needs_review"},
+				Choose: func(e *Event) string {
+					if len(e.Args) > 0 && e.Args[0].(int) > 100 {
+						return "needs_review"
+					}
+					return ""
+				}},
+			{EvtName: "reset", SrcStates: []string{"approved", "needs_review"}, DstStates: "draft"},
+		},
+		Callbacks{
+			"enter_state": func(action string, e *Event) {
+				entered = e.Dst
+			},
+		},
+	)
+
+	if err := fsm.Event("submit", 500); err != nil {
+		t.Error(err)
+	}
+	if fsm.Current() != "needs_review" || entered != "needs_review" {
+		t.Error("expected state to be 'needs_review'")
+	}
+	if err := fsm.Event("reset"); err != nil {
+		t.Error(err)
+	}
+	if err := fsm.Event("submit", 10); err != nil {
+		t.Error(err)
+	}
+	if fsm.Current() != "approved" {
+		t.Error("expected state to be 'approved'")
+	}
+	if !fsm.Can("reset") {
+		t.Error("expected 'needs_review' to be a known state")
+	}
+}
+
+func TestChooseInvalid(t *testing.T) {
+	fsm := NewFSM(
+		"draft",
+		Events{
+			{EvtName: "submit", SrcStates: []string{"draft"}, DstStates: "approved",
+				Choose: func(e *Event) string { return "lost" }},
+		},
+		Callbacks{},
+	)
+	err := fsm.Event("submit")
+	if e, ok := err.(InvalidChoiceError); !ok || e.Dst != "lost" {
+		t.Error("expected 'InvalidChoiceError' with destination 'lost'")
+	}
+	if fsm.Current() != "draft" {
+		t.Error("expected state to be 'draft'")
+	}
+}
+
+func TestSetDst(t *testing.T) {
+	var setErr error
+	fsm := NewFSM(
+		"draft",
+		Events{
+			{EvtName: "submit", SrcStates: []string{"draft"}, DstStates: "approved",
+				DstChoices: []string{"needs_review"}},
+		},
+		Callbacks{
+			"before_submit": func(action string, e *Event) {
+				setErr = e.SetDst("lost")
+				if err := e.SetDst("needs_review"); err != nil {
+					t.Error(err)
+				}
+			},
+		},
+	)
+	if err := fsm.Event("submit"); err != nil {
+		t.Error(err)
+	}
+	if _, ok := setErr.(InvalidChoiceError); !ok {
+		t.Error("expected 'InvalidChoiceError'")
+	}
+	if fsm.Current() != "needs_review" {
+		t.Error("expected state to be 'needs_review'")
+	}
+}
+
+func TestInternalTransition(t *testing.T) {
+	var called []string
+	record := func(action string, e *Event) {
+		called = append(called, action)
+	}
+	fsm := NewFSM(
+		"open",
+		Events{
+			{EvtName: "ping", SrcStates: []string{"open", "closed"}, Internal: true},
+			{EvtName: "close", SrcStates: []string{"open"}, DstStates: "closed"},
+		},
+		Callbacks{
+			"before_ping":  record,
+			"after_ping":   record,
+			"leave_state":  record,
+			"enter_state":  record,
+			"on_open":      record,
+			"before_close": func(action string, e *Event) {},
+		},
+	)
+
+	if err := fsm.Event("ping"); err != nil {
+		t.Error(err)
+	}
+	if fsm.Current() != "open" {
+		t.Error("expected state to be 'open'")
+	}
+	if strings.Join(called, ",") != ActionBeforeEvent+","+ActionAfterEvent {
+		t.Error("expected only event callbacks, got", called)
+	}
+
+	if err := fsm.Event("close"); err != nil {
+		t.Error(err)
+	}
+	if err := fsm.Event("ping"); err != nil {
+		t.Error(err)
+	}
+	if fsm.Current() != "closed" {
+		t.Error("expected state to be 'closed'")
+	}
+	if fsm.allStates[""] {
+		t.Error("expected no empty state")
+	}
+}
+
+func TestUnhandledCallbacks(t *testing.T) {
+	var seen []string
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{EvtName: "open", SrcStates: []string{"closed"}, DstStates: "open"},
+			{EvtName: "close", SrcStates: []string{"open"}, DstStates: "closed"},
+		},
+		Callbacks{
+			"unhandled_open": func(action string, e *Event) {
+				if _, ok := e.Err.(InvalidEventError); !ok || action != ActionUnhandled {
+					t.Error("expected 'InvalidEventError'")
+				}
+				e.Err = nil
+			},
+			"unhandled_state": func(action string, e *Event) {
+				seen = append(seen, e.Src+":"+e.Event)
+			},
+		},
+	)
+
+	err := fsm.Event("close")
+	if _, ok := err.(InvalidEventError); !ok {
+		t.Error("expected 'InvalidEventError'")
+	}
+	err = fsm.Event("knock")
+	if _, ok := err.(UnknownEventError); !ok {
+		t.Error("expected 'UnknownEventError'")
+	}
+
+	if err := fsm.Event("open"); err != nil {
+		t.Error(err)
+	}
+	if err := fsm.Event("open"); err != nil {
+		t.Error("expected the event to be accepted, got", err)
+	}
+	if fsm.Current() != "open" {
+		t.Error("expected state to be 'open'")
+	}
+	if strings.Join(seen, ",") != "closed:close,closed:knock,open:open" {
+		t.Error("expected unhandled events, got", seen)
+	}
+}
+
+func TestWithStates(t *testing.T) {
+	var called []string
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{EvtName: "open", SrcStates: []string{"closed"}, DstStates: "open"},
+			{EvtName: "close", SrcStates: []string{"open"}, DstStates: "closed"},
+		},
+		Callbacks{
+			"enter_open": func(action string, e *Event) {
+				called = append(called, "enter_open")
+			},
+		},
+		WithStates(States{
+			{
+				Name:    "open",
+				OnEnter: func(e *Event) { called = append(called, "OnEnter") },
+				OnExit: func(e *Event) {
+					called = append(called, "OnExit")
+					e.Cancel()
+				},
+			},
+			{Name: "broken"},
+		}),
+	)
+
+	if err := fsm.Event("open"); err != nil {
+		t.Error(err)
+	}
+	err := fsm.Event("close")
+	if _, ok := err.(CanceledError); !ok {
+		t.Error("expected 'CanceledError'")
+	}
+	if fsm.Current() != "open" {
+		t.Error("expected state to be 'open'")
+	}
+	if strings.Join(called, ",") != "enter_open,OnEnter,OnExit" {
+		t.Error("expected state actions, got", called)
+	}
+	if u := fsm.Unreachable(); len(u) != 1 || u[0] != "broken" {
+		t.Error("expected 'broken' to be unreachable, got", u)
+	}
+}
+
+func TestAction(t *testing.T) {
+	var called []string
+	record := func(action string, e *Event) {
+		called = append(called, action)
+	}
+	fail := errors.New("jammed")
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{EvtName: "open", SrcStates: []string{"closed"}, DstStates: "open",
+				Action: func(e *Event) error {
+					called = append(called, "Action")
+					if len(e.Args) > 0 {
+						return fail
+					}
+					return nil
+				}},
+		},
+		Callbacks{
+			"leave_state": record,
+			"enter_state": record,
+		},
+	)
+
+	err := fsm.Event("open", "jam")
+	if err != fail {
+		t.Error("expected the action error")
+	}
+	if fsm.Current() != "closed" {
+		t.Error("expected state to be 'closed'")
+	}
+	if err := fsm.Event("open"); err != nil {
+		t.Error(err)
+	}
+	if fsm.Current() != "open" {
+		t.Error("expected state to be 'open'")
+	}
+	expected := "LeavingState,Action,LeavingState,Action,EnteringState"
+	if strings.Join(called, ",") != expected {
+		t.Error("expected the action between leave and enter, got", called)
+	}
+}
+
+func TestActionPanic(t *testing.T) {
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{EvtName: "open", SrcStates: []string{"closed"}, DstStates: "open",
+				Action: func(e *Event) error { panic("boom") }},
+		},
+		Callbacks{},
+		WithPanicRecovery(),
+	)
+	err := fsm.Event("open")
+	if _, ok := err.(CallbackPanicError); !ok {
+		t.Error("expected 'CallbackPanicError', got", err)
+	}
+	if fsm.Current() != "closed" {
+		t.Error("expected state to be 'closed'")
+	}
+}
+
+func TestEventAllocs(t *testing.T) {
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{EvtName: "open", SrcStates: []string{"closed"}, DstStates: "open"},
+			{EvtName: "close", SrcStates: []string{"open"}, DstStates: "closed"},
+		},
+		Callbacks{},
+	)
+	allocs := testing.AllocsPerRun(100, func() {
+		fsm.Event("open")
+		fsm.Event("close")
+	})
+	if allocs != 0 {
+		t.Error("expected no allocations, got", allocs)
+	}
+}
+
+func BenchmarkEvent(b *testing.B) {
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{EvtName: "open", SrcStates: []string{"closed"}, DstStates: "open"},
+			{EvtName: "close", SrcStates: []string{"open"}, DstStates: "closed"},
+		},
+		Callbacks{},
+	)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if i%2 == 0 {
+			fsm.Event("open")
+		} else {
+			fsm.Event("close")
+		}
+	}
+}
+
+func TestWithoutLocking(t *testing.T) {
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{EvtName: "open", SrcStates: []string{"closed"}, DstStates: "open"},
+			{EvtName: "close", SrcStates: []string{"open"}, DstStates: "closed"},
+		},
+		Callbacks{
+			"enter_open": func(action string, e *Event) {
+				// Would deadlock if the FSM locked its state while
+				// calling callbacks with a write lock pending.
+				e.FSM.SetMetadata("opened", e.FSM.Current())
+			},
+		},
+		WithoutLocking(),
+	)
+	if err := fsm.Event("open"); err != nil {
+		t.Error(err)
+	}
+	if v, _ := fsm.Metadata("opened"); v != "open" || !fsm.Can("close") {
+		t.Error("expected the FSM to work without locking")
+	}
+}
+
+func BenchmarkEventWithoutLocking(b *testing.B) {
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{EvtName: "open", SrcStates: []string{"closed"}, DstStates: "open"},
+			{EvtName: "close", SrcStates: []string{"open"}, DstStates: "closed"},
+		},
+		Callbacks{},
+		WithoutLocking(),
+	)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if i%2 == 0 {
+			fsm.Event("open")
+		} else {
+			fsm.Event("close")
+		}
+	}
+}
+
+func BenchmarkCurrentParallel(b *testing.B) {
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{EvtName: "open", SrcStates: []string{"closed"}, DstStates: "open"},
+			{EvtName: "close", SrcStates: []string{"open"}, DstStates: "closed"},
+		},
+		Callbacks{},
+	)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				fsm.Event("open")
+				fsm.Event("close")
+			}
+		}
+	}()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			fsm.Current()
+		}
+	})
+}
+
 func ExampleNewFSM() {
 	fsm := NewFSM(
 		"green",
@@ -708,6 +2168,25 @@ func ExampleFSM_Is() {
 	// false
 }
 
+func ExampleFSM_IsAny() {
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{EvtName: "open", SrcStates: []string{"closed", "locked"}, DstStates: "open"},
+			{EvtName: "close", SrcStates: []string{"open"}, DstStates: "closed"},
+			{EvtName: "lock", SrcStates: []string{"closed"}, DstStates: "locked"},
+		},
+		Callbacks{},
+	)
+	fmt.Println(fsm.IsAny("closed", "locked"))
+	fmt.Println(fsm.IsAny("open"))
+	fmt.Println(fsm.IsNot("open", "locked"))
+	// Output:
+	// true
+	// false
+	// true
+}
+
 func ExampleFSM_Can() {
 	fsm := NewFSM(
 		"closed",
@@ -734,10 +2213,7 @@ func ExampleFSM_AvailableTransitions() {
 		},
 		Callbacks{},
 	)
-	// sort the results ordering is consistent for the output checker
-	transitions := fsm.AvailableTransitions()
-	sort.Strings(transitions)
-	fmt.Println(transitions)
+	fmt.Println(fsm.AvailableTransitions())
 	// Output:
 	// [kick open]
 }
@@ -812,7 +2288,7 @@ func ExampleFSM_Transition() {
 	// open
 }
 
-func ExampleFSM_OnStateTransition() {
+func ExampleFSM_Event_onStateTransition() {
 	onStateCalled := false
 	fsm := NewFSM(
 		"closed",
@@ -844,7 +2320,7 @@ func ExampleFSM_OnStateTransition() {
 	}
 }
 
-func ExampleFSM_OnStateTransitionCancelled() {
+func ExampleFSM_Event_onStateTransitionCancelled() {
 	fsm := NewFSM(
 		"closed",
 		Events{
@@ -872,7 +2348,7 @@ func ExampleFSM_OnStateTransitionCancelled() {
 	// closed
 }
 
-func ExampleFSM_MultipleEventOnSameState() {
+func ExampleFSM_Event_multipleEventOnSameState() {
 	counter := 0
 	fsm := NewFSM(
 		"Idle",
@@ -932,7 +2408,7 @@ func ExampleFSM_MultipleEventOnSameState() {
 	// 1
 }
 
-func ExampleFSM_OnStateTransitionSameEvent() {
+func ExampleFSM_Event_onStateTransitionSameEvent() {
 	fsm := NewFSM(
 		"state1",
 		Events{
@@ -1007,7 +2483,7 @@ func ExampleFSM_OnStateTransitionSameEvent() {
 }
 
 
-func ExampleFSM_OnStateTransitionSameEvent2() {
+func ExampleFSM_Event_onStateTransitionSameEvent2() {
 	fsm := NewFSM(
 		"state1",
 		Events{
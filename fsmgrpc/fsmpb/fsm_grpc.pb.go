@@ -0,0 +1,267 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: fsm.proto
+
+package fsmpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	FSMService_GetState_FullMethodName         = "/fsm.v1.FSMService/GetState"
+	FSMService_FireEvent_FullMethodName        = "/fsm.v1.FSMService/FireEvent"
+	FSMService_ListTransitions_FullMethodName  = "/fsm.v1.FSMService/ListTransitions"
+	FSMService_WatchTransitions_FullMethodName = "/fsm.v1.FSMService/WatchTransitions"
+)
+
+// FSMServiceClient is the client API for FSMService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// FSMService drives FSM instances identified by ID.
+type FSMServiceClient interface {
+	// GetState returns the current state of an instance.
+	GetState(ctx context.Context, in *GetStateRequest, opts ...grpc.CallOption) (*GetStateResponse, error)
+	// FireEvent sends an event to an instance.
+	FireEvent(ctx context.Context, in *FireEventRequest, opts ...grpc.CallOption) (*FireEventResponse, error)
+	// ListTransitions returns the transitions available in the current state
+	// of an instance.
+	ListTransitions(ctx context.Context, in *ListTransitionsRequest, opts ...grpc.CallOption) (*ListTransitionsResponse, error)
+	// WatchTransitions streams the transitions of an instance as they happen.
+	WatchTransitions(ctx context.Context, in *WatchTransitionsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Transition], error)
+}
+
+type fSMServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewFSMServiceClient(cc grpc.ClientConnInterface) FSMServiceClient {
+	return &fSMServiceClient{cc}
+}
+
+func (c *fSMServiceClient) GetState(ctx context.Context, in *GetStateRequest, opts ...grpc.CallOption) (*GetStateResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetStateResponse)
+	err := c.cc.Invoke(ctx, FSMService_GetState_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fSMServiceClient) FireEvent(ctx context.Context, in *FireEventRequest, opts ...grpc.CallOption) (*FireEventResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(FireEventResponse)
+	err := c.cc.Invoke(ctx, FSMService_FireEvent_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fSMServiceClient) ListTransitions(ctx context.Context, in *ListTransitionsRequest, opts ...grpc.CallOption) (*ListTransitionsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListTransitionsResponse)
+	err := c.cc.Invoke(ctx, FSMService_ListTransitions_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fSMServiceClient) WatchTransitions(ctx context.Context, in *WatchTransitionsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Transition], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &FSMService_ServiceDesc.Streams[0], FSMService_WatchTransitions_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchTransitionsRequest, Transition]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type FSMService_WatchTransitionsClient = grpc.ServerStreamingClient[Transition]
+
+// FSMServiceServer is the server API for FSMService service.
+// All implementations must embed UnimplementedFSMServiceServer
+// for forward compatibility.
+//
+// FSMService drives FSM instances identified by ID.
+type FSMServiceServer interface {
+	// GetState returns the current state of an instance.
+	GetState(context.Context, *GetStateRequest) (*GetStateResponse, error)
+	// FireEvent sends an event to an instance.
+	FireEvent(context.Context, *FireEventRequest) (*FireEventResponse, error)
+	// ListTransitions returns the transitions available in the current state
+	// of an instance.
+	ListTransitions(context.Context, *ListTransitionsRequest) (*ListTransitionsResponse, error)
+	// WatchTransitions streams the transitions of an instance as they happen.
+	WatchTransitions(*WatchTransitionsRequest, grpc.ServerStreamingServer[Transition]) error
+	mustEmbedUnimplementedFSMServiceServer()
+}
+
+// UnimplementedFSMServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedFSMServiceServer struct{}
+
+func (UnimplementedFSMServiceServer) GetState(context.Context, *GetStateRequest) (*GetStateResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetState not implemented")
+}
+func (UnimplementedFSMServiceServer) FireEvent(context.Context, *FireEventRequest) (*FireEventResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method FireEvent not implemented")
+}
+func (UnimplementedFSMServiceServer) ListTransitions(context.Context, *ListTransitionsRequest) (*ListTransitionsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListTransitions not implemented")
+}
+func (UnimplementedFSMServiceServer) WatchTransitions(*WatchTransitionsRequest, grpc.ServerStreamingServer[Transition]) error {
+	return status.Errorf(codes.Unimplemented, "method WatchTransitions not implemented")
+}
+func (UnimplementedFSMServiceServer) mustEmbedUnimplementedFSMServiceServer() {}
+func (UnimplementedFSMServiceServer) testEmbeddedByValue()                    {}
+
+// UnsafeFSMServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to FSMServiceServer will
+// result in compilation errors.
+type UnsafeFSMServiceServer interface {
+	mustEmbedUnimplementedFSMServiceServer()
+}
+
+func RegisterFSMServiceServer(s grpc.ServiceRegistrar, srv FSMServiceServer) {
+	// If the following call pancis, it indicates UnimplementedFSMServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&FSMService_ServiceDesc, srv)
+}
+
+func _FSMService_GetState_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetStateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FSMServiceServer).GetState(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FSMService_GetState_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FSMServiceServer).GetState(ctx, req.(*GetStateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FSMService_FireEvent_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FireEventRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FSMServiceServer).FireEvent(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FSMService_FireEvent_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FSMServiceServer).FireEvent(ctx, req.(*FireEventRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FSMService_ListTransitions_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListTransitionsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FSMServiceServer).ListTransitions(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FSMService_ListTransitions_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FSMServiceServer).ListTransitions(ctx, req.(*ListTransitionsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FSMService_WatchTransitions_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchTransitionsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(FSMServiceServer).WatchTransitions(m, &grpc.GenericServerStream[WatchTransitionsRequest, Transition]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type FSMService_WatchTransitionsServer = grpc.ServerStreamingServer[Transition]
+
+// FSMService_ServiceDesc is the grpc.ServiceDesc for FSMService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var FSMService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "fsm.v1.FSMService",
+	HandlerType: (*FSMServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetState",
+			Handler:    _FSMService_GetState_Handler,
+		},
+		{
+			MethodName: "FireEvent",
+			Handler:    _FSMService_FireEvent_Handler,
+		},
+		{
+			MethodName: "ListTransitions",
+			Handler:    _FSMService_ListTransitions_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchTransitions",
+			Handler:       _FSMService_WatchTransitions_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "fsm.proto",
+}
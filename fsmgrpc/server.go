@@ -0,0 +1,208 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fsmgrpc exposes FSM instances as a gRPC service, see fsm.proto, so
+// that other services and clients in any language can drive them remotely.
+//
+// It is a separate module so that the fsm package does not depend on gRPC.
+package fsmgrpc
+
+import (
+	"context"
+	"sync"
+
+	"github.com/papiguy/fsm"
+	"github.com/papiguy/fsm/fsmgrpc/fsmpb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Manager gives the FSM instances served, by ID.
+type Manager interface {
+	// Get returns the instance id, or false if there is none.
+	Get(id string) (*fsm.FSM, bool)
+}
+
+// ManagerFunc is an adapter to use an ordinary function as a Manager.
+type ManagerFunc func(id string) (*fsm.FSM, bool)
+
+// Get calls fn(id).
+func (fn ManagerFunc) Get(id string) (*fsm.FSM, bool) {
+	return fn(id)
+}
+
+// Server implements fsmpb.FSMServiceServer over the instances of a Manager.
+//
+// Errors of events are returned with the gRPC status codes:
+//
+//   - NotFound for an unknown instance
+//   - InvalidArgument for an unknown event
+//   - FailedPrecondition for an event that is not valid in the current state,
+//     or while an asynchronous transition is in progress
+//   - Aborted for an event canceled or rejected by a guard
+//   - Unknown for other errors
+type Server struct {
+	fsmpb.UnimplementedFSMServiceServer
+
+	manager Manager
+
+	mu       sync.Mutex
+	watchers map[*fsm.FSM]*watchers
+}
+
+// NewServer returns a Server for the instances of manager.
+func NewServer(manager Manager) *Server {
+	return &Server{
+		manager:  manager,
+		watchers: make(map[*fsm.FSM]*watchers),
+	}
+}
+
+// GetState returns the current state of an instance.
+func (s *Server) GetState(ctx context.Context, req *fsmpb.GetStateRequest) (*fsmpb.GetStateResponse, error) {
+	f, err := s.get(req.Id)
+	if err != nil {
+		return nil, err
+	}
+	return &fsmpb.GetStateResponse{State: f.Current(), Sequence: f.Sequence()}, nil
+}
+
+// FireEvent sends an event to an instance, with the arguments as strings.
+func (s *Server) FireEvent(ctx context.Context, req *fsmpb.FireEventRequest) (*fsmpb.FireEventResponse, error) {
+	f, err := s.get(req.Id)
+	if err != nil {
+		return nil, err
+	}
+	args := make([]interface{}, len(req.Args))
+	for i, arg := range req.Args {
+		args[i] = arg
+	}
+	switch err := f.EventCtx(ctx, req.Event, args...); err.(type) {
+	case nil, fsm.AsyncError, fsm.QueuedError:
+	case fsm.UnknownEventError:
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	case fsm.InvalidEventError, fsm.InTransitionError:
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	case fsm.CanceledError, fsm.GuardFailedError:
+		return nil, status.Error(codes.Aborted, err.Error())
+	case fsm.AbortedError:
+		return nil, status.FromContextError(err).Err()
+	default:
+		return nil, status.Error(codes.Unknown, err.Error())
+	}
+	return &fsmpb.FireEventResponse{State: f.Current()}, nil
+}
+
+// ListTransitions returns the transitions available in the current state of
+// an instance.
+func (s *Server) ListTransitions(ctx context.Context, req *fsmpb.ListTransitionsRequest) (*fsmpb.ListTransitionsResponse, error) {
+	f, err := s.get(req.Id)
+	if err != nil {
+		return nil, err
+	}
+	src := f.Current()
+	resp := &fsmpb.ListTransitionsResponse{}
+	for _, event := range f.AvailableTransitions() {
+		if desc, ok := f.Lookup(event, src); ok {
+			resp.Transitions = append(resp.Transitions, &fsmpb.Transition{
+				Event: event,
+				Src:   src,
+				Dst:   desc.DstStates,
+			})
+		}
+	}
+	return resp, nil
+}
+
+// WatchTransitions streams the transitions of an instance until the client
+// goes away. Transitions are dropped for a client that does not keep up.
+func (s *Server) WatchTransitions(req *fsmpb.WatchTransitionsRequest, stream fsmpb.FSMService_WatchTransitionsServer) error {
+	f, err := s.get(req.Id)
+	if err != nil {
+		return err
+	}
+
+	ch := make(chan *fsmpb.Transition, watchBuffer)
+	w := s.watch(f)
+	w.add(ch)
+	defer w.remove(ch)
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case t := <-ch:
+			if err := stream.Send(t); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// get returns the instance id, or a NotFound error.
+func (s *Server) get(id string) (*fsm.FSM, error) {
+	f, ok := s.manager.Get(id)
+	if !ok {
+		return nil, status.Error(codes.NotFound, fsm.NotFoundError{ID: id}.Error())
+	}
+	return f, nil
+}
+
+// watch returns the watchers of f, adding them as an observer of f the first
+// time.
+func (s *Server) watch(f *fsm.FSM) *watchers {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w, ok := s.watchers[f]
+	if !ok {
+		w = &watchers{chans: make(map[chan *fsmpb.Transition]struct{})}
+		s.watchers[f] = w
+		f.AddObserver(w)
+	}
+	return w
+}
+
+// watchBuffer is the number of transitions buffered for each watching client.
+const watchBuffer = 64
+
+// watchers is an fsm.Observer sending the transitions of a FSM to the
+// clients watching it.
+type watchers struct {
+	mu    sync.Mutex
+	chans map[chan *fsmpb.Transition]struct{}
+}
+
+func (w *watchers) add(ch chan *fsmpb.Transition) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.chans[ch] = struct{}{}
+}
+
+func (w *watchers) remove(ch chan *fsmpb.Transition) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.chans, ch)
+}
+
+// OnTransition sends the transition to the clients, without blocking.
+func (w *watchers) OnTransition(src, dst, event string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for ch := range w.chans {
+		select {
+		case ch <- &fsmpb.Transition{Event: event, Src: src, Dst: dst}:
+		default:
+		}
+	}
+}
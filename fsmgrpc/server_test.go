@@ -0,0 +1,134 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsmgrpc
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/papiguy/fsm"
+	"github.com/papiguy/fsm/fsmgrpc/fsmpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func newClient(t *testing.T, f *fsm.FSM) (fsmpb.FSMServiceClient, *Server) {
+	lis := bufconn.Listen(1 << 16)
+	srv := grpc.NewServer()
+	s := NewServer(ManagerFunc(func(id string) (*fsm.FSM, bool) {
+		return f, id == "door-1"
+	}))
+	fsmpb.RegisterFSMServiceServer(srv, s)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return fsmpb.NewFSMServiceClient(conn), s
+}
+
+func newDoor() *fsm.FSM {
+	return fsm.NewFSM(
+		"closed",
+		fsm.Events{
+			{EvtName: "open", SrcStates: []string{"closed"}, DstStates: "open"},
+			{EvtName: "close", SrcStates: []string{"open"}, DstStates: "closed"},
+		},
+		fsm.Callbacks{},
+	)
+}
+
+func TestServer(t *testing.T) {
+	door := newDoor()
+	client, _ := newClient(t, door)
+	ctx := context.Background()
+
+	state, err := client.GetState(ctx, &fsmpb.GetStateRequest{Id: "door-1"})
+	if err != nil || state.State != "closed" {
+		t.Fatalf("expected state closed, got %v, %v", state, err)
+	}
+
+	list, err := client.ListTransitions(ctx, &fsmpb.ListTransitionsRequest{Id: "door-1"})
+	if err != nil || len(list.Transitions) != 1 || list.Transitions[0].Dst != "open" {
+		t.Fatalf("expected the open transition, got %v, %v", list, err)
+	}
+
+	fired, err := client.FireEvent(ctx, &fsmpb.FireEventRequest{Id: "door-1", Event: "open"})
+	if err != nil || fired.State != "open" {
+		t.Fatalf("expected state open, got %v, %v", fired, err)
+	}
+
+	for _, c := range []struct {
+		id, event string
+		code      codes.Code
+	}{
+		{"door-2", "open", codes.NotFound},
+		{"door-1", "knock", codes.InvalidArgument},
+		{"door-1", "open", codes.FailedPrecondition},
+	} {
+		_, err := client.FireEvent(ctx, &fsmpb.FireEventRequest{Id: c.id, Event: c.event})
+		if status.Code(err) != c.code {
+			t.Errorf("expected %v for %s on %s, got %v", c.code, c.event, c.id, err)
+		}
+	}
+}
+
+func TestWatchTransitions(t *testing.T) {
+	door := newDoor()
+	client, srv := newClient(t, door)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := client.WatchTransitions(ctx, &fsmpb.WatchTransitionsRequest{Id: "door-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Wait for the server to register the watch.
+	w := srv.watch(door)
+	for {
+		w.mu.Lock()
+		n := len(w.chans)
+		w.mu.Unlock()
+		if n > 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	door.Event("open")
+	door.Event("close")
+	for _, expected := range []string{"open", "close"} {
+		tr, err := stream.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tr.Event != expected {
+			t.Errorf("expected %s, got %v", expected, tr)
+		}
+	}
+}
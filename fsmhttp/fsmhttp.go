@@ -0,0 +1,194 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fsmhttp exposes FSMs over HTTP, with REST endpoints to read their
+// state and fire events, for example to bolt an admin UI onto a machine.
+// OpenAPI and ManagerOpenAPI describe the endpoints, to generate clients.
+package fsmhttp
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/papiguy/fsm"
+)
+
+// Manager gives the FSM instances served by NewManagerHandler, by ID.
+type Manager interface {
+	// Get returns the instance id, or false if there is none.
+	Get(id string) (*fsm.FSM, bool)
+}
+
+// ManagerFunc is an adapter to use an ordinary function as a Manager.
+type ManagerFunc func(id string) (*fsm.FSM, bool)
+
+// Get calls fn(id).
+func (fn ManagerFunc) Get(id string) (*fsm.FSM, bool) {
+	return fn(id)
+}
+
+// State is the response of GET /state.
+type State struct {
+	State    string `json:"state"`
+	Sequence uint64 `json:"sequence"`
+}
+
+// Transition is a transition in the response of GET /transitions.
+type Transition struct {
+	Event string `json:"event"`
+	Src   string `json:"src"`
+	Dst   string `json:"dst"`
+}
+
+// EventRequest is the optional body of POST /events/{name}.
+type EventRequest struct {
+	// Args are passed to the event, decoded from JSON.
+	Args []interface{} `json:"args"`
+}
+
+// Error is the body of error responses.
+type Error struct {
+	Error string `json:"error"`
+}
+
+// NewHandler returns a handler serving f with the endpoints:
+//
+//   - GET /state returns the State
+//   - POST /events/{name} fires an event, with an optional EventRequest, and
+//     returns the State after it
+//   - GET /transitions returns the Transitions available in the current state
+//   - GET /diagram returns the graph of f in Graphviz format, see FSM.ToDOT
+//
+// Errors of events are returned with the status codes:
+//
+//   - 202 Accepted for an event starting an asynchronous transition or queued
+//   - 404 Not Found for an unknown event
+//   - 409 Conflict for an event that is not valid in the current state, or
+//     while an asynchronous transition is in progress
+//   - 422 Unprocessable Entity for an event canceled or rejected by a guard
+//   - 500 Internal Server Error for other errors
+//
+// Mount it under a prefix with http.StripPrefix.
+func NewHandler(f *fsm.FSM) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serve(w, r, f, r.URL.Path)
+	})
+}
+
+// NewManagerHandler returns a handler serving the instances of m, with the
+// endpoints of NewHandler under /{id}, e.g. GET /{id}/state.
+func NewManagerHandler(m Manager) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, path, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+		if id, err := url.PathUnescape(id); err == nil {
+			if f, ok := m.Get(id); ok {
+				serve(w, r, f, "/"+path)
+				return
+			}
+		}
+		writeError(w, http.StatusNotFound, fsm.NotFoundError{ID: id})
+	})
+}
+
+// serve serves the endpoint at path of f.
+func serve(w http.ResponseWriter, r *http.Request, f *fsm.FSM, path string) {
+	if name, ok := strings.CutPrefix(path, "/events/"); ok {
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w, http.MethodPost)
+			return
+		}
+		fireEvent(w, r, f, name)
+		return
+	}
+
+	switch path {
+	case "/state", "/transitions", "/diagram":
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	switch path {
+	case "/state":
+		writeJSON(w, http.StatusOK, State{f.Current(), f.Sequence()})
+	case "/transitions":
+		src := f.Current()
+		transitions := []Transition{}
+		for _, event := range f.AvailableTransitions() {
+			if desc, ok := f.Lookup(event, src); ok {
+				transitions = append(transitions, Transition{event, src, desc.DstStates})
+			}
+		}
+		writeJSON(w, http.StatusOK, transitions)
+	case "/diagram":
+		w.Header().Set("Content-Type", "text/vnd.graphviz; charset=utf-8")
+		io.WriteString(w, f.ToDOT())
+	}
+}
+
+// fireEvent fires the event name on f.
+func fireEvent(w http.ResponseWriter, r *http.Request, f *fsm.FSM, name string) {
+	name, err := url.PathUnescape(name)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	var req EventRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	code := http.StatusOK
+	switch err := f.EventCtx(r.Context(), name, req.Args...); err.(type) {
+	case nil:
+	case fsm.AsyncError, fsm.QueuedError:
+		code = http.StatusAccepted
+	case fsm.UnknownEventError:
+		writeError(w, http.StatusNotFound, err)
+		return
+	case fsm.InvalidEventError, fsm.InTransitionError:
+		writeError(w, http.StatusConflict, err)
+		return
+	case fsm.CanceledError, fsm.GuardFailedError:
+		writeError(w, http.StatusUnprocessableEntity, err)
+		return
+	default:
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, code, State{f.Current(), f.Sequence()})
+}
+
+func methodNotAllowed(w http.ResponseWriter, method string) {
+	w.Header().Set("Allow", method)
+	writeJSON(w, http.StatusMethodNotAllowed, Error{"method not allowed"})
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, Error{err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsmhttp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/papiguy/fsm"
+)
+
+func newDoor() *fsm.FSM {
+	return fsm.NewFSM(
+		"closed",
+		fsm.Events{
+			{EvtName: "open", SrcStates: []string{"closed"}, DstStates: "open"},
+			{EvtName: "close", SrcStates: []string{"open"}, DstStates: "closed"},
+		},
+		fsm.Callbacks{},
+	)
+}
+
+func do(h http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+	return w
+}
+
+func TestHandler(t *testing.T) {
+	h := NewHandler(newDoor())
+
+	for _, c := range []struct {
+		method, path, body string
+		code               int
+		response           string
+	}{
+		{"GET", "/state", "", 200, `{"state":"closed","sequence":0}`},
+		{"GET", "/transitions", "", 200, `[{"event":"open","src":"closed","dst":"open"}]`},
+		{"POST", "/events/open", `{"args":["key"]}`, 200, `{"state":"open","sequence":1}`},
+		{"POST", "/events/open", "", 409, `{"error":"event open inappropriate in current state open, available events: close"}`},
+		{"POST", "/events/knock", "", 404, `{"error":"event knock does not exist"}`},
+		{"POST", "/events/close", "{", 400, `{"error":"unexpected EOF"}`},
+		{"GET", "/events/close", "", 405, `{"error":"method not allowed"}`},
+		{"POST", "/state", "", 405, `{"error":"method not allowed"}`},
+		{"GET", "/transitions", "", 200, `[{"event":"close","src":"open","dst":"closed"}]`},
+		{"GET", "/other", "", 404, "404 page not found"},
+	} {
+		w := do(h, c.method, c.path, c.body)
+		if w.Code != c.code || strings.TrimSpace(w.Body.String()) != c.response {
+			t.Errorf("%s %s: expected %d %s, got %d %s", c.method, c.path, c.code, c.response, w.Code, w.Body)
+		}
+	}
+
+	w := do(h, "GET", "/diagram", "")
+	if w.Header().Get("Content-Type") != "text/vnd.graphviz; charset=utf-8" ||
+		!strings.HasPrefix(w.Body.String(), "digraph") {
+		t.Errorf("expected a Graphviz diagram, got %s", w.Body)
+	}
+}
+
+func TestManagerHandler(t *testing.T) {
+	door := newDoor()
+	h := NewManagerHandler(ManagerFunc(func(id string) (*fsm.FSM, bool) {
+		return door, id == "front door"
+	}))
+
+	if w := do(h, "POST", "/front%20door/events/open", ""); w.Code != 200 {
+		t.Errorf("expected 200, got %d %s", w.Code, w.Body)
+	}
+	if w := do(h, "GET", "/front%20door/state", ""); !strings.Contains(w.Body.String(), `"state":"open"`) {
+		t.Errorf("expected state open, got %s", w.Body)
+	}
+	w := do(h, "GET", "/back/state", "")
+	if w.Code != 404 || strings.TrimSpace(w.Body.String()) != `{"error":"instance back not found"}` {
+		t.Errorf("expected 404, got %d %s", w.Code, w.Body)
+	}
+}
+
+func TestFSMManager(t *testing.T) {
+	def := fsm.NewDefinition(fsm.Events{
+		{EvtName: "open", SrcStates: []string{"closed"}, DstStates: "open"},
+	}, fsm.Callbacks{})
+	m := fsm.NewManager(def, "closed")
+	if _, err := m.Create(context.Background(), "front"); err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewManagerHandler(m)
+	if w := do(h, "POST", "/front/events/open", ""); w.Code != 200 {
+		t.Errorf("expected 200, got %d %s", w.Code, w.Body)
+	}
+	if w := do(h, "GET", "/back/state", ""); w.Code != 404 {
+		t.Errorf("expected 404, got %d %s", w.Code, w.Body)
+	}
+}
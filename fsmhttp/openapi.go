@@ -0,0 +1,169 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsmhttp
+
+import (
+	"encoding/json"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/papiguy/fsm"
+)
+
+// OpenAPI returns an OpenAPI 3 document, in JSON, describing the endpoints of
+// NewHandler serving f, with title and version as the info of the API. Each
+// event of f has its own path under /events/, described with its sources,
+// destinations and EventDesc.Description, and the states of f are listed in
+// the State schema, so that typed clients can be generated.
+//
+// The document can be served next to the handler:
+//
+//	doc, err := fsmhttp.OpenAPI(f, "Door API", "1.0.0")
+//	...
+//	mux.HandleFunc("/openapi.json", func(w http.ResponseWriter, r *http.Request) {
+//		w.Header().Set("Content-Type", "application/json")
+//		w.Write(doc)
+//	})
+func OpenAPI(f *fsm.FSM, title, version string) ([]byte, error) {
+	return json.Marshal(openAPI(f, title, version, ""))
+}
+
+// ManagerOpenAPI returns an OpenAPI 3 document, in JSON, describing the
+// endpoints of NewManagerHandler serving instances with the definition of f,
+// as OpenAPI does for NewHandler, under /{id}.
+func ManagerOpenAPI(f *fsm.FSM, title, version string) ([]byte, error) {
+	return json.Marshal(openAPI(f, title, version, "/{id}"))
+}
+
+// object is a JSON object of an OpenAPI document.
+type object map[string]interface{}
+
+// openAPI returns the document of the endpoints of f under prefix, which has
+// an id parameter if not empty.
+func openAPI(f *fsm.FSM, title, version, prefix string) object {
+	errorResponse := func(description string) object {
+		return object{"description": description, "content": jsonContent("Error")}
+	}
+	operation := func(id, summary string, responses object) object {
+		op := object{"operationId": id, "summary": summary, "responses": responses}
+		if prefix != "" {
+			op["parameters"] = []object{{
+				"name": "id", "in": "path", "required": true,
+				"description": "ID of the instance", "schema": object{"type": "string"},
+			}}
+			responses["404"] = errorResponse("Unknown instance")
+		}
+		return op
+	}
+
+	paths := object{
+		prefix + "/state": object{"get": operation("getState", "Get the current state", object{
+			"200": object{"description": "The current state", "content": jsonContent("State")},
+		})},
+		prefix + "/transitions": object{"get": operation("getTransitions", "List the transitions available in the current state", object{
+			"200": object{"description": "The available transitions", "content": object{
+				"application/json": object{"schema": object{"type": "array", "items": ref("Transition")}},
+			}},
+		})},
+		prefix + "/diagram": object{"get": operation("getDiagram", "Get the diagram of the state machine in Graphviz format", object{
+			"200": object{"description": "The diagram", "content": object{
+				"text/vnd.graphviz": object{"schema": object{"type": "string"}},
+			}},
+		})},
+	}
+
+	src := make(map[string][]string)
+	dst := make(map[string][]string)
+	for _, e := range f.Transitions() {
+		src[e.Event] = appendState(src[e.Event], e.Src)
+		dst[e.Event] = appendState(dst[e.Event], e.Dst)
+	}
+	for _, event := range f.EventNames() {
+		op := operation("fire_"+event, "Fire the event "+event, object{
+			"200": object{"description": "The state after the event", "content": jsonContent("State")},
+			"202": object{"description": "The event started an asynchronous transition or was queued", "content": jsonContent("State")},
+			"400": errorResponse("Malformed request"),
+			"409": errorResponse("The event is not valid in the current state, or a transition is in progress"),
+			"422": errorResponse("The event was canceled or rejected by a guard"),
+			"500": errorResponse("The event failed"),
+		})
+		description := "From " + strings.Join(src[event], ", ") + " to " + strings.Join(dst[event], ", ") + "."
+		if len(src[event]) > 0 {
+			if desc, ok := f.Lookup(event, src[event][0]); ok && desc.Description != "" {
+				description = desc.Description + "\n\n" + description
+			}
+		}
+		op["description"] = description
+		op["requestBody"] = object{"required": false, "content": jsonContent("EventRequest")}
+		paths[prefix+"/events/"+url.PathEscape(event)] = object{"post": op}
+	}
+
+	return object{
+		"openapi": "3.0.3",
+		"info":    object{"title": title, "version": version},
+		"paths":   paths,
+		"components": object{"schemas": object{
+			"State": object{
+				"type":     "object",
+				"required": []string{"state", "sequence"},
+				"properties": object{
+					"state":    object{"type": "string", "enum": f.States()},
+					"sequence": object{"type": "integer", "format": "int64", "minimum": 0},
+				},
+			},
+			"Transition": object{
+				"type":     "object",
+				"required": []string{"event", "src", "dst"},
+				"properties": object{
+					"event": object{"type": "string", "enum": f.EventNames()},
+					"src":   object{"type": "string"},
+					"dst":   object{"type": "string"},
+				},
+			},
+			"EventRequest": object{
+				"type": "object",
+				"properties": object{
+					"args": object{"type": "array", "items": object{}, "description": "Arguments of the event"},
+				},
+			},
+			"Error": object{
+				"type":       "object",
+				"required":   []string{"error"},
+				"properties": object{"error": object{"type": "string"}},
+			},
+		}},
+	}
+}
+
+// jsonContent returns the JSON content of a request or response with the
+// schema name.
+func jsonContent(name string) object {
+	return object{"application/json": object{"schema": ref(name)}}
+}
+
+// ref returns a reference to the schema name.
+func ref(name string) object {
+	return object{"$ref": "#/components/schemas/" + name}
+}
+
+// appendState adds state to the sorted states, unless it is already there.
+func appendState(states []string, state string) []string {
+	i := sort.SearchStrings(states, state)
+	if i < len(states) && states[i] == state {
+		return states
+	}
+	return append(states[:i], append([]string{state}, states[i:]...)...)
+}
@@ -0,0 +1,100 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsmhttp
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/papiguy/fsm"
+)
+
+func TestOpenAPI(t *testing.T) {
+	f := fsm.NewFSM(
+		"closed",
+		fsm.Events{
+			{EvtName: "open", SrcStates: []string{"closed"}, DstStates: "open", Description: "Open the door."},
+			{EvtName: "close", SrcStates: []string{"open"}, DstStates: "closed"},
+			{EvtName: "lock", SrcStates: []string{"closed"}, DstStates: "locked"},
+		},
+		fsm.Callbacks{},
+	)
+	data, err := OpenAPI(f, "Door API", "1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		OpenAPI string `json:"openapi"`
+		Info    struct {
+			Title   string `json:"title"`
+			Version string `json:"version"`
+		} `json:"info"`
+		Paths map[string]map[string]struct {
+			OperationID string            `json:"operationId"`
+			Description string            `json:"description"`
+			Parameters  []json.RawMessage `json:"parameters"`
+			Responses   map[string]json.RawMessage
+		} `json:"paths"`
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]struct {
+					Enum []string `json:"enum"`
+				} `json:"properties"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.OpenAPI != "3.0.3" || doc.Info.Title != "Door API" || doc.Info.Version != "1.0.0" {
+		t.Errorf("unexpected header %s %+v", doc.OpenAPI, doc.Info)
+	}
+	if len(doc.Paths) != 6 {
+		t.Errorf("expected 6 paths, got %d", len(doc.Paths))
+	}
+	open := doc.Paths["/events/open"]["post"]
+	if open.OperationID != "fire_open" || open.Description != "Open the door.\n\nFrom closed to open." {
+		t.Errorf("unexpected event operation %+v", open)
+	}
+	if _, ok := open.Responses["409"]; !ok {
+		t.Error("expected the conflict response to be documented")
+	}
+	if get := doc.Paths["/state"]["get"]; get.OperationID != "getState" || len(get.Parameters) != 0 {
+		t.Errorf("unexpected state operation %+v", get)
+	}
+	if states := doc.Components.Schemas["State"].Properties["state"].Enum; fmt.Sprint(states) != "[closed locked open]" {
+		t.Errorf("expected the states in the schema, got %v", states)
+	}
+
+	data, err = ManagerOpenAPI(f, "Doors API", "1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc.Paths = nil
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	get := doc.Paths["/{id}/state"]["get"]
+	if len(get.Parameters) != 1 {
+		t.Error("expected the id parameter")
+	}
+	if _, ok := get.Responses["404"]; !ok {
+		t.Error("expected the unknown instance response to be documented")
+	}
+	if _, ok := doc.Paths["/{id}/events/lock"]; !ok {
+		t.Error("expected the events under the instance")
+	}
+}
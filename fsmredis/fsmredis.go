@@ -0,0 +1,112 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fsmredis implements fsm.Store on Redis.
+//
+// It is a separate module so that the fsm package does not depend on a Redis
+// client.
+package fsmredis
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/papiguy/fsm"
+	"github.com/redis/go-redis/v9"
+)
+
+// maxRetries is the number of times Save retries when the instance is
+// modified while it is saving.
+const maxRetries = 10
+
+// Store is a fsm.Store keeping each instance in a Redis hash, with the
+// sequence number of the state in the field "version" and the encoded state in
+// the field "state".
+//
+// Save uses optimistic locking: it watches the hash and only writes the state
+// if its sequence number directly follows the saved one, so that many replicas
+// can safely drive the same instance.
+type Store struct {
+	// Codec encodes the states. If nil, the codec passed in the context by
+	// the FSM is used, see fsm.WithCodec, or fsm.JSONCodec.
+	Codec fsm.Codec
+
+	client redis.UniversalClient
+	prefix string
+}
+
+// NewStore returns a Store using client, keeping instance id in the key
+// prefix + id.
+func NewStore(client redis.UniversalClient, prefix string) *Store {
+	return &Store{client: client, prefix: prefix}
+}
+
+// Load returns the state saved for instance id, or a fsm.NotFoundError.
+func (s *Store) Load(ctx context.Context, id string) (fsm.Snapshot, error) {
+	var snapshot fsm.Snapshot
+	data, err := s.client.HGet(ctx, s.prefix+id, "state").Bytes()
+	if err == redis.Nil {
+		return snapshot, fsm.NotFoundError{ID: id}
+	}
+	if err != nil {
+		return snapshot, err
+	}
+	err = s.codec(ctx).Unmarshal(data, &snapshot)
+	return snapshot, err
+}
+
+// Save saves the state of instance id. It returns a fsm.ConflictError unless
+// the state saved has the sequence number just before snapshot, or no state is
+// saved and snapshot has sequence number 0 or 1.
+func (s *Store) Save(ctx context.Context, id string, snapshot fsm.Snapshot) error {
+	data, err := s.codec(ctx).Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+
+	key := s.prefix + id
+	save := func(tx *redis.Tx) error {
+		version, err := tx.HGet(ctx, key, "version").Uint64()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+		if err == nil && version+1 != snapshot.Sequence || err == redis.Nil && snapshot.Sequence > 1 {
+			return fsm.ConflictError{ID: id, Sequence: version}
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.HSet(ctx, key,
+				"version", strconv.FormatUint(snapshot.Sequence, 10),
+				"state", data)
+			return nil
+		})
+		return err
+	}
+
+	for i := 0; i < maxRetries; i++ {
+		err = s.client.Watch(ctx, save, key)
+		if !errors.Is(err, redis.TxFailedErr) {
+			return err
+		}
+	}
+	return err
+}
+
+// codec returns the Codec of the Store, or the one carried by ctx.
+func (s *Store) codec(ctx context.Context) fsm.Codec {
+	if s.Codec == nil {
+		return fsm.CodecFromContext(ctx)
+	}
+	return s.Codec
+}
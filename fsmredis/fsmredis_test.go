@@ -0,0 +1,200 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsmredis
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/papiguy/fsm"
+	"github.com/redis/go-redis/v9"
+)
+
+func newStore(t *testing.T) *Store {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return NewStore(client, "fsm:")
+}
+
+func newDoor(store fsm.Store) *fsm.FSM {
+	return fsm.NewFSM(
+		"closed",
+		fsm.Events{
+			{EvtName: "open", SrcStates: []string{"closed"}, DstStates: "open"},
+			{EvtName: "close", SrcStates: []string{"open"}, DstStates: "closed"},
+		},
+		fsm.Callbacks{},
+		fsm.WithStore(store, "door-1"),
+	)
+}
+
+func TestStore(t *testing.T) {
+	store := newStore(t)
+	ctx := context.Background()
+
+	if _, err := store.Load(ctx, "door-1"); err != (fsm.NotFoundError{ID: "door-1"}) {
+		t.Errorf("expected NotFoundError, got %v", err)
+	}
+
+	door := newDoor(store)
+	if err := door.Event("open"); err != nil {
+		t.Fatal(err)
+	}
+
+	replica := newDoor(store)
+	if err := replica.Load(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if replica.Current() != "open" || replica.Sequence() != 1 {
+		t.Error("expected the replica to be loaded in state open")
+	}
+	if err := replica.Event("close"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := door.Event("close").(fsm.StoreError); !ok {
+		t.Error("expected StoreError for a stale instance")
+	}
+	s, err := store.Load(ctx, "door-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.State != "closed" || s.Sequence != 2 {
+		t.Errorf("expected state closed and sequence 2, got %+v", s)
+	}
+}
+
+// prefixCodec is a fsm.JSONCodec prefixing its encodings, to tell them apart.
+type prefixCodec struct{}
+
+func (prefixCodec) Marshal(v interface{}) ([]byte, error) {
+	data, err := fsm.JSONCodec{}.Marshal(v)
+	return append([]byte("fsm:"), data...), err
+}
+
+func (prefixCodec) Unmarshal(data []byte, v interface{}) error {
+	if !bytes.HasPrefix(data, []byte("fsm:")) {
+		return errors.New("missing prefix")
+	}
+	return fsm.JSONCodec{}.Unmarshal(data[4:], v)
+}
+
+func TestStoreContextCodec(t *testing.T) {
+	store := newStore(t)
+	ctx := context.Background()
+
+	door := fsm.NewFSM(
+		"closed",
+		fsm.Events{{EvtName: "open", SrcStates: []string{"closed"}, DstStates: "open"}},
+		fsm.Callbacks{},
+		fsm.WithStore(store, "door-1"),
+		fsm.WithCodec(prefixCodec{}),
+	)
+	if err := door.Event("open"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.Load(ctx, "door-1"); err == nil {
+		t.Error("expected an error loading without the codec of the FSM")
+	}
+	s, err := store.Load(fsm.ContextWithCodec(ctx, prefixCodec{}), "door-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.State != "open" {
+		t.Errorf("expected state open, got %+v", s)
+	}
+}
+
+func TestStoreConcurrent(t *testing.T) {
+	store := newStore(t)
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	saved := 0
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := store.Save(ctx, "door-1", fsm.Snapshot{State: "open", Sequence: 1})
+			if err == nil {
+				mu.Lock()
+				saved++
+				mu.Unlock()
+			} else if _, ok := err.(fsm.ConflictError); !ok {
+				t.Errorf("expected ConflictError, got %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if saved != 1 {
+		t.Errorf("expected exactly one save, got %d", saved)
+	}
+}
+
+func TestStoreStaleWriters(t *testing.T) {
+	store := newStore(t)
+	ctx := context.Background()
+
+	a, b := newDoor(store), newDoor(store)
+	if err := a.Event("open"); err != nil {
+		t.Fatal(err)
+	}
+
+	// b is behind the store: retrying does not let it overwrite the saved
+	// state.
+	for _, event := range []string{"open", "open", "open"} {
+		var conflict fsm.ConflictError
+		if err := b.Event(event); !errors.As(err, &conflict) {
+			t.Fatalf("expected ConflictError for %s, got %v", event, err)
+		}
+	}
+	if b.Current() != "closed" || b.Sequence() != 0 {
+		t.Error("expected the stale instance not to commit")
+	}
+
+	if err := a.Event("close"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Load(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Event("open"); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Event("open"); !errors.Is(err, fsm.ErrConflict) {
+		t.Errorf("expected ConflictError for the other stale instance, got %v", err)
+	}
+
+	s, err := store.Load(ctx, "door-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.State != "open" || s.Sequence != 3 {
+		t.Errorf("expected state open and sequence 3, got %+v", s)
+	}
+	if err := store.Save(ctx, "door-1", fsm.Snapshot{State: "closed", Sequence: 5}); !errors.Is(err, fsm.ErrConflict) {
+		t.Errorf("expected ConflictError for a skipped sequence, got %v", err)
+	}
+	if err := store.Save(ctx, "door-2", fsm.Snapshot{State: "open", Sequence: 2}); !errors.Is(err, fsm.ErrConflict) {
+		t.Errorf("expected ConflictError for a first state with sequence 2, got %v", err)
+	}
+}
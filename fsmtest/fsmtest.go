@@ -0,0 +1,110 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fsmtest provides test helpers for state machines, to turn
+// requirements such as "an order can never be shipped before it is paid" into
+// executable tests.
+//
+// The helpers look at the definition only: guards are not evaluated, so a
+// guarded transition counts as possible.
+package fsmtest
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/papiguy/fsm"
+)
+
+// AssertCannot reports an error if event is defined from any of the states,
+// naming the event description that makes it possible. Without states the
+// current state of f is checked. It returns whether the assertion held.
+func AssertCannot(t testing.TB, f *fsm.FSM, event string, fromStates ...string) bool {
+	t.Helper()
+
+	if len(fromStates) == 0 {
+		fromStates = []string{f.Current()}
+	}
+
+	ok := true
+	for _, state := range fromStates {
+		if desc, found := f.Lookup(event, state); found {
+			t.Errorf("expected event %s to be impossible in state %s, but it is defined by %s",
+				event, state, describe(desc))
+			ok = false
+		}
+	}
+	return ok
+}
+
+// AssertNoPath reports an error if any sequence of events leads from the
+// state from to the state to, showing the shortest such sequence with the
+// index of each event description used. It returns whether the assertion held.
+func AssertNoPath(t testing.TB, events fsm.Events, from, to string) bool {
+	t.Helper()
+
+	if from == to {
+		t.Errorf("expected no path from state %s to itself, but they are the same state", from)
+		return false
+	}
+
+	type step struct {
+		prev  string
+		index int
+	}
+	reached := map[string]step{from: {}}
+	queue := []string{from}
+	for len(queue) > 0 {
+		state := queue[0]
+		queue = queue[1:]
+		for i, e := range events {
+			if _, ok := reached[e.DstStates]; ok || !contains(e.SrcStates, state) {
+				continue
+			}
+			reached[e.DstStates] = step{state, i}
+			if e.DstStates != to {
+				queue = append(queue, e.DstStates)
+				continue
+			}
+
+			var path []string
+			for s := to; s != from; s = reached[s].prev {
+				i := reached[s].index
+				path = append(path, fmt.Sprintf("events[%d] %s: %s -> %s", i, events[i].EvtName, reached[s].prev, s))
+			}
+			for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+				path[i], path[j] = path[j], path[i]
+			}
+			t.Errorf("expected no path from state %s to state %s, found:\n\t%s",
+				from, to, strings.Join(path, "\n\t"))
+			return false
+		}
+	}
+	return true
+}
+
+// describe formats an event description for failure messages.
+func describe(e fsm.EventDesc) string {
+	return fmt.Sprintf("{%s %v -> %s}", e.EvtName, e.SrcStates, e.DstStates)
+}
+
+func contains(states []string, state string) bool {
+	for _, s := range states {
+		if s == state {
+			return true
+		}
+	}
+	return false
+}
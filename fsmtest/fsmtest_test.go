@@ -0,0 +1,79 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsmtest
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/papiguy/fsm"
+)
+
+// recorder records the failures of an assertion instead of failing the test.
+type recorder struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+var orderEvents = fsm.Events{
+	{EvtName: "pay", SrcStates: []string{"new"}, DstStates: "paid"},
+	{EvtName: "cancel", SrcStates: []string{"new", "paid"}, DstStates: "canceled"},
+	{EvtName: "ship", SrcStates: []string{"paid"}, DstStates: "shipped"},
+}
+
+func TestAssertCannot(t *testing.T) {
+	f := fsm.NewFSM("new", orderEvents, fsm.Callbacks{})
+
+	r := &recorder{}
+	if !AssertCannot(r, f, "ship") || !AssertCannot(r, f, "pay", "paid", "shipped") {
+		t.Errorf("expected the assertions to hold, got %v", r.errors)
+	}
+
+	r = &recorder{}
+	if AssertCannot(r, f, "cancel", "shipped", "paid") {
+		t.Error("expected the assertion to fail")
+	}
+	expected := "[expected event cancel to be impossible in state paid, but it is defined by {cancel [new paid] -> canceled}]"
+	if fmt.Sprint(r.errors) != expected {
+		t.Errorf("unexpected failures %v", r.errors)
+	}
+}
+
+func TestAssertNoPath(t *testing.T) {
+	r := &recorder{}
+	if !AssertNoPath(r, orderEvents, "canceled", "shipped") {
+		t.Errorf("expected the assertion to hold, got %v", r.errors)
+	}
+
+	r = &recorder{}
+	if AssertNoPath(r, orderEvents, "new", "shipped") {
+		t.Error("expected the assertion to fail")
+	}
+	expected := "[expected no path from state new to state shipped, found:\n\tevents[0] pay: new -> paid\n\tevents[2] ship: paid -> shipped]"
+	if fmt.Sprint(r.errors) != expected {
+		t.Errorf("unexpected failures %v", r.errors)
+	}
+
+	r = &recorder{}
+	if AssertNoPath(r, orderEvents, "new", "new") {
+		t.Error("expected the assertion to fail for the same state")
+	}
+}
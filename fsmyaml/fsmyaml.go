@@ -0,0 +1,270 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fsmyaml loads FSM definitions from YAML.
+//
+// It is a separate module so that the fsm package does not depend on a YAML
+// library.
+package fsmyaml
+
+import (
+	"bytes"
+	"io"
+	"time"
+
+	"github.com/papiguy/fsm"
+	"gopkg.in/yaml.v3"
+)
+
+// doc is the YAML document read by NewFSM.
+type doc struct {
+	Initial string      `yaml:"initial"`
+	Events  []yaml.Node `yaml:"events"`
+}
+
+// event is an event in a doc.
+type event struct {
+	Name string `yaml:"name"`
+	Src  states `yaml:"src"`
+	Dst  string `yaml:"dst"`
+
+	// Timeout, Every and After are the timers of the event, and Retry and
+	// Deadline how it is handled, see NewFSM.
+	Timeout  time.Duration `yaml:"timeout"`
+	Every    time.Duration `yaml:"every"`
+	After    time.Duration `yaml:"after"`
+	Retry    *retry        `yaml:"retry"`
+	Deadline time.Duration `yaml:"deadline"`
+}
+
+// retry is the retry policy of an event, see fsm.Retry.
+type retry struct {
+	Attempts int           `yaml:"attempts"`
+	Backoff  time.Duration `yaml:"backoff"`
+}
+
+// states is a list of states that can also be given as a single string.
+type states []string
+
+func (s *states) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*s = states{node.Value}
+		return nil
+	}
+	return node.Decode((*[]string)(s))
+}
+
+// NewFSM constructs a FSM from a YAML document with the initial state and the
+// events, in the same form as fsm.NewFSMFromJSON:
+//
+//	initial: closed
+//	events:
+//	  - name: open
+//	    src: [closed]
+//	    dst: open
+//	  - name: close
+//	    src: open
+//	    dst: closed
+//
+// A single source state can be given as a string. Anchors, aliases and merge
+// keys can be used to share lists of states or parts of events:
+//
+//	working: &working [idle, running, paused]
+//	events:
+//	  - name: fail
+//	    src: *working
+//	    dst: failed
+//
+// Top level keys other than initial and events are ignored, to leave room for
+// anchors. The callbacks are given as for fsm.NewFSM.
+//
+// An event can also have timers, as in fsm.NewFSMFromJSON:
+//
+//	events:
+//	  - name: expire
+//	    src: pending
+//	    dst: expired
+//	    timeout: 15m
+//
+// With timeout the event is fired once the FSM has been in a source state for
+// the duration, as with fsm.FSM.Timeout. With every it is fired every duration
+// while the FSM is in a source state, as with fsm.FSM.Recurring. With after it
+// is fired once, the duration after the FSM is constructed, unless it has left
+// the initial state by then, as with fsm.FSM.EventAfter; the initial state
+// must then be a source state of the event.
+//
+// The handling of an event sent with Event can be bounded too:
+//
+//	events:
+//	  - name: charge
+//	    src: cart
+//	    dst: paid
+//	    retry: {attempts: 3, backoff: 100ms}
+//	    deadline: 5s
+//
+// With retry the event is handled again when it fails with a retryable error,
+// up to attempts times in all, as with fsm.Retry. With deadline, its service
+// level agreement, its context is done after the duration, retries included,
+// as with fsm.Deadline.
+//
+// An fsm.ImportError is returned if the document is malformed, if an event has
+// unknown fields, invalid timers, retry or deadline or if the initial state or
+// the name, source or destination of an event is missing, and a
+// fsm.ConflictingTransitionError as returned by fsm.NewFSMStrict.
+func NewFSM(data []byte, callbacks fsm.Callbacks) (*fsm.FSM, error) {
+	initial, events, err := decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	descs := make(fsm.Events, 0, len(events))
+	for _, e := range events {
+		descs = append(descs, e.desc())
+	}
+	f, err := fsm.NewFSMStrict(initial, descs, callbacks)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range events {
+		if err := e.start(f); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// Import reads a YAML document in the form read by NewFSM, and returns the
+// initial state and the events. The timers, retries and deadlines of the
+// events are checked, but not returned since fsm.Events can not express them.
+func Import(r io.Reader) (string, fsm.Events, error) {
+	initial, events, err := decode(r)
+	if err != nil {
+		return "", nil, err
+	}
+	descs := make(fsm.Events, 0, len(events))
+	for _, e := range events {
+		descs = append(descs, e.desc())
+	}
+	return initial, descs, nil
+}
+
+// decode reads a YAML document in the form read by NewFSM, and returns the
+// initial state and the validated events.
+func decode(r io.Reader) (string, []event, error) {
+	var d doc
+	if err := yaml.NewDecoder(r).Decode(&d); err != nil {
+		return "", nil, fsm.ImportError{Format: "yaml", Msg: err.Error()}
+	}
+	if d.Initial == "" {
+		return "", nil, fsm.ImportError{Format: "yaml", Msg: "no initial state"}
+	}
+
+	events := make([]event, 0, len(d.Events))
+	for _, node := range d.Events {
+		e, err := decodeEvent(&node, d.Initial)
+		if err != nil {
+			return "", nil, err
+		}
+		events = append(events, e)
+	}
+	return d.Initial, events, nil
+}
+
+// desc returns the description of the event.
+func (e event) desc() fsm.EventDesc {
+	return fsm.EventDesc{EvtName: e.Name, SrcStates: e.Src, DstStates: e.Dst}
+}
+
+// start adds the timers of the event to f, and the middleware of its retry
+// and deadline.
+func (e event) start(f *fsm.FSM) error {
+	for _, state := range e.Src {
+		if e.Timeout > 0 {
+			if err := f.Timeout(state, e.Timeout, e.Name); err != nil {
+				return err
+			}
+		}
+		if e.Every > 0 {
+			if err := f.Recurring(state, fsm.Interval(e.Every), e.Name); err != nil {
+				return err
+			}
+		}
+	}
+	if e.After > 0 {
+		if _, err := f.EventAfter(e.After, e.Name); err != nil {
+			return err
+		}
+	}
+	if e.Deadline > 0 {
+		f.Use(fsm.Deadline(e.Name, e.Deadline))
+	}
+	if e.Retry != nil && e.Retry.Attempts > 1 {
+		f.Use(fsm.Retry(e.Name, e.Retry.Attempts, e.Retry.Backoff))
+	}
+	return nil
+}
+
+// decodeEvent decodes and validates an event of a FSM starting in initial.
+func decodeEvent(node *yaml.Node, initial string) (event, error) {
+	fail := func(msg string) (event, error) {
+		return event{}, fsm.ImportError{Format: "yaml", Line: node.Line, Msg: msg}
+	}
+
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	if node.Kind != yaml.MappingNode {
+		return fail("event is not a mapping")
+	}
+	for i := 0; i < len(node.Content); i += 2 {
+		switch key := node.Content[i].Value; key {
+		case "name", "src", "dst", "timeout", "every", "after", "retry", "deadline", "<<":
+		default:
+			return fail("unknown field " + key + " in event")
+		}
+	}
+
+	var e event
+	if err := node.Decode(&e); err != nil {
+		return fail(err.Error())
+	}
+	switch {
+	case e.Name == "":
+		return fail("event without name")
+	case len(e.Src) == 0:
+		return fail("event " + e.Name + " has no source state")
+	case e.Dst == "":
+		return fail("event " + e.Name + " has no destination state")
+	case e.Timeout < 0:
+		return fail("event " + e.Name + " has a negative timeout")
+	case e.Every < 0:
+		return fail("event " + e.Name + " has a negative every")
+	case e.After < 0:
+		return fail("event " + e.Name + " has a negative after")
+	case e.Deadline < 0:
+		return fail("event " + e.Name + " has a negative deadline")
+	case e.Retry != nil && e.Retry.Attempts < 1:
+		return fail("event " + e.Name + " has a retry without attempts")
+	case e.Retry != nil && e.Retry.Backoff < 0:
+		return fail("event " + e.Name + " has a negative retry backoff")
+	}
+	if e.After > 0 {
+		for _, state := range e.Src {
+			if state == initial {
+				return e, nil
+			}
+		}
+		return fail("event " + e.Name + " has an after but can not occur in the initial state " + initial)
+	}
+	return e, nil
+}
@@ -0,0 +1,170 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsmyaml
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/papiguy/fsm"
+)
+
+func TestNewFSM(t *testing.T) {
+	f, err := NewFSM([]byte(`
+working: &working [idle, running]
+retry: &retry
+  name: retry
+  dst: idle
+initial: idle
+events:
+  - name: run
+    src: idle
+    dst: running
+  - name: fail
+    src: *working
+    dst: failed
+  - <<: *retry
+    src: [failed]
+`), fsm.Callbacks{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Current() != "idle" {
+		t.Errorf("expected state to be 'idle', got %q", f.Current())
+	}
+	for _, event := range []string{"run", "fail", "retry", "fail"} {
+		if err := f.Event(event); err != nil {
+			t.Errorf("expected no error for %s, got %v", event, err)
+		}
+	}
+	if f.Current() != "failed" {
+		t.Errorf("expected state to be 'failed', got %q", f.Current())
+	}
+}
+
+func TestNewFSMTimers(t *testing.T) {
+	pings := make(chan struct{}, 10)
+	f, err := NewFSM([]byte(`
+initial: pending
+events:
+  - {name: wake, src: pending, dst: awake, after: 5ms}
+  - {name: expire, src: awake, dst: expired, timeout: 10ms}
+  - {name: ping, src: expired, dst: expired, every: 5ms}
+`), fsm.Callbacks{
+		"after_ping": func(action string, e *fsm.Event) {
+			select {
+			case pings <- struct{}{}:
+			default:
+			}
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case <-pings:
+		case <-time.After(time.Second):
+			t.Fatal("expected the delayed event, the timeout and the recurring event to fire")
+		}
+	}
+	if f.Current() != "expired" {
+		t.Errorf("expected state to be 'expired', got %q", f.Current())
+	}
+}
+
+func TestNewFSMRetry(t *testing.T) {
+	attempts := 0
+	f, err := NewFSM([]byte(`
+initial: cart
+events:
+  - name: charge
+    src: cart
+    dst: paid
+    retry: {attempts: 3, backoff: 1ms}
+    deadline: 1s
+`), fsm.Callbacks{
+		"before_charge": func(action string, e *fsm.Event) {
+			attempts++
+			if _, ok := e.Context().Deadline(); !ok {
+				t.Error("expected the event to have a deadline")
+			}
+			if attempts < 3 {
+				e.Fail(errors.New("unavailable"), fsm.Retryable)
+			}
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Event("charge"); err != nil || attempts != 3 {
+		t.Errorf("expected the third attempt to succeed, got %v after %d", err, attempts)
+	}
+}
+
+func TestImport(t *testing.T) {
+	initial, events, err := Import(strings.NewReader(`
+initial: closed
+events:
+  - {name: open, src: closed, dst: open}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if initial != "closed" || len(events) != 1 || events[0].EvtName != "open" ||
+		events[0].SrcStates[0] != "closed" || events[0].DstStates != "open" {
+		t.Errorf("unexpected definition %q %v", initial, events)
+	}
+}
+
+func TestNewFSMErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		line int
+	}{
+		{"initial: [", 0},
+		{"events: []", 0},
+		{"initial: a\nevents:\n  - name: go\n    src: a\n    dest: b", 3},
+		{"initial: a\nevents:\n  - src: a\n    dst: b", 3},
+		{"initial: a\nevents:\n  - name: go\n    dst: b", 3},
+		{"initial: a\nevents:\n  - name: go\n    src: a", 3},
+		{"initial: a\nevents:\n  - go", 3},
+		{"initial: a\nevents:\n  - name: go\n    src: {a: b}\n    dst: b", 3},
+		{"initial: a\nevents:\n  - name: go\n    src: a\n    dst: b\n    timeout: soon", 3},
+		{"initial: a\nevents:\n  - name: go\n    src: a\n    dst: b\n    every: -1s", 3},
+		{"initial: a\nevents:\n  - name: go\n    src: a\n    dst: b\n    retry: {backoff: 1s}", 3},
+		{"initial: a\nevents:\n  - name: go\n    src: a\n    dst: b\n    retry: {attempts: 2, backoff: -1s}", 3},
+		{"initial: a\nevents:\n  - name: go\n    src: a\n    dst: b\n    deadline: -1s", 3},
+		{"initial: a\nevents:\n  - name: go\n    src: b\n    dst: c\n    after: 1s", 3},
+	}
+	for _, test := range tests {
+		_, err := NewFSM([]byte(test.src), nil)
+		e, ok := err.(fsm.ImportError)
+		if !ok {
+			t.Errorf("expected ImportError for %q, got %v", test.src, err)
+			continue
+		}
+		if e.Format != "yaml" || e.Line != test.line {
+			t.Errorf("expected line %d for %q, got %v", test.line, test.src, e)
+		}
+	}
+
+	_, err := NewFSM([]byte("initial: a\nevents:\n  - {name: go, src: a, dst: b}\n  - {name: go, src: a, dst: c}"), nil)
+	if _, ok := err.(fsm.ConflictingTransitionError); !ok {
+		t.Errorf("expected ConflictingTransitionError, got %v", err)
+	}
+}
@@ -0,0 +1,9 @@
+module github.com/papiguy/fsm/fsmyaml
+
+go 1.21
+
+require github.com/papiguy/fsm v0.0.0
+
+require gopkg.in/yaml.v3 v3.0.1
+
+replace github.com/papiguy/fsm => ../
@@ -1,5 +1,3 @@
 module github.com/papiguy/fsm
 
-go 1.13
-
-require github.com/emicklei/dot v0.10.2
+go 1.21
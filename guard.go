@@ -0,0 +1,134 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import "strings"
+
+// Guard is a named condition that must hold for a transition to happen.
+//
+// Guards are declared in EventDesc.Guards and evaluated in the declared order
+// before any callback is called. The first guard that does not hold rejects
+// the event with a GuardFailedError naming it, and the remaining guards are
+// not evaluated.
+type Guard struct {
+	// Name identifies the guard in a GuardFailedError.
+	Name string
+
+	// Check returns true if the transition may happen. A nil Check always
+	// holds.
+	Check func(e *Event) bool
+
+	// all and any are the guards combined by And and Or.
+	all []Guard
+	any []Guard
+}
+
+// And combines guards into a guard that holds if all of them hold. They are
+// evaluated in order and evaluation stops at the first one that does not hold,
+// which is then reported as the rejecting guard.
+//
+// The name of the combined guard is built from the names of the guards, it
+// can be replaced by setting Name on the returned guard.
+func And(guards ...Guard) Guard {
+	return Guard{Name: joinGuardNames(guards, " and "), all: guards}
+}
+
+// Or combines guards into a guard that holds if any of them holds. They are
+// evaluated in order and evaluation stops at the first one that holds. If none
+// holds, the combined guard is reported as the rejecting guard.
+//
+// The name of the combined guard is built from the names of the guards, it
+// can be replaced by setting Name on the returned guard.
+func Or(guards ...Guard) Guard {
+	return Guard{Name: joinGuardNames(guards, " or "), any: guards}
+}
+
+// reject reports whether g rejects e, and if so the name of the guard that
+// rejected it.
+func (g Guard) reject(e *Event) (string, bool) {
+	switch {
+	case g.all != nil:
+		for _, guard := range g.all {
+			if name, rejected := guard.reject(e); rejected {
+				return name, true
+			}
+		}
+		return "", false
+	case g.any != nil:
+		for _, guard := range g.any {
+			if _, rejected := guard.reject(e); !rejected {
+				return "", false
+			}
+		}
+		return g.Name, true
+	case g.Check != nil && !g.Check(e):
+		return g.Name, true
+	}
+	return "", false
+}
+
+// joinGuardNames joins the names of guards with sep, in parentheses.
+func joinGuardNames(guards []Guard, sep string) string {
+	names := make([]string, 0, len(guards))
+	for _, g := range guards {
+		names = append(names, g.Name)
+	}
+	return "(" + strings.Join(names, sep) + ")"
+}
+
+// CanWithArgs returns true if event can occur in the current state with args,
+// that is if Can returns true and the guards of the transition hold. The
+// arguments are transformed, and the destination chosen, as for Event, but no
+// callback is called and the state is not changed, so user interfaces can
+// disable the actions that would be rejected.
+//
+// Guards and Choose functions are evaluated each time, and should therefore
+// not have side effects.
+func (f *FSM) CanWithArgs(event string, args ...interface{}) bool {
+	// The guards run without stateMu, so that they can call Can and the
+	// like; desc is not changed by AddTransition, which replaces it.
+	f.stateMu.RLock()
+	src := f.current
+	dst, desc, ok := f.table.find(event, src)
+	dsts := f.dsts(eKey{event, src})
+	transformers := f.transformers[event]
+	pending := f.transition != nil
+	f.stateMu.RUnlock()
+	if !ok || (pending && desc.WhilePending != AcceptWhilePending) {
+		return false
+	}
+
+	var err error
+	for _, t := range transformers {
+		if args, err = t(args); err != nil {
+			return false
+		}
+	}
+
+	e := &Event{FSM: f, Event: event, Src: src, Dst: dst, Args: args, exposed: true}
+	if desc.Choose != nil && !desc.Internal {
+		if choice := desc.Choose(e); choice != "" {
+			valid := false
+			for _, d := range dsts {
+				valid = valid || d == choice
+			}
+			if !valid {
+				return false
+			}
+			e.Dst = choice
+		}
+	}
+	return guardsError(desc, e) == nil
+}
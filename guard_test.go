@@ -0,0 +1,163 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"fmt"
+	"testing"
+)
+
+func argIs(name string, value string, evaluated *[]string) Guard {
+	return Guard{
+		Name: name,
+		Check: func(e *Event) bool {
+			*evaluated = append(*evaluated, name)
+			return len(e.Args) > 0 && e.Args[0] == value
+		},
+	}
+}
+
+func TestGuards(t *testing.T) {
+	var evaluated []string
+	called := false
+
+	fsm := NewFSM(
+		"submitted",
+		Events{
+			{
+				EvtName:   "approve",
+				SrcStates: []string{"submitted"},
+				DstStates: "approved",
+				Guards: []Guard{
+					{Name: "has_args", Check: func(e *Event) bool {
+						evaluated = append(evaluated, "has_args")
+						return len(e.Args) > 0
+					}},
+					argIs("is_manager", "manager", &evaluated),
+				},
+			},
+		},
+		Callbacks{
+			"before_approve": func(action string, e *Event) {
+				called = true
+			},
+		},
+	)
+
+	err := fsm.Event("approve")
+	if e, ok := err.(GuardFailedError); !ok || e.Guard != "has_args" || e.Event != "approve" || e.State != "submitted" {
+		t.Error("expected 'GuardFailedError' for 'has_args'")
+	}
+	if fmt.Sprint(evaluated) != "[has_args]" {
+		t.Error("expected guards to short-circuit")
+	}
+
+	err = fsm.Event("approve", "clerk")
+	if e, ok := err.(GuardFailedError); !ok || e.Guard != "is_manager" {
+		t.Error("expected 'GuardFailedError' for 'is_manager'")
+	}
+	if called || fsm.Current() != "submitted" {
+		t.Error("expected no callbacks and no transition")
+	}
+
+	if err := fsm.Event("approve", "manager"); err != nil {
+		t.Error("expected no error")
+	}
+	if !called || fsm.Current() != "approved" {
+		t.Error("expected transition to 'approved'")
+	}
+}
+
+func TestGuardCombinators(t *testing.T) {
+	var evaluated []string
+	e := &Event{Args: []interface{}{"clerk"}}
+
+	g := Or(argIs("manager", "manager", &evaluated), argIs("clerk", "clerk", &evaluated), argIs("admin", "admin", &evaluated))
+	if _, rejected := g.reject(e); rejected {
+		t.Error("expected 'Or' to hold")
+	}
+	if fmt.Sprint(evaluated) != "[manager clerk]" {
+		t.Error("expected 'Or' to short-circuit")
+	}
+
+	evaluated = nil
+	g = Or(argIs("manager", "manager", &evaluated), argIs("admin", "admin", &evaluated))
+	if name, rejected := g.reject(e); !rejected || name != "(manager or admin)" {
+		t.Error("expected 'Or' to be reported as the rejecting guard")
+	}
+
+	evaluated = nil
+	g = And(argIs("clerk", "clerk", &evaluated), Or(argIs("manager", "manager", &evaluated), argIs("admin", "admin", &evaluated)), argIs("other", "other", &evaluated))
+	if name, rejected := g.reject(e); !rejected || name != "(manager or admin)" {
+		t.Error("expected nested 'Or' to be reported as the rejecting guard")
+	}
+	if fmt.Sprint(evaluated) != "[clerk manager admin]" {
+		t.Error("expected 'And' to short-circuit")
+	}
+
+	g = And(argIs("clerk", "clerk", &evaluated))
+	g.Name = "is_clerk"
+	if _, rejected := g.reject(e); rejected {
+		t.Error("expected 'And' to hold")
+	}
+}
+
+func TestCanWithArgs(t *testing.T) {
+	var evaluated []string
+	called := false
+
+	fsm := NewFSM(
+		"submitted",
+		Events{
+			{
+				EvtName:   "approve",
+				SrcStates: []string{"submitted"},
+				DstStates: "approved",
+				Guards:    []Guard{argIs("is_manager", "manager", &evaluated)},
+			},
+			{EvtName: "reopen", SrcStates: []string{"approved"}, DstStates: "submitted"},
+		},
+		Callbacks{
+			"before_approve": func(action string, e *Event) {
+				called = true
+			},
+		},
+	)
+	fsm.AddArgTransformer("approve", func(args []interface{}) ([]interface{}, error) {
+		if len(args) > 0 && args[0] == "boss" {
+			return []interface{}{"manager"}, nil
+		}
+		return args, nil
+	})
+
+	if !fsm.Can("approve") {
+		t.Error("expected Can to ignore guards")
+	}
+	if fsm.CanWithArgs("approve") || fsm.CanWithArgs("approve", "clerk") {
+		t.Error("expected guard to reject 'approve'")
+	}
+	if !fsm.CanWithArgs("approve", "manager") || !fsm.CanWithArgs("approve", "boss") {
+		t.Error("expected 'approve' to be possible for a manager")
+	}
+	if fsm.CanWithArgs("reopen") || fsm.CanWithArgs("unknown") {
+		t.Error("expected events without transition to be impossible")
+	}
+	if called || fsm.Current() != "submitted" {
+		t.Error("expected no callbacks and no transition")
+	}
+	if fmt.Sprint(evaluated) != "[is_manager is_manager is_manager is_manager]" {
+		t.Error("expected guard to be evaluated for each call")
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import "sort"
+
+// maxSuggestions is the number of event names suggested by an
+// UnknownEventError.
+const maxSuggestions = 3
+
+// invalidEvent returns the InvalidEventError for event in state, with the
+// events available in state. stateMu or eventMu must be locked.
+func (f *FSM) invalidEvent(event, state string) InvalidEventError {
+	available := f.table.from(state)
+	if len(available) == 0 {
+		available = nil
+	}
+	sort.Strings(available)
+	return InvalidEventError{Event: event, State: state, Description: f.eventDescs[event], Available: available}
+}
+
+// unknownEvent returns the UnknownEventError for event, with the events whose
+// names are closest to it. stateMu or eventMu must be locked.
+func (f *FSM) unknownEvent(event string) UnknownEventError {
+	type candidate struct {
+		name     string
+		distance int
+	}
+	var candidates []candidate
+	limit := len(event) / 3
+	if limit < 2 {
+		limit = 2
+	}
+	if limit >= len(event) {
+		limit = len(event) - 1
+	}
+	for _, name := range f.table.eventNames() {
+		if d := editDistance(event, name, limit); d <= limit {
+			candidates = append(candidates, candidate{name, d})
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].distance != candidates[j].distance {
+			return candidates[i].distance < candidates[j].distance
+		}
+		return candidates[i].name < candidates[j].name
+	})
+	if len(candidates) > maxSuggestions {
+		candidates = candidates[:maxSuggestions]
+	}
+
+	err := UnknownEventError{Event: event}
+	for _, c := range candidates {
+		err.Suggestions = append(err.Suggestions, c.name)
+	}
+	return err
+}
+
+// editDistance returns the Levenshtein distance between a and b, or a value
+// above limit as soon as it is known to exceed it.
+func editDistance(a, b string, limit int) int {
+	if d := len(a) - len(b); d > limit || -d > limit {
+		return limit + 1
+	}
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		min := cur[0]
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = prev[j-1] + cost
+			if prev[j]+1 < cur[j] {
+				cur[j] = prev[j] + 1
+			}
+			if cur[j-1]+1 < cur[j] {
+				cur[j] = cur[j-1] + 1
+			}
+			if cur[j] < min {
+				min = cur[j]
+			}
+		}
+		if min > limit {
+			return limit + 1
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
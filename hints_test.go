@@ -0,0 +1,78 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRejectionHints(t *testing.T) {
+	f := NewFSM(
+		"closed",
+		Events{
+			{EvtName: "open", SrcStates: []string{"closed"}, DstStates: "open"},
+			{EvtName: "lock", SrcStates: []string{"closed"}, DstStates: "locked"},
+			{EvtName: "close", SrcStates: []string{"open"}, DstStates: "closed"},
+			{EvtName: "unlock", SrcStates: []string{"locked"}, DstStates: "closed"},
+		},
+		Callbacks{},
+	)
+
+	err := f.Event("close")
+	if e, ok := err.(InvalidEventError); !ok || fmt.Sprint(e.Available) != "[lock open]" {
+		t.Errorf("expected InvalidEventError with the available events, got %v", err)
+	}
+
+	err = f.Event("opn")
+	if e, ok := err.(UnknownEventError); !ok || fmt.Sprint(e.Suggestions) != "[open]" {
+		t.Errorf("expected UnknownEventError with suggestions, got %v", err)
+	}
+	err = f.Event("clock")
+	if e, ok := err.(UnknownEventError); !ok || fmt.Sprint(e.Suggestions) != "[lock close unlock]" {
+		t.Errorf("expected suggestions closest first, got %v", err)
+	}
+	err = f.Event("jump")
+	if e, ok := err.(UnknownEventError); !ok || e.Suggestions != nil {
+		t.Errorf("expected no suggestions, got %v", err)
+	}
+
+	if _, err := f.EventAfter(0, "unlock"); fmt.Sprint(err) != "event unlock inappropriate in current state closed, available events: lock, open" {
+		t.Errorf("unexpected error %v", err)
+	}
+	if err := f.Timeout("locked", 0, "open"); fmt.Sprint(err) != "event open inappropriate in current state locked, available events: unlock" {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b  string
+		limit int
+		want  int
+	}{
+		{"open", "open", 2, 0},
+		{"opn", "open", 2, 1},
+		{"close", "clsoe", 2, 2},
+		{"kitten", "sitting", 3, 3},
+		{"kitten", "sitting", 2, 3},
+		{"a", "abcdef", 2, 3},
+	}
+	for _, tt := range tests {
+		if got := editDistance(tt.a, tt.b, tt.limit); got != tt.want {
+			t.Errorf("editDistance(%q, %q, %d) = %d, expected %d", tt.a, tt.b, tt.limit, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Transition is a committed transition, as recorded in the history of a FSM
+// and appended to a Log.
+type Transition struct {
+	// Sequence is the sequence number of the transition.
+	Sequence uint64 `json:"sequence"`
+
+	// Event is the event name.
+	Event string `json:"event"`
+
+	// Src is the state before the transition.
+	Src string `json:"src"`
+
+	// Dst is the state after the transition.
+	Dst string `json:"dst"`
+
+	// Args are the arguments of the event, after transformation.
+	Args []interface{} `json:"args,omitempty"`
+
+	// Time is when the transition was committed.
+	Time time.Time `json:"time"`
+}
+
+// history is a ring buffer of the last transitions.
+type history struct {
+	mu          sync.Mutex
+	transitions []Transition
+	next        int
+	full        bool
+}
+
+// recordTransition returns t as recorded in the history. With a codec, its
+// arguments are replaced by those decoded from their encoding, as they would
+// be read back from a Log, so that the history does not share them with the
+// callbacks. It returns a HistoryError if the codec fails, so that the
+// transition is not committed without its arguments.
+func recordTransition(t Transition, codec Codec) (Transition, error) {
+	if codec == nil || t.Args == nil {
+		return t, nil
+	}
+	data, err := codec.Marshal(t.Args)
+	if err != nil {
+		return t, HistoryError{t.Sequence, err}
+	}
+	var args []interface{}
+	if err := codec.Unmarshal(data, &args); err != nil {
+		return t, HistoryError{t.Sequence, err}
+	}
+	t.Args = args
+	return t, nil
+}
+
+// add records t, overwriting the oldest transition if the buffer is full.
+func (h *history) add(t Transition) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.transitions[h.next] = t
+	h.next++
+	if h.next == len(h.transitions) {
+		h.next = 0
+		h.full = true
+	}
+}
+
+// last returns the last n transitions, oldest first.
+func (h *history) last(n int) []Transition {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	size := h.next
+	if h.full {
+		size = len(h.transitions)
+	}
+	if n <= 0 || n > size {
+		n = size
+	}
+	ts := make([]Transition, n)
+	start := h.next - n
+	if start < 0 {
+		start += len(h.transitions)
+	}
+	for i := range ts {
+		ts[i] = h.transitions[(start+i)%len(h.transitions)]
+	}
+	return ts
+}
+
+// History returns the last n committed transitions, oldest first, or all of
+// those recorded if n is zero or more than recorded. The FSM records the
+// number of transitions given to WithHistory, none by default. With
+// WithCodec, the arguments are those decoded from their encoding.
+//
+// History is safe to call from a callback.
+func (f *FSM) History(n int) []Transition {
+	if f.history == nil {
+		return nil
+	}
+	return f.history.last(n)
+}
+
+// transitionOf returns the transition of e, with the sequence number it gets
+// when it is committed.
+func (f *FSM) transitionOf(e *Event) Transition {
+	f.stateMu.RLock()
+	seq := f.seq + 1
+	f.stateMu.RUnlock()
+	return Transition{
+		Sequence: seq,
+		Event:    e.Event,
+		Src:      e.Src,
+		Dst:      e.Dst,
+		Args:     e.Args,
+		Time:     time.Now(),
+	}
+}
+
+// persist saves the state after the transition t in the store and appends t
+// to the log, if any. It is called before t is committed, which is aborted if
+// persist returns an error. During a batch, t is only written, and recorded
+// in the history as recorded, once the batch succeeds, see EventsCtx.
+func (f *FSM) persist(ctx context.Context, t, recorded Transition) error {
+	var metadata map[string]interface{}
+	if f.store != nil {
+		metadata = f.copyMetadata()
+	}
+	if f.batch != nil {
+		f.batch.writes = append(f.batch.writes, batchWrite{f.batch.index, t, recorded, metadata})
+		return nil
+	}
+	return f.write(ctx, t, metadata)
+}
+
+// write saves the state after the transition t, with metadata, in the store
+// and appends t to the log, if any.
+//
+// The state is saved first, so that a FSM behind its store, which gets a
+// ConflictError, does not append to the log. If the store saves the state
+// but the log refuses t, the store is ahead of the FSM until it is loaded
+// again.
+func (f *FSM) write(ctx context.Context, t Transition, metadata map[string]interface{}) error {
+	if f.store != nil {
+		s := Snapshot{State: t.Dst, Sequence: t.Sequence, Metadata: metadata}
+		if err := f.store.Save(f.codecContext(ctx), f.storeID, s); err != nil {
+			return StoreError{f.storeID, err}
+		}
+	}
+	if f.log != nil {
+		if err := f.log.Append(f.codecContext(ctx), t); err != nil {
+			return LogError{t.Sequence, err}
+		}
+	}
+	return nil
+}
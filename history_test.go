@@ -0,0 +1,97 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import "testing"
+
+func TestHistory(t *testing.T) {
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{EvtName: "open", SrcStates: []string{"closed"}, DstStates: "open"},
+			{EvtName: "close", SrcStates: []string{"open"}, DstStates: "closed"},
+		},
+		Callbacks{},
+		WithHistory(3),
+	)
+	if len(fsm.History(0)) != 0 {
+		t.Error("expected an empty history")
+	}
+
+	for i := 0; i < 5; i++ {
+		event := "open"
+		if i%2 == 1 {
+			event = "close"
+		}
+		if err := fsm.Event(event, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	h := fsm.History(0)
+	if len(h) != 3 {
+		t.Fatalf("expected 3 transitions, got %d", len(h))
+	}
+	for i, tr := range h {
+		if tr.Sequence != uint64(i+3) || tr.Args[0] != i+2 || tr.Time.IsZero() {
+			t.Errorf("unexpected transition %+v", tr)
+		}
+	}
+	if h[2].Event != "open" || h[2].Src != "closed" || h[2].Dst != "open" {
+		t.Errorf("expected the last transition to be open, got %+v", h[2])
+	}
+
+	h = fsm.History(2)
+	if len(h) != 2 || h[0].Sequence != 4 || h[1].Sequence != 5 {
+		t.Errorf("expected the last 2 transitions, got %+v", h)
+	}
+}
+
+func TestHistoryDisabled(t *testing.T) {
+	fsm := NewFSM(
+		"closed",
+		Events{{EvtName: "open", SrcStates: []string{"closed"}, DstStates: "open"}},
+		Callbacks{},
+	)
+	fsm.Event("open")
+	if fsm.History(10) != nil {
+		t.Error("expected no history by default")
+	}
+}
+
+func TestHistoryCodecError(t *testing.T) {
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{EvtName: "open", SrcStates: []string{"closed"}, DstStates: "open"},
+		},
+		Callbacks{},
+		WithHistory(3),
+		WithCodec(JSONCodec{}),
+	)
+	if _, ok := fsm.Event("open", make(chan int)).(HistoryError); !ok {
+		t.Error("expected 'HistoryError' for arguments the codec can not encode")
+	}
+	if fsm.Current() != "closed" || len(fsm.History(0)) != 0 {
+		t.Error("expected the transition not to be committed")
+	}
+
+	if err := fsm.Event("open", 1); err != nil {
+		t.Fatal(err)
+	}
+	if h := fsm.History(0); len(h) != 1 || h[0].Args[0] != 1.0 {
+		t.Errorf("expected the arguments decoded by the codec, got %+v", h)
+	}
+}
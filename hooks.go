@@ -0,0 +1,122 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+// Hook is a callback with a typed key, created with Before, Leave, Enter,
+// After or Unhandled, as an alternative to the string keys of Callbacks:
+//
+//	f, err := fsm.NewFSMHooks("start", events, fsm.Hooks{
+//		fsm.Before("run", checkInput),
+//		fsm.Enter("end", notify),
+//	})
+//
+// A misspelled kind of callback does not compile, and NewFSMHooks returns an
+// UnknownCallbackError for an event or state that the FSM does not have,
+// instead of silently never calling the callback.
+type Hook struct {
+	key cKey
+	cb  Callback
+}
+
+// Hooks is a shorthand for defining the callbacks in NewFSMHooks.
+type Hooks []Hook
+
+// Before returns a before_<EVENT> hook of event, or a before_event hook if
+// event is empty.
+func Before(event string, fn Callback) Hook {
+	return Hook{cKey{event, callbackBeforeEvent}, fn}
+}
+
+// Leave returns a leave_<STATE> hook of state, or a leave_state hook if state
+// is empty.
+func Leave(state string, fn Callback) Hook {
+	return Hook{cKey{state, callbackLeaveState}, fn}
+}
+
+// Enter returns an enter_<STATE> hook of state, or an enter_state hook if
+// state is empty.
+func Enter(state string, fn Callback) Hook {
+	return Hook{cKey{state, callbackEnterState}, fn}
+}
+
+// After returns an after_<EVENT> hook of event, or an after_event hook if
+// event is empty.
+func After(event string, fn Callback) Hook {
+	return Hook{cKey{event, callbackAfterEvent}, fn}
+}
+
+// Unhandled returns an unhandled_<STATE> hook of state, or an unhandled_state
+// hook if state is empty.
+func Unhandled(state string, fn Callback) Hook {
+	return Hook{cKey{state, callbackUnhandled}, fn}
+}
+
+// Key returns the key of the hook in Callbacks, such as "before_run".
+func (h Hook) Key() string {
+	prefix, all := "", ""
+	switch h.key.callbackType {
+	case callbackBeforeEvent:
+		prefix, all = "before_", "event"
+	case callbackLeaveState:
+		prefix, all = "leave_", "state"
+	case callbackEnterState:
+		prefix, all = "enter_", "state"
+	case callbackAfterEvent:
+		prefix, all = "after_", "event"
+	case callbackUnhandled:
+		prefix, all = "unhandled_", "state"
+	}
+	if h.key.target == "" {
+		return prefix + all
+	}
+	return prefix + h.key.target
+}
+
+// NewFSMHooks constructs a FSM like NewFSM, with callbacks given as hooks.
+// Hooks with the same key are chained and called in order, see Chain.
+//
+// It returns an UnknownCallbackError if a hook is for an event or a state that
+// is not defined by the events or the options, such as WithStates.
+func NewFSMHooks(initial string, events []EventDesc, hooks Hooks, opts ...Option) (*FSM, error) {
+	f := NewDefinition(events, nil).instance(initial)
+	for _, h := range hooks {
+		f.addCallback(h.key, h.cb)
+	}
+	for _, opt := range opts {
+		opt(f)
+	}
+
+	for _, h := range hooks {
+		if !f.hasTarget(h.key) {
+			f.stopAllTimers()
+			return nil, UnknownCallbackError{Callback: h.Key(), Target: h.key.target}
+		}
+	}
+	return f, nil
+}
+
+// hasTarget returns whether the event or state of key is defined, or key is
+// for all events or states.
+func (f *FSM) hasTarget(key cKey) bool {
+	if key.target == "" {
+		return true
+	}
+	switch key.callbackType {
+	case callbackBeforeEvent, callbackAfterEvent:
+		return f.table.hasEvent(key.target)
+	default:
+		return f.allStates[key.target]
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestNewFSMHooks(t *testing.T) {
+	events := Events{
+		{EvtName: "run", SrcStates: []string{"start"}, DstStates: "end"},
+	}
+
+	var calls []string
+	record := func(name string) Callback {
+		return func(action string, e *Event) {
+			calls = append(calls, name)
+		}
+	}
+	f, err := NewFSMHooks("start", events, Hooks{
+		Before("run", record("before_run")),
+		Before("", record("before_event")),
+		Leave("start", record("leave_start")),
+		Enter("end", record("enter_end")),
+		Enter("end", record("enter_end 2")),
+		After("run", record("after_run")),
+		Enter("idle", record("enter_idle")),
+	}, WithStates(States{{Name: "idle"}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Event("run"); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(calls) != "[before_run before_event leave_start enter_end enter_end 2 after_run]" {
+		t.Errorf("unexpected calls %v", calls)
+	}
+
+	_, err = NewFSMHooks("start", events, Hooks{Enter("ned", record("enter_ned"))})
+	var unknown UnknownCallbackError
+	if !errors.As(err, &unknown) || unknown.Callback != "enter_ned" || unknown.Target != "ned" {
+		t.Errorf("expected UnknownCallbackError for enter_ned, got %v", err)
+	}
+	_, err = NewFSMHooks("start", events, Hooks{After("end", record("after_end"))})
+	if !errors.Is(err, ErrUnknownCallback) {
+		t.Errorf("expected ErrUnknownCallback for a state given as event, got %v", err)
+	}
+}
+
+func TestHookKey(t *testing.T) {
+	tests := []struct {
+		hook Hook
+		key  string
+	}{
+		{Before("run", nil), "before_run"},
+		{Before("", nil), "before_event"},
+		{Leave("start", nil), "leave_start"},
+		{Leave("", nil), "leave_state"},
+		{Enter("end", nil), "enter_end"},
+		{Enter("", nil), "enter_state"},
+		{After("run", nil), "after_run"},
+		{After("", nil), "after_event"},
+		{Unhandled("start", nil), "unhandled_start"},
+		{Unhandled("", nil), "unhandled_state"},
+	}
+	for _, test := range tests {
+		if key := test.hook.Key(); key != test.key {
+			t.Errorf("expected key %s, got %s", test.key, key)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package hypermedia derives REST hypermedia affordances (HATEOAS links) from
+// the transitions available in a FSM.
+package hypermedia
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/papiguy/fsm"
+)
+
+// Method is the HTTP method used by the links to fire an event.
+const Method = "POST"
+
+// Link is a hypermedia affordance for an event that can be fired.
+type Link struct {
+	// Rel is the name of the event.
+	Rel string `json:"rel"`
+
+	// Href is the URL template expanded for the event.
+	Href string `json:"href"`
+
+	// Method is the HTTP method to use with Href.
+	Method string `json:"method"`
+}
+
+// Allow reports whether the caller is permitted to fire event.
+type Allow func(event string) bool
+
+// Links returns a link for every event that can currently occur in f and that
+// allow permits, in the order of f.AvailableTransitions(). A nil allow permits
+// every event.
+//
+// The href of each link is built from template by replacing every occurrence
+// of {event} with the path escaped event name, for example
+// "/orders/42/events/{event}".
+func Links(f *fsm.FSM, template string, allow Allow) []Link {
+	links := []Link{}
+	for _, event := range f.AvailableTransitions() {
+		if !f.Can(event) {
+			continue
+		}
+		if allow != nil && !allow(event) {
+			continue
+		}
+		links = append(links, Link{
+			Rel:    event,
+			Href:   strings.Replace(template, "{event}", url.PathEscape(event), -1),
+			Method: Method,
+		})
+	}
+	return links
+}
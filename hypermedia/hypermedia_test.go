@@ -0,0 +1,88 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hypermedia
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/papiguy/fsm"
+)
+
+func newOrder() *fsm.FSM {
+	return fsm.NewFSM(
+		"submitted",
+		fsm.Events{
+			{EvtName: "approve", SrcStates: []string{"submitted"}, DstStates: "approved"},
+			{EvtName: "reject", SrcStates: []string{"submitted"}, DstStates: "rejected"},
+			{EvtName: "put on hold", SrcStates: []string{"submitted"}, DstStates: "on_hold"},
+			{EvtName: "ship", SrcStates: []string{"approved"}, DstStates: "shipped"},
+		},
+		fsm.Callbacks{},
+	)
+}
+
+func TestLinks(t *testing.T) {
+	links := Links(newOrder(), "/orders/42/events/{event}", nil)
+	if len(links) != 3 {
+		t.Fatal("expected a link for every available transition")
+	}
+	if links[0] != (Link{Rel: "approve", Href: "/orders/42/events/approve", Method: "POST"}) {
+		t.Error("unexpected link for 'approve'")
+	}
+	if links[1].Href != "/orders/42/events/put%20on%20hold" {
+		t.Error("expected event name to be escaped")
+	}
+}
+
+func TestLinksFiltered(t *testing.T) {
+	links := Links(newOrder(), "/orders/42/events/{event}", func(event string) bool {
+		return event != "approve"
+	})
+	for _, l := range links {
+		if l.Rel == "approve" {
+			t.Error("expected 'approve' to be filtered out")
+		}
+	}
+	if len(links) != 2 {
+		t.Error("expected the other links to be kept")
+	}
+}
+
+func TestLinksNone(t *testing.T) {
+	f := newOrder()
+	f.SetState("shipped")
+	links := Links(f, "/orders/42/events/{event}", nil)
+	if links == nil || len(links) != 0 {
+		t.Error("expected an empty list of links")
+	}
+}
+
+func ExampleLinks() {
+	f := fsm.NewFSM(
+		"submitted",
+		fsm.Events{
+			{EvtName: "approve", SrcStates: []string{"submitted"}, DstStates: "approved"},
+			{EvtName: "reject", SrcStates: []string{"submitted"}, DstStates: "rejected"},
+		},
+		fsm.Callbacks{},
+	)
+	links := Links(f, "/orders/42/events/{event}", nil)
+	b, _ := json.Marshal(links)
+	fmt.Println(string(b))
+	// Output:
+	// [{"rel":"approve","href":"/orders/42/events/approve","method":"POST"},{"rel":"reject","href":"/orders/42/events/reject","method":"POST"}]
+}
@@ -0,0 +1,102 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import "sort"
+
+// Edge is a transition of the definition of a FSM, from a source state to a
+// destination state on an event.
+type Edge struct {
+	Event string
+	Src   string
+	Dst   string
+}
+
+// States returns all states of the FSM, in sorted order.
+func (f *FSM) States() []string {
+	f.stateMu.RLock()
+	defer f.stateMu.RUnlock()
+	return f.sortedStates()
+}
+
+// EventNames returns the names of all events of the FSM, in sorted order.
+func (f *FSM) EventNames() []string {
+	f.stateMu.RLock()
+	defer f.stateMu.RUnlock()
+	events := f.table.eventNames()
+	sort.Strings(events)
+	return events
+}
+
+// Transitions returns all transitions of the FSM, sorted by source state, then
+// by event. An event with several destinations, see EventDesc.DstChoices, has
+// one transition for each of them. Guards are not taken into account.
+func (f *FSM) Transitions() []Edge {
+	f.stateMu.RLock()
+	defer f.stateMu.RUnlock()
+	edges := make([]Edge, 0, f.table.len())
+	for _, k := range f.sortedTransitionKeys() {
+		for _, dst := range f.dsts(k) {
+			edges = append(edges, Edge{k.event, k.src, dst})
+		}
+	}
+	return edges
+}
+
+// AvailableTransition is a transition available in the current state, see
+// FSM.AvailableTransitionsDetailed.
+type AvailableTransition struct {
+	Event string
+
+	// Dst is the destination state, the current state for internal events.
+	Dst string
+
+	// DstChoices are the other destinations the event may choose, see
+	// EventDesc.DstChoices.
+	DstChoices []string
+
+	// Description and Tags are those of the event description.
+	Description string
+	Tags        []string
+}
+
+// AvailableTransitionsDetailed returns the transitions available in the
+// current state, sorted by event, with their destinations and descriptions, so
+// that user interfaces can show where each event leads. As for
+// AvailableTransitions, guards are not evaluated.
+func (f *FSM) AvailableTransitionsDetailed() []AvailableTransition {
+	f.stateMu.RLock()
+	defer f.stateMu.RUnlock()
+	events := f.table.from(f.current)
+	if len(events) == 0 {
+		return nil
+	}
+	sort.Strings(events)
+	transitions := make([]AvailableTransition, 0, len(events))
+	for _, event := range events {
+		dst, desc, _ := f.table.find(event, f.current)
+		t := AvailableTransition{
+			Event:       event,
+			Dst:         dst,
+			Description: desc.Description,
+			Tags:        append([]string(nil), desc.Tags...),
+		}
+		if !desc.Internal {
+			t.DstChoices = append([]string(nil), desc.DstChoices...)
+		}
+		transitions = append(transitions, t)
+	}
+	return transitions
+}
@@ -0,0 +1,93 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIntrospection(t *testing.T) {
+	fsm := newAnalysisFSM()
+
+	expectedStates := []string{"archived", "draft", "published", "retired", "review"}
+	if got := fsm.States(); !reflect.DeepEqual(got, expectedStates) {
+		t.Errorf("expected states %v, got %v", expectedStates, got)
+	}
+
+	expectedEvents := []string{"approve", "archive", "reject", "restore", "submit"}
+	if got := fsm.EventNames(); !reflect.DeepEqual(got, expectedEvents) {
+		t.Errorf("expected events %v, got %v", expectedEvents, got)
+	}
+
+	expectedEdges := []Edge{
+		{"restore", "archived", "published"},
+		{"submit", "draft", "review"},
+		{"archive", "published", "archived"},
+		{"archive", "retired", "archived"},
+		{"approve", "review", "published"},
+		{"reject", "review", "draft"},
+	}
+	if got := fsm.Transitions(); !reflect.DeepEqual(got, expectedEdges) {
+		t.Errorf("expected transitions %v, got %v", expectedEdges, got)
+	}
+}
+
+func TestIntrospectionChoices(t *testing.T) {
+	fsm := NewFSM(
+		"review",
+		Events{
+			{EvtName: "decide", SrcStates: []string{"review"}, DstStates: "approved", DstChoices: []string{"rejected"}},
+			{EvtName: "ping", SrcStates: []string{"review"}, DstStates: "ignored", Internal: true},
+		},
+		Callbacks{},
+	)
+
+	expected := []Edge{
+		{"decide", "review", "approved"},
+		{"decide", "review", "rejected"},
+		{"ping", "review", "review"},
+	}
+	if got := fsm.Transitions(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected transitions %v, got %v", expected, got)
+	}
+}
+
+func TestAvailableTransitionsDetailed(t *testing.T) {
+	fsm := NewFSM(
+		"review",
+		Events{
+			{EvtName: "decide", SrcStates: []string{"review"}, DstStates: "approved", DstChoices: []string{"rejected"},
+				Description: "decide on the request", Tags: []string{"manual"}},
+			{EvtName: "ping", SrcStates: []string{"review"}, Internal: true},
+			{EvtName: "reopen", SrcStates: []string{"approved", "rejected"}, DstStates: "review"},
+		},
+		Callbacks{},
+	)
+
+	expected := []AvailableTransition{
+		{Event: "decide", Dst: "approved", DstChoices: []string{"rejected"},
+			Description: "decide on the request", Tags: []string{"manual"}},
+		{Event: "ping", Dst: "review"},
+	}
+	if got := fsm.AvailableTransitionsDetailed(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %+v, got %+v", expected, got)
+	}
+
+	fsm.SetState("done")
+	if got := fsm.AvailableTransitionsDetailed(); got != nil {
+		t.Errorf("expected no transitions, got %+v", got)
+	}
+}
@@ -0,0 +1,260 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+)
+
+// jsonDoc is the JSON document read by NewFSMFromJSON.
+type jsonDoc struct {
+	Initial string      `json:"initial"`
+	Events  []jsonEvent `json:"events"`
+}
+
+// jsonEvent is an event in a jsonDoc.
+type jsonEvent struct {
+	Name string     `json:"name"`
+	Src  jsonStates `json:"src"`
+	Dst  string     `json:"dst"`
+
+	// Timeout, Every and After are the timers of the event, and Retry and
+	// Deadline how it is handled, see NewFSMFromJSON.
+	Timeout  jsonDuration `json:"timeout"`
+	Every    jsonDuration `json:"every"`
+	After    jsonDuration `json:"after"`
+	Retry    *jsonRetry   `json:"retry"`
+	Deadline jsonDuration `json:"deadline"`
+}
+
+// jsonRetry is the retry policy of a jsonEvent, see Retry.
+type jsonRetry struct {
+	Attempts int          `json:"attempts"`
+	Backoff  jsonDuration `json:"backoff"`
+}
+
+// jsonDuration is a duration given as a string such as "1m30s".
+type jsonDuration time.Duration
+
+func (d *jsonDuration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = jsonDuration(v)
+	return nil
+}
+
+// jsonStates is a list of states that can also be given as a single string.
+type jsonStates []string
+
+func (s *jsonStates) UnmarshalJSON(data []byte) error {
+	var state string
+	if err := json.Unmarshal(data, &state); err == nil {
+		*s = jsonStates{state}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(s))
+}
+
+// NewFSMFromJSON constructs a FSM from a JSON document with the initial state
+// and the events, such as:
+//
+//	{
+//	    "initial": "closed",
+//	    "events": [
+//	        {"name": "open", "src": ["closed"], "dst": "open"},
+//	        {"name": "close", "src": "open", "dst": "closed"}
+//	    ]
+//	}
+//
+// A single source state can be given as a string. The callbacks are given as
+// for NewFSM, since they can not be expressed in JSON.
+//
+// An event can also have timers, given as durations such as "30s":
+//
+//	{"name": "expire", "src": "pending", "dst": "expired", "timeout": "15m"}
+//
+// With timeout the event is fired once the FSM has been in a source state for
+// the duration, as with FSM.Timeout. With every it is fired every duration
+// while the FSM is in a source state, as with FSM.Recurring. With after it is
+// fired once, the duration after the FSM is constructed, unless it has left
+// the initial state by then, as with FSM.EventAfter; the initial state must
+// then be a source state of the event.
+//
+// The handling of an event sent with Event can be bounded too:
+//
+//	{"name": "charge", "src": "cart", "dst": "paid",
+//	    "retry": {"attempts": 3, "backoff": "100ms"}, "deadline": "5s"}
+//
+// With retry the event is handled again when it fails with a Retryable error,
+// up to attempts times in all, as with the Retry middleware. With deadline,
+// its service level agreement, its context is done after the duration, retries
+// included, as with the Deadline middleware.
+//
+// The errors are those of ImportJSON and a ConflictingTransitionError as
+// returned by NewFSMStrict.
+func NewFSMFromJSON(data []byte, callbacks Callbacks) (*FSM, error) {
+	doc, err := decodeJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	events, err := doc.events("json")
+	if err != nil {
+		return nil, err
+	}
+	f, err := NewFSMStrict(doc.Initial, events, callbacks)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range doc.Events {
+		if err := e.start(f); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// ImportJSON reads the initial state and the events of a FSM from a JSON
+// document, as described for NewFSMFromJSON. The timers, retries and deadlines
+// of the events are checked, but not returned since Events can not express
+// them.
+//
+// An ImportError is returned if the document is malformed, has unknown fields
+// or misses the initial state or the name, source or destination of an event,
+// or if the timers, retry or deadline of an event are invalid.
+func ImportJSON(r io.Reader) (string, Events, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", nil, err
+	}
+	doc, err := decodeJSON(data)
+	if err != nil {
+		return "", nil, err
+	}
+	events, err := doc.events("json")
+	if err != nil {
+		return "", nil, err
+	}
+	return doc.Initial, events, nil
+}
+
+// decodeJSON decodes a JSON document, reporting the line of syntax and type
+// errors.
+func decodeJSON(data []byte) (jsonDoc, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	var doc jsonDoc
+	if err := dec.Decode(&doc); err != nil {
+		line := 0
+		var serr *json.SyntaxError
+		var terr *json.UnmarshalTypeError
+		if errors.As(err, &serr) {
+			line = 1 + bytes.Count(data[:serr.Offset], []byte("\n"))
+		} else if errors.As(err, &terr) {
+			line = 1 + bytes.Count(data[:terr.Offset], []byte("\n"))
+		}
+		return doc, ImportError{"json", line, err.Error()}
+	}
+	return doc, nil
+}
+
+// events validates the document and converts it to events.
+func (doc jsonDoc) events(format string) (Events, error) {
+	if doc.Initial == "" {
+		return nil, ImportError{format, 0, "no initial state"}
+	}
+	events := make(Events, 0, len(doc.Events))
+	for _, e := range doc.Events {
+		switch {
+		case e.Name == "":
+			return nil, ImportError{format, 0, "event without name"}
+		case len(e.Src) == 0:
+			return nil, ImportError{format, 0, "event " + e.Name + " has no source state"}
+		case e.Dst == "":
+			return nil, ImportError{format, 0, "event " + e.Name + " has no destination state"}
+		}
+		if msg := e.check(doc.Initial); msg != "" {
+			return nil, ImportError{format, 0, "event " + e.Name + " " + msg}
+		}
+		events = append(events, EventDesc{EvtName: e.Name, SrcStates: []string(e.Src), DstStates: e.Dst})
+	}
+	return events, nil
+}
+
+// check returns why the timers, retry or deadline of e are invalid for a FSM
+// starting in initial, or the empty string if they are valid.
+func (e jsonEvent) check(initial string) string {
+	switch {
+	case e.Timeout < 0:
+		return "has a negative timeout"
+	case e.Every < 0:
+		return "has a negative every"
+	case e.After < 0:
+		return "has a negative after"
+	case e.Deadline < 0:
+		return "has a negative deadline"
+	case e.Retry != nil && e.Retry.Attempts < 1:
+		return "has a retry without attempts"
+	case e.Retry != nil && e.Retry.Backoff < 0:
+		return "has a negative retry backoff"
+	case e.After > 0:
+		for _, state := range e.Src {
+			if state == initial {
+				return ""
+			}
+		}
+		return "has an after but can not occur in the initial state " + initial
+	}
+	return ""
+}
+
+// start adds the timers of e to f, and the middleware of its retry and
+// deadline, as checked by check.
+func (e jsonEvent) start(f *FSM) error {
+	for _, state := range e.Src {
+		if e.Timeout > 0 {
+			if err := f.Timeout(state, time.Duration(e.Timeout), e.Name); err != nil {
+				return err
+			}
+		}
+		if e.Every > 0 {
+			if err := f.Recurring(state, Interval(time.Duration(e.Every)), e.Name); err != nil {
+				return err
+			}
+		}
+	}
+	if e.After > 0 {
+		if _, err := f.EventAfter(time.Duration(e.After), e.Name); err != nil {
+			return err
+		}
+	}
+	if e.Deadline > 0 {
+		f.Use(Deadline(e.Name, time.Duration(e.Deadline)))
+	}
+	if e.Retry != nil && e.Retry.Attempts > 1 {
+		f.Use(Retry(e.Name, e.Retry.Attempts, time.Duration(e.Retry.Backoff)))
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestNewFSMFromJSON(t *testing.T) {
+	opened := false
+	fsm, err := NewFSMFromJSON([]byte(`{
+		"initial": "closed",
+		"events": [
+			{"name": "open", "src": ["closed"], "dst": "open"},
+			{"name": "close", "src": "open", "dst": "closed"}
+		]
+	}`), Callbacks{
+		"enter_open": func(action string, e *Event) {
+			opened = true
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fsm.Current() != "closed" {
+		t.Errorf("expected state to be 'closed', got %q", fsm.Current())
+	}
+	if err := fsm.Event("open"); err != nil || !opened {
+		t.Error("expected the callbacks to be used")
+	}
+	if err := fsm.Event("close"); err != nil {
+		t.Error("expected a single source state to be accepted")
+	}
+}
+
+func TestNewFSMFromJSONTimers(t *testing.T) {
+	pings := make(chan struct{}, 10)
+	fsm, err := NewFSMFromJSON([]byte(`{
+		"initial": "pending",
+		"events": [
+			{"name": "expire", "src": "pending", "dst": "expired", "timeout": "20ms"},
+			{"name": "ping", "src": "expired", "dst": "expired", "every": "5ms"}
+		]
+	}`), Callbacks{
+		"after_ping": func(action string, e *Event) {
+			select {
+			case pings <- struct{}{}:
+			default:
+			}
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !waitFor(fsm, "expired") {
+		t.Fatal("expected the timeout to fire")
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case <-pings:
+		case <-time.After(time.Second):
+			t.Fatal("expected the recurring event to fire repeatedly")
+		}
+	}
+
+	fsm, err = NewFSMFromJSON([]byte(`{
+		"initial": "idle",
+		"events": [
+			{"name": "wake", "src": ["idle", "asleep"], "dst": "awake", "after": "10ms"},
+			{"name": "sleep", "src": "awake", "dst": "asleep"}
+		]
+	}`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !waitFor(fsm, "awake") {
+		t.Fatal("expected the delayed event to fire")
+	}
+	fsm.Event("sleep")
+	time.Sleep(30 * time.Millisecond)
+	if fsm.Current() != "asleep" {
+		t.Error("expected the delayed event to fire only once")
+	}
+}
+
+func TestNewFSMFromJSONRetry(t *testing.T) {
+	attempts := 0
+	fsm, err := NewFSMFromJSON([]byte(`{
+		"initial": "cart",
+		"events": [
+			{"name": "charge", "src": "cart", "dst": "paid",
+				"retry": {"attempts": 3, "backoff": "1ms"}, "deadline": "1s"}
+		]
+	}`), Callbacks{
+		"before_charge": func(action string, e *Event) {
+			attempts++
+			if _, ok := e.Context().Deadline(); !ok {
+				t.Error("expected the event to have a deadline")
+			}
+			if attempts < 3 {
+				e.Fail(errors.New("unavailable"), Retryable)
+			}
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fsm.Event("charge"); err != nil || attempts != 3 {
+		t.Errorf("expected the third attempt to succeed, got %v after %d", err, attempts)
+	}
+}
+
+func TestNewFSMFromJSONErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		line int
+	}{
+		{"{\n\"initial\": \"a\",\n\"events\": [\n}", 4},
+		{"{\n\"initial\": 1}", 2},
+		{`{"initial": "a", "event": []}`, 0},
+		{`{"events": []}`, 0},
+		{`{"initial": "a", "events": [{"src": "a", "dst": "b"}]}`, 0},
+		{`{"initial": "a", "events": [{"name": "go", "dst": "b"}]}`, 0},
+		{`{"initial": "a", "events": [{"name": "go", "src": "a"}]}`, 0},
+		{`{"initial": "a", "events": [{"name": "go", "src": "a", "dst": "b", "timeout": "soon"}]}`, 0},
+		{`{"initial": "a", "events": [{"name": "go", "src": "a", "dst": "b", "every": "-1s"}]}`, 0},
+		{`{"initial": "a", "events": [{"name": "go", "src": "a", "dst": "b", "retry": "1s"}]}`, 1},
+		{`{"initial": "a", "events": [{"name": "go", "src": "a", "dst": "b", "retry": {"backoff": "1s"}}]}`, 0},
+		{`{"initial": "a", "events": [{"name": "go", "src": "a", "dst": "b", "retry": {"attempts": 2, "backoff": "-1s"}}]}`, 0},
+		{`{"initial": "a", "events": [{"name": "go", "src": "a", "dst": "b", "deadline": "-1s"}]}`, 0},
+		{`{"initial": "a", "events": [{"name": "go", "src": "b", "dst": "c", "after": "1s"}]}`, 0},
+	}
+	for _, test := range tests {
+		_, err := NewFSMFromJSON([]byte(test.src), nil)
+		e, ok := err.(ImportError)
+		if !ok {
+			t.Errorf("expected ImportError for %s, got %v", test.src, err)
+			continue
+		}
+		if e.Format != "json" || e.Line != test.line {
+			t.Errorf("expected line %d for %s, got %v", test.line, test.src, e)
+		}
+	}
+
+	_, err := NewFSMFromJSON([]byte(`{"initial": "a", "events": [
+		{"name": "go", "src": "a", "dst": "b"},
+		{"name": "go", "src": "a", "dst": "c"}
+	]}`), nil)
+	if _, ok := err.(ConflictingTransitionError); !ok {
+		t.Errorf("expected ConflictingTransitionError, got %v", err)
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import "sync"
+
+// mutex is a sync.Mutex that can be turned off, see WithoutLocking.
+type mutex struct {
+	mu  sync.Mutex
+	off bool
+}
+
+func (m *mutex) Lock() {
+	if !m.off {
+		m.mu.Lock()
+	}
+}
+
+func (m *mutex) Unlock() {
+	if !m.off {
+		m.mu.Unlock()
+	}
+}
+
+// rwMutex is a sync.RWMutex that can be turned off, see WithoutLocking.
+type rwMutex struct {
+	mu  sync.RWMutex
+	off bool
+}
+
+func (m *rwMutex) Lock() {
+	if !m.off {
+		m.mu.Lock()
+	}
+}
+
+func (m *rwMutex) Unlock() {
+	if !m.off {
+		m.mu.Unlock()
+	}
+}
+
+func (m *rwMutex) RLock() {
+	if !m.off {
+		m.mu.RLock()
+	}
+}
+
+func (m *rwMutex) RUnlock() {
+	if !m.off {
+		m.mu.RUnlock()
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"strconv"
+	"sync"
+)
+
+// Log is an append-only log of the transitions of a FSM, see WithLog. The
+// current state can be reconstructed from it with Replay.
+//
+// Implementations must be safe for concurrent use. MemoryLog is an in-memory
+// implementation, mainly for tests.
+type Log interface {
+	// Append appends t to the log.
+	Append(ctx context.Context, t Transition) error
+
+	// Entries returns the entries of the log, in the order they were
+	// appended.
+	Entries(ctx context.Context) ([]Transition, error)
+}
+
+// MemoryLog is a Log keeping the entries in memory. An entry appended with a
+// codec in the context, see ContextWithCodec, is kept encoded by it, as a
+// persistent log would.
+type MemoryLog struct {
+	mu      sync.Mutex
+	entries []memoryEntry
+}
+
+// memoryEntry is an entry of a MemoryLog, either t or its encoding data by
+// codec.
+type memoryEntry struct {
+	t     Transition
+	data  []byte
+	codec Codec
+}
+
+// Append appends t to the log.
+func (l *MemoryLog) Append(ctx context.Context, t Transition) error {
+	entry := memoryEntry{t: t}
+	if codec, ok := contextCodec(ctx); ok {
+		data, err := codec.Marshal(t)
+		if err != nil {
+			return err
+		}
+		entry = memoryEntry{data: data, codec: codec}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, entry)
+	return nil
+}
+
+// Entries returns a copy of the entries of the log.
+func (l *MemoryLog) Entries(ctx context.Context) ([]Transition, error) {
+	l.mu.Lock()
+	entries := append([]memoryEntry(nil), l.entries...)
+	l.mu.Unlock()
+
+	var ts []Transition
+	if len(entries) > 0 {
+		ts = make([]Transition, len(entries))
+	}
+	for i, entry := range entries {
+		if entry.codec == nil {
+			ts[i] = entry.t
+			continue
+		}
+		if err := entry.codec.Unmarshal(entry.data, &ts[i]); err != nil {
+			return nil, err
+		}
+	}
+	return ts, nil
+}
+
+// Replay sets the state of the FSM to the one reached by the transitions in
+// log, starting from the current state, without calling any callbacks or
+// guards, except those of WithRestoreCallbacks for the state reached. Timers
+// of the state reached, see Timeout, are started from the beginning.
+//
+// It returns a ReplayError if an entry is not a transition of the FSM, does
+// not start in the state reached by the entries before it, or does not follow
+// them in sequence. The FSM is then left unchanged.
+//
+// Replay must not be called from a callback.
+func (f *FSM) Replay(ctx context.Context, log Log) error {
+	entries, err := log.Entries(f.codecContext(ctx))
+	if err != nil {
+		return err
+	}
+
+	f.eventMu.Lock()
+	defer f.eventMu.Unlock()
+
+	state, seq := f.Current(), f.Sequence()
+	for _, entry := range entries {
+		if entry.Sequence != seq+1 {
+			return ReplayError{entry.Sequence, "expected sequence " + strconv.FormatUint(seq+1, 10)}
+		}
+		if entry.Src != state {
+			return ReplayError{entry.Sequence, "transition from " + entry.Src + " while in state " + state}
+		}
+		if key := (eKey{entry.Event, entry.Src}); !f.isDst(key, entry.Dst) {
+			return ReplayError{entry.Sequence, "unknown transition " + entry.Event + " from " + entry.Src + " to " + entry.Dst}
+		}
+		state, seq = entry.Dst, entry.Sequence
+	}
+
+	src := f.Current()
+	f.restore(state, seq, nil)
+	f.restoredStateCallbacks(ctx, src)
+	return nil
+}
+
+// ReplayFSM constructs a FSM like NewFSMStrict and replays log on it, see
+// Replay.
+func ReplayFSM(ctx context.Context, initial string, events []EventDesc, callbacks map[string]Callback, log Log, opts ...Option) (*FSM, error) {
+	f, err := NewFSMStrict(initial, events, callbacks, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.Replay(ctx, log); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
@@ -0,0 +1,159 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestReplay(t *testing.T) {
+	ctx := context.Background()
+	log := &MemoryLog{}
+	events := Events{
+		{EvtName: "open", SrcStates: []string{"closed"}, DstStates: "open"},
+		{EvtName: "close", SrcStates: []string{"open"}, DstStates: "closed"},
+		{EvtName: "lock", SrcStates: []string{"closed"}, DstStates: "locked"},
+	}
+	fsm := NewFSM("closed", events, Callbacks{}, WithLog(log))
+	for _, event := range []string{"open", "close", "lock"} {
+		if err := fsm.Event(event, event+"-arg"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, _ := log.Entries(ctx)
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(entries))
+	}
+	e := entries[1]
+	if e.Sequence != 2 || e.Event != "close" || e.Src != "open" || e.Dst != "closed" ||
+		len(e.Args) != 1 || e.Args[0] != "close-arg" || e.Time.IsZero() {
+		t.Errorf("unexpected entry %+v", e)
+	}
+
+	called := false
+	replayed, err := ReplayFSM(ctx, "closed", events, Callbacks{
+		"enter_state": func(_ string, e *Event) {
+			called = true
+		},
+	}, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replayed.Current() != "locked" || replayed.Sequence() != 3 {
+		t.Error("expected state locked and sequence 3")
+	}
+	if called {
+		t.Error("expected no callbacks during replay")
+	}
+
+	var entered []string
+	replayed, err = ReplayFSM(ctx, "closed", events, Callbacks{
+		"enter_locked": func(action string, e *Event) {
+			entered = append(entered, action+" "+e.Dst)
+		},
+		"enter_state": NonReplayable(func(_ string, e *Event) {
+			called = true
+		}),
+	}, log, WithRestoreCallbacks())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entered) != 1 || entered[0] != ActionRestoringState+" locked" || called {
+		t.Errorf("expected only the replayable callbacks of the state reached, got %v", entered)
+	}
+}
+
+func TestReplayInvalid(t *testing.T) {
+	ctx := context.Background()
+	events := Events{
+		{EvtName: "open", SrcStates: []string{"closed"}, DstStates: "open"},
+		{EvtName: "close", SrcStates: []string{"open"}, DstStates: "closed"},
+	}
+
+	for _, entries := range [][]Transition{
+		{{Sequence: 2, Event: "open", Src: "closed", Dst: "open"}},
+		{{Sequence: 1, Event: "close", Src: "open", Dst: "closed"}},
+		{{Sequence: 1, Event: "open", Src: "closed", Dst: "closed"}},
+		{
+			{Sequence: 1, Event: "open", Src: "closed", Dst: "open"},
+			{Sequence: 2, Event: "open", Src: "closed", Dst: "open"},
+		},
+	} {
+		log := &MemoryLog{}
+		for _, entry := range entries {
+			log.Append(ctx, entry)
+		}
+		fsm := NewFSM("closed", events, Callbacks{})
+		if _, ok := fsm.Replay(ctx, log).(ReplayError); !ok {
+			t.Errorf("expected ReplayError for %+v", entries)
+		}
+		if fsm.Current() != "closed" || fsm.Sequence() != 0 {
+			t.Error("expected the FSM to be unchanged")
+		}
+	}
+}
+
+// flakyLog is a MemoryLog that refuses the next append when fail is set.
+type flakyLog struct {
+	MemoryLog
+	fail bool
+}
+
+func (l *flakyLog) Append(ctx context.Context, t Transition) error {
+	if l.fail {
+		l.fail = false
+		return errors.New("disk full")
+	}
+	return l.MemoryLog.Append(ctx, t)
+}
+
+func TestLogAppendFailure(t *testing.T) {
+	ctx := context.Background()
+	log := &flakyLog{}
+	events := Events{
+		{EvtName: "open", SrcStates: []string{"closed"}, DstStates: "open"},
+		{EvtName: "close", SrcStates: []string{"open"}, DstStates: "closed"},
+	}
+	entered := false
+	fsm := NewFSM("closed", events, Callbacks{
+		"enter_open": func(_ string, e *Event) {
+			entered = true
+		},
+	}, WithLog(log))
+
+	log.fail = true
+	if _, ok := fsm.Event("open").(LogError); !ok {
+		t.Fatal("expected LogError")
+	}
+	if fsm.Current() != "closed" || fsm.Sequence() != 0 || entered {
+		t.Error("expected the transition not to be committed")
+	}
+
+	for _, event := range []string{"open", "close"} {
+		if err := fsm.Event(event); err != nil {
+			t.Fatal(err)
+		}
+	}
+	replayed, err := ReplayFSM(ctx, "closed", events, Callbacks{}, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replayed.Current() != "closed" || replayed.Sequence() != 2 {
+		t.Error("expected the log to replay without a gap")
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"log/slog"
+)
+
+// logPhase logs a callback called during the transition of e.
+func (f *FSM) logPhase(e *Event, phase Phase) {
+	f.logger.LogAttrs(e.Context(), slog.LevelDebug, "fsm callback",
+		slog.String("callback", phase.Callback),
+		slog.String("action", phase.Action),
+		slog.String("event", e.Event),
+		slog.String("src", e.Src),
+		slog.String("dst", e.Dst),
+		slog.Duration("duration", phase.Duration),
+	)
+}
+
+// logTransition logs the committed transition of e.
+func (f *FSM) logTransition(e *Event) {
+	f.logger.LogAttrs(e.Context(), slog.LevelDebug, "fsm transition",
+		slog.String("event", e.Event),
+		slog.String("src", e.Src),
+		slog.String("dst", e.Dst),
+		slog.Uint64("sequence", f.Sequence()),
+	)
+}
+
+// logRejected logs an event rejected in state src with err.
+func (f *FSM) logRejected(ctx context.Context, event, src string, err error) {
+	f.logger.LogAttrs(ctx, slog.LevelWarn, "fsm event rejected",
+		slog.String("event", event),
+		slog.String("src", src),
+		slog.String("error", err.Error()),
+	)
+}
@@ -0,0 +1,60 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	handler := slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey || a.Key == "duration" {
+				return slog.Attr{}
+			}
+			return a
+		},
+	})
+	fsm := NewFSM(
+		"closed",
+		Events{{EvtName: "open", SrcStates: []string{"closed"}, DstStates: "open"}},
+		Callbacks{
+			"enter_open": func(_ string, e *Event) {},
+		},
+		WithLogger(slog.New(handler)),
+	)
+	fsm.Event("open")
+	fsm.Event("open")
+
+	expected := []string{
+		"level=DEBUG msg=\"fsm transition\" event=open src=closed dst=open sequence=1",
+		"level=DEBUG msg=\"fsm callback\" callback=enter_open action=EnteringState event=open src=closed dst=open",
+		"level=WARN msg=\"fsm event rejected\" event=open src=open error=\"event open inappropriate in current state open\"",
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != len(expected) {
+		t.Fatalf("expected %d lines, got %q", len(expected), lines)
+	}
+	for i, line := range lines {
+		if line != expected[i] {
+			t.Errorf("expected %q, got %q", expected[i], line)
+		}
+	}
+}
@@ -0,0 +1,597 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Manager owns the FSM instances of a Definition, keyed by ID, for services
+// that track the state of many entities such as orders or connections.
+//
+// The instances are created with Create, in the initial state or in the state
+// saved in the store given with ManagerStore, and are then found with Get
+// until they are removed with Delete, or evicted once idle, see
+// ManagerEviction. A Manager is safe for concurrent use.
+//
+// The instances are split into shards by a hash of their ID, each with its own
+// lock, so that goroutines handling different instances seldom contend. See
+// ManagerShards.
+type Manager struct {
+	def      *Definition
+	initial  string
+	opts     []Option
+	store    Store
+	observer func(id, src, dst, event string)
+
+	// config are the options given to NewManager, inherited by WithDefaults.
+	config []ManagerOption
+
+	// occupancy counts the instances in each state, if states are limited
+	// with ManagerStateLimit.
+	occupancy *occupancy
+
+	shards []managerShard
+
+	// ttl is the time after which idle instances are evicted, if not zero.
+	// The eviction stops when stop is closed.
+	ttl       time.Duration
+	stop      chan struct{}
+	closeOnce sync.Once
+
+	// stopped is set by Shutdown, after which no instance is added.
+	stopped atomic.Bool
+}
+
+// managedFSM is an instance of a Manager.
+type managedFSM struct {
+	fsm *FSM
+
+	// occupant counts the instance in the occupancy of the manager, if any.
+	occupant *occupant
+
+	// used is when the instance was last used, in Unix nanoseconds.
+	used atomic.Int64
+}
+
+// managerShard holds the instances whose ID hash to it.
+type managerShard struct {
+	mu        sync.RWMutex
+	instances map[string]*managedFSM
+
+	// pad keeps shards on separate cache lines.
+	pad [64]byte
+}
+
+// DefaultManagerShards is the number of shards of a Manager, unless set with
+// ManagerShards.
+const DefaultManagerShards = 32
+
+// ManagerOption configures a Manager, see NewManager.
+type ManagerOption func(*Manager)
+
+// ManagerOptions applies opts to every instance created by the manager.
+func ManagerOptions(opts ...Option) ManagerOption {
+	return func(m *Manager) {
+		m.opts = append(m.opts, opts...)
+	}
+}
+
+// ManagerStore saves the state of every instance in store under its ID, as
+// with WithStore. Create restores the state saved for the ID, if any.
+func ManagerStore(store Store) ManagerOption {
+	return func(m *Manager) {
+		m.store = store
+	}
+}
+
+// ManagerShards splits the instances of the manager into n shards, at least
+// one. More shards reduce contention between goroutines using different
+// instances, at the cost of some memory.
+func ManagerShards(n int) ManagerOption {
+	return func(m *Manager) {
+		if n < 1 {
+			n = 1
+		}
+		m.shards = make([]managerShard, n)
+	}
+}
+
+// ManagerEviction evicts the instances that have not been used for ttl: their
+// state is saved in the store of the manager, if any, and they are removed
+// from memory, to be restored from the store the next time they are used.
+// Without a store, idle instances are simply deleted.
+//
+// As the store refuses a state with a sequence number already saved, changes
+// made since the last transition without one, such as SetMetadata, are lost
+// unless the instance has never been saved.
+//
+// An instance is used when it is returned by Get or Load, or sent an event
+// with Manager.Event. Instances with timers running are not evicted, as the
+// timers would be lost. Call Close to stop the eviction.
+func ManagerEviction(ttl time.Duration) ManagerOption {
+	return func(m *Manager) {
+		m.ttl = ttl
+	}
+}
+
+// ManagerObserver calls fn after each committed transition of any instance,
+// with the ID of the instance, as an Observer added to each of them.
+func ManagerObserver(fn func(id, src, dst, event string)) ManagerOption {
+	return func(m *Manager) {
+		m.observer = fn
+	}
+}
+
+// NewManager returns a manager of instances of def, created in the initial
+// state.
+func NewManager(def *Definition, initial string, opts ...ManagerOption) *Manager {
+	m := &Manager{
+		def:     def,
+		initial: initial,
+		shards:  make([]managerShard, DefaultManagerShards),
+		config:  opts,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	for i := range m.shards {
+		m.shards[i].instances = make(map[string]*managedFSM)
+	}
+	if m.ttl > 0 {
+		m.stop = make(chan struct{})
+		go m.evictLoop()
+	}
+	return m
+}
+
+// WithDefaults returns a new manager of instances of def, created in the
+// initial state, configured with the options given to m and then with opts,
+// so that a service hosting several kinds of machines configures the store,
+// metrics, logger and the like once:
+//
+//	base := fsm.NewManager(nil, "", fsm.ManagerStore(store), fsm.ManagerOptions(fsm.WithMetrics(metrics)))
+//	orders := base.WithDefaults(orderDef, "cart", fsm.ManagerShards(64))
+//	payments := base.WithDefaults(paymentDef, "pending")
+//
+// The options of opts override those of m, except for ManagerOptions, whose
+// options are applied to the instances after those of m. The new manager has
+// instances of its own, and is closed separately from m. As above, a manager
+// with a nil definition can serve as a base, as long as it is not used to
+// create instances.
+func (m *Manager) WithDefaults(def *Definition, initial string, opts ...ManagerOption) *Manager {
+	config := append(m.config[:len(m.config):len(m.config)], opts...)
+	return NewManager(def, initial, config...)
+}
+
+// Close stops the eviction of idle instances, if any. The manager and its
+// instances can still be used.
+func (m *Manager) Close() {
+	m.closeOnce.Do(func() {
+		if m.stop != nil {
+			close(m.stop)
+		}
+	})
+}
+
+// shard returns the shard of the instance id.
+func (m *Manager) shard(id string) *managerShard {
+	// FNV-1a, inlined so that it does not allocate.
+	h := uint32(2166136261)
+	for i := 0; i < len(id); i++ {
+		h ^= uint32(id[i])
+		h *= 16777619
+	}
+	return &m.shards[h%uint32(len(m.shards))]
+}
+
+// Get returns the instance id, or false if there is none. If the manager has
+// a store, an instance that is not in memory, for example because it was
+// evicted, is restored from the store as with Load. Get implements the Manager
+// interfaces of the fsmhttp and fsmgrpc packages.
+func (m *Manager) Get(id string) (*FSM, bool) {
+	if f, ok := m.get(id); ok {
+		return f, true
+	}
+	if m.store == nil {
+		return nil, false
+	}
+	f, err := m.Load(context.Background(), id)
+	return f, err == nil
+}
+
+// get returns the instance id in memory, and marks it used.
+func (m *Manager) get(id string) (*FSM, bool) {
+	s := m.shard(id)
+	s.mu.RLock()
+	mf, ok := s.instances[id]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, false
+	}
+	mf.used.Store(time.Now().UnixNano())
+	return mf.fsm, true
+}
+
+// Load returns the instance id, restoring it from the store of the manager if
+// it is not in memory. It returns a NotFoundError if there is no such
+// instance, a ManagerStoppedError if it is not in memory once the manager is
+// shut down, or the error of the store.
+func (m *Manager) Load(ctx context.Context, id string) (*FSM, error) {
+	if f, ok := m.get(id); ok {
+		return f, nil
+	}
+	if m.store == nil {
+		return nil, NotFoundError{id}
+	}
+	f := m.newInstance(id)
+	if err := f.Load(ctx); err != nil {
+		f.stopAllTimers()
+		return nil, err
+	}
+	if f := m.insert(id, f); f != nil {
+		return f, nil
+	}
+	return nil, ManagerStoppedError{id}
+}
+
+// Event sends event, with args, to the instance id, restoring it from the
+// store if needed as with Load.
+func (m *Manager) Event(ctx context.Context, id, event string, args ...interface{}) error {
+	f, err := m.Load(ctx, id)
+	if err != nil {
+		return err
+	}
+	return f.EventCtx(ctx, event, args...)
+}
+
+// insert adds f as the instance id, unless there already is one, which is
+// returned instead. It returns nil once the manager is shut down.
+func (m *Manager) insert(id string, f *FSM) *FSM {
+	s := m.shard(id)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if mf, ok := s.instances[id]; ok {
+		f.stopAllTimers()
+		return mf.fsm
+	}
+	if m.stopped.Load() {
+		f.stopAllTimers()
+		return nil
+	}
+	mf := &managedFSM{fsm: f}
+	if m.occupancy != nil {
+		mf.occupant = m.occupancy.add(f.Current())
+		f.occupant = mf.occupant
+	}
+	mf.used.Store(time.Now().UnixNano())
+	s.instances[id] = mf
+	return f
+}
+
+// Create creates the instance id, restoring the state saved in the store of
+// the manager if any. It returns an InstanceExistsError if the manager already
+// has an instance id, a ManagerStoppedError once the manager is shut down, or
+// the error of the store.
+func (m *Manager) Create(ctx context.Context, id string) (*FSM, error) {
+	if _, ok := m.get(id); ok {
+		return nil, InstanceExistsError{id}
+	}
+
+	f := m.newInstance(id)
+	if m.store != nil {
+		var notFound NotFoundError
+		if err := f.Load(ctx); err != nil && !errors.As(err, &notFound) {
+			f.stopAllTimers()
+			return nil, err
+		}
+	}
+
+	switch m.insert(id, f) {
+	case f:
+		return f, nil
+	case nil:
+		return nil, ManagerStoppedError{id}
+	}
+	return nil, InstanceExistsError{id}
+}
+
+// newInstance returns a new instance id in the initial state.
+func (m *Manager) newInstance(id string) *FSM {
+	opts := m.opts
+	if m.store != nil {
+		opts = append(opts[:len(opts):len(opts)], WithStore(m.store, id))
+	}
+	f := m.def.NewInstance(m.initial, opts...)
+	if m.observer != nil {
+		f.AddObserver(ObserverFunc(func(src, dst, event string) {
+			m.observer(id, src, dst, event)
+		}))
+	}
+	return f
+}
+
+// Delete removes the instance id from the manager and stops its timers. It
+// returns false if there is no such instance. The state saved in the store is
+// kept, so Get and Load restore the instance from it.
+func (m *Manager) Delete(id string) bool {
+	s := m.shard(id)
+	s.mu.Lock()
+	mf, ok := s.instances[id]
+	delete(s.instances, id)
+	s.mu.Unlock()
+
+	if ok {
+		mf.remove()
+	}
+	return ok
+}
+
+// Len returns the number of instances of the manager.
+func (m *Manager) Len() int {
+	n := 0
+	for i := range m.shards {
+		s := &m.shards[i]
+		s.mu.RLock()
+		n += len(s.instances)
+		s.mu.RUnlock()
+	}
+	return n
+}
+
+// StateDistribution returns how many instances of the manager are in each
+// state, as StateDistribution does for a slice of FSMs. Only the instances in
+// memory are counted, not those evicted to the store.
+func (m *Manager) StateDistribution() map[string]int {
+	counts := make(map[string]int)
+	for i := range m.shards {
+		s := &m.shards[i]
+		s.mu.RLock()
+		for _, mf := range s.instances {
+			counts[mf.fsm.Current()]++
+		}
+		s.mu.RUnlock()
+	}
+	return counts
+}
+
+// Heatmap outputs the transition graph of the definition of the manager in
+// Graphviz format, with each state colored and sized by the number of
+// instances in it, as given by StateDistribution. See VisualizeHeatmap.
+func (m *Manager) Heatmap() string {
+	return VisualizeHeatmap(m.def.instance(m.initial), m.StateDistribution())
+}
+
+// evictLoop evicts the idle instances until the manager is closed.
+func (m *Manager) evictLoop() {
+	interval := m.ttl / 2
+	if interval <= 0 {
+		interval = m.ttl
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.stop:
+			return
+		case now := <-ticker.C:
+			m.evict(now)
+		}
+	}
+}
+
+// evict evicts the instances not used since ttl before now, and returns how
+// many were evicted. An instance whose state can not be saved is kept.
+func (m *Manager) evict(now time.Time) int {
+	deadline := now.Add(-m.ttl).UnixNano()
+	evicted := 0
+	for i := range m.shards {
+		s := &m.shards[i]
+
+		var idle []string
+		s.mu.RLock()
+		for id, mf := range s.instances {
+			if mf.used.Load() < deadline {
+				idle = append(idle, id)
+			}
+		}
+		s.mu.RUnlock()
+
+		for _, id := range idle {
+			if m.evictInstance(s, id, deadline) {
+				evicted++
+			}
+		}
+	}
+	return evicted
+}
+
+// evictInstance saves and removes the instance id of s, if it is still idle.
+func (m *Manager) evictInstance(s *managerShard, id string, deadline int64) bool {
+	s.mu.RLock()
+	mf, ok := s.instances[id]
+	s.mu.RUnlock()
+	if !ok || mf.fsm.hasTimers() || (m.occupancy != nil && m.occupancy.limited(mf.fsm.Current())) {
+		return false
+	}
+
+	if m.store != nil {
+		err := m.store.Save(mf.fsm.codecContext(context.Background()), id, mf.fsm.Snapshot())
+		var conflict ConflictError
+		if err != nil && !errors.As(err, &conflict) {
+			return false
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.instances[id] != mf || mf.used.Load() >= deadline {
+		return false
+	}
+	delete(s.instances, id)
+	if mf.occupant != nil {
+		mf.occupant.remove()
+	}
+	return true
+}
+
+// ShutdownParallelism is the number of instances stopped at once by
+// Manager.Shutdown.
+const ShutdownParallelism = 16
+
+// shutdownPoll is how often Shutdown checks whether an asynchronous
+// transition is done.
+const shutdownPoll = 10 * time.Millisecond
+
+// Shutdown stops the manager and its instances, for example before the
+// process exits during a rolling deploy. The eviction is stopped as with
+// Close, and no instance is created or loaded afterwards.
+//
+// The instances are stopped up to ShutdownParallelism at a time: Shutdown
+// waits for the event in progress and the asynchronous transition in
+// progress, if any, to be done, stops the timers, saves the state in the
+// store of the manager, if any, and removes the instance. It gives up on an
+// instance when ctx is done, and returns a ShutdownError with the errors of
+// the instances that could not be stopped, which are kept. The events queued
+// by QueueWhilePending run as the asynchronous transition completes.
+//
+// Shutdown must not be called from a callback.
+func (m *Manager) Shutdown(ctx context.Context) error {
+	m.Close()
+	m.stopped.Store(true)
+
+	type instance struct {
+		id string
+		mf *managedFSM
+	}
+	var instances []instance
+	for i := range m.shards {
+		s := &m.shards[i]
+		s.mu.RLock()
+		for id, mf := range s.instances {
+			instances = append(instances, instance{id, mf})
+		}
+		s.mu.RUnlock()
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	errs := make(map[string]error)
+	work := make(chan instance)
+	for i := 0; i < ShutdownParallelism && i < len(instances); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for in := range work {
+				if err := m.stopInstance(ctx, in.id, in.mf); err != nil {
+					mu.Lock()
+					errs[in.id] = err
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for _, in := range instances {
+		work <- in
+	}
+	close(work)
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return ShutdownError{errs}
+	}
+	return nil
+}
+
+// stopInstance stops the instance id, once its transitions are done or ctx is.
+func (m *Manager) stopInstance(ctx context.Context, id string, mf *managedFSM) error {
+	f := mf.fsm
+
+	// pending is the error for the asynchronous transition last seen.
+	var pending error
+	for {
+		if err := lockCtx(ctx, &f.eventMu); err != nil {
+			if pending != nil {
+				return pending
+			}
+			return err
+		}
+		if e := f.transition; e != nil {
+			f.eventMu.Unlock()
+			pending = InTransitionError{e.Event}
+			select {
+			case <-ctx.Done():
+				return pending
+			case <-time.After(shutdownPoll):
+				continue
+			}
+		}
+		f.stopAllTimers()
+		f.eventMu.Unlock()
+		break
+	}
+
+	if m.store != nil {
+		err := m.store.Save(f.codecContext(ctx), id, f.Snapshot())
+		var conflict ConflictError
+		if err != nil && !errors.As(err, &conflict) {
+			return err
+		}
+	}
+
+	s := m.shard(id)
+	s.mu.Lock()
+	if s.instances[id] == mf {
+		delete(s.instances, id)
+		if mf.occupant != nil {
+			mf.occupant.remove()
+		}
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+// remove stops the timers of the instance and stops counting it, once it is
+// removed from the manager.
+func (mf *managedFSM) remove() {
+	mf.fsm.stopAllTimers()
+	if mf.occupant != nil {
+		mf.occupant.remove()
+	}
+}
+
+// lockCtx locks mu, or returns the error of ctx if it is done first, in which
+// case mu is unlocked as soon as it is acquired.
+func lockCtx(ctx context.Context, mu sync.Locker) error {
+	locked := make(chan struct{})
+	go func() {
+		mu.Lock()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+		return nil
+	case <-ctx.Done():
+		go func() {
+			<-locked
+			mu.Unlock()
+		}()
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,357 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newOrderDefinition() *Definition {
+	return NewDefinition(
+		Events{
+			{EvtName: "checkout", SrcStates: []string{"cart"}, DstStates: "checkout"},
+			{EvtName: "pay", SrcStates: []string{"checkout"}, DstStates: "paid"},
+		},
+		Callbacks{},
+	)
+}
+
+func TestManager(t *testing.T) {
+	ctx := context.Background()
+	var observed []string
+	m := NewManager(newOrderDefinition(), "cart",
+		ManagerObserver(func(id, src, dst, event string) {
+			observed = append(observed, id+":"+event)
+		}),
+	)
+
+	a, err := m.Create(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Create(ctx, "a"); err != (InstanceExistsError{"a"}) {
+		t.Error("expected 'InstanceExistsError', got", err)
+	}
+	b, _ := m.Create(ctx, "b")
+
+	if f, ok := m.Get("a"); !ok || f != a {
+		t.Error("expected instance 'a'")
+	}
+	if _, ok := m.Get("c"); ok {
+		t.Error("expected no instance 'c'")
+	}
+	if m.Len() != 2 {
+		t.Error("expected 2 instances")
+	}
+
+	a.Event("checkout")
+	b.Event("checkout")
+	a.Event("pay")
+	if b.Current() != "checkout" || a.Current() != "paid" {
+		t.Error("expected instances to have their own state")
+	}
+	if fmt.Sprint(observed) != "[a:checkout b:checkout a:pay]" {
+		t.Error("expected transitions of all instances to be observed, got", observed)
+	}
+
+	if !m.Delete("a") || m.Delete("a") {
+		t.Error("expected 'a' to be deleted once")
+	}
+	if _, ok := m.Get("a"); ok || m.Len() != 1 {
+		t.Error("expected instance 'a' to be gone")
+	}
+}
+
+func TestManagerStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	def := newOrderDefinition()
+
+	m := NewManager(def, "cart", ManagerStore(store))
+	a, _ := m.Create(ctx, "a")
+	a.Event("checkout")
+	m.Delete("a")
+
+	a, err := m.Create(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Current() != "checkout" || a.Sequence() != 1 {
+		t.Error("expected the state to be restored from the store")
+	}
+
+	failing := NewManager(def, "cart", ManagerStore(failingStore{}))
+	if _, err := failing.Create(ctx, "a"); err == nil || failing.Len() != 0 {
+		t.Error("expected the error of the store")
+	}
+}
+
+type failingStore struct{}
+
+func (failingStore) Load(ctx context.Context, id string) (Snapshot, error) {
+	return Snapshot{}, errors.New("unavailable")
+}
+
+func (failingStore) Save(ctx context.Context, id string, s Snapshot) error {
+	return errors.New("unavailable")
+}
+
+func TestManagerDeleteStopsTimers(t *testing.T) {
+	fired := make(chan struct{}, 1)
+	m := NewManager(newOrderDefinition(), "cart",
+		ManagerObserver(func(id, src, dst, event string) {
+			fired <- struct{}{}
+		}),
+	)
+	a, _ := m.Create(context.Background(), "a")
+	a.Timeout("cart", 10*time.Millisecond, "checkout")
+	m.Delete("a")
+
+	select {
+	case <-fired:
+		t.Error("expected the timer to be stopped")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestManagerShards(t *testing.T) {
+	for _, shards := range []int{0, 1, 7} {
+		m := NewManager(newOrderDefinition(), "cart", ManagerShards(shards))
+		for i := 0; i < 100; i++ {
+			m.Create(context.Background(), fmt.Sprint("order-", i))
+		}
+		if m.Len() != 100 {
+			t.Errorf("expected 100 instances with %d shards, got %d", shards, m.Len())
+		}
+		if _, ok := m.Get("order-42"); !ok {
+			t.Errorf("expected instance 'order-42' with %d shards", shards)
+		}
+	}
+}
+
+func TestManagerEviction(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	m := NewManager(newOrderDefinition(), "cart", ManagerStore(store), ManagerEviction(time.Hour))
+	defer m.Close()
+
+	a, _ := m.Create(ctx, "a")
+	a.SetMetadata("customer", "alice")
+	a.Event("checkout")
+	m.Create(ctx, "b")
+	c, _ := m.Create(ctx, "c")
+	c.Timeout("cart", time.Hour, "checkout")
+
+	if n := m.evict(time.Now()); n != 0 {
+		t.Errorf("expected no instance to be evicted, got %d", n)
+	}
+	m.Get("b")
+	if n := m.evict(time.Now().Add(2 * time.Hour)); n != 2 || m.Len() != 1 {
+		t.Errorf("expected 'a' and 'b' to be evicted, got %d", n)
+	}
+
+	if err := m.Event(ctx, "a", "pay"); err != nil {
+		t.Fatal(err)
+	}
+	a, ok := m.Get("a")
+	if !ok || a.Current() != "paid" || a.Sequence() != 2 {
+		t.Error("expected 'a' to be restored from the store")
+	}
+	if v, _ := a.Metadata("customer"); v != "alice" {
+		t.Error("expected the metadata of 'a' to be restored")
+	}
+	if f, ok := m.Get("b"); !ok || f.Current() != "cart" {
+		t.Error("expected 'b' to be restored in its saved state")
+	}
+	if _, err := m.Load(ctx, "d"); err != (NotFoundError{"d"}) {
+		t.Error("expected 'NotFoundError', got", err)
+	}
+}
+
+func TestManagerEvictionWithoutStore(t *testing.T) {
+	m := NewManager(newOrderDefinition(), "cart", ManagerEviction(10*time.Millisecond))
+	defer m.Close()
+
+	m.Create(context.Background(), "a")
+	deadline := time.Now().Add(time.Second)
+	for m.Len() > 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if m.Len() != 0 {
+		t.Error("expected the idle instance to be deleted")
+	}
+	if _, ok := m.Get("a"); ok {
+		t.Error("expected no instance 'a' without a store")
+	}
+	if err := m.Event(context.Background(), "a", "checkout"); err != (NotFoundError{"a"}) {
+		t.Error("expected 'NotFoundError', got", err)
+	}
+}
+
+func TestManagerStateDistribution(t *testing.T) {
+	ctx := context.Background()
+	m := NewManager(newOrderDefinition(), "cart", ManagerShards(4))
+	for i := 0; i < 5; i++ {
+		if _, err := m.Create(ctx, fmt.Sprint(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, id := range []string{"0", "1", "2"} {
+		if err := m.Event(ctx, id, "checkout"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.Event(ctx, "0", "pay"); err != nil {
+		t.Fatal(err)
+	}
+
+	counts := m.StateDistribution()
+	if len(counts) != 3 || counts["cart"] != 2 || counts["checkout"] != 2 || counts["paid"] != 1 {
+		t.Errorf("unexpected distribution %v", counts)
+	}
+
+	heatmap := m.Heatmap()
+	for _, line := range []string{
+		`"cart" -> "checkout" [ label = "checkout" ];`,
+		`"checkout" [ label = "checkout\n2", style = "filled", fillcolor = "0.000 1.000 1.000", width = 1.75 ];`,
+		`"paid" [ label = "paid\n1", style = "filled", fillcolor = "0.000 0.500 1.000", width = 1.25 ];`,
+	} {
+		if !strings.Contains(heatmap, line) {
+			t.Errorf("expected %s in heatmap:\n%s", line, heatmap)
+		}
+	}
+}
+
+func TestManagerWithDefaults(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	var observed []string
+	base := NewManager(nil, "",
+		ManagerStore(store),
+		ManagerObserver(func(id, src, dst, event string) {
+			observed = append(observed, id+":"+event)
+		}),
+		ManagerOptions(WithHistory(1)),
+	)
+	defer base.Close()
+
+	orders := base.WithDefaults(newOrderDefinition(), "cart", ManagerOptions(WithHistory(4)))
+	doors := base.WithDefaults(NewDefinition(
+		Events{
+			{EvtName: "open", SrcStates: []string{"closed"}, DstStates: "open"},
+		},
+		Callbacks{},
+	), "closed", ManagerStore(nil))
+
+	if err := orders.Event(ctx, "o", "checkout"); err == nil {
+		t.Error("expected no instance 'o'")
+	}
+	o, _ := orders.Create(ctx, "o")
+	d, _ := doors.Create(ctx, "d")
+	if err := orders.Event(ctx, "o", "checkout"); err != nil {
+		t.Fatal(err)
+	}
+	if err := doors.Event(ctx, "d", "open"); err != nil {
+		t.Fatal(err)
+	}
+
+	if fmt.Sprint(observed) != "[o:checkout d:open]" {
+		t.Errorf("expected the observer to be inherited, got %v", observed)
+	}
+	if s, err := store.Load(ctx, "o"); err != nil || s.State != "checkout" {
+		t.Errorf("expected the store to be inherited, got %v %v", s, err)
+	}
+	if _, err := store.Load(ctx, "d"); err == nil {
+		t.Error("expected the store to be overridden")
+	}
+	o.Event("pay")
+	if len(o.History(0)) != 2 || len(d.History(0)) != 1 {
+		t.Errorf("expected the instance options in order, got %d and %d transitions", len(o.History(0)), len(d.History(0)))
+	}
+	if base.Len() != 0 || orders.Len() != 1 || doors.Len() != 1 {
+		t.Error("expected each manager to have its own instances")
+	}
+}
+
+func TestManagerShutdown(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	def := NewDefinition(
+		Events{
+			{EvtName: "checkout", SrcStates: []string{"cart"}, DstStates: "checkout"},
+			{EvtName: "pay", SrcStates: []string{"checkout"}, DstStates: "paid"},
+			{EvtName: "expire", SrcStates: []string{"checkout"}, DstStates: "cart"},
+		},
+		Callbacks{
+			"leave_checkout": func(_ string, e *Event) {
+				e.Async()
+			},
+		},
+	)
+	m := NewManager(def, "cart", ManagerStore(store))
+	idle, _ := m.Create(ctx, "idle")
+	timed, _ := m.Create(ctx, "timed")
+	pending, _ := m.Create(ctx, "pending")
+	timed.Event("checkout")
+	if err := timed.Timeout("checkout", time.Hour, "expire"); err != nil {
+		t.Fatal(err)
+	}
+	pending.Event("checkout")
+	if _, ok := pending.Event("pay").(AsyncError); !ok {
+		t.Fatal("expected an asynchronous transition")
+	}
+
+	short, cancel := context.WithTimeout(ctx, 30*time.Millisecond)
+	defer cancel()
+	err := m.Shutdown(short)
+	var serr ShutdownError
+	if !errors.As(err, &serr) || len(serr.Errors) != 1 || !errors.Is(serr.Errors["pending"], ErrInTransition) {
+		t.Fatalf("expected the pending instance to be reported, got %v", err)
+	}
+	if !errors.Is(err, ErrShutdown) || !errors.Is(err, ErrInTransition) {
+		t.Error("expected the error to match its sentinel and those of the instances")
+	}
+	if m.Len() != 1 {
+		t.Errorf("expected the pending instance to be kept, got %d instances", m.Len())
+	}
+	if timed.hasTimers() {
+		t.Error("expected the timers to be stopped")
+	}
+	if s, err := store.Load(ctx, "idle"); err != nil || s.State != idle.Current() {
+		t.Errorf("expected the idle instance to be saved, got %v %v", s, err)
+	}
+	if _, err := m.Create(ctx, "new"); !errors.Is(err, ErrManagerStopped) {
+		t.Errorf("expected ManagerStoppedError, got %v", err)
+	}
+	if _, err := m.Load(ctx, "idle"); !errors.Is(err, ErrManagerStopped) {
+		t.Errorf("expected ManagerStoppedError, got %v", err)
+	}
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		pending.Transition()
+	}()
+	if err := m.Shutdown(ctx); err != nil {
+		t.Errorf("expected the transition to be waited for, got %v", err)
+	}
+	if m.Len() != 0 || pending.Current() != "paid" {
+		t.Errorf("expected the pending instance to be stopped once paid, got %d instances in %s", m.Len(), pending.Current())
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+// Metadata returns the value stored under key with SetMetadata, and whether
+// there is one.
+//
+// Metadata can be called from callbacks, and concurrently with events.
+func (f *FSM) Metadata(key string) (interface{}, bool) {
+	f.metadataMu.RLock()
+	defer f.metadataMu.RUnlock()
+	v, ok := f.metadata[key]
+	return v, ok
+}
+
+// SetMetadata stores v under key, so that callbacks can share data across
+// transitions. The metadata is part of the Snapshot of the FSM.
+//
+// SetMetadata can be called from callbacks, and concurrently with events.
+func (f *FSM) SetMetadata(key string, v interface{}) {
+	f.metadataMu.Lock()
+	defer f.metadataMu.Unlock()
+	if f.metadata == nil {
+		f.metadata = make(map[string]interface{})
+	}
+	f.metadata[key] = v
+}
+
+// DeleteMetadata removes the value stored under key, if any.
+func (f *FSM) DeleteMetadata(key string) {
+	f.metadataMu.Lock()
+	defer f.metadataMu.Unlock()
+	delete(f.metadata, key)
+}
+
+// copyMetadata returns a copy of the metadata, nil if there is none.
+func (f *FSM) copyMetadata() map[string]interface{} {
+	f.metadataMu.RLock()
+	defer f.metadataMu.RUnlock()
+	return cloneMetadata(f.metadata)
+}
+
+// setMetadata replaces the metadata with a copy of m.
+func (f *FSM) setMetadata(m map[string]interface{}) {
+	m = cloneMetadata(m)
+	f.metadataMu.Lock()
+	f.metadata = m
+	f.metadataMu.Unlock()
+}
+
+func cloneMetadata(m map[string]interface{}) map[string]interface{} {
+	if len(m) == 0 {
+		return nil
+	}
+	c := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
@@ -0,0 +1,57 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestMetadata(t *testing.T) {
+	fsm := newDoorFSM(Callbacks{
+		"enter_open": func(action string, e *Event) {
+			n, _ := e.FSM.Metadata("opened")
+			count, _ := n.(int)
+			e.FSM.SetMetadata("opened", count+1)
+		},
+	})
+
+	if _, ok := fsm.Metadata("opened"); ok {
+		t.Error("expected no metadata")
+	}
+	fsm.Event("open")
+	fsm.Event("close")
+	fsm.Event("open")
+	if v, ok := fsm.Metadata("opened"); !ok || v != 2 {
+		t.Error("expected metadata to be 2, got", v)
+	}
+
+	data, err := json.Marshal(fsm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsm.DeleteMetadata("opened")
+	if _, ok := fsm.Metadata("opened"); ok {
+		t.Error("expected metadata to be deleted")
+	}
+
+	restored := newDoorFSM(Callbacks{})
+	if err := json.Unmarshal(data, restored); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := restored.Metadata("opened"); v != 2.0 {
+		t.Error("expected restored metadata to be 2, got", v)
+	}
+}
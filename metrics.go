@@ -0,0 +1,71 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import "time"
+
+// Metrics records the transitions of a FSM, see WithMetrics. The methods are
+// called while the FSM handles the event, so they should not block.
+//
+// A Metrics can also implement WaitMetrics. Embed NopMetrics to implement
+// only some of the methods.
+type Metrics interface {
+	// TransitionStarted is called when an event that is valid in the current
+	// state starts a transition from src to dst, before guards and callbacks.
+	TransitionStarted(event, src, dst string)
+
+	// TransitionCompleted is called when the FSM has entered dst, with the
+	// time since the transition started, including the wait for Transition
+	// in an asynchronous transition.
+	TransitionCompleted(event, src, dst string, d time.Duration)
+
+	// TransitionRejected is called when an event does not change the state,
+	// with the error returned for it. Dst is empty if the event is not valid
+	// in src. An asynchronous transition is only rejected if it is canceled
+	// or fails when completed.
+	TransitionRejected(event, src, dst string, err error)
+}
+
+// WaitMetrics records how long events wait for a FSM before it handles them,
+// apart from the time spent in callbacks, so that contention on a busy FSM
+// can be told from slow callbacks. It is used if the Metrics given to
+// WithMetrics implements it.
+type WaitMetrics interface {
+	// LockWaited is called with the time an event sent with Event or
+	// EventCtx waited for the FSM to finish handling other events.
+	LockWaited(event string, d time.Duration)
+
+	// QueueWaited is called with the time a queued event, see
+	// QueueWhilePending, waited for the transition in progress to complete.
+	QueueWaited(event string, d time.Duration)
+}
+
+// NopMetrics is a Metrics and a WaitMetrics doing nothing.
+type NopMetrics struct{}
+
+// TransitionStarted does nothing.
+func (NopMetrics) TransitionStarted(event, src, dst string) {}
+
+// TransitionCompleted does nothing.
+func (NopMetrics) TransitionCompleted(event, src, dst string, d time.Duration) {}
+
+// TransitionRejected does nothing.
+func (NopMetrics) TransitionRejected(event, src, dst string, err error) {}
+
+// LockWaited does nothing.
+func (NopMetrics) LockWaited(event string, d time.Duration) {}
+
+// QueueWaited does nothing.
+func (NopMetrics) QueueWaited(event string, d time.Duration) {}
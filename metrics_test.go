@@ -0,0 +1,192 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingMetrics records the calls to its methods.
+type recordingMetrics struct {
+	calls []string
+}
+
+func (m *recordingMetrics) TransitionStarted(event, src, dst string) {
+	m.calls = append(m.calls, fmt.Sprintf("started %s %s %s", event, src, dst))
+}
+
+func (m *recordingMetrics) TransitionCompleted(event, src, dst string, d time.Duration) {
+	m.calls = append(m.calls, fmt.Sprintf("completed %s %s %s", event, src, dst))
+}
+
+func (m *recordingMetrics) TransitionRejected(event, src, dst string, err error) {
+	m.calls = append(m.calls, fmt.Sprintf("rejected %s %s %s: %T", event, src, dst, err))
+}
+
+func (m *recordingMetrics) LockWaited(event string, d time.Duration) {
+	m.calls = append(m.calls, "lock "+event)
+}
+
+func (m *recordingMetrics) QueueWaited(event string, d time.Duration) {
+	m.calls = append(m.calls, "queue "+event)
+}
+
+func TestMetrics(t *testing.T) {
+	m := &recordingMetrics{}
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{EvtName: "open", SrcStates: []string{"closed"}, DstStates: "open"},
+			{EvtName: "close", SrcStates: []string{"open"}, DstStates: "closed"},
+			{EvtName: "knock", SrcStates: []string{"open"}, DstStates: "open", WhilePending: QueueWhilePending},
+		},
+		Callbacks{
+			"leave_open": func(_ string, e *Event) {
+				e.Async()
+			},
+		},
+		WithMetrics(m),
+	)
+
+	fsm.Event("open")
+	fsm.Event("open")
+	fsm.Event("close")
+	fsm.Event("knock")
+	fsm.CancelTransition()
+
+	expected := []string{
+		"lock open",
+		"started open closed open",
+		"completed open closed open",
+		"lock open",
+		"rejected open open : fsm.InvalidEventError",
+		"lock close",
+		"started close open closed",
+		"lock knock",
+		"rejected close open closed: fsm.CanceledError",
+		"queue knock",
+		"started knock open open",
+		"completed knock open open",
+	}
+	if !reflect.DeepEqual(m.calls, expected) {
+		t.Errorf("expected %q, got %q", expected, m.calls)
+	}
+}
+
+func TestNopMetrics(t *testing.T) {
+	var _ Metrics = NopMetrics{}
+	fsm := NewFSM(
+		"closed",
+		Events{{EvtName: "open", SrcStates: []string{"closed"}, DstStates: "open"}},
+		Callbacks{},
+		WithMetrics(NopMetrics{}),
+	)
+	if err := fsm.Event("open"); err != nil {
+		t.Error(err)
+	}
+}
+
+// waitingMetrics records the wait times, and only them.
+type waitingMetrics struct {
+	NopMetrics
+	mu    sync.Mutex
+	waits map[string]time.Duration
+}
+
+func (m *waitingMetrics) LockWaited(event string, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.waits["lock "+event] = d
+}
+
+func (m *waitingMetrics) QueueWaited(event string, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.waits["queue "+event] = d
+}
+
+func TestWaitMetrics(t *testing.T) {
+	m := &waitingMetrics{waits: make(map[string]time.Duration)}
+	started := make(chan struct{})
+	fsm := NewFSM(
+		"idle",
+		Events{
+			{EvtName: "work", SrcStates: []string{"idle"}, DstStates: "busy"},
+			{EvtName: "ping", SrcStates: []string{"busy"}, DstStates: "busy"},
+			{EvtName: "finish", SrcStates: []string{"busy"}, DstStates: "done"},
+			{EvtName: "knock", SrcStates: []string{"busy"}, DstStates: "busy", WhilePending: QueueWhilePending},
+		},
+		Callbacks{
+			"enter_busy": func(_ string, e *Event) {
+				if e.Event == "work" {
+					close(started)
+					time.Sleep(20 * time.Millisecond)
+				}
+			},
+			"leave_busy": func(_ string, e *Event) {
+				if e.Event == "finish" {
+					e.Async()
+				}
+			},
+		},
+		WithMetrics(m),
+	)
+
+	go fsm.Event("work")
+	<-started
+	if err := fsm.Event("ping"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fsm.Event("finish").(AsyncError); !ok {
+		t.Fatal("expected AsyncError")
+	}
+	if _, ok := fsm.Event("knock").(QueuedError); !ok {
+		t.Fatal("expected QueuedError")
+	}
+	time.Sleep(10 * time.Millisecond)
+	fsm.CancelTransition()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if d := m.waits["lock ping"]; d < 10*time.Millisecond {
+		t.Errorf("expected ping to wait for work to be handled, got %v", d)
+	}
+	if d := m.waits["queue knock"]; d < 10*time.Millisecond {
+		t.Errorf("expected knock to wait in the queue, got %v", d)
+	}
+	if d, ok := m.waits["lock finish"]; !ok || d >= 10*time.Millisecond {
+		t.Errorf("expected finish not to wait, got %v", d)
+	}
+}
+
+func TestMetricsWithoutWaits(t *testing.T) {
+	m := &struct{ Metrics }{NopMetrics{}}
+	fsm := NewFSM(
+		"closed",
+		Events{{EvtName: "open", SrcStates: []string{"closed"}, DstStates: "open"}},
+		Callbacks{},
+		WithMetrics(m),
+	)
+	if fsm.waits != nil {
+		t.Error("expected a Metrics that is not a WaitMetrics not to record the wait times")
+	}
+	if err := fsm.Event("open"); err != nil {
+		t.Error(err)
+	}
+}
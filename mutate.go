@@ -0,0 +1,70 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+// AddTransition adds the transitions of desc to the FSM while it is running,
+// for machines whose allowed transitions are configured at runtime. A
+// transition already defined for the event from one of the source states of
+// desc is replaced, as for the later of two such event descriptions given to
+// NewFSM. The states of desc that are not states of the FSM are added.
+//
+// Callbacks given to NewFSM for states or events that did not exist then are
+// not added; use OnEnter and the like to add them.
+//
+// AddTransition waits for the event in progress, if any, and must not be
+// called from a callback. An instance of a Definition or a clone copies the
+// transitions it shares before changing them.
+func (f *FSM) AddTransition(desc EventDesc) {
+	f.eventMu.Lock()
+	defer f.eventMu.Unlock()
+	f.stateMu.Lock()
+	defer f.stateMu.Unlock()
+
+	f.own()
+	for _, src := range desc.SrcStates {
+		dst := desc.DstStates
+		if desc.Internal {
+			dst = src
+		}
+		f.table.add(desc.EvtName, src, dst, &desc)
+		f.allStates[src] = true
+		for _, dst := range desc.destinations() {
+			f.allStates[dst] = true
+		}
+	}
+	if _, ok := f.eventDescs[desc.EvtName]; !ok && desc.Description != "" {
+		f.eventDescs[desc.EvtName] = desc.Description
+	}
+}
+
+// RemoveTransition removes the transition for event from src, and returns
+// true if there was one. The states of the FSM are kept, even if no
+// transition leads to them anymore.
+//
+// As for AddTransition, it must not be called from a callback. An
+// asynchronous transition in progress for the removed transition can still
+// be completed with Transition.
+func (f *FSM) RemoveTransition(event, src string) bool {
+	f.eventMu.Lock()
+	defer f.eventMu.Unlock()
+	f.stateMu.Lock()
+	defer f.stateMu.Unlock()
+
+	if _, _, ok := f.table.find(event, src); !ok {
+		return false
+	}
+	f.own()
+	return f.table.remove(event, src)
+}
@@ -0,0 +1,107 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAddTransition(t *testing.T) {
+	fsm := NewFSM(
+		"draft",
+		Events{
+			{EvtName: "submit", SrcStates: []string{"draft"}, DstStates: "review"},
+		},
+		Callbacks{},
+	)
+
+	if _, ok := fsm.Event("approve").(UnknownEventError); !ok {
+		t.Error("expected 'UnknownEventError' before the transition is added")
+	}
+
+	fsm.AddTransition(EventDesc{EvtName: "approve", SrcStates: []string{"review"}, DstStates: "published"})
+	fsm.AddTransition(EventDesc{EvtName: "submit", SrcStates: []string{"draft"}, DstStates: "triage"})
+
+	expected := []string{"draft", "published", "review", "triage"}
+	if got := fsm.States(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected states %v, got %v", expected, got)
+	}
+	if err := fsm.Event("submit"); err != nil || fsm.Current() != "triage" {
+		t.Error("expected the transition for 'submit' to be replaced")
+	}
+	fsm.SetState("review")
+	if err := fsm.Event("approve"); err != nil || fsm.Current() != "published" {
+		t.Error("expected the added transition to 'published'")
+	}
+}
+
+func TestRemoveTransition(t *testing.T) {
+	fsm := NewFSM(
+		"draft",
+		Events{
+			{EvtName: "submit", SrcStates: []string{"draft"}, DstStates: "review"},
+			{EvtName: "approve", SrcStates: []string{"review"}, DstStates: "published"},
+			{EvtName: "reject", SrcStates: []string{"review"}, DstStates: "draft"},
+		},
+		Callbacks{},
+	)
+
+	if !fsm.RemoveTransition("reject", "review") {
+		t.Error("expected the transition to be removed")
+	}
+	if fsm.RemoveTransition("reject", "review") || fsm.RemoveTransition("unknown", "draft") {
+		t.Error("expected no transition to remove")
+	}
+
+	fsm.SetState("review")
+	if fsm.Can("reject") {
+		t.Error("expected 'reject' to be impossible")
+	}
+	if _, ok := fsm.Event("reject").(UnknownEventError); !ok {
+		t.Error("expected 'UnknownEventError' once the event has no transitions")
+	}
+	if _, ok := fsm.Event("submit").(InvalidEventError); !ok {
+		t.Error("expected 'InvalidEventError'")
+	}
+	expected := []string{"approve", "submit"}
+	if got := fsm.EventNames(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected events %v, got %v", expected, got)
+	}
+}
+
+func TestMutateInstance(t *testing.T) {
+	def := NewDefinition(
+		Events{
+			{EvtName: "submit", SrcStates: []string{"draft"}, DstStates: "review"},
+		},
+		Callbacks{},
+	)
+	a := def.NewInstance("draft")
+	b := def.NewInstance("draft")
+
+	a.RemoveTransition("submit", "draft")
+	a.AddTransition(EventDesc{EvtName: "discard", SrcStates: []string{"draft"}, DstStates: "discarded"})
+
+	if a.Can("submit") || !a.Can("discard") {
+		t.Error("expected the instance to have its own transitions")
+	}
+	if !b.Can("submit") || b.Can("discard") {
+		t.Error("expected the other instances to keep the definition")
+	}
+	if c := def.NewInstance("draft"); !c.Can("submit") || c.Can("discard") {
+		t.Error("expected the definition to be unchanged")
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import "time"
+
+// Observer is notified of the transitions of a FSM, see FSM.AddObserver.
+type Observer interface {
+	// OnTransition is called after each committed transition, once the
+	// enter_ and after_ callbacks have been called, or once the batch of the
+	// transition succeeds, see EventsCtx. It is called while the FSM handles
+	// the event, so it must not send events to the FSM.
+	OnTransition(src, dst, event string)
+}
+
+// ObserverFunc is an Observer calling itself.
+type ObserverFunc func(src, dst, event string)
+
+// OnTransition calls fn(src, dst, event).
+func (fn ObserverFunc) OnTransition(src, dst, event string) {
+	fn(src, dst, event)
+}
+
+// AddObserver adds o to the observers of the FSM, which are notified of the
+// transitions in the order they were added.
+//
+// Unlike callbacks, any number of observers can watch a FSM. AddObserver is
+// safe to call from a callback, and an observer added from an enter_ or after_
+// callback is notified of the transition in progress too.
+func (f *FSM) AddObserver(o Observer) {
+	f.observerMu.Lock()
+	defer f.observerMu.Unlock()
+	observers := make([]Observer, len(f.observers), len(f.observers)+1)
+	copy(observers, f.observers)
+	f.observers = append(observers, o)
+}
+
+// notifyObservers notifies the observers and the subscribers of the
+// transition from src to dst with event and args, committed with sequence
+// number seq.
+func (f *FSM) notifyObservers(src, dst, event string, args []interface{}, seq uint64) {
+	f.observerMu.Lock()
+	observers, subscriptions := f.observers, f.subscriptions
+	f.observerMu.Unlock()
+
+	for _, o := range observers {
+		o.OnTransition(src, dst, event)
+	}
+	if len(subscriptions) > 0 {
+		f.notifySubscriptions(subscriptions, Transition{
+			Sequence: seq,
+			Event:    event,
+			Src:      src,
+			Dst:      dst,
+			Args:     args,
+			Time:     time.Now(),
+		})
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestObserver(t *testing.T) {
+	var calls []string
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{EvtName: "open", SrcStates: []string{"closed"}, DstStates: "open"},
+			{EvtName: "close", SrcStates: []string{"open"}, DstStates: "closed"},
+		},
+		Callbacks{
+			"after_open": func(_ string, e *Event) {
+				calls = append(calls, "after_open")
+				e.FSM.AddObserver(ObserverFunc(func(src, dst, event string) {
+					calls = append(calls, "late "+event)
+				}))
+			},
+		},
+	)
+	for _, name := range []string{"first", "second"} {
+		name := name
+		fsm.AddObserver(ObserverFunc(func(src, dst, event string) {
+			calls = append(calls, name+" "+src+" "+dst+" "+event)
+		}))
+	}
+
+	fsm.Event("open")
+	fsm.Event("open")
+	fsm.Event("close")
+
+	expected := []string{
+		"after_open",
+		"first closed open open",
+		"second closed open open",
+		"late open",
+		"first open closed close",
+		"second open closed close",
+		"late close",
+	}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("expected %q, got %q", expected, calls)
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"sync"
+)
+
+// LimitPolicy controls what a transition to a state at its limit does, see
+// ManagerStateLimit.
+type LimitPolicy int
+
+const (
+	// RejectWhenFull rejects the transition with a StateLimitError.
+	RejectWhenFull LimitPolicy = iota
+
+	// WaitWhenFull waits for an instance to leave the state, or for the
+	// context of the event to be done, in which case the transition is
+	// rejected with a StateLimitError.
+	WaitWhenFull
+)
+
+// ManagerStateLimit allows at most n instances of the manager in state at
+// once, for work in progress limits such as "at most 50 orders in
+// processing". A transition to state beyond the limit is rejected or waits,
+// as given by policy.
+//
+// The limit is checked once the callbacks before the state change have run,
+// as for the store of WithStore. States set with SetState, Restore or Replay,
+// and instances created or loaded in state, count even beyond the limit.
+// Instances in a limited state are not evicted, see ManagerEviction.
+func ManagerStateLimit(state string, n int, policy LimitPolicy) ManagerOption {
+	return func(m *Manager) {
+		if m.occupancy == nil {
+			m.occupancy = &occupancy{counts: make(map[string]int), changed: make(chan struct{})}
+		}
+		if m.occupancy.limits == nil {
+			m.occupancy.limits = make(map[string]stateLimit)
+		}
+		m.occupancy.limits[state] = stateLimit{n, policy}
+	}
+}
+
+// stateLimit is a limit of ManagerStateLimit.
+type stateLimit struct {
+	n      int
+	policy LimitPolicy
+}
+
+// occupancy counts the instances of a Manager in each limited state.
+type occupancy struct {
+	limits map[string]stateLimit
+
+	// mu guards counts, changed and the occupants. changed is closed and
+	// replaced when an instance leaves a state.
+	mu      sync.Mutex
+	counts  map[string]int
+	changed chan struct{}
+}
+
+// occupant is an instance counted by an occupancy.
+type occupant struct {
+	o *occupancy
+
+	// state is the state the instance is counted in, and removed is set once
+	// it is no longer counted.
+	state   string
+	removed bool
+}
+
+// limited returns true if state has a limit.
+func (o *occupancy) limited(state string) bool {
+	_, ok := o.limits[state]
+	return ok
+}
+
+// add counts an instance in state, and returns it.
+func (o *occupancy) add(state string) *occupant {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.counts[state]++
+	return &occupant{o: o, state: state}
+}
+
+// leave uncounts an instance from state. o.mu must be locked.
+func (o *occupancy) leave(state string) {
+	o.counts[state]--
+	close(o.changed)
+	o.changed = make(chan struct{})
+}
+
+// enter reserves room in dst for the transition of the instance, waiting as
+// allowed by the policy of dst and ctx. The function returned must be called
+// with whether the transition was committed.
+func (p *occupant) enter(ctx context.Context, dst string) (func(committed bool), error) {
+	o := p.o
+	limit, ok := o.limits[dst]
+	for {
+		o.mu.Lock()
+		if !ok || o.counts[dst] < limit.n {
+			o.counts[dst]++
+			o.mu.Unlock()
+			break
+		}
+		changed := o.changed
+		o.mu.Unlock()
+
+		if limit.policy != WaitWhenFull {
+			return nil, StateLimitError{dst, limit.n}
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil, StateLimitError{dst, limit.n}
+		}
+	}
+
+	return func(committed bool) {
+		o.mu.Lock()
+		defer o.mu.Unlock()
+		if !committed || p.removed {
+			o.leave(dst)
+			return
+		}
+		o.leave(p.state)
+		p.state = dst
+	}, nil
+}
+
+// move counts the instance in dst instead of its state, without checking the
+// limits.
+func (p *occupant) move(dst string) {
+	o := p.o
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if p.removed || p.state == dst {
+		return
+	}
+	o.leave(p.state)
+	o.counts[dst]++
+	p.state = dst
+}
+
+// remove stops counting the instance.
+func (p *occupant) remove() {
+	o := p.o
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if !p.removed {
+		p.removed = true
+		o.leave(p.state)
+	}
+}
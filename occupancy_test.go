@@ -0,0 +1,122 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestManagerStateLimit(t *testing.T) {
+	ctx := context.Background()
+	m := NewManager(newOrderDefinition(), "cart", ManagerStateLimit("checkout", 2, RejectWhenFull))
+	a, _ := m.Create(ctx, "a")
+	b, _ := m.Create(ctx, "b")
+	c, _ := m.Create(ctx, "c")
+
+	if err := m.Event(ctx, "a", "checkout"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Event(ctx, "b", "checkout"); err != nil {
+		t.Fatal(err)
+	}
+	err := c.Event("checkout")
+	if _, ok := err.(StateLimitError); !ok || !errors.Is(err, ErrStateLimit) {
+		t.Fatalf("expected StateLimitError, got %v", err)
+	}
+	if c.Current() != "cart" || c.Sequence() != 0 {
+		t.Error("expected the transition not to happen")
+	}
+
+	if err := a.Event("pay"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Event("checkout"); err != nil {
+		t.Errorf("expected room once an instance left, got %v", err)
+	}
+
+	m.Delete("b")
+	b.SetState("cart")
+	a.SetState("checkout")
+	if _, err := m.Create(ctx, "d"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Event(ctx, "d", "checkout"); !errors.Is(err, ErrStateLimit) {
+		t.Errorf("expected the instance set in the state to count, got %v", err)
+	}
+	c.SetState("cart")
+	if err := m.Event(ctx, "d", "checkout"); err != nil {
+		t.Errorf("expected room once an instance was set out of the state, got %v", err)
+	}
+}
+
+func TestManagerStateLimitWait(t *testing.T) {
+	ctx := context.Background()
+	m := NewManager(newOrderDefinition(), "cart", ManagerStateLimit("checkout", 1, WaitWhenFull))
+	a, _ := m.Create(ctx, "a")
+	b, _ := m.Create(ctx, "b")
+	if err := a.Event("checkout"); err != nil {
+		t.Fatal(err)
+	}
+
+	short, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if err := b.EventCtx(short, "checkout"); !errors.Is(err, ErrStateLimit) {
+		t.Errorf("expected StateLimitError once the context is done, got %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- b.EventCtx(ctx, "checkout")
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("expected the event to wait, got %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	if err := a.Event("pay"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("expected the event to complete, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the event to complete once there is room")
+	}
+	if b.Current() != "checkout" {
+		t.Errorf("expected state to be 'checkout', got %q", b.Current())
+	}
+}
+
+func TestManagerStateLimitStoreFailure(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	m := NewManager(newOrderDefinition(), "cart", ManagerStore(store), ManagerStateLimit("checkout", 1, RejectWhenFull))
+	a, _ := m.Create(ctx, "a")
+	b, _ := m.Create(ctx, "b")
+
+	// A stale write by another process makes the store refuse the transition.
+	store.Save(ctx, "a", Snapshot{State: "checkout", Sequence: 1})
+	if err := a.Event("checkout"); !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected ConflictError, got %v", err)
+	}
+	if err := b.Event("checkout"); err != nil {
+		t.Errorf("expected the room reserved by the refused transition to be freed, got %v", err)
+	}
+}
@@ -0,0 +1,210 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import "log/slog"
+
+// Option configures a FSM, given to NewFSM.
+type Option func(*FSM)
+
+// WithPanicRecovery recovers panics in callbacks. The event is stopped and
+// FSM.Event, or FSM.Transition for an asynchronous transition, returns a
+// CallbackPanicError. The remaining callbacks of the event are not called.
+//
+// A panic before the state has changed, in before_ or leave_ callbacks or the
+// short form state callbacks called with ActionOnEvent, leaves the FSM in the
+// old state with no transition in progress, as if the event was canceled. A
+// panic in enter_ or after_ callbacks leaves the FSM in the new state.
+func WithPanicRecovery() Option {
+	return func(f *FSM) {
+		f.recoverPanics = true
+	}
+}
+
+// WithErrorTrace makes FSM.Event return the errors set by callbacks on
+// Event.Err in a CallbackError, with the trace of the callbacks called during
+// the transition. Use errors.As to get the CallbackError, and errors.Is or
+// errors.As to look at the callback error.
+//
+// Without it, the error set by a callback is returned unchanged, so that it
+// can be compared directly, unless it is set with Event.Fail.
+func WithErrorTrace() Option {
+	return func(f *FSM) {
+		f.errorTrace = true
+	}
+}
+
+// WithRestoreCallbacks makes Restore, Load and Replay call the enter callbacks
+// of the state they restore, enter_<STATE>, <STATE> and enter_state, so that
+// in-memory initialization done on entering a state is redone for a FSM
+// restored in it. The callbacks are called with ActionRestoringState and an
+// Event with no name, from the state before the restore, and without calling
+// Event on the FSM, as for other callbacks.
+//
+// Callbacks with external side effects, such as sending an email, should be
+// wrapped with NonReplayable so that they are skipped then, and the StateDesc
+// of such entry actions should be NonReplayable.
+func WithRestoreCallbacks() Option {
+	return func(f *FSM) {
+		f.restoreCallbacks = true
+	}
+}
+
+// NonReplayable returns a callback that calls cb, except for a FSM being
+// restored, see WithRestoreCallbacks:
+//
+//	fsm.Callbacks{
+//		"enter_paid": fsm.NonReplayable(sendReceipt),
+//	}
+func NonReplayable(cb Callback) Callback {
+	return func(action string, e *Event) {
+		if action != ActionRestoringState {
+			cb(action, e)
+		}
+	}
+}
+
+// WithStore saves the state of the FSM in store as instance id before every
+// transition is committed, see Store. If the store refuses the state, for
+// example with a ConflictError because another process drove the instance
+// first, the transition is not committed and a StoreError is returned. Use
+// FSM.Load to restore the saved state.
+func WithStore(store Store, id string) Option {
+	return func(f *FSM) {
+		f.store = store
+		f.storeID = id
+	}
+}
+
+// WithLog appends every transition to log before it is committed, see Log. If
+// the log refuses it, the transition is not committed and a LogError is
+// returned, so that the log never misses a committed transition. Use Replay to
+// restore the state from the log.
+func WithLog(log Log) Option {
+	return func(f *FSM) {
+		f.log = log
+	}
+}
+
+// WithCodec encodes the arguments and metadata of the FSM with c wherever
+// they are persisted, instead of JSONCodec: by MarshalBinary and the history,
+// in the audit records, and in the store and the log, to which c is passed in
+// the context, see CodecFromContext. MarshalJSON always encodes to JSON.
+func WithCodec(c Codec) Option {
+	return func(f *FSM) {
+		f.codec = c
+	}
+}
+
+// WithHistory records the last size committed transitions in memory, returned
+// by FSM.History.
+func WithHistory(size int) Option {
+	return func(f *FSM) {
+		if size > 0 {
+			f.history = &history{transitions: make([]Transition, size)}
+		}
+	}
+}
+
+// WithAudit sends a record of every attempted transition of the FSM to sink,
+// with id as the instance ID, see AuditSink.
+func WithAudit(sink AuditSink, id string) Option {
+	return func(f *FSM) {
+		f.audit = sink
+		f.auditID = id
+	}
+}
+
+// WithMetrics records the transitions of the FSM in metrics, see Metrics, and
+// the time events wait if metrics is a WaitMetrics.
+func WithMetrics(metrics Metrics) Option {
+	return func(f *FSM) {
+		f.metrics = metrics
+		f.waits, _ = metrics.(WaitMetrics)
+	}
+}
+
+// WithLogger logs the transitions of the FSM to l: each callback called and
+// each transition committed at debug level, and each rejected event at warning
+// level.
+func WithLogger(l *slog.Logger) Option {
+	return func(f *FSM) {
+		f.logger = l
+	}
+}
+
+// WithStates declares the entry and exit actions of states, as an alternative
+// to the enter_<STATE> and leave_<STATE> keys of the callbacks given to
+// NewFSM. They are called after the callbacks with those keys. States not used
+// by any event are added to the FSM, and are reported by FSM.Unreachable.
+func WithStates(states States) Option {
+	return func(f *FSM) {
+		f.own()
+		if f.stateDescs == nil {
+			f.stateDescs = make(map[string]*StateDesc)
+		}
+		for i := range states {
+			s := states[i]
+			f.allStates[s.Name] = true
+			f.stateDescs[s.Name] = &s
+			if s.OnEnter != nil {
+				enter := stateAction(s.OnEnter)
+				if s.NonReplayable {
+					enter = NonReplayable(enter)
+				}
+				f.addCallback(cKey{s.Name, callbackEnterState}, enter)
+			}
+			if s.OnExit != nil {
+				f.addCallback(cKey{s.Name, callbackLeaveState}, stateAction(s.OnExit))
+			}
+		}
+	}
+}
+
+// stateAction adapts an action of a StateDesc to a Callback.
+func stateAction(action func(e *Event)) Callback {
+	return func(_ string, e *Event) {
+		action(e)
+	}
+}
+
+// WithFinalStates declares states as final states of the FSM, which are not
+// reported by FSM.DeadEnds.
+func WithFinalStates(states ...string) Option {
+	return func(f *FSM) {
+		if f.finals == nil {
+			f.finals = make(map[string]bool)
+		}
+		for _, state := range states {
+			f.finals[state] = true
+		}
+	}
+}
+
+// WithoutLocking turns off the locking of the FSM, for machines that are only
+// used from one goroutine, such as within an Actor or a simulation loop.
+//
+// The FSM is then not safe for concurrent use: its methods must not be called
+// concurrently, and asynchronous transitions must be completed from the same
+// goroutine. Timeout, Recurring, EventAfter and middleware such as Debounce
+// fire events from other goroutines, and must not be used. Observers and
+// subscriptions can still be added from other goroutines, see Subscribe.
+func WithoutLocking() Option {
+	return func(f *FSM) {
+		f.eventMu.off = true
+		f.stateMu.off = true
+		f.metadataMu.off = true
+	}
+}
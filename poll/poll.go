@@ -0,0 +1,165 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package poll bridges external systems that can not push events to a FSM,
+// by polling them on an interval.
+package poll
+
+import (
+	"context"
+	"time"
+
+	"github.com/papiguy/fsm"
+)
+
+// DefaultKeys is the number of deduplication keys a Poller remembers.
+const DefaultKeys = 1024
+
+// ExternalEvent is an event read from an external system.
+type ExternalEvent struct {
+	// Key identifies the event in the external system. Events with a key
+	// seen recently are dropped, so that a source can return the same event
+	// more than once. Events without a key are never dropped.
+	Key string
+
+	// Event is the name of the FSM event to fire.
+	Event string
+
+	// Args are passed to the FSM event.
+	Args []interface{}
+}
+
+// Source is an external system that is polled for events.
+type Source interface {
+	// Poll returns the events that happened since the last call.
+	Poll(ctx context.Context) ([]ExternalEvent, error)
+}
+
+// SourceFunc is an adapter to use an ordinary function as a Source.
+type SourceFunc func(ctx context.Context) ([]ExternalEvent, error)
+
+// Poll calls fn(ctx).
+func (fn SourceFunc) Poll(ctx context.Context) ([]ExternalEvent, error) {
+	return fn(ctx)
+}
+
+// Poller fires the events of a Source on a FSM.
+//
+// The events of a poll are fired in order. When the FSM rejects one because an
+// asynchronous transition is in progress, it and the following events are kept
+// and retried on the next interval, and the source is not polled again until
+// they have all been fired. This keeps a slow machine from being flooded.
+type Poller struct {
+	// OnError is called with the errors of Poll and, along with the event,
+	// the errors of events other than fsm.InTransitionError. The event is
+	// not retried. It may be nil.
+	OnError func(e *ExternalEvent, err error)
+
+	fsm      *fsm.FSM
+	source   Source
+	interval time.Duration
+
+	backlog []ExternalEvent
+
+	// seen holds the recent keys and order the same keys, oldest first.
+	seen  map[string]bool
+	order []string
+	keys  int
+}
+
+// NewPoller returns a Poller firing the events of source on f, polled every
+// interval.
+func NewPoller(f *fsm.FSM, source Source, interval time.Duration) *Poller {
+	return &Poller{
+		fsm:      f,
+		source:   source,
+		interval: interval,
+		seen:     make(map[string]bool),
+		keys:     DefaultKeys,
+	}
+}
+
+// Run polls until ctx is done, and returns ctx.Err().
+func (p *Poller) Run(ctx context.Context) error {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		p.Step(ctx)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Step performs a single interval: it polls the source unless events are left
+// from the previous step, and fires the events. It returns the number of
+// events left for the next step.
+//
+// The events are fired with the values of ctx but not its cancellation, as
+// they have already been taken from the source and would otherwise be lost
+// when ctx is done, see fsm.AbortedError.
+func (p *Poller) Step(ctx context.Context) int {
+	if len(p.backlog) == 0 {
+		events, err := p.source.Poll(ctx)
+		if err != nil {
+			p.error(nil, err)
+		}
+		for _, e := range events {
+			if e.Key != "" {
+				if p.seen[e.Key] {
+					continue
+				}
+				p.remember(e.Key)
+			}
+			p.backlog = append(p.backlog, e)
+		}
+	}
+
+	fireCtx := context.WithoutCancel(ctx)
+	for len(p.backlog) > 0 {
+		e := p.backlog[0]
+		err := p.fsm.EventCtx(fireCtx, e.Event, e.Args...)
+		if _, ok := err.(fsm.InTransitionError); ok {
+			break
+		}
+		p.backlog = p.backlog[1:]
+		switch err.(type) {
+		case nil, fsm.AsyncError, fsm.QueuedError:
+		default:
+			p.error(&e, err)
+		}
+	}
+	if len(p.backlog) == 0 {
+		p.backlog = nil
+	}
+	return len(p.backlog)
+}
+
+// remember adds key to the recent keys, forgetting the oldest if needed.
+func (p *Poller) remember(key string) {
+	if len(p.order) >= p.keys {
+		delete(p.seen, p.order[0])
+		p.order = p.order[1:]
+	}
+	p.seen[key] = true
+	p.order = append(p.order, key)
+}
+
+func (p *Poller) error(e *ExternalEvent, err error) {
+	if p.OnError != nil {
+		p.OnError(e, err)
+	}
+}
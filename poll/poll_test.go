@@ -0,0 +1,126 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package poll
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/papiguy/fsm"
+)
+
+func newDoor(async *bool) *fsm.FSM {
+	return fsm.NewFSM(
+		"closed",
+		fsm.Events{
+			{EvtName: "open", SrcStates: []string{"closed"}, DstStates: "open"},
+			{EvtName: "close", SrcStates: []string{"open"}, DstStates: "closed"},
+		},
+		fsm.Callbacks{
+			"leave_state": func(action string, e *fsm.Event) {
+				if *async {
+					e.Async()
+				}
+			},
+		},
+	)
+}
+
+func TestPollerDedup(t *testing.T) {
+	async := false
+	f := newDoor(&async)
+	polls := 0
+	p := NewPoller(f, SourceFunc(func(ctx context.Context) ([]ExternalEvent, error) {
+		polls++
+		return []ExternalEvent{{Key: "1", Event: "open"}, {Key: "1", Event: "open"}, {Key: "2", Event: "close"}}, nil
+	}), time.Second)
+
+	var errs []error
+	p.OnError = func(e *ExternalEvent, err error) {
+		errs = append(errs, err)
+	}
+
+	p.Step(context.Background())
+	if f.Current() != "closed" || len(errs) != 0 {
+		t.Errorf("expected open and close once each, got %s %v", f.Current(), errs)
+	}
+	p.Step(context.Background())
+	if f.Current() != "closed" || polls != 2 {
+		t.Errorf("expected the events of the second poll to be dropped, got %s", f.Current())
+	}
+}
+
+func TestPollerBackpressure(t *testing.T) {
+	async := true
+	f := newDoor(&async)
+	polls := 0
+	p := NewPoller(f, SourceFunc(func(ctx context.Context) ([]ExternalEvent, error) {
+		polls++
+		return []ExternalEvent{{Event: "open"}, {Event: "close"}}, nil
+	}), time.Second)
+
+	if left := p.Step(context.Background()); left != 1 {
+		t.Errorf("expected close to be kept while open is pending, got %d", left)
+	}
+	p.Step(context.Background())
+	if polls != 1 {
+		t.Error("expected no poll while events are kept")
+	}
+
+	async = false
+	f.Transition()
+	if left := p.Step(context.Background()); left != 0 || f.Current() != "closed" || polls != 1 {
+		t.Errorf("expected close to be fired without polling, got %d %s %d", left, f.Current(), polls)
+	}
+}
+
+func TestPollerErrors(t *testing.T) {
+	async := false
+	f := newDoor(&async)
+	p := NewPoller(f, SourceFunc(func(ctx context.Context) ([]ExternalEvent, error) {
+		return []ExternalEvent{{Event: "close"}}, errors.New("partial")
+	}), time.Second)
+
+	var errs []string
+	p.OnError = func(e *ExternalEvent, err error) {
+		errs = append(errs, fmt.Sprint(e != nil, " ", err))
+	}
+	if left := p.Step(context.Background()); left != 0 {
+		t.Error("expected the invalid event to be dropped")
+	}
+	if fmt.Sprint(errs) != "[false partial true event close inappropriate in current state closed, available events: open]" {
+		t.Errorf("unexpected errors %v", errs)
+	}
+}
+
+func TestPollerRun(t *testing.T) {
+	async := false
+	f := newDoor(&async)
+	ctx, cancel := context.WithCancel(context.Background())
+	p := NewPoller(f, SourceFunc(func(ctx context.Context) ([]ExternalEvent, error) {
+		cancel()
+		return []ExternalEvent{{Event: "open"}}, nil
+	}), time.Millisecond)
+
+	if err := p.Run(ctx); err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if f.Current() != "open" {
+		t.Error("expected the event to be fired")
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Debounce returns middleware that collapses bursts of event into one: the
+// event is only handled once it has not been received for d, with the
+// arguments of the last one. Other events are passed on unchanged.
+//
+// The debounced event returns a DebouncedError right away. The error of the
+// event when it is eventually handled is discarded. It is handled with the
+// values of the context of the last event, but is not canceled with it, as
+// that context, typically the one of a request, is usually done by then. Add
+// the middleware with FSM.Use, one per event:
+//
+//	f.Use(fsm.Debounce("input", 100*time.Millisecond))
+func Debounce(event string, d time.Duration) Middleware {
+	return func(next TransitionFunc) TransitionFunc {
+		var mu sync.Mutex
+		var timer *time.Timer
+		var ctx context.Context
+		var args []interface{}
+
+		// generation is incremented by each event, so that a timer that fired
+		// but is superseded by a later event before it gets mu does nothing.
+		var generation uint64
+
+		return func(c context.Context, e string, a []interface{}) error {
+			if e != event {
+				return next(c, e, a)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			ctx, args = context.WithoutCancel(c), a
+			generation++
+			gen := generation
+			if timer != nil {
+				timer.Stop()
+			}
+			timer = time.AfterFunc(d, func() {
+				mu.Lock()
+				if gen != generation {
+					mu.Unlock()
+					return
+				}
+				c, a := ctx, args
+				timer = nil
+				mu.Unlock()
+				next(c, event, a)
+			})
+			return DebouncedError{event}
+		}
+	}
+}
+
+// Throttle returns middleware that allows event to cause at most n
+// transitions within any window of time. The events over the limit are
+// rejected with a ThrottledError. Events that fail do not count, but events
+// in progress do, so that concurrent events can not exceed the limit. Other
+// events are passed on unchanged. The events over the limit are rejected right
+// away, even while another one is being handled.
+//
+//	f.Use(fsm.Throttle("input", 10, time.Second))
+func Throttle(event string, n int, window time.Duration) Middleware {
+	return func(next TransitionFunc) TransitionFunc {
+		var mu sync.Mutex
+		var times []time.Time
+
+		return func(ctx context.Context, e string, args []interface{}) error {
+			if e != event {
+				return next(ctx, e, args)
+			}
+
+			mu.Lock()
+			now := time.Now()
+			for len(times) > 0 && now.Sub(times[0]) >= window {
+				times = times[1:]
+			}
+			if len(times) >= n {
+				mu.Unlock()
+				return ThrottledError{event}
+			}
+			times = append(times, now)
+			mu.Unlock()
+
+			// mu is not held while handling the event, whose callbacks may
+			// send it again.
+			err := next(ctx, e, args)
+			if err != nil {
+				mu.Lock()
+				for i, t := range times {
+					if t.Equal(now) {
+						times = append(times[:i:i], times[i+1:]...)
+						break
+					}
+				}
+				mu.Unlock()
+			}
+			return err
+		}
+	}
+}
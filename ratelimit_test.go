@@ -0,0 +1,220 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newInputFSM(inputs chan<- interface{}) *FSM {
+	return NewFSM(
+		"editing",
+		Events{
+			{EvtName: "input", SrcStates: []string{"editing"}, DstStates: "editing"},
+			{EvtName: "save", SrcStates: []string{"editing"}, DstStates: "saved"},
+		},
+		Callbacks{
+			"after_input": func(action string, e *Event) {
+				inputs <- e.Args[0]
+			},
+		},
+	)
+}
+
+func TestDebounce(t *testing.T) {
+	inputs := make(chan interface{}, 10)
+	fsm := newInputFSM(inputs)
+	fsm.Use(Debounce("input", 10*time.Millisecond))
+
+	for i := 0; i < 5; i++ {
+		if _, ok := fsm.Event("input", i).(DebouncedError); !ok {
+			t.Error("expected DebouncedError")
+		}
+	}
+	select {
+	case got := <-inputs:
+		if got != 4 {
+			t.Errorf("expected the last arguments, got %v", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the debounced event to be handled")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if len(inputs) != 0 {
+		t.Error("expected a single event")
+	}
+
+	if err := fsm.Event("save"); err != nil {
+		t.Errorf("expected other events to be passed on, got %v", err)
+	}
+}
+
+func TestThrottle(t *testing.T) {
+	inputs := make(chan interface{}, 100)
+	fsm := newInputFSM(inputs)
+	fsm.Use(Throttle("input", 3, 20*time.Millisecond))
+
+	var mu sync.Mutex
+	throttled := 0
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, ok := fsm.Event("input", i).(ThrottledError); ok {
+				mu.Lock()
+				throttled++
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+	if len(inputs) != 3 || throttled != 7 {
+		t.Errorf("expected 3 events and 7 throttled, got %d and %d", len(inputs), throttled)
+	}
+
+	time.Sleep(25 * time.Millisecond)
+	if err := fsm.Event("input", 10); err != nil {
+		t.Errorf("expected the window to have passed, got %v", err)
+	}
+	if err := fsm.Event("save"); err != nil {
+		t.Errorf("expected other events to be passed on, got %v", err)
+	}
+}
+
+func TestDebounceCanceledContext(t *testing.T) {
+	inputs := make(chan interface{}, 10)
+	fsm := newInputFSM(inputs)
+	fsm.Use(Debounce("input", 10*time.Millisecond))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if _, ok := fsm.EventCtx(ctx, "input", 1).(DebouncedError); !ok {
+		t.Error("expected DebouncedError")
+	}
+	cancel()
+	select {
+	case got := <-inputs:
+		if got != 1 {
+			t.Errorf("unexpected arguments %v", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the debounced event to be handled after its context is done")
+	}
+}
+
+func TestThrottleWhileHandled(t *testing.T) {
+	var fsm *FSM
+	var inner error
+	fsm = NewFSM(
+		"editing",
+		Events{
+			{EvtName: "input", SrcStates: []string{"editing"}, DstStates: "editing"},
+		},
+		Callbacks{
+			"after_input": func(action string, e *Event) {
+				// Wait for the event sent again by another goroutine, which
+				// must be throttled instead of waiting for this one.
+				result := make(chan error, 1)
+				go func() {
+					result <- fsm.Event("input")
+				}()
+				select {
+				case inner = <-result:
+				case <-time.After(time.Second):
+				}
+			},
+		},
+	)
+	fsm.Use(Throttle("input", 1, time.Minute))
+
+	if err := fsm.Event("input"); err != nil {
+		t.Error(err)
+	}
+	if _, ok := inner.(ThrottledError); !ok {
+		t.Errorf("expected ThrottledError while the event is handled, got %v", inner)
+	}
+}
+
+func TestThrottleFailed(t *testing.T) {
+	fsm := NewFSM(
+		"editing",
+		Events{
+			{EvtName: "input", SrcStates: []string{"editing"}, DstStates: "editing"},
+		},
+		Callbacks{
+			"before_input": func(action string, e *Event) {
+				if len(e.Args) > 0 {
+					e.Cancel()
+				}
+			},
+		},
+	)
+	fsm.Use(Throttle("input", 1, time.Minute))
+
+	if _, ok := fsm.Event("input", "cancel").(CanceledError); !ok {
+		t.Error("expected CanceledError")
+	}
+	if err := fsm.Event("input"); err != nil {
+		t.Errorf("expected the failed event not to count, got %v", err)
+	}
+	if _, ok := fsm.Event("input").(ThrottledError); !ok {
+		t.Error("expected ThrottledError")
+	}
+}
+
+func TestUseKeepsMiddlewareState(t *testing.T) {
+	inputs := make(chan interface{}, 10)
+	fsm := newInputFSM(inputs)
+	fsm.Use(Debounce("input", 10*time.Millisecond), Throttle("save", 1, time.Hour))
+
+	if _, ok := fsm.Event("input", 1).(DebouncedError); !ok {
+		t.Error("expected DebouncedError")
+	}
+	if err := fsm.Event("save"); err != nil {
+		t.Fatal(err)
+	}
+	fsm.SetState("editing")
+	var seen []string
+	var mu sync.Mutex
+	fsm.Use(func(next TransitionFunc) TransitionFunc {
+		return func(ctx context.Context, event string, args []interface{}) error {
+			mu.Lock()
+			seen = append(seen, event)
+			mu.Unlock()
+			return next(ctx, event, args)
+		}
+	})
+
+	select {
+	case got := <-inputs:
+		if got != 1 {
+			t.Errorf("expected the pending input, got %v", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the debounced event to be handled")
+	}
+	mu.Lock()
+	if len(seen) != 1 || seen[0] != "input" {
+		t.Errorf("expected the debounced event to go through the middleware added later, got %v", seen)
+	}
+	mu.Unlock()
+
+	if _, ok := fsm.Event("save").(ThrottledError); !ok {
+		t.Error("expected the throttle window to be kept by Use")
+	}
+}
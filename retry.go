@@ -0,0 +1,87 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"time"
+)
+
+// Retry returns middleware that handles event again when it fails with a
+// Retryable error, see IsRetryable, making at most attempts attempts in all.
+// It waits backoff before the first retry, and twice as long before each of
+// the next ones. Other events are passed on unchanged.
+//
+// The caller of Event waits for the retries, and gets the error of the last
+// attempt. The retries stop early once the context of the event is done, for
+// example when it has a Deadline. Add the middleware with FSM.Use, one per
+// event:
+//
+//	f.Use(fsm.Retry("charge", 3, 100*time.Millisecond))
+func Retry(event string, attempts int, backoff time.Duration) Middleware {
+	return func(next TransitionFunc) TransitionFunc {
+		return func(ctx context.Context, e string, args []interface{}) error {
+			if e != event {
+				return next(ctx, e, args)
+			}
+
+			err := next(ctx, e, args)
+			wait := backoff
+			for i := 1; i < attempts && IsRetryable(err); i++ {
+				timer := time.NewTimer(wait)
+				select {
+				case <-timer.C:
+				case <-ctx.Done():
+					timer.Stop()
+					return err
+				}
+				wait *= 2
+				err = next(ctx, e, args)
+			}
+			return err
+		}
+	}
+}
+
+// Deadline returns middleware that gives event a deadline d after it is
+// received, as a service level agreement: the context of the event, seen by
+// its callbacks with Event.Context, is done by then. Retries made by Retry
+// middleware added after it share the deadline. Other events are passed on
+// unchanged.
+//
+// An asynchronous transition started by the event keeps the deadline, and is
+// aborted if it is not completed by then, see AbortedError.
+//
+//	f.Use(fsm.Deadline("charge", time.Second))
+func Deadline(event string, d time.Duration) Middleware {
+	return func(next TransitionFunc) TransitionFunc {
+		return func(ctx context.Context, e string, args []interface{}) error {
+			if e != event {
+				return next(ctx, e, args)
+			}
+
+			ctx, cancel := context.WithTimeout(ctx, d)
+			err := next(ctx, e, args)
+			if _, ok := err.(AsyncError); ok {
+				// Keep the deadline of the pending transition.
+				deadline, _ := ctx.Deadline()
+				time.AfterFunc(time.Until(deadline), cancel)
+			} else {
+				cancel()
+			}
+			return err
+		}
+	}
+}
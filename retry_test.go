@@ -0,0 +1,99 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func newChargeFSM(attempts *int, class ErrorClass) *FSM {
+	return NewFSM(
+		"cart",
+		Events{
+			{EvtName: "charge", SrcStates: []string{"cart"}, DstStates: "paid"},
+		},
+		Callbacks{
+			"before_charge": func(action string, e *Event) {
+				*attempts++
+				e.Fail(errors.New("unavailable"), class)
+			},
+		},
+	)
+}
+
+func TestRetry(t *testing.T) {
+	attempts := 0
+	fsm := newChargeFSM(&attempts, Retryable)
+	fsm.Use(Retry("charge", 3, time.Millisecond))
+
+	start := time.Now()
+	if err := fsm.Event("charge"); !IsRetryable(err) {
+		t.Errorf("expected the error of the last attempt, got %v", err)
+	}
+	if attempts != 3 {
+		t.Errorf("expected 3 attempts, got %d", attempts)
+	}
+	if time.Since(start) < 3*time.Millisecond {
+		t.Error("expected a doubling backoff between the attempts")
+	}
+
+	attempts = 0
+	fsm = newChargeFSM(&attempts, Terminal)
+	fsm.Use(Retry("charge", 3, time.Millisecond))
+	if err := fsm.Event("charge"); !IsTerminal(err) || attempts != 1 {
+		t.Errorf("expected a terminal error not to be retried, got %v after %d", err, attempts)
+	}
+
+	attempts = 0
+	fsm = newChargeFSM(&attempts, Retryable)
+	fsm.Use(Retry("charge", 3, time.Hour))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := fsm.EventCtx(ctx, "charge"); !IsRetryable(err) || attempts != 1 {
+		t.Errorf("expected the retries to stop with the context, got %v after %d", err, attempts)
+	}
+}
+
+func TestDeadline(t *testing.T) {
+	fsm := NewFSM(
+		"cart",
+		Events{
+			{EvtName: "charge", SrcStates: []string{"cart"}, DstStates: "paid"},
+		},
+		Callbacks{
+			"leave_cart": func(action string, e *Event) {
+				if _, ok := e.Context().Deadline(); !ok {
+					t.Error("expected the event to have a deadline")
+				}
+				e.Async()
+			},
+		},
+	)
+	fsm.Use(Deadline("charge", 10*time.Millisecond))
+
+	if _, ok := fsm.Event("charge").(AsyncError); !ok {
+		t.Fatal("expected AsyncError")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if _, ok := fsm.Transition().(AbortedError); !ok {
+		t.Error("expected the pending transition to be aborted past its deadline")
+	}
+	if fsm.Current() != "cart" {
+		t.Errorf("expected to stay in cart, got %s", fsm.Current())
+	}
+}
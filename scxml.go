@@ -0,0 +1,128 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+)
+
+// scxmlDoc is the subset of a W3C SCXML document read by ImportSCXML.
+type scxmlDoc struct {
+	XMLName xml.Name     `xml:"scxml"`
+	Initial string       `xml:"initial,attr"`
+	States  []scxmlState `xml:",any"`
+}
+
+// scxmlState is a <state>, <final> or <parallel> element.
+type scxmlState struct {
+	XMLName     xml.Name          `xml:""`
+	ID          string            `xml:"id,attr"`
+	Transitions []scxmlTransition `xml:"transition"`
+	States      []scxmlChild      `xml:"state"`
+	Finals      []scxmlChild      `xml:"final"`
+	Parallels   []scxmlChild      `xml:"parallel"`
+}
+
+// scxmlChild is a nested state, which is not supported.
+type scxmlChild struct {
+	ID string `xml:"id,attr"`
+}
+
+// scxmlTransition is a <transition> element.
+type scxmlTransition struct {
+	Event  string `xml:"event,attr"`
+	Target string `xml:"target,attr"`
+	Cond   string `xml:"cond,attr"`
+}
+
+// ImportSCXML builds the events of a FSM from a W3C SCXML document.
+//
+// Only flat machines are supported: the <state> and <final> elements directly
+// below <scxml> are the states, and their <transition> elements the events. A
+// transition with several space separated events gives one event each, and
+// transitions with the same event and target are combined into one EventDesc
+// with several source states, in the order they appear.
+//
+// The initial state is given by the initial attribute of <scxml>, or is the
+// first state. Executable content such as <onentry> and <onexit> is ignored,
+// callbacks have to be added in Go. An ImportError is returned for compound and
+// parallel states and for transitions without an event, without a single
+// target or with a condition, since they can not be expressed as Events.
+func ImportSCXML(r io.Reader) (string, Events, error) {
+	var doc scxmlDoc
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		if serr, ok := err.(*xml.SyntaxError); ok {
+			return "", nil, ImportError{"scxml", serr.Line, serr.Msg}
+		}
+		return "", nil, ImportError{"scxml", 0, err.Error()}
+	}
+
+	fail := func(msg string) (string, Events, error) {
+		return "", nil, ImportError{"scxml", 0, msg}
+	}
+
+	var events Events
+	index := make(map[[2]string]int)
+	for _, s := range doc.States {
+		switch s.XMLName.Local {
+		case "state", "final":
+		case "parallel":
+			return fail("parallel state " + s.ID + " is not supported")
+		default:
+			continue
+		}
+		if s.ID == "" {
+			return fail("<" + s.XMLName.Local + "> without id")
+		}
+		if len(s.States)+len(s.Finals)+len(s.Parallels) > 0 {
+			return fail("compound state " + s.ID + " is not supported")
+		}
+
+		for _, t := range s.Transitions {
+			names := strings.Fields(t.Event)
+			targets := strings.Fields(t.Target)
+			switch {
+			case len(names) == 0:
+				return fail("transition in state " + s.ID + " has no event")
+			case len(targets) != 1:
+				return fail("transition " + t.Event + " in state " + s.ID + " must have one target")
+			case t.Cond != "":
+				return fail("transition " + t.Event + " in state " + s.ID + " has a condition")
+			}
+
+			for _, name := range names {
+				key := [2]string{name, targets[0]}
+				if i, ok := index[key]; ok {
+					events[i].SrcStates = append(events[i].SrcStates, s.ID)
+					continue
+				}
+				index[key] = len(events)
+				events = append(events, EventDesc{EvtName: name, SrcStates: []string{s.ID}, DstStates: targets[0]})
+			}
+		}
+
+		if doc.Initial == "" {
+			doc.Initial = s.ID
+		}
+	}
+
+	if strings.Contains(strings.TrimSpace(doc.Initial), " ") {
+		return fail("more than one initial state")
+	}
+
+	return strings.TrimSpace(doc.Initial), events, nil
+}
@@ -0,0 +1,89 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestImportSCXML(t *testing.T) {
+	src := `<?xml version="1.0"?>
+<scxml xmlns="http://www.w3.org/2005/07/scxml" version="1.0" initial="closed">
+	<datamodel/>
+	<state id="open">
+		<onentry><log expr="'opened'"/></onentry>
+		<transition event="close" target="closed"/>
+		<transition event="kick" target="broken"/>
+	</state>
+	<state id="closed">
+		<transition event="open" target="open"/>
+		<transition event="kick smash" target="broken"/>
+	</state>
+	<final id="broken"/>
+</scxml>`
+
+	initial, events, err := ImportSCXML(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if initial != "closed" {
+		t.Errorf("expected initial state 'closed', got %q", initial)
+	}
+	var got []string
+	for _, e := range events {
+		got = append(got, fmt.Sprint(e.EvtName, e.SrcStates, e.DstStates))
+	}
+	expected := "[close[open]closed kick[open closed]broken open[closed]open smash[closed]broken]"
+	if fmt.Sprint(got) != expected {
+		t.Errorf("unexpected events %v", got)
+	}
+
+	fsm := NewFSM(initial, events, Callbacks{})
+	if err := fsm.Event("smash"); err != nil || fsm.Current() != "broken" {
+		t.Error("expected the imported events to work")
+	}
+}
+
+func TestImportSCXMLFirstState(t *testing.T) {
+	src := `<scxml><state id="a"><transition event="go" target="b"/></state><state id="b"/></scxml>`
+	initial, _, err := ImportSCXML(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if initial != "a" {
+		t.Errorf("expected the first state to be initial, got %q", initial)
+	}
+}
+
+func TestImportSCXMLErrors(t *testing.T) {
+	tests := []string{
+		`<scxml><state id="a"><state id="b"/></state></scxml>`,
+		`<scxml><parallel id="a"/></scxml>`,
+		`<scxml><state id="a"><transition target="a"/></state></scxml>`,
+		`<scxml><state id="a"><transition event="go"/></state></scxml>`,
+		`<scxml><state id="a"><transition event="go" target="a b"/></state></scxml>`,
+		`<scxml><state id="a"><transition event="go" target="a" cond="x"/></state></scxml>`,
+		`<scxml><state id="a"></scxml>`,
+		`<fsm/>`,
+	}
+	for _, src := range tests {
+		_, _, err := ImportSCXML(strings.NewReader(src))
+		if e, ok := err.(ImportError); !ok || e.Format != "scxml" {
+			t.Errorf("expected ImportError for %s, got %v", src, err)
+		}
+	}
+}
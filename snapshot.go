@@ -0,0 +1,191 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+)
+
+// Snapshot is the runtime state of an FSM, as returned by FSM.Snapshot. It
+// can be encoded as JSON and restored with FSM.Restore on an FSM with the same
+// definition, for example after a process restart.
+type Snapshot struct {
+	// State is the current state.
+	State string `json:"state"`
+
+	// Sequence is the sequence number of the last committed transition.
+	Sequence uint64 `json:"sequence"`
+
+	// Pending is the asynchronous transition in progress, if any.
+	Pending *PendingTransition `json:"pending,omitempty"`
+
+	// Metadata is the data stored with FSM.SetMetadata.
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// PendingTransition is an asynchronous transition in progress, waiting for a
+// call to FSM.Transition.
+type PendingTransition struct {
+	// Event is the event name.
+	Event string `json:"event"`
+
+	// Src is the state before the transition.
+	Src string `json:"src"`
+
+	// Dst is the state after the transition.
+	Dst string `json:"dst"`
+
+	// Args are the arguments of the event.
+	Args []interface{} `json:"args,omitempty"`
+}
+
+// Snapshot returns the runtime state of the FSM.
+//
+// Snapshot must not be called from a callback.
+func (f *FSM) Snapshot() Snapshot {
+	f.eventMu.Lock()
+	defer f.eventMu.Unlock()
+
+	f.stateMu.RLock()
+	defer f.stateMu.RUnlock()
+
+	s := Snapshot{State: f.current, Sequence: f.seq, Metadata: f.copyMetadata()}
+	if e := f.pending; e != nil {
+		s.Pending = &PendingTransition{
+			Event: e.Event,
+			Src:   e.Src,
+			Dst:   e.Dst,
+			Args:  e.Args,
+		}
+	}
+	return s
+}
+
+// Restore sets the runtime state and the metadata of the FSM to s, without
+// calling any callbacks unless the FSM has WithRestoreCallbacks. It returns a
+// SnapshotError if s does not match the definition of the FSM, in which case
+// the FSM is left unchanged.
+//
+// An asynchronous transition in progress is canceled. If s has a pending
+// transition it is put back in progress, and completed by the next call to
+// Transition as if its leave_<STATE> callbacks had just called Async. Its
+// arguments are the decoded ones, e.g. numbers are float64 after a round trip
+// through JSON. Otherwise the timers of the state, see Timeout, are started
+// from the beginning.
+//
+// Restore must not be called from a callback.
+func (f *FSM) Restore(s Snapshot) error {
+	f.eventMu.Lock()
+	defer f.eventMu.Unlock()
+
+	if !f.allStates[s.State] {
+		return SnapshotError{"unknown state " + s.State}
+	}
+	var e *Event
+	if p := s.Pending; p != nil {
+		if p.Src != s.State {
+			return SnapshotError{"pending transition from " + p.Src + " while in state " + s.State}
+		}
+		if key := (eKey{p.Event, p.Src}); !f.isDst(key, p.Dst) {
+			return SnapshotError{"unknown pending transition " + p.Event + " from " + p.Src + " to " + p.Dst}
+		}
+		e = &Event{FSM: f, Event: p.Event, Src: p.Src, Dst: p.Dst, Args: p.Args}
+		e.setContext(context.Background())
+	}
+
+	src := f.Current()
+	f.restore(s.State, s.Sequence, e)
+	f.setMetadata(s.Metadata)
+	f.restoredStateCallbacks(context.Background(), src)
+	return nil
+}
+
+// restore sets the current state and sequence number, with e as the pending
+// transition if not nil, canceling the transition in progress.
+func (f *FSM) restore(state string, seq uint64, e *Event) {
+	f.cancelPending()
+	f.queue = nil
+
+	f.stateMu.Lock()
+	f.setCurrent(state)
+	f.last = Edge{}
+	f.seq = seq
+	f.epoch++
+	f.stateMu.Unlock()
+
+	f.stopTimers()
+	if f.occupant != nil {
+		f.occupant.move(state)
+	}
+	if e != nil {
+		f.pending = e
+		f.transition = e
+	} else {
+		f.startTimeouts()
+	}
+}
+
+// MarshalJSON returns the JSON encoding of the Snapshot of the FSM. It always
+// uses encoding/json, whatever the codec given to WithCodec, see
+// MarshalBinary.
+func (f *FSM) MarshalJSON() ([]byte, error) {
+	return json.Marshal(f.Snapshot())
+}
+
+// UnmarshalJSON restores the FSM from the JSON encoding of a Snapshot. The
+// FSM must have been created with the same definition, see Restore.
+func (f *FSM) UnmarshalJSON(data []byte) error {
+	var s Snapshot
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	return f.Restore(s)
+}
+
+// MarshalBinary returns the encoding of the Snapshot of the FSM by the codec
+// given to WithCodec or, without one, its gob encoding, which is more compact
+// than JSON and keeps the types of the arguments of a pending transition.
+// Arguments and metadata of other than the basic types must then be
+// registered with gob.Register.
+func (f *FSM) MarshalBinary() ([]byte, error) {
+	if f.codec != nil {
+		return f.codec.Marshal(f.Snapshot())
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(f.Snapshot()); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary restores the FSM from the encoding of a Snapshot returned by
+// MarshalBinary. The FSM must have been created with the same definition and
+// codec, see Restore.
+func (f *FSM) UnmarshalBinary(data []byte) error {
+	var s Snapshot
+	if f.codec != nil {
+		if err := f.codec.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		return f.Restore(s)
+	}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&s); err != nil {
+		return err
+	}
+	return f.Restore(s)
+}
@@ -0,0 +1,234 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func newDoorFSM(callbacks Callbacks) *FSM {
+	return NewFSM(
+		"closed",
+		Events{
+			{EvtName: "open", SrcStates: []string{"closed"}, DstStates: "open"},
+			{EvtName: "close", SrcStates: []string{"open"}, DstStates: "closed"},
+		},
+		callbacks,
+	)
+}
+
+func TestSnapshot(t *testing.T) {
+	fsm := newDoorFSM(Callbacks{})
+	fsm.Event("open")
+
+	data, err := json.Marshal(fsm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"state":"open","sequence":1}` {
+		t.Errorf("unexpected snapshot %s", data)
+	}
+
+	restored := newDoorFSM(Callbacks{})
+	if err := json.Unmarshal(data, restored); err != nil {
+		t.Fatal(err)
+	}
+	if restored.Current() != "open" || restored.Sequence() != 1 {
+		t.Error("expected state open and sequence 1")
+	}
+	if err := restored.Event("close"); err != nil {
+		t.Errorf("expected the restored FSM to work, got %v", err)
+	}
+}
+
+func TestRestoreCallbacks(t *testing.T) {
+	var calls []string
+	callbacks := Callbacks{
+		"enter_open": func(action string, e *Event) {
+			calls = append(calls, action+" "+e.Src+" "+e.Dst)
+		},
+		"enter_state": NonReplayable(func(action string, e *Event) {
+			calls = append(calls, "notify "+e.Dst)
+		}),
+	}
+
+	restored := newDoorFSM(callbacks)
+	if err := restored.Restore(Snapshot{State: "open", Sequence: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != 0 {
+		t.Errorf("expected no callbacks by default, got %v", calls)
+	}
+
+	restored = NewFSM(
+		"closed",
+		Events{
+			{EvtName: "open", SrcStates: []string{"closed"}, DstStates: "open"},
+			{EvtName: "close", SrcStates: []string{"open"}, DstStates: "closed"},
+		},
+		callbacks,
+		WithRestoreCallbacks(),
+	)
+	if err := restored.Restore(Snapshot{State: "open", Sequence: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != 1 || calls[0] != ActionRestoringState+" closed open" {
+		t.Errorf("expected the replayable enter callback, got %v", calls)
+	}
+
+	calls = nil
+	restored.Event("close")
+	restored.Event("open")
+	if strings.Join(calls, ", ") != "notify closed, "+ActionEnteringState+" closed open, notify open" {
+		t.Errorf("expected every callback on transitions, got %v", calls)
+	}
+}
+
+func TestRestoreNonReplayableState(t *testing.T) {
+	var calls []string
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{EvtName: "open", SrcStates: []string{"closed"}, DstStates: "open"},
+			{EvtName: "close", SrcStates: []string{"open"}, DstStates: "closed"},
+		},
+		Callbacks{},
+		WithRestoreCallbacks(),
+		WithStates(States{
+			{Name: "open", OnEnter: func(e *Event) {
+				calls = append(calls, "init "+e.Dst)
+			}},
+			{Name: "closed", NonReplayable: true, OnEnter: func(e *Event) {
+				calls = append(calls, "notify "+e.Dst)
+			}},
+		}),
+	)
+
+	if err := fsm.Restore(Snapshot{State: "open", Sequence: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsm.Restore(Snapshot{State: "closed", Sequence: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(calls, ", ") != "init open" {
+		t.Errorf("expected only the replayable entry action, got %v", calls)
+	}
+
+	calls = nil
+	fsm.Event("open")
+	fsm.Event("close")
+	if strings.Join(calls, ", ") != "init open, notify closed" {
+		t.Errorf("expected every entry action on transitions, got %v", calls)
+	}
+}
+
+func TestSnapshotPending(t *testing.T) {
+	fsm := newDoorFSM(Callbacks{
+		"leave_closed": func(_ string, e *Event) {
+			e.Async()
+		},
+	})
+	if _, ok := fsm.Event("open", "key").(AsyncError); !ok {
+		t.Fatal("expected AsyncError")
+	}
+
+	data, err := json.Marshal(fsm)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var args []interface{}
+	restored := newDoorFSM(Callbacks{
+		"enter_open": func(_ string, e *Event) {
+			args = e.Args
+		},
+	})
+	if err := json.Unmarshal(data, restored); err != nil {
+		t.Fatal(err)
+	}
+	if restored.Current() != "closed" {
+		t.Error("expected state closed")
+	}
+	if _, ok := restored.Event("open").(InTransitionError); !ok {
+		t.Error("expected InTransitionError")
+	}
+	if err := restored.Transition(); err != nil {
+		t.Fatal(err)
+	}
+	if restored.Current() != "open" {
+		t.Error("expected state open")
+	}
+	if len(args) != 1 || args[0] != "key" {
+		t.Errorf("expected the pending arguments, got %v", args)
+	}
+}
+
+func TestSnapshotBinary(t *testing.T) {
+	fsm := newDoorFSM(Callbacks{
+		"leave_closed": func(_ string, e *Event) {
+			e.Async()
+		},
+	})
+	fsm.Event("open", 42)
+
+	data, err := fsm.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var args []interface{}
+	restored := newDoorFSM(Callbacks{
+		"enter_open": func(_ string, e *Event) {
+			args = e.Args
+		},
+	})
+	if err := restored.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := restored.Transition(); err != nil {
+		t.Fatal(err)
+	}
+	if restored.Current() != "open" || restored.Sequence() != 1 {
+		t.Error("expected state open and sequence 1")
+	}
+	if len(args) != 1 || args[0] != 42 {
+		t.Errorf("expected the pending arguments with their types, got %v", args)
+	}
+
+	if err := restored.UnmarshalBinary([]byte("garbage")); err == nil {
+		t.Error("expected an error for invalid data")
+	}
+}
+
+func TestRestoreInvalid(t *testing.T) {
+	fsm := newDoorFSM(Callbacks{})
+	fsm.Event("open")
+
+	for _, s := range []Snapshot{
+		{State: "ajar"},
+		{State: "closed", Pending: &PendingTransition{Event: "open", Src: "open", Dst: "closed"}},
+		{State: "closed", Pending: &PendingTransition{Event: "close", Src: "closed", Dst: "open"}},
+		{State: "closed", Pending: &PendingTransition{Event: "open", Src: "closed", Dst: "closed"}},
+	} {
+		if _, ok := fsm.Restore(s).(SnapshotError); !ok {
+			t.Errorf("expected SnapshotError for %+v", s)
+		}
+	}
+	if fsm.Current() != "open" || fsm.Sequence() != 1 {
+		t.Error("expected the FSM to be unchanged")
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"sync"
+)
+
+// Store persists the state of FSMs, keyed by instance ID. See WithStore.
+//
+// Implementations must be safe for concurrent use. MemoryStore is an in-memory
+// implementation, mainly for tests.
+type Store interface {
+	// Load returns the state saved for instance id, or a NotFoundError.
+	Load(ctx context.Context, id string) (Snapshot, error)
+
+	// Save saves the state of instance id, as a compare-and-set on the
+	// sequence number, so that several processes can safely drive the same
+	// instance: it must return a ConflictError unless the state saved has the
+	// sequence number just before s, or no state is saved and s has sequence
+	// number 0 or 1.
+	Save(ctx context.Context, id string, s Snapshot) error
+}
+
+// Load restores the state saved for the FSM in the store given to WithStore,
+// see Restore. It returns a NotFoundError if no state has been saved yet, or
+// if the FSM has no store, in which case the FSM is left unchanged.
+//
+// Load must not be called from a callback.
+func (f *FSM) Load(ctx context.Context) error {
+	if f.store == nil {
+		return NotFoundError{f.storeID}
+	}
+	s, err := f.store.Load(f.codecContext(ctx), f.storeID)
+	if err != nil {
+		return err
+	}
+	return f.Restore(s)
+}
+
+// MemoryStore is a Store keeping the states in memory. A state saved with a
+// codec in the context, see ContextWithCodec, is kept encoded by it, as a
+// persistent store would.
+type MemoryStore struct {
+	mu     sync.Mutex
+	states map[string]memoryState
+}
+
+// memoryState is a state saved in a MemoryStore, either s or its encoding
+// data by codec.
+type memoryState struct {
+	seq   uint64
+	s     Snapshot
+	data  []byte
+	codec Codec
+}
+
+// NewMemoryStore returns a new empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{states: make(map[string]memoryState)}
+}
+
+// Load returns the state saved for instance id, or a NotFoundError.
+func (m *MemoryStore) Load(ctx context.Context, id string) (Snapshot, error) {
+	m.mu.Lock()
+	state, ok := m.states[id]
+	m.mu.Unlock()
+	if !ok {
+		return Snapshot{}, NotFoundError{id}
+	}
+	if state.codec == nil {
+		return state.s, nil
+	}
+	var s Snapshot
+	if err := state.codec.Unmarshal(state.data, &s); err != nil {
+		return Snapshot{}, err
+	}
+	return s, nil
+}
+
+// Save saves the state of instance id. It returns a ConflictError unless the
+// state saved has the sequence number just before s, or no state is saved and
+// s has sequence number 0 or 1.
+func (m *MemoryStore) Save(ctx context.Context, id string, s Snapshot) error {
+	state := memoryState{seq: s.Sequence, s: s}
+	if codec, ok := contextCodec(ctx); ok {
+		data, err := codec.Marshal(s)
+		if err != nil {
+			return err
+		}
+		state = memoryState{seq: s.Sequence, data: data, codec: codec}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	old, ok := m.states[id]
+	if ok && old.seq+1 != s.Sequence || !ok && s.Sequence > 1 {
+		return ConflictError{id, old.seq}
+	}
+	m.states[id] = state
+	return nil
+}
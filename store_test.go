@@ -0,0 +1,130 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestStore(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{EvtName: "open", SrcStates: []string{"closed"}, DstStates: "open"},
+			{EvtName: "close", SrcStates: []string{"open"}, DstStates: "closed"},
+		},
+		Callbacks{},
+		WithStore(store, "door-1"),
+	)
+
+	if _, ok := fsm.Load(ctx).(NotFoundError); !ok {
+		t.Error("expected NotFoundError before the first transition")
+	}
+
+	if err := fsm.Event("open"); err != nil {
+		t.Fatal(err)
+	}
+	s, err := store.Load(ctx, "door-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.State != "open" || s.Sequence != 1 {
+		t.Errorf("expected state open and sequence 1 saved, got %+v", s)
+	}
+
+	replica := NewFSM(
+		"closed",
+		Events{
+			{EvtName: "open", SrcStates: []string{"closed"}, DstStates: "open"},
+			{EvtName: "close", SrcStates: []string{"open"}, DstStates: "closed"},
+		},
+		Callbacks{},
+		WithStore(store, "door-1"),
+	)
+	if err := replica.Load(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if replica.Current() != "open" {
+		t.Error("expected the replica to be loaded in state open")
+	}
+	if err := replica.Event("close"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The first FSM is now behind the saved state.
+	err = fsm.Event("close")
+	var conflict ConflictError
+	if _, ok := err.(StoreError); !ok || !errors.As(err, &conflict) {
+		t.Fatalf("expected StoreError with a ConflictError, got %v", err)
+	}
+	if conflict.Sequence != 2 {
+		t.Errorf("expected the saved sequence 2, got %d", conflict.Sequence)
+	}
+	if fsm.Current() != "open" || fsm.Sequence() != 1 {
+		t.Error("expected the transition not to be committed")
+	}
+
+	// The stale FSM can not overwrite the store with later transitions.
+	if err := replica.Event("open"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsm.Event("close"); !errors.As(err, &conflict) {
+		t.Fatalf("expected a ConflictError, got %v", err)
+	}
+	if s, _ := store.Load(ctx, "door-1"); s.State != "open" || s.Sequence != 3 {
+		t.Errorf("expected the state of the replica saved, got %+v", s)
+	}
+
+	// Once loaded again, it continues from the saved state.
+	if err := fsm.Load(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsm.Event("close"); err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := store.Load(ctx, "door-1"); s.State != "closed" || s.Sequence != 4 {
+		t.Errorf("expected state closed and sequence 4 saved, got %+v", s)
+	}
+}
+
+func TestMemoryStoreCompareAndSet(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+	if err := store.Save(ctx, "a", Snapshot{State: "b", Sequence: 2}); !errors.Is(err, ErrConflict) {
+		t.Errorf("expected a ConflictError for a first state with sequence 2, got %v", err)
+	}
+	if err := store.Save(ctx, "a", Snapshot{State: "b", Sequence: 1}); err != nil {
+		t.Fatal(err)
+	}
+	for _, seq := range []uint64{1, 3} {
+		if err := store.Save(ctx, "a", Snapshot{State: "c", Sequence: seq}); !errors.Is(err, ErrConflict) {
+			t.Errorf("expected a ConflictError for sequence %d, got %v", seq, err)
+		}
+	}
+	if err := store.Save(ctx, "a", Snapshot{State: "c", Sequence: 2}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestStoreNone(t *testing.T) {
+	fsm := NewFSM("start", Events{}, Callbacks{})
+	if _, ok := fsm.Load(context.Background()).(NotFoundError); !ok {
+		t.Error("expected NotFoundError without store")
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import "sync"
+
+// SubscriptionBuffer is the number of transitions buffered for a subscriber,
+// see FSM.Subscribe.
+const SubscriptionBuffer = 64
+
+// StateFilter selects the transitions sent to a subscriber, see FSM.Subscribe.
+//
+// A transition matches if it enters one of the states of Enter or leaves one
+// of the states of Leave. Transitions from a state to itself neither enter nor
+// leave it. An empty filter matches every transition.
+type StateFilter struct {
+	Enter []string
+	Leave []string
+}
+
+// match returns true if the transition from src to dst matches the filter.
+func (s StateFilter) match(src, dst string) bool {
+	if len(s.Enter) == 0 && len(s.Leave) == 0 {
+		return true
+	}
+	if src == dst {
+		return false
+	}
+	for _, state := range s.Enter {
+		if state == dst {
+			return true
+		}
+	}
+	for _, state := range s.Leave {
+		if state == src {
+			return true
+		}
+	}
+	return false
+}
+
+// subscription is a subscriber added by Subscribe.
+type subscription struct {
+	filter StateFilter
+
+	// mu guards closed, and is held while sending on ch so that cancel does
+	// not close it under its feet.
+	mu     sync.Mutex
+	ch     chan Transition
+	closed bool
+}
+
+// Subscribe returns a channel receiving the committed transitions that match
+// filter, and a function to cancel the subscription, which closes the
+// channel.
+//
+// The transitions are sent as they are committed, after the observers have
+// been notified, or once their batch succeeds, see EventsCtx. Up to
+// SubscriptionBuffer transitions are buffered; further ones are dropped until
+// the subscriber catches up, which it can detect with gaps in
+// Transition.Sequence. Subscribe is safe to call from a callback, and from
+// another goroutine even with WithoutLocking.
+func (f *FSM) Subscribe(filter StateFilter) (<-chan Transition, func()) {
+	s := &subscription{filter: filter, ch: make(chan Transition, SubscriptionBuffer)}
+
+	f.observerMu.Lock()
+	subscriptions := make([]*subscription, len(f.subscriptions), len(f.subscriptions)+1)
+	copy(subscriptions, f.subscriptions)
+	f.subscriptions = append(subscriptions, s)
+	f.observerMu.Unlock()
+
+	var once sync.Once
+	return s.ch, func() {
+		once.Do(func() {
+			f.unsubscribe(s)
+		})
+	}
+}
+
+// unsubscribe removes s from the subscriptions and closes its channel.
+func (f *FSM) unsubscribe(s *subscription) {
+	f.observerMu.Lock()
+	subscriptions := make([]*subscription, 0, len(f.subscriptions))
+	for _, other := range f.subscriptions {
+		if other != s {
+			subscriptions = append(subscriptions, other)
+		}
+	}
+	f.subscriptions = subscriptions
+	f.observerMu.Unlock()
+
+	s.mu.Lock()
+	s.closed = true
+	close(s.ch)
+	s.mu.Unlock()
+}
+
+// notifySubscriptions sends t to the subscriptions matching it.
+func (f *FSM) notifySubscriptions(subscriptions []*subscription, t Transition) {
+	for _, s := range subscriptions {
+		if !s.filter.match(t.Src, t.Dst) {
+			continue
+		}
+		s.mu.Lock()
+		if !s.closed {
+			select {
+			case s.ch <- t:
+			default:
+			}
+		}
+		s.mu.Unlock()
+	}
+}
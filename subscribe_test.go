@@ -0,0 +1,80 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestSubscribe(t *testing.T) {
+	fsm := newAnalysisFSM()
+
+	all, cancelAll := fsm.Subscribe(StateFilter{})
+	defer cancelAll()
+	review, cancelReview := fsm.Subscribe(StateFilter{Enter: []string{"review"}, Leave: []string{"published"}})
+
+	fsm.Event("submit")
+	fsm.Event("reject")
+	fsm.Event("submit")
+	fsm.Event("approve")
+	fsm.Event("archive")
+	cancelReview()
+	cancelReview()
+	fsm.Event("restore")
+
+	var got []string
+	for tr := range review {
+		got = append(got, fmt.Sprint(tr.Sequence, ":", tr.Src, "->", tr.Dst))
+	}
+	expected := "[1:draft->review 3:draft->review 5:published->archived]"
+	if fmt.Sprint(got) != expected {
+		t.Errorf("expected %s, got %v", expected, got)
+	}
+
+	if n := len(all); n != 6 {
+		t.Errorf("expected 6 transitions for the empty filter, got %d", n)
+	}
+}
+
+func TestSubscribeDrops(t *testing.T) {
+	fsm := NewFSM(
+		"idle",
+		Events{
+			{EvtName: "tick", SrcStates: []string{"idle"}, DstStates: "idle"},
+		},
+		Callbacks{},
+	)
+	ch, cancel := fsm.Subscribe(StateFilter{})
+	defer cancel()
+
+	for i := 0; i < SubscriptionBuffer+10; i++ {
+		fsm.Event("tick")
+	}
+	if len(ch) != SubscriptionBuffer {
+		t.Errorf("expected %d buffered transitions, got %d", SubscriptionBuffer, len(ch))
+	}
+	if tr := <-ch; tr.Sequence != 1 {
+		t.Errorf("expected the first transition, got %d", tr.Sequence)
+	}
+	if fsm.Event("tick"); len(ch) != SubscriptionBuffer {
+		t.Error("expected the transition to be buffered once there is room")
+	}
+
+	filter := StateFilter{Enter: []string{"idle"}}
+	if filter.match("idle", "idle") {
+		t.Error("expected a transition to the same state not to enter it")
+	}
+}
@@ -0,0 +1,196 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+// table is the transition table of a FSM. States and events are interned as
+// dense integers, and the transitions from each state are kept in a slice
+// indexed by its number, so that machines with many states take much less
+// memory than with maps keyed by names.
+type table struct {
+	states  []string
+	stateID map[string]int32
+	events  []string
+	eventID map[string]int32
+
+	// count is the number of transitions of each event.
+	count []int32
+
+	// out holds the transitions from each state, in the order they were
+	// added.
+	out [][]edge
+}
+
+// edge is a transition from a state.
+type edge struct {
+	event int32
+	dst   int32
+	desc  *EventDesc
+}
+
+func newTable() *table {
+	return &table{
+		stateID: make(map[string]int32),
+		eventID: make(map[string]int32),
+	}
+}
+
+// state returns the number of the state name, interning it if needed.
+func (t *table) state(name string) int32 {
+	if id, ok := t.stateID[name]; ok {
+		return id
+	}
+	id := int32(len(t.states))
+	t.states = append(t.states, name)
+	t.stateID[name] = id
+	t.out = append(t.out, nil)
+	return id
+}
+
+// event returns the number of the event name, interning it if needed.
+func (t *table) event(name string) int32 {
+	if id, ok := t.eventID[name]; ok {
+		return id
+	}
+	id := int32(len(t.events))
+	t.events = append(t.events, name)
+	t.eventID[name] = id
+	t.count = append(t.count, 0)
+	return id
+}
+
+// add adds the transition for event from src to dst, replacing the one
+// already defined if any.
+func (t *table) add(event, src, dst string, desc *EventDesc) {
+	s, e := t.state(src), t.event(event)
+	edge := edge{e, t.state(dst), desc}
+	for i := range t.out[s] {
+		if t.out[s][i].event == e {
+			t.out[s][i] = edge
+			return
+		}
+	}
+	t.out[s] = append(t.out[s], edge)
+	t.count[e]++
+}
+
+// remove removes the transition for event from src, and returns true if there
+// was one. The names stay interned.
+func (t *table) remove(event, src string) bool {
+	s, ok := t.stateID[src]
+	if !ok {
+		return false
+	}
+	e, ok := t.eventID[event]
+	if !ok {
+		return false
+	}
+	for i, edge := range t.out[s] {
+		if edge.event == e {
+			t.out[s] = append(t.out[s][:i:i], t.out[s][i+1:]...)
+			t.count[e]--
+			return true
+		}
+	}
+	return false
+}
+
+// clone returns a copy of t that can be changed without changing t.
+func (t *table) clone() *table {
+	c := &table{
+		states:  append([]string(nil), t.states...),
+		stateID: make(map[string]int32, len(t.stateID)),
+		events:  append([]string(nil), t.events...),
+		eventID: make(map[string]int32, len(t.eventID)),
+		count:   append([]int32(nil), t.count...),
+		out:     make([][]edge, len(t.out)),
+	}
+	for name, id := range t.stateID {
+		c.stateID[name] = id
+	}
+	for name, id := range t.eventID {
+		c.eventID[name] = id
+	}
+	for s, edges := range t.out {
+		c.out[s] = append([]edge(nil), edges...)
+	}
+	return c
+}
+
+// find returns the destination state and the description of the transition
+// for event from src, and whether there is one.
+func (t *table) find(event, src string) (string, *EventDesc, bool) {
+	s, ok := t.stateID[src]
+	if !ok {
+		return "", nil, false
+	}
+	e, ok := t.eventID[event]
+	if !ok {
+		return "", nil, false
+	}
+	for _, edge := range t.out[s] {
+		if edge.event == e {
+			return t.states[edge.dst], edge.desc, true
+		}
+	}
+	return "", nil, false
+}
+
+// hasEvent returns true if event has a transition from any state.
+func (t *table) hasEvent(event string) bool {
+	e, ok := t.eventID[event]
+	return ok && t.count[e] > 0
+}
+
+// eventNames returns the events with a transition from any state.
+func (t *table) eventNames() []string {
+	events := make([]string, 0, len(t.events))
+	for e, name := range t.events {
+		if t.count[e] > 0 {
+			events = append(events, name)
+		}
+	}
+	return events
+}
+
+// from returns the events with a transition from src.
+func (t *table) from(src string) []string {
+	s, ok := t.stateID[src]
+	if !ok {
+		return nil
+	}
+	events := make([]string, 0, len(t.out[s]))
+	for _, edge := range t.out[s] {
+		events = append(events, t.events[edge.event])
+	}
+	return events
+}
+
+// each calls fn for each transition.
+func (t *table) each(fn func(event, src, dst string, desc *EventDesc)) {
+	for s, edges := range t.out {
+		for _, edge := range edges {
+			fn(t.events[edge.event], t.states[s], t.states[edge.dst], edge.desc)
+		}
+	}
+}
+
+// len returns the number of transitions.
+func (t *table) len() int {
+	n := 0
+	for _, edges := range t.out {
+		n += len(edges)
+	}
+	return n
+}
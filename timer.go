@@ -0,0 +1,355 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"context"
+	"time"
+)
+
+// CancelFunc cancels an event scheduled with EventAfter. It returns true if
+// the event was canceled, and false if it had already been fired or canceled.
+type CancelFunc func() bool
+
+// Schedule gives the times of a recurring event, see Recurring. It is
+// satisfied by the schedules of common cron packages, so that cron specs can
+// be used.
+type Schedule interface {
+	// Next returns the next time after t, or the zero time if there is none.
+	Next(t time.Time) time.Time
+}
+
+// Interval returns a Schedule recurring every d.
+func Interval(d time.Duration) Schedule {
+	return interval(d)
+}
+
+type interval time.Duration
+
+func (i interval) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(i))
+}
+
+// timeout is an event fired after some time in a state, once or repeatedly.
+type timeout struct {
+	schedule Schedule
+	repeat   bool
+	event    string
+	args     []interface{}
+}
+
+// stateTimer is a timer that fires an event unless the state it was started
+// in has been left.
+type stateTimer struct {
+	timer *time.Timer
+	epoch uint64
+
+	// state is the state of the timeout that started the timer, empty for
+	// EventAfter.
+	state string
+	event string
+
+	// repeat is the recurring event to schedule again once fired, if any.
+	repeat *timeout
+}
+
+// Timeout makes the FSM fire event, with args, when it has been in state for
+// d. The timer is started when the FSM enters state with an event, or right
+// away if it is in state when Timeout is called, and is stopped when the FSM
+// leaves state. A transition from state to itself does not restart it.
+//
+// The event is fired like with Event, except that it does not go through the
+// middleware added with Use, and its error is discarded. If it is rejected
+// because an asynchronous transition is in progress, it is fired once the
+// transition is done, unless it leaves state. Several timeouts can be added
+// for the same state. Each event must be valid in state, otherwise an
+// InvalidEventError is returned.
+//
+// Timeout must not be called from a callback.
+func (f *FSM) Timeout(state string, d time.Duration, event string, args ...interface{}) error {
+	f.eventMu.Lock()
+	defer f.eventMu.Unlock()
+
+	if _, _, ok := f.table.find(event, state); !ok {
+		return f.invalidEvent(event, state)
+	}
+	f.addTimeout(state, timeout{Interval(d), false, event, args})
+	return nil
+}
+
+// Recurring makes the FSM fire event, with args, at the times given by
+// schedule while it is in state. The schedule is started and stopped like the
+// timer of Timeout. Each time the event is fired and the FSM is still in state
+// afterwards, the next time is scheduled, so a transition from state to itself
+// can be used as a heartbeat:
+//
+//	f.Recurring("connected", fsm.Interval(10*time.Second), "heartbeat")
+//
+// The event is fired as for Timeout. The event must be valid in state,
+// otherwise an InvalidEventError is returned. A recurring event keeps the FSM
+// alive while it is in state: use RemoveTimeout or StopTimers once the FSM is
+// no longer used.
+//
+// Recurring must not be called from a callback.
+func (f *FSM) Recurring(state string, schedule Schedule, event string, args ...interface{}) error {
+	f.eventMu.Lock()
+	defer f.eventMu.Unlock()
+
+	if _, _, ok := f.table.find(event, state); !ok {
+		return f.invalidEvent(event, state)
+	}
+	f.addTimeout(state, timeout{schedule, true, event, args})
+	return nil
+}
+
+// addTimeout adds t to the timeouts of state, and starts it if the FSM is in
+// state.
+func (f *FSM) addTimeout(state string, t timeout) {
+	if f.timeouts == nil {
+		f.timeouts = make(map[string][]timeout)
+	}
+	f.timeouts[state] = append(f.timeouts[state], t)
+
+	f.stateMu.RLock()
+	current, epoch := f.current, f.epoch
+	f.stateMu.RUnlock()
+	if current == state {
+		f.startTimeout(state, epoch, t)
+	}
+}
+
+// RemoveTimeout removes the timeouts and recurring events of state firing
+// event, added with Timeout and Recurring, and stops their timers. It returns
+// false if there are none.
+//
+// RemoveTimeout must not be called from a callback.
+func (f *FSM) RemoveTimeout(state, event string) bool {
+	f.eventMu.Lock()
+	defer f.eventMu.Unlock()
+
+	var kept []timeout
+	for _, t := range f.timeouts[state] {
+		if t.event != event {
+			kept = append(kept, t)
+		}
+	}
+	if len(kept) == len(f.timeouts[state]) {
+		return false
+	}
+	if len(kept) == 0 {
+		delete(f.timeouts, state)
+	} else {
+		f.timeouts[state] = kept
+	}
+
+	match := func(t *stateTimer) bool {
+		return t.state == state && t.event == event
+	}
+	f.dropQueuedTimers(match)
+
+	f.timerMu.Lock()
+	defer f.timerMu.Unlock()
+	for t := range f.timers {
+		if match(t) {
+			t.timer.Stop()
+			delete(f.timers, t)
+		}
+	}
+	return true
+}
+
+// StopTimers stops the running timers of the FSM: those of the timeouts and
+// recurring events of the current state, and the events scheduled with
+// EventAfter. Timer events queued while an asynchronous transition is in
+// progress are dropped. The timeouts and recurring events of a state are
+// started again when the FSM next enters it with an event.
+//
+// Call StopTimers before dropping a FSM whose timers are running, as they
+// keep firing events and keep the FSM from being garbage collected. The
+// Manager stops the timers of the instances it removes.
+//
+// StopTimers must not be called from a callback.
+func (f *FSM) StopTimers() {
+	f.eventMu.Lock()
+	defer f.eventMu.Unlock()
+	f.dropQueuedTimers(func(t *stateTimer) bool { return true })
+	f.stopAllTimers()
+}
+
+// dropQueuedTimers removes the queued events of the timers matching match, so
+// that they are neither fired nor scheduled again.
+func (f *FSM) dropQueuedTimers(match func(t *stateTimer) bool) {
+	var kept []queuedEvent
+	for _, q := range f.queue {
+		if q.timer == nil || !match(q.timer) {
+			kept = append(kept, q)
+		}
+	}
+	f.queue = kept
+}
+
+// EventAfter schedules the event, with args, to be fired after d, unless the
+// FSM has left its current state by then. The event is fired as for Timeout.
+//
+// It returns a CancelFunc to cancel the event, or an InvalidEventError or an
+// UnknownEventError if the event can not occur in the current state. Unlike
+// Timeout, EventAfter can be called from callbacks. From enter_ and after_
+// callbacks the event is bound to the new state, from before_ and leave_
+// callbacks to the old one.
+func (f *FSM) EventAfter(d time.Duration, event string, args ...interface{}) (CancelFunc, error) {
+	f.stateMu.RLock()
+	current, epoch := f.current, f.epoch
+	if _, _, ok := f.table.find(event, current); !ok {
+		var err error = f.unknownEvent(event)
+		if f.table.hasEvent(event) {
+			err = f.invalidEvent(event, current)
+		}
+		f.stateMu.RUnlock()
+		return nil, err
+	}
+	f.stateMu.RUnlock()
+
+	t := f.schedule("", epoch, d, event, args, nil)
+	return func() bool {
+		return f.stop(t)
+	}, nil
+}
+
+// startTimeouts starts the timeouts of the current state.
+func (f *FSM) startTimeouts() {
+	f.stateMu.RLock()
+	current, epoch := f.current, f.epoch
+	f.stateMu.RUnlock()
+
+	for _, t := range f.timeouts[current] {
+		f.startTimeout(current, epoch, t)
+	}
+}
+
+// startTimeout schedules the next time of t, a timeout of state.
+func (f *FSM) startTimeout(state string, epoch uint64, t timeout) {
+	next := t.schedule.Next(time.Now())
+	if next.IsZero() {
+		return
+	}
+	var repeat *timeout
+	if t.repeat {
+		repeat = &t
+	}
+	f.schedule(state, epoch, time.Until(next), t.event, t.args, repeat)
+}
+
+// schedule starts a timer firing event after d, unless the state of epoch has
+// been left by then. The recurring event repeat, if any, is scheduled again
+// once fired. The state of the timeout starting the timer, if any, is state.
+func (f *FSM) schedule(state string, epoch uint64, d time.Duration, event string, args []interface{}, repeat *timeout) *stateTimer {
+	t := &stateTimer{epoch: epoch, state: state, event: event, repeat: repeat}
+
+	f.timerMu.Lock()
+	defer f.timerMu.Unlock()
+	if f.timers == nil {
+		f.timers = make(map[*stateTimer]struct{})
+	}
+	f.timers[t] = struct{}{}
+	t.timer = time.AfterFunc(d, func() {
+		f.fire(t, event, args)
+	})
+	return t
+}
+
+// fire fires the event of the timer t, if its state has not been left. If the
+// event is rejected because an asynchronous transition is in progress, it is
+// queued and fired once the transition is done, unless it leaves the state.
+// Other errors of the event are reported like those of any event, to the
+// Logger and Metrics of the FSM.
+func (f *FSM) fire(t *stateTimer, event string, args []interface{}) {
+	f.eventMu.Lock()
+	defer f.eventMu.Unlock()
+
+	f.timerMu.Lock()
+	_, running := f.timers[t]
+	delete(f.timers, t)
+	f.timerMu.Unlock()
+
+	if !running || f.left(t) {
+		return
+	}
+	err := f.dispatch(context.Background(), event, args)
+	if _, ok := err.(InTransitionError); ok && f.transition != nil {
+		f.enqueue(queuedEvent{ctx: context.Background(), event: event, args: args, time: time.Now(), timer: t})
+		return
+	}
+	f.rearm(t)
+}
+
+// left returns true if the FSM has left the state in which t was started.
+func (f *FSM) left(t *stateTimer) bool {
+	f.stateMu.RLock()
+	defer f.stateMu.RUnlock()
+	return f.epoch != t.epoch
+}
+
+// rearm schedules the recurring timer t again once it has fired, if its state
+// has not been left.
+func (f *FSM) rearm(t *stateTimer) {
+	if t.repeat != nil && !f.left(t) {
+		f.startTimeout(t.state, t.epoch, *t.repeat)
+	}
+}
+
+// stop stops the timer t, and returns whether it was running.
+func (f *FSM) stop(t *stateTimer) bool {
+	f.timerMu.Lock()
+	defer f.timerMu.Unlock()
+	if _, ok := f.timers[t]; !ok {
+		return false
+	}
+	delete(f.timers, t)
+	t.timer.Stop()
+	return true
+}
+
+// stopTimers stops the timers started in a state that has been left.
+func (f *FSM) stopTimers() {
+	f.stateMu.RLock()
+	epoch := f.epoch
+	f.stateMu.RUnlock()
+
+	f.timerMu.Lock()
+	defer f.timerMu.Unlock()
+	for t := range f.timers {
+		if t.epoch != epoch {
+			t.timer.Stop()
+			delete(f.timers, t)
+		}
+	}
+}
+
+// hasTimers returns true if timers of the FSM are running.
+func (f *FSM) hasTimers() bool {
+	f.timerMu.Lock()
+	defer f.timerMu.Unlock()
+	return len(f.timers) > 0
+}
+
+// stopAllTimers stops all the timers of the FSM, once it is no longer used.
+func (f *FSM) stopAllTimers() {
+	f.timerMu.Lock()
+	defer f.timerMu.Unlock()
+	for t := range f.timers {
+		t.timer.Stop()
+		delete(f.timers, t)
+	}
+}
@@ -0,0 +1,325 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"testing"
+	"time"
+)
+
+// waitFor waits up to a second for the FSM to be in state.
+func waitFor(f *FSM, state string) bool {
+	for i := 0; i < 1000; i++ {
+		if f.Current() == state {
+			return true
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return false
+}
+
+func newTimeoutFSM(entered chan<- string) *FSM {
+	return NewFSM(
+		"idle",
+		Events{
+			{EvtName: "start", SrcStates: []string{"idle"}, DstStates: "waiting"},
+			{EvtName: "poke", SrcStates: []string{"waiting"}, DstStates: "waiting"},
+			{EvtName: "reply", SrcStates: []string{"waiting"}, DstStates: "idle"},
+			{EvtName: "expire", SrcStates: []string{"waiting"}, DstStates: "expired"},
+		},
+		Callbacks{
+			"after_event": func(action string, e *Event) {
+				if entered != nil {
+					entered <- e.Dst + " " + e.Event
+				}
+			},
+		},
+	)
+}
+
+func TestTimeout(t *testing.T) {
+	fsm := newTimeoutFSM(nil)
+	if err := fsm.Timeout("waiting", 20*time.Millisecond, "expire"); err != nil {
+		t.Fatal(err)
+	}
+
+	fsm.Event("start")
+	time.Sleep(10 * time.Millisecond)
+	fsm.Event("poke")
+	if !waitFor(fsm, "expired") {
+		t.Error("expected the timeout to fire")
+	}
+}
+
+func TestTimeoutStoppedOnExit(t *testing.T) {
+	entered := make(chan string, 10)
+	fsm := newTimeoutFSM(entered)
+	fsm.Timeout("waiting", 20*time.Millisecond, "expire")
+
+	fsm.Event("start")
+	fsm.Event("reply")
+	fsm.Event("start")
+	time.Sleep(10 * time.Millisecond)
+	fsm.SetState("idle")
+	fsm.SetState("waiting")
+	time.Sleep(40 * time.Millisecond)
+
+	if fsm.Current() != "waiting" {
+		t.Errorf("expected the timers to be stopped, got %q", fsm.Current())
+	}
+	if len(entered) != 3 {
+		t.Errorf("expected no timed event, got %d transitions", len(entered))
+	}
+}
+
+func TestTimeoutCurrentState(t *testing.T) {
+	fsm := newTimeoutFSM(nil)
+	fsm.SetState("waiting")
+	fsm.Timeout("waiting", time.Millisecond, "expire")
+	if !waitFor(fsm, "expired") {
+		t.Error("expected the timeout to start in the current state")
+	}
+
+	if _, ok := fsm.Timeout("idle", time.Second, "expire").(InvalidEventError); !ok {
+		t.Error("expected InvalidEventError")
+	}
+}
+
+func TestTimeoutWhilePending(t *testing.T) {
+	fsm := NewFSM(
+		"waiting",
+		Events{
+			{EvtName: "reply", SrcStates: []string{"waiting"}, DstStates: "idle"},
+			{EvtName: "expire", SrcStates: []string{"waiting"}, DstStates: "expired"},
+		},
+		Callbacks{
+			"leave_waiting": func(action string, e *Event) {
+				if e.Event == "reply" {
+					e.Async()
+				}
+			},
+		},
+	)
+	fsm.Timeout("waiting", 10*time.Millisecond, "expire")
+
+	// The timeout fires while the reply is pending, and runs once it is
+	// canceled.
+	if _, ok := fsm.Event("reply").(AsyncError); !ok {
+		t.Fatal("expected AsyncError")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if fsm.Current() != "waiting" {
+		t.Fatal("expected the timeout to wait for the pending transition")
+	}
+	fsm.CancelTransition()
+	if fsm.Current() != "expired" {
+		t.Errorf("expected the timeout to fire after the cancel, got %s", fsm.Current())
+	}
+
+	// It is dropped if the pending transition leaves the state.
+	fsm.SetState("waiting")
+	if _, ok := fsm.Event("reply").(AsyncError); !ok {
+		t.Fatal("expected AsyncError")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if err := fsm.Transition(); err != nil {
+		t.Fatal(err)
+	}
+	if fsm.Current() != "idle" {
+		t.Errorf("expected the timeout to be dropped, got %s", fsm.Current())
+	}
+}
+
+func TestEventAfter(t *testing.T) {
+	fsm := newTimeoutFSM(nil)
+	fsm.Event("start")
+
+	if _, err := fsm.EventAfter(time.Millisecond, "expire"); err != nil {
+		t.Fatal(err)
+	}
+	if !waitFor(fsm, "expired") {
+		t.Error("expected the event to be fired")
+	}
+
+	if _, err := fsm.EventAfter(time.Millisecond, "reply"); err == nil {
+		t.Error("expected InvalidEventError")
+	} else if _, ok := err.(InvalidEventError); !ok {
+		t.Errorf("expected InvalidEventError, got %v", err)
+	}
+	if _, err := fsm.EventAfter(time.Millisecond, "jump"); err == nil {
+		t.Error("expected UnknownEventError")
+	}
+}
+
+func TestEventAfterCanceled(t *testing.T) {
+	entered := make(chan string, 10)
+	fsm := newTimeoutFSM(entered)
+	fsm.Event("start")
+
+	cancel, _ := fsm.EventAfter(10*time.Millisecond, "expire")
+	if !cancel() {
+		t.Error("expected the event to be canceled")
+	}
+	if cancel() {
+		t.Error("expected the second cancel to do nothing")
+	}
+
+	cancel, _ = fsm.EventAfter(10*time.Millisecond, "expire")
+	fsm.Event("reply")
+	fsm.Event("start")
+	time.Sleep(30 * time.Millisecond)
+	if fsm.Current() != "waiting" || len(entered) != 3 {
+		t.Errorf("expected the event to be canceled on leaving the state, got %q", fsm.Current())
+	}
+	if cancel() {
+		t.Error("expected the event to be already canceled")
+	}
+}
+
+func TestEventAfterFromCallback(t *testing.T) {
+	var err error
+	fsm := NewFSM(
+		"idle",
+		Events{
+			{EvtName: "start", SrcStates: []string{"idle"}, DstStates: "waiting"},
+			{EvtName: "expire", SrcStates: []string{"waiting"}, DstStates: "expired"},
+		},
+		Callbacks{
+			"enter_waiting": func(action string, e *Event) {
+				_, err = e.FSM.EventAfter(time.Millisecond, "expire")
+			},
+		},
+	)
+	fsm.Event("start")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !waitFor(fsm, "expired") {
+		t.Error("expected the event scheduled in enter_waiting to be fired")
+	}
+}
+
+// countdown is a Schedule recurring every millisecond, n times.
+type countdown struct {
+	n int
+}
+
+func (c *countdown) Next(t time.Time) time.Time {
+	if c.n == 0 {
+		return time.Time{}
+	}
+	c.n--
+	return t.Add(time.Millisecond)
+}
+
+func TestRecurring(t *testing.T) {
+	entered := make(chan string, 100)
+	fsm := newTimeoutFSM(entered)
+	if err := fsm.Recurring("waiting", Interval(2*time.Millisecond), "poke"); err != nil {
+		t.Fatal(err)
+	}
+
+	fsm.Event("start")
+	<-entered
+	for i := 0; i < 3; i++ {
+		if got := <-entered; got != "waiting poke" {
+			t.Fatalf("expected a heartbeat, got %q", got)
+		}
+	}
+	fsm.Event("reply")
+	for len(entered) > 0 {
+		<-entered
+	}
+	time.Sleep(10 * time.Millisecond)
+	if len(entered) != 0 {
+		t.Errorf("expected no heartbeat after leaving the state, got %d", len(entered))
+	}
+
+	if _, ok := fsm.Recurring("idle", Interval(time.Second), "poke").(InvalidEventError); !ok {
+		t.Error("expected InvalidEventError")
+	}
+}
+
+func TestRecurringSchedule(t *testing.T) {
+	entered := make(chan string, 100)
+	fsm := newTimeoutFSM(entered)
+	fsm.SetState("waiting")
+	fsm.Recurring("waiting", &countdown{2}, "poke")
+
+	time.Sleep(20 * time.Millisecond)
+	if len(entered) != 2 {
+		t.Errorf("expected two events, got %d", len(entered))
+	}
+}
+
+func TestStopTimers(t *testing.T) {
+	entered := make(chan string, 100)
+	fsm := newTimeoutFSM(entered)
+	fsm.Recurring("waiting", Interval(2*time.Millisecond), "poke")
+	fsm.Timeout("waiting", 5*time.Millisecond, "expire")
+
+	fsm.Event("start")
+	<-entered
+	if got := <-entered; got != "waiting poke" {
+		t.Fatalf("expected a heartbeat, got %q", got)
+	}
+	fsm.StopTimers()
+	for len(entered) > 0 {
+		<-entered
+	}
+	time.Sleep(20 * time.Millisecond)
+	if len(entered) != 0 || fsm.Current() != "waiting" {
+		t.Errorf("expected no event after StopTimers, got %d in state %s", len(entered), fsm.Current())
+	}
+
+	fsm.Event("reply")
+	fsm.Event("start")
+	<-entered
+	<-entered
+	if got := <-entered; got != "waiting poke" {
+		t.Errorf("expected the heartbeat restarted on entering the state, got %q", got)
+	}
+	fsm.StopTimers()
+}
+
+func TestRemoveTimeout(t *testing.T) {
+	entered := make(chan string, 100)
+	fsm := newTimeoutFSM(entered)
+	fsm.Recurring("waiting", Interval(2*time.Millisecond), "poke")
+
+	fsm.Event("start")
+	<-entered
+	<-entered
+	if !fsm.RemoveTimeout("waiting", "poke") {
+		t.Error("expected the recurring event to be removed")
+	}
+	for len(entered) > 0 {
+		<-entered
+	}
+	time.Sleep(10 * time.Millisecond)
+	if len(entered) != 0 {
+		t.Errorf("expected no heartbeat once removed, got %d", len(entered))
+	}
+
+	fsm.Event("reply")
+	fsm.Event("start")
+	time.Sleep(10 * time.Millisecond)
+	if len(entered) != 2 {
+		t.Errorf("expected no heartbeat on entering the state again, got %d events", len(entered))
+	}
+	if fsm.RemoveTimeout("waiting", "poke") {
+		t.Error("expected no recurring event left to remove")
+	}
+}
@@ -0,0 +1,228 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import "fmt"
+
+// TypedEventDesc represents an event when initializing a TypedFSM.
+type TypedEventDesc[S comparable, E comparable] struct {
+	// Event is the event used when calling for a transition.
+	Event E
+
+	// Src is a slice of source states that the FSM must be in to perform a
+	// state transition.
+	Src []S
+
+	// Dst is the destination state that the FSM will be in if the transition
+	// succeds.
+	Dst S
+
+	// Guards are conditions that must all hold for the transition to happen.
+	Guards []Guard
+}
+
+// TypedFSM is a state machine whose states and events are of user defined
+// types, typically enums, instead of strings.
+//
+// It wraps a FSM where every state and event is named by formatting its value
+// with fmt.Sprint, so types implementing fmt.Stringer get readable names. The
+// names are used for the callback keys, in Event and in errors.
+//
+// It has to be created with NewTypedFSM to function properly.
+type TypedFSM[S comparable, E comparable] struct {
+	fsm *FSM
+
+	// The names are only set by NewTypedFSM, so that they can be read
+	// concurrently without locking.
+	stateNames map[S]string
+	states     map[string]S
+	eventNames map[E]string
+	events     map[string]E
+}
+
+// NewTypedFSM constructs a TypedFSM from typed events and callbacks.
+//
+// The callbacks are keyed as for NewFSM, using the names of the states and
+// events. It returns a NameCollisionError if two different states or two
+// different events have the same name.
+func NewTypedFSM[S comparable, E comparable](initial S, events []TypedEventDesc[S, E], callbacks map[string]Callback) (*TypedFSM[S, E], error) {
+	f := &TypedFSM[S, E]{
+		stateNames: make(map[S]string),
+		states:     make(map[string]S),
+		eventNames: make(map[E]string),
+		events:     make(map[string]E),
+	}
+
+	if err := f.addState(initial); err != nil {
+		return nil, err
+	}
+
+	evts := make(Events, 0, len(events))
+	for _, e := range events {
+		if err := f.addEvent(e.Event); err != nil {
+			return nil, err
+		}
+		src := make([]string, 0, len(e.Src))
+		for _, s := range e.Src {
+			if err := f.addState(s); err != nil {
+				return nil, err
+			}
+			src = append(src, f.stateNames[s])
+		}
+		if err := f.addState(e.Dst); err != nil {
+			return nil, err
+		}
+		evts = append(evts, EventDesc{
+			EvtName:   f.eventNames[e.Event],
+			SrcStates: src,
+			DstStates: f.stateNames[e.Dst],
+			Guards:    e.Guards,
+		})
+	}
+
+	f.fsm = NewFSM(f.stateNames[initial], evts, callbacks)
+	return f, nil
+}
+
+// FSM returns the underlying string based FSM.
+func (f *TypedFSM[S, E]) FSM() *FSM {
+	return f.fsm
+}
+
+// Current returns the current state of the FSM.
+func (f *TypedFSM[S, E]) Current() S {
+	return f.states[f.fsm.Current()]
+}
+
+// Is returns true if state is the current state.
+func (f *TypedFSM[S, E]) Is(state S) bool {
+	name, ok := f.stateNames[state]
+	return ok && f.fsm.Is(name)
+}
+
+// IsAny returns true if the current state is one of states.
+func (f *TypedFSM[S, E]) IsAny(states ...S) bool {
+	current := f.fsm.Current()
+	for _, state := range states {
+		if name, ok := f.stateNames[state]; ok && name == current {
+			return true
+		}
+	}
+	return false
+}
+
+// IsNot returns true if the current state is none of states.
+func (f *TypedFSM[S, E]) IsNot(states ...S) bool {
+	return !f.IsAny(states...)
+}
+
+// SetState allows the user to move to the given state from current state.
+// The call does not trigger any callbacks, if defined.
+//
+// The state must be one of the states of the events given to NewTypedFSM,
+// otherwise the FSM is left unchanged and SetState returns a
+// NameCollisionError if the name of state is used by one of them, or an
+// UnknownStateError.
+func (f *TypedFSM[S, E]) SetState(state S) error {
+	name, ok := f.stateNames[state]
+	if !ok {
+		name = fmt.Sprint(state)
+		if _, ok := f.states[name]; ok {
+			return NameCollisionError{Kind: "state", Name: name}
+		}
+		return UnknownStateError{name}
+	}
+	f.fsm.SetState(name)
+	return nil
+}
+
+// Can returns true if event can occur in the current state.
+func (f *TypedFSM[S, E]) Can(event E) bool {
+	return f.fsm.Can(f.eventName(event))
+}
+
+// CanWithArgs returns true if event can occur in the current state with args
+// and its guards hold, see FSM.CanWithArgs.
+func (f *TypedFSM[S, E]) CanWithArgs(event E, args ...interface{}) bool {
+	return f.fsm.CanWithArgs(f.eventName(event), args...)
+}
+
+// Cannot returns true if event can not occure in the current state.
+func (f *TypedFSM[S, E]) Cannot(event E) bool {
+	return !f.Can(event)
+}
+
+// AvailableTransitions returns the events available in the current state,
+// sorted by name.
+func (f *TypedFSM[S, E]) AvailableTransitions() []E {
+	var events []E
+	for _, name := range f.fsm.AvailableTransitions() {
+		events = append(events, f.events[name])
+	}
+	return events
+}
+
+// Event initiates a state transition with the given event. See FSM.Event.
+func (f *TypedFSM[S, E]) Event(event E, args ...interface{}) error {
+	return f.fsm.Event(f.eventName(event), args...)
+}
+
+// Transition completes an asynchronous state change. See FSM.Transition.
+func (f *TypedFSM[S, E]) Transition() error {
+	return f.fsm.Transition()
+}
+
+// State returns the typed state with the given name, as found in Event.Src
+// and Event.Dst in callbacks.
+func (f *TypedFSM[S, E]) State(name string) S {
+	return f.states[name]
+}
+
+// addState names state, checking that the name is not used by another state.
+func (f *TypedFSM[S, E]) addState(state S) error {
+	if _, ok := f.stateNames[state]; ok {
+		return nil
+	}
+	name := fmt.Sprint(state)
+	if _, ok := f.states[name]; ok {
+		return NameCollisionError{Kind: "state", Name: name}
+	}
+	f.stateNames[state] = name
+	f.states[name] = state
+	return nil
+}
+
+// addEvent names event, checking that the name is not used by another event.
+func (f *TypedFSM[S, E]) addEvent(event E) error {
+	if _, ok := f.eventNames[event]; ok {
+		return nil
+	}
+	name := fmt.Sprint(event)
+	if _, ok := f.events[name]; ok {
+		return NameCollisionError{Kind: "event", Name: name}
+	}
+	f.eventNames[event] = name
+	f.events[name] = event
+	return nil
+}
+
+// eventName returns the name of event, which may not be part of the
+// definition.
+func (f *TypedFSM[S, E]) eventName(event E) string {
+	if name, ok := f.eventNames[event]; ok {
+		return name
+	}
+	return fmt.Sprint(event)
+}
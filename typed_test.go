@@ -0,0 +1,158 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import (
+	"fmt"
+	"testing"
+)
+
+type doorState int
+
+const (
+	doorClosed doorState = iota
+	doorOpen
+	doorBroken
+)
+
+func (s doorState) String() string {
+	return [...]string{"closed", "open", "broken", "missing"}[s]
+}
+
+type doorEvent string
+
+const (
+	doorOpenEvent  doorEvent = "open"
+	doorCloseEvent doorEvent = "close"
+	doorKickEvent  doorEvent = "kick"
+)
+
+func TestTypedFSM(t *testing.T) {
+	var entered doorState
+
+	var fsm *TypedFSM[doorState, doorEvent]
+	fsm, err := NewTypedFSM(
+		doorClosed,
+		[]TypedEventDesc[doorState, doorEvent]{
+			{Event: doorOpenEvent, Src: []doorState{doorClosed}, Dst: doorOpen},
+			{Event: doorCloseEvent, Src: []doorState{doorOpen}, Dst: doorClosed},
+			{Event: doorKickEvent, Src: []doorState{doorClosed, doorOpen}, Dst: doorBroken},
+		},
+		Callbacks{
+			"enter_state": func(action string, e *Event) {
+				entered = fsm.State(e.Dst)
+			},
+		},
+	)
+	if err != nil {
+		t.Fatal("expected no error")
+	}
+
+	if fsm.Current() != doorClosed || !fsm.Is(doorClosed) {
+		t.Error("expected state to be 'closed'")
+	}
+	if !fsm.IsAny(doorOpen, doorClosed) || fsm.IsNot(doorClosed, doorBroken) {
+		t.Error("expected state to be one of 'open' and 'closed'")
+	}
+	if fmt.Sprint(fsm.AvailableTransitions()) != "[kick open]" {
+		t.Error("expected 'kick' and 'open' to be available")
+	}
+	if !fsm.Can(doorOpenEvent) || !fsm.Cannot(doorCloseEvent) {
+		t.Error("expected only 'open' to be possible")
+	}
+
+	if err := fsm.Event(doorOpenEvent); err != nil {
+		t.Error("expected no error")
+	}
+	if fsm.Current() != doorOpen || entered != doorOpen {
+		t.Error("expected state to be 'open'")
+	}
+
+	if _, ok := fsm.Event(doorOpenEvent).(InvalidEventError); !ok {
+		t.Error("expected 'InvalidEventError'")
+	}
+
+	if err := fsm.SetState(doorBroken); err != nil {
+		t.Fatal(err)
+	}
+	if fsm.Current() != doorBroken || fsm.FSM().Current() != "broken" {
+		t.Error("expected state to be 'broken'")
+	}
+	if _, ok := fsm.SetState(doorState(3)).(UnknownStateError); !ok {
+		t.Error("expected 'UnknownStateError'")
+	}
+}
+
+type badState int
+
+func (s badState) String() string {
+	return "same"
+}
+
+func TestTypedFSMNameCollision(t *testing.T) {
+	_, err := NewTypedFSM(
+		badState(0),
+		[]TypedEventDesc[badState, string]{
+			{Event: "run", Src: []badState{0}, Dst: 1},
+		},
+		Callbacks{},
+	)
+	if e, ok := err.(NameCollisionError); !ok || e.Kind != "state" || e.Name != "same" {
+		t.Error("expected 'NameCollisionError'")
+	}
+
+	fsm, err := NewTypedFSM(
+		badState(0),
+		[]TypedEventDesc[badState, string]{
+			{Event: "run", Src: []badState{0}, Dst: 0},
+		},
+		Callbacks{},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, ok := fsm.SetState(badState(1)).(NameCollisionError); !ok || e.Name != "same" {
+		t.Error("expected 'NameCollisionError'")
+	}
+	if fsm.Current() != badState(0) {
+		t.Error("expected the state to be unchanged")
+	}
+}
+
+func TestTypedFSMConcurrentSetState(t *testing.T) {
+	fsm, err := NewTypedFSM(
+		doorClosed,
+		[]TypedEventDesc[doorState, doorEvent]{
+			{Event: doorOpenEvent, Src: []doorState{doorClosed}, Dst: doorOpen},
+		},
+		Callbacks{},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			fsm.SetState(doorState(i % 4))
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		fsm.IsAny(doorOpen, doorBroken)
+		fsm.Current()
+	}
+	<-done
+}
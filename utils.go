@@ -3,9 +3,15 @@ package fsm
 import (
 	"bytes"
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
 )
 
 // Visualize outputs a visualization of a FSM in Graphviz format.
+//
+// The output is stable: transitions and states are written in sorted order,
+// with the transitions from the current state first.
 func Visualize(fsm *FSM) string {
 	var buf bytes.Buffer
 
@@ -14,28 +20,40 @@ func Visualize(fsm *FSM) string {
 	buf.WriteString(fmt.Sprintf(`digraph fsm {`))
 	buf.WriteString("\n")
 
+	keys := fsm.sortedTransitionKeys()
+
 	// make sure the initial state is at top
-	for k, v := range fsm.transitions {
+	for _, k := range keys {
 		if k.src == fsm.current {
-			states[k.src]++
-			states[v]++
-			buf.WriteString(fmt.Sprintf(`    "%s" -> "%s" [ label = "%s" ];`, k.src, v, k.event))
-			buf.WriteString("\n")
+			for _, v := range fsm.dsts(k) {
+				states[k.src]++
+				states[v]++
+				buf.WriteString(fmt.Sprintf(`    "%s" -> "%s" [ label = "%s" ];`, k.src, v, k.event))
+				buf.WriteString("\n")
+			}
 		}
 	}
 
-	for k, v := range fsm.transitions {
+	for _, k := range keys {
 		if k.src != fsm.current {
-			states[k.src]++
-			states[v]++
-			buf.WriteString(fmt.Sprintf(`    "%s" -> "%s" [ label = "%s" ];`, k.src, v, k.event))
-			buf.WriteString("\n")
+			for _, v := range fsm.dsts(k) {
+				states[k.src]++
+				states[v]++
+				buf.WriteString(fmt.Sprintf(`    "%s" -> "%s" [ label = "%s" ];`, k.src, v, k.event))
+				buf.WriteString("\n")
+			}
 		}
 	}
 
 	buf.WriteString("\n")
 
+	sortedStates := make([]string, 0, len(states))
 	for k := range states {
+		sortedStates = append(sortedStates, k)
+	}
+	sort.Strings(sortedStates)
+
+	for _, k := range sortedStates {
 		buf.WriteString(fmt.Sprintf(`    "%s";`, k))
 		buf.WriteString("\n")
 	}
@@ -43,3 +61,218 @@ func Visualize(fsm *FSM) string {
 
 	return buf.String()
 }
+
+// DiagramOption configures the output of ToDOT and ToMermaid.
+type DiagramOption func(*diagram)
+
+// diagram holds the options of a diagram.
+type diagram struct {
+	current string
+	last    string
+}
+
+func newDiagram(opts []DiagramOption) *diagram {
+	d := &diagram{current: "lightgrey"}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
+}
+
+// HighlightCurrent fills the current state with color instead of light grey,
+// or does not fill it if color is empty.
+func HighlightCurrent(color string) DiagramOption {
+	return func(d *diagram) {
+		d.current = color
+	}
+}
+
+// HighlightLast colors the last transition taken, the most recent transition
+// committed since the state was last set with SetState or Restore.
+func HighlightLast(color string) DiagramOption {
+	return func(d *diagram) {
+		d.last = color
+	}
+}
+
+// ToDOT outputs the complete transition graph of the FSM in Graphviz format,
+// with the events as edge labels and the current state filled in grey. The
+// highlighting can be changed with HighlightCurrent and HighlightLast, so that
+// dashboards can show where an instance is and how it got there.
+//
+// Unlike Visualize, every state is written even if it has no transitions, and
+// names are quoted so that the output can be read back with ImportDOT. The
+// descriptions of events and states given in EventDesc and WithStates are
+// written as tooltips, and their tags as classes.
+func (f *FSM) ToDOT(opts ...DiagramOption) string {
+	f.stateMu.RLock()
+	defer f.stateMu.RUnlock()
+
+	d := newDiagram(opts)
+
+	var buf bytes.Buffer
+
+	buf.WriteString("digraph fsm {\n")
+
+	for _, k := range f.sortedTransitionKeys() {
+		_, desc, _ := f.table.find(k.event, k.src)
+		for _, dst := range f.dsts(k) {
+			var color string
+			if d.last != "" && f.last == (Edge{k.event, k.src, dst}) {
+				color = ", color = " + dotQuote(d.last) + ", fontcolor = " + dotQuote(d.last)
+			}
+			buf.WriteString(fmt.Sprintf(`    %s -> %s [ label = %s%s%s ];`,
+				dotQuote(k.src), dotQuote(dst), dotQuote(k.event), color, dotDoc(desc.Description, desc.Tags)))
+			buf.WriteString("\n")
+		}
+	}
+
+	buf.WriteString("\n")
+
+	for _, k := range f.sortedStates() {
+		var doc string
+		if s, ok := f.stateDescs[k]; ok {
+			doc = dotDoc(s.Description, s.Tags)
+		}
+		switch {
+		case k == f.current && d.current != "":
+			buf.WriteString(fmt.Sprintf(`    %s [ style = "filled", fillcolor = %s%s ];`, dotQuote(k), dotQuote(d.current), doc))
+		case doc != "":
+			buf.WriteString(fmt.Sprintf(`    %s [ %s ];`, dotQuote(k), doc[2:]))
+		default:
+			buf.WriteString(fmt.Sprintf(`    %s;`, dotQuote(k)))
+		}
+		buf.WriteString("\n")
+	}
+	buf.WriteString("}\n")
+
+	return buf.String()
+}
+
+// dotDoc returns the tooltip and class attributes for description and tags,
+// each preceded by ", ", or the empty string if there are none.
+func dotDoc(description string, tags []string) string {
+	var doc string
+	if description != "" {
+		doc += ", tooltip = " + dotQuote(description)
+	}
+	if len(tags) > 0 {
+		doc += ", class = " + dotQuote(strings.Join(tags, " "))
+	}
+	return doc
+}
+
+// dotQuote returns s as a double quoted Graphviz ID.
+func dotQuote(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
+
+// ToMermaid outputs the complete transition graph of the FSM as a Mermaid state
+// diagram, with the events as transition labels and the current state filled
+// in grey. The descriptions of states given to WithStates are written as
+// notes.
+//
+// The highlighting can be changed as for ToDOT. As Mermaid state diagrams can
+// not style transitions, HighlightLast fills the source state of the last
+// transition instead.
+func (f *FSM) ToMermaid(opts ...DiagramOption) string {
+	f.stateMu.RLock()
+	defer f.stateMu.RUnlock()
+
+	d := newDiagram(opts)
+
+	var buf bytes.Buffer
+
+	buf.WriteString("stateDiagram-v2\n")
+
+	ids := make(map[string]string)
+	for i, k := range f.sortedStates() {
+		ids[k] = "s" + strconv.Itoa(i)
+		buf.WriteString(fmt.Sprintf("    state %s as %s\n", mermaidQuote(k), ids[k]))
+	}
+	for _, k := range f.sortedTransitionKeys() {
+		for _, dst := range f.dsts(k) {
+			buf.WriteString(fmt.Sprintf("    %s --> %s: %s\n",
+				ids[k.src], ids[dst], mermaidEscape(k.event)))
+		}
+	}
+	for _, k := range f.sortedStates() {
+		if s, ok := f.stateDescs[k]; ok && s.Description != "" {
+			buf.WriteString(fmt.Sprintf("    note right of %s: %s\n", ids[k], mermaidEscape(s.Description)))
+		}
+	}
+	if _, _, ok := f.table.find(f.last.Event, f.last.Src); ok && d.last != "" && f.last.Src != f.current {
+		id := ids[f.last.Src]
+		buf.WriteString("    classDef last fill:" + d.last + "\n")
+		buf.WriteString("    class " + id + " last\n")
+	}
+	if id, ok := ids[f.current]; ok && d.current != "" {
+		buf.WriteString("    classDef current fill:" + d.current + "\n")
+		buf.WriteString("    class " + id + " current\n")
+	}
+
+	return buf.String()
+}
+
+// mermaidQuote returns s as a double quoted Mermaid description.
+func mermaidQuote(s string) string {
+	return `"` + mermaidEscape(s) + `"`
+}
+
+// mermaidEscape escapes the characters of s that end Mermaid labels.
+func mermaidEscape(s string) string {
+	return strings.NewReplacer(`"`, "#quot;", "\n", " ", ";", "#59;").Replace(s)
+}
+
+// StateDistribution counts how many of the machines are currently in each
+// state.
+func StateDistribution(machines []*FSM) map[string]int {
+	counts := make(map[string]int)
+	for _, m := range machines {
+		counts[m.Current()]++
+	}
+	return counts
+}
+
+// VisualizeHeatmap outputs a visualization of a FSM in Graphviz format where
+// each state is labeled with, sized by and colored by the number of machines
+// in that state, as given by counts. This is typically the result of
+// StateDistribution for a fleet of machines sharing the same definition, or of
+// Manager.StateDistribution, see Manager.Heatmap.
+//
+// States without machines are white, the most occupied state is red.
+func VisualizeHeatmap(fsm *FSM, counts map[string]int) string {
+	var buf bytes.Buffer
+
+	max := 0
+	for _, n := range counts {
+		if n > max {
+			max = n
+		}
+	}
+
+	buf.WriteString(fmt.Sprintf(`digraph fsm {`))
+	buf.WriteString("\n")
+
+	for _, k := range fsm.sortedTransitionKeys() {
+		for _, dst := range fsm.dsts(k) {
+			buf.WriteString(fmt.Sprintf(`    "%s" -> "%s" [ label = "%s" ];`, k.src, dst, k.event))
+			buf.WriteString("\n")
+		}
+	}
+
+	buf.WriteString("\n")
+
+	for _, k := range fsm.sortedStates() {
+		ratio := 0.0
+		if max > 0 {
+			ratio = float64(counts[k]) / float64(max)
+		}
+		buf.WriteString(fmt.Sprintf(`    "%s" [ label = "%s\n%d", style = "filled", fillcolor = "0.000 %.3f 1.000", width = %.2f ];`,
+			k, k, counts[k], ratio, 0.75+ratio))
+		buf.WriteString("\n")
+	}
+	buf.WriteString(fmt.Sprintln("}"))
+
+	return buf.String()
+}
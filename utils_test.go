@@ -0,0 +1,222 @@
+package fsm
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVisualize(t *testing.T) {
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{EvtName: "open", SrcStates: []string{"closed"}, DstStates: "open"},
+			{EvtName: "close", SrcStates: []string{"open"}, DstStates: "closed"},
+			{EvtName: "kick", SrcStates: []string{"closed", "open"}, DstStates: "broken"},
+			{EvtName: "fix", SrcStates: []string{"broken"}, DstStates: "closed"},
+		},
+		Callbacks{},
+	)
+
+	expected := `digraph fsm {
+    "closed" -> "broken" [ label = "kick" ];
+    "closed" -> "open" [ label = "open" ];
+    "broken" -> "closed" [ label = "fix" ];
+    "open" -> "closed" [ label = "close" ];
+    "open" -> "broken" [ label = "kick" ];
+
+    "broken";
+    "closed";
+    "open";
+}
+`
+	for i := 0; i < 20; i++ {
+		if got := Visualize(fsm); got != expected {
+			t.Fatalf("unexpected output:\n%s", got)
+		}
+	}
+}
+
+func TestToDOT(t *testing.T) {
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{EvtName: "open", SrcStates: []string{"closed"}, DstStates: "open"},
+			{EvtName: "close", SrcStates: []string{"open"}, DstStates: "closed"},
+			{EvtName: "say \"hi\"", SrcStates: []string{"open"}, DstStates: "open"},
+		},
+		Callbacks{},
+	)
+	fsm.Event("open")
+
+	expected := `digraph fsm {
+    "closed" -> "open" [ label = "open" ];
+    "open" -> "closed" [ label = "close" ];
+    "open" -> "open" [ label = "say \"hi\"" ];
+
+    "closed";
+    "open" [ style = "filled", fillcolor = "lightgrey" ];
+}
+`
+	if got := fsm.ToDOT(); got != expected {
+		t.Errorf("unexpected output:\n%s", got)
+	}
+
+	initial, events, err := ImportDOT(strings.NewReader(fsm.ToDOT()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if initial != "closed" || len(events) != 3 || events[2].EvtName != `say "hi"` {
+		t.Errorf("expected the graph to be read back, got %q %v", initial, events)
+	}
+}
+
+func TestToMermaid(t *testing.T) {
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{EvtName: "open", SrcStates: []string{"closed"}, DstStates: "open"},
+			{EvtName: "close", SrcStates: []string{"open"}, DstStates: "closed"},
+			{EvtName: "say \"hi\"", SrcStates: []string{"open"}, DstStates: "open"},
+		},
+		Callbacks{},
+	)
+	fsm.Event("open")
+
+	expected := `stateDiagram-v2
+    state "closed" as s0
+    state "open" as s1
+    s0 --> s1: open
+    s1 --> s0: close
+    s1 --> s1: say #quot;hi#quot;
+    classDef current fill:lightgrey
+    class s1 current
+`
+	if got := fsm.ToMermaid(); got != expected {
+		t.Errorf("unexpected output:\n%s", got)
+	}
+}
+
+func TestDiagramHighlight(t *testing.T) {
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{EvtName: "open", SrcStates: []string{"closed"}, DstStates: "open"},
+			{EvtName: "close", SrcStates: []string{"open"}, DstStates: "closed"},
+		},
+		Callbacks{},
+	)
+	if got := fsm.ToDOT(HighlightLast("red")); strings.Contains(got, "red") {
+		t.Errorf("expected no transition to be highlighted before the first one:\n%s", got)
+	}
+	fsm.Event("open")
+
+	expected := `digraph fsm {
+    "closed" -> "open" [ label = "open", color = "red", fontcolor = "red" ];
+    "open" -> "closed" [ label = "close" ];
+
+    "closed";
+    "open" [ style = "filled", fillcolor = "green" ];
+}
+`
+	got := fsm.ToDOT(HighlightCurrent("green"), HighlightLast("red"))
+	if got != expected {
+		t.Errorf("unexpected output:\n%s", got)
+	}
+	if _, events, err := ImportDOT(strings.NewReader(got)); err != nil || len(events) != 2 {
+		t.Error("expected the diagram to be imported, got", err)
+	}
+
+	expected = `stateDiagram-v2
+    state "closed" as s0
+    state "open" as s1
+    s0 --> s1: open
+    s1 --> s0: close
+    classDef last fill:red
+    class s0 last
+`
+	if got := fsm.ToMermaid(HighlightCurrent(""), HighlightLast("red")); got != expected {
+		t.Errorf("unexpected output:\n%s", got)
+	}
+
+	fsm.SetState("closed")
+	if got := fsm.ToDOT(HighlightLast("red")); strings.Contains(got, "red") {
+		t.Errorf("expected no transition to be highlighted after SetState:\n%s", got)
+	}
+}
+
+func TestDiagramDocs(t *testing.T) {
+	fsm := NewFSM(
+		"closed",
+		Events{
+			{EvtName: "open", SrcStates: []string{"closed"}, DstStates: "open",
+				Description: "open the door", Tags: []string{"manual", "safe"}},
+			{EvtName: "close", SrcStates: []string{"open"}, DstStates: "closed"},
+		},
+		Callbacks{},
+		WithStates(States{
+			{Name: "closed", Description: "the door is closed"},
+			{Name: "open", Tags: []string{"unsafe"}},
+		}),
+	)
+
+	expected := `digraph fsm {
+    "closed" -> "open" [ label = "open", tooltip = "open the door", class = "manual safe" ];
+    "open" -> "closed" [ label = "close" ];
+
+    "closed" [ style = "filled", fillcolor = "lightgrey", tooltip = "the door is closed" ];
+    "open" [ class = "unsafe" ];
+}
+`
+	if got := fsm.ToDOT(); got != expected {
+		t.Errorf("unexpected output:\n%s", got)
+	}
+	if _, events, err := ImportDOT(strings.NewReader(fsm.ToDOT())); err != nil || len(events) != 2 {
+		t.Error("expected the diagram to be imported, got", err)
+	}
+
+	if got := fsm.ToMermaid(); !strings.Contains(got, "note right of s0: the door is closed\n") {
+		t.Errorf("unexpected output:\n%s", got)
+	}
+
+	fsm.Event("open")
+	err := fsm.Event("open")
+	if e, ok := err.(InvalidEventError); !ok || e.Description != "open the door" {
+		t.Error("expected 'InvalidEventError' with the event description")
+	}
+}
+
+func TestVisualizeHeatmap(t *testing.T) {
+	newDoor := func(state string) *FSM {
+		fsm := NewFSM(
+			"closed",
+			Events{
+				{EvtName: "open", SrcStates: []string{"closed"}, DstStates: "open"},
+				{EvtName: "close", SrcStates: []string{"open"}, DstStates: "closed"},
+				{EvtName: "kick", SrcStates: []string{"closed"}, DstStates: "broken"},
+			},
+			Callbacks{},
+		)
+		fsm.SetState(state)
+		return fsm
+	}
+	doors := []*FSM{newDoor("closed"), newDoor("open"), newDoor("closed"), newDoor("closed"), newDoor("open")}
+
+	counts := StateDistribution(doors)
+	if len(counts) != 2 || counts["closed"] != 3 || counts["open"] != 2 {
+		t.Errorf("unexpected distribution %v", counts)
+	}
+
+	expected := `digraph fsm {
+    "closed" -> "broken" [ label = "kick" ];
+    "closed" -> "open" [ label = "open" ];
+    "open" -> "closed" [ label = "close" ];
+
+    "broken" [ label = "broken\n0", style = "filled", fillcolor = "0.000 0.000 1.000", width = 0.75 ];
+    "closed" [ label = "closed\n3", style = "filled", fillcolor = "0.000 1.000 1.000", width = 1.75 ];
+    "open" [ label = "open\n2", style = "filled", fillcolor = "0.000 0.667 1.000", width = 1.42 ];
+}
+`
+	if got := VisualizeHeatmap(doors[0], counts); got != expected {
+		t.Errorf("unexpected output:\n%s", got)
+	}
+}
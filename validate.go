@@ -0,0 +1,157 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import "sort"
+
+// IssueKind is the kind of an Issue found by Events.Validate.
+type IssueKind int
+
+const (
+	// IssueUnknownDestination is a destination state that is never a source
+	// state, so the FSM can not leave it. It may be intended for final states.
+	IssueUnknownDestination IssueKind = iota
+
+	// IssueEmptySources is an event without source states, which can never
+	// occur.
+	IssueEmptySources
+
+	// IssueDuplicateTransition is an event defined twice from the same source
+	// state, of which NewFSM silently uses the last one.
+	IssueDuplicateTransition
+
+	// IssueUnknownCallback is a callback for a state or event that is not
+	// defined, which NewFSM silently ignores.
+	IssueUnknownCallback
+)
+
+func (k IssueKind) String() string {
+	switch k {
+	case IssueUnknownDestination:
+		return "unknown destination"
+	case IssueEmptySources:
+		return "empty sources"
+	case IssueDuplicateTransition:
+		return "duplicate transition"
+	case IssueUnknownCallback:
+		return "unknown callback"
+	}
+	return "unknown issue"
+}
+
+// Issue is a problem in the definition of a FSM, found by Events.Validate.
+type Issue struct {
+	Kind IssueKind
+
+	// Index is the index of the event description with the issue, or -1 for
+	// callbacks.
+	Index int
+
+	// Event and State are the event and state with the issue, if any.
+	Event string
+	State string
+
+	// Callback is the key of the callback with the issue, if any.
+	Callback string
+
+	// Msg describes the issue.
+	Msg string
+}
+
+func (i Issue) String() string {
+	return i.Kind.String() + ": " + i.Msg
+}
+
+// Validate checks the definition of a FSM with events and callbacks, and
+// returns the issues found, nil if there are none. The issues of the events
+// come first, in the order of the events, followed by those of the callbacks,
+// sorted by key.
+//
+// Unlike NewFSMStrict, which only refuses duplicate transitions, Validate
+// reports every issue at once, so that definitions can be checked in tests.
+func (events Events) Validate(callbacks Callbacks) []Issue {
+	var issues []Issue
+
+	allEvents := make(map[string]bool)
+	allStates := make(map[string]bool)
+	sources := make(map[string]bool)
+	for _, e := range events {
+		allEvents[e.EvtName] = true
+		for _, dst := range e.destinations() {
+			allStates[dst] = true
+		}
+		for _, src := range e.SrcStates {
+			allStates[src] = true
+			sources[src] = true
+		}
+	}
+
+	defined := make(map[eKey]int)
+	reported := make(map[string]bool)
+	for i, e := range events {
+		if len(e.SrcStates) == 0 {
+			issues = append(issues, Issue{
+				Kind:  IssueEmptySources,
+				Index: i,
+				Event: e.EvtName,
+				Msg:   "event " + e.EvtName + " has no source states",
+			})
+		}
+		for _, src := range e.SrcStates {
+			key := eKey{e.EvtName, src}
+			if j, ok := defined[key]; ok && j != i {
+				err := DuplicateTransitionError{e.EvtName, src, j, i, events[j].DstStates, e.DstStates}
+				issues = append(issues, Issue{
+					Kind:  IssueDuplicateTransition,
+					Index: i,
+					Event: e.EvtName,
+					State: src,
+					Msg:   err.Error(),
+				})
+			}
+			defined[key] = i
+		}
+		for _, dst := range e.destinations() {
+			if !sources[dst] && !reported[dst] {
+				reported[dst] = true
+				issues = append(issues, Issue{
+					Kind:  IssueUnknownDestination,
+					Index: i,
+					Event: e.EvtName,
+					State: dst,
+					Msg:   "state " + dst + " is never a source state",
+				})
+			}
+		}
+	}
+
+	names := make([]string, 0, len(callbacks))
+	for name := range callbacks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if target, callbackType, _ := parseCallback(name, allEvents, allStates); callbackType == callbackNone {
+			issues = append(issues, Issue{
+				Kind:     IssueUnknownCallback,
+				Index:    -1,
+				Callback: name,
+				Msg:      "callback " + name + " for unknown state or event " + target,
+			})
+		}
+	}
+
+	return issues
+}
@@ -0,0 +1,70 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsm
+
+import "testing"
+
+func TestValidate(t *testing.T) {
+	events := Events{
+		{EvtName: "open", SrcStates: []string{"closed"}, DstStates: "open"},
+		{EvtName: "close", SrcStates: []string{"open"}, DstStates: "closed"},
+		{EvtName: "break", SrcStates: []string{"open", "closed"}, DstStates: "broken"},
+		{EvtName: "repair", DstStates: "closed"},
+		{EvtName: "open", SrcStates: []string{"closed"}, DstStates: "ajar"},
+	}
+	callbacks := Callbacks{
+		"enter_open":   func(_ string, e *Event) {},
+		"enter_opened": func(_ string, e *Event) {},
+		"before_kick":  func(_ string, e *Event) {},
+		"broken":       func(_ string, e *Event) {},
+		"ajar":         func(_ string, e *Event) {},
+		"after_event":  func(_ string, e *Event) {},
+	}
+
+	expected := []string{
+		"unknown destination: state broken is never a source state",
+		"empty sources: event repair has no source states",
+		"duplicate transition: event open from state closed defined twice: events[0] to open and events[4] to ajar",
+		"unknown destination: state ajar is never a source state",
+		"unknown callback: callback before_kick for unknown state or event kick",
+		"unknown callback: callback enter_opened for unknown state or event opened",
+	}
+	issues := events.Validate(callbacks)
+	if len(issues) != len(expected) {
+		t.Fatalf("expected %d issues, got %v", len(expected), issues)
+	}
+	for i, issue := range issues {
+		if issue.String() != expected[i] {
+			t.Errorf("expected %q, got %q", expected[i], issue)
+		}
+	}
+
+	if i := issues[2]; i.Kind != IssueDuplicateTransition || i.Index != 4 || i.Event != "open" || i.State != "closed" {
+		t.Errorf("unexpected issue fields %+v", i)
+	}
+	if i := issues[4]; i.Index != -1 || i.Callback != "before_kick" {
+		t.Errorf("unexpected issue fields %+v", i)
+	}
+}
+
+func TestValidateNone(t *testing.T) {
+	events := Events{
+		{EvtName: "open", SrcStates: []string{"closed"}, DstStates: "open"},
+		{EvtName: "close", SrcStates: []string{"open"}, DstStates: "closed"},
+	}
+	if issues := events.Validate(Callbacks{"open": func(_ string, e *Event) {}}); issues != nil {
+		t.Errorf("expected no issues, got %v", issues)
+	}
+}
@@ -0,0 +1,237 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package webhook posts the transitions of a FSM to HTTP endpoints, for
+// integrating state changes with external systems.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/papiguy/fsm"
+)
+
+// Default values of a Notifier.
+const (
+	DefaultRetries = 3
+	DefaultBackoff = time.Second
+)
+
+// Hook is an endpoint that is posted the transitions it matches. Empty fields
+// match any transition.
+type Hook struct {
+	// URL is the endpoint the payloads are posted to.
+	URL string
+
+	// Event is the event of the transitions to post.
+	Event string
+
+	// Src is the source state of the transitions to post.
+	Src string
+
+	// Dst is the destination state of the transitions to post.
+	Dst string
+}
+
+// match returns true if p is a transition h should be posted.
+func (h Hook) match(p Payload) bool {
+	return (h.Event == "" || h.Event == p.Event) &&
+		(h.Src == "" || h.Src == p.Src) &&
+		(h.Dst == "" || h.Dst == p.Dst)
+}
+
+// Payload is the body posted for a transition, encoded by the Codec of the
+// Notifier.
+type Payload struct {
+	// ID is the ID of the Notifier, identifying the FSM.
+	ID string `json:"id,omitempty"`
+
+	// Event is the event name.
+	Event string `json:"event"`
+
+	// Src is the state before the transition.
+	Src string `json:"src"`
+
+	// Dst is the state after the transition.
+	Dst string `json:"dst"`
+
+	// Time is when the transition was committed.
+	Time time.Time `json:"time"`
+}
+
+// StatusError is the error of a post that got an unsuccessful status code.
+type StatusError struct {
+	URL        string
+	StatusCode int
+}
+
+func (e StatusError) Error() string {
+	return fmt.Sprintf("webhook %s: status %d", e.URL, e.StatusCode)
+}
+
+// QueueFullError is the error of a transition dropped because the queue of
+// the Notifier is full.
+type QueueFullError struct{}
+
+func (e QueueFullError) Error() string {
+	return "webhook queue full"
+}
+
+// Notifier posts transitions to hooks. It is a fsm.Observer, added to a FSM
+// with AddObserver, that queues the transitions, and Run posts them.
+//
+// Failed posts are retried, waiting Backoff before the first retry and twice
+// as long before each following one. Responses with a 4xx status other than
+// 429 are not retried.
+type Notifier struct {
+	// ID is sent in the payloads to identify the FSM.
+	ID string
+
+	// Client is the HTTP client used, http.DefaultClient if nil.
+	Client *http.Client
+
+	// Retries is the number of times a failed post is retried.
+	Retries int
+
+	// Backoff is the time to wait before the first retry.
+	Backoff time.Duration
+
+	// Codec encodes the payloads, fsm.JSONCodec if nil.
+	Codec fsm.Codec
+
+	// ContentType is the content type of the payloads, application/json if
+	// empty. It must be set with a Codec other than fsm.JSONCodec.
+	ContentType string
+
+	// OnError is called with the posts that failed after all retries, and
+	// with the transitions dropped when the queue is full, with an empty URL.
+	// It may be nil.
+	OnError func(url string, p Payload, err error)
+
+	hooks []Hook
+	queue chan Payload
+}
+
+// NewNotifier returns a Notifier posting to hooks, queueing up to size
+// transitions.
+func NewNotifier(size int, hooks ...Hook) *Notifier {
+	return &Notifier{
+		Retries: DefaultRetries,
+		Backoff: DefaultBackoff,
+		hooks:   hooks,
+		queue:   make(chan Payload, size),
+	}
+}
+
+// OnTransition queues the transition for Run, or drops it if the queue is
+// full.
+func (n *Notifier) OnTransition(src, dst, event string) {
+	p := Payload{ID: n.ID, Event: event, Src: src, Dst: dst, Time: time.Now()}
+	select {
+	case n.queue <- p:
+	default:
+		n.error("", p, QueueFullError{})
+	}
+}
+
+// Run posts the queued transitions until ctx is done, and returns ctx.Err().
+// The transitions are posted in order, one at a time.
+func (n *Notifier) Run(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case p := <-n.queue:
+			n.notify(ctx, p)
+		}
+	}
+}
+
+// notify posts p to the hooks matching it.
+func (n *Notifier) notify(ctx context.Context, p Payload) {
+	codec := n.Codec
+	if codec == nil {
+		codec = fsm.JSONCodec{}
+	}
+	body, err := codec.Marshal(p)
+	if err != nil {
+		n.error("", p, err)
+		return
+	}
+	for _, h := range n.hooks {
+		if !h.match(p) {
+			continue
+		}
+		if err := n.post(ctx, h.URL, body); err != nil {
+			n.error(h.URL, p, err)
+		}
+	}
+}
+
+// post posts body to url, with retries.
+func (n *Notifier) post(ctx context.Context, url string, body []byte) error {
+	backoff := n.Backoff
+	for i := 0; ; i++ {
+		retry, err := n.postOnce(ctx, url, body)
+		if err == nil || !retry || i >= n.Retries {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// postOnce posts body to url, and returns whether a failed post should be
+// retried.
+func (n *Notifier) postOnce(ctx context.Context, url string, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	contentType := n.ContentType
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	client := n.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+	return retry, StatusError{url, resp.StatusCode}
+}
+
+func (n *Notifier) error(url string, p Payload, err error) {
+	if n.OnError != nil {
+		n.OnError(url, p, err)
+	}
+}
@@ -0,0 +1,180 @@
+// Copyright (c) 2013 - Max Persson <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/papiguy/fsm"
+)
+
+// server records the payloads posted to it, failing with the status codes in
+// fail first.
+type server struct {
+	mu          sync.Mutex
+	fail        []int
+	payloads    []Payload
+	posts       int
+	contentType string
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.posts++
+	s.contentType = r.Header.Get("Content-Type")
+	if len(s.fail) > 0 {
+		w.WriteHeader(s.fail[0])
+		s.fail = s.fail[1:]
+		return
+	}
+	var p Payload
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	s.payloads = append(s.payloads, p)
+}
+
+func newDoor(n *Notifier) *fsm.FSM {
+	f := fsm.NewFSM(
+		"closed",
+		fsm.Events{
+			{EvtName: "open", SrcStates: []string{"closed"}, DstStates: "open"},
+			{EvtName: "close", SrcStates: []string{"open"}, DstStates: "closed"},
+		},
+		fsm.Callbacks{},
+	)
+	f.AddObserver(n)
+	return f
+}
+
+func TestNotifier(t *testing.T) {
+	all := &server{fail: []int{http.StatusInternalServerError, http.StatusTooManyRequests}}
+	opened := &server{}
+	allServer := httptest.NewServer(all)
+	defer allServer.Close()
+	openedServer := httptest.NewServer(opened)
+	defer openedServer.Close()
+
+	n := NewNotifier(10, Hook{URL: allServer.URL}, Hook{URL: openedServer.URL, Dst: "open"})
+	n.ID = "door-1"
+	n.Backoff = time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	n.OnError = func(url string, p Payload, err error) {
+		// The last post may be canceled by the end of the test.
+		if ctx.Err() == nil {
+			t.Errorf("unexpected error for %s: %v", url, err)
+		}
+	}
+	door := newDoor(n)
+	door.Event("open")
+	door.Event("close")
+
+	done := make(chan error)
+	go func() { done <- n.Run(ctx) }()
+	deadline := time.Now().Add(time.Second)
+	for {
+		all.mu.Lock()
+		posted := len(all.payloads)
+		all.mu.Unlock()
+		if posted == 2 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+
+	if all.posts != 4 || len(all.payloads) != 2 {
+		t.Fatalf("expected 2 payloads after 2 retries, got %d posts", all.posts)
+	}
+	p := all.payloads[1]
+	if p.ID != "door-1" || p.Event != "close" || p.Src != "open" || p.Dst != "closed" || p.Time.IsZero() {
+		t.Errorf("unexpected payload %+v", p)
+	}
+	if len(opened.payloads) != 1 || opened.payloads[0].Event != "open" {
+		t.Errorf("expected only the open transition, got %+v", opened.payloads)
+	}
+}
+
+// indentCodec is a fsm.Codec encoding indented JSON.
+type indentCodec struct{ fsm.JSONCodec }
+
+func (indentCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.MarshalIndent(v, "", "  ")
+}
+
+func TestNotifierCodec(t *testing.T) {
+	s := &server{}
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	n := NewNotifier(1, Hook{URL: ts.URL})
+	n.Codec = indentCodec{}
+	n.ContentType = "application/vnd.door+json"
+	n.notify(context.Background(), Payload{Event: "open", Src: "closed", Dst: "open"})
+
+	if len(s.payloads) != 1 || s.payloads[0].Event != "open" {
+		t.Fatalf("expected the open transition, got %+v", s.payloads)
+	}
+	if s.contentType != n.ContentType {
+		t.Errorf("expected content type %s, got %s", n.ContentType, s.contentType)
+	}
+}
+
+func TestNotifierErrors(t *testing.T) {
+	s := &server{fail: []int{http.StatusBadRequest, 500, 500, 500}}
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	var errs []error
+	n := NewNotifier(1, Hook{URL: ts.URL})
+	n.Retries = 2
+	n.Backoff = time.Millisecond
+	n.OnError = func(url string, p Payload, err error) {
+		errs = append(errs, err)
+	}
+	n.OnTransition("closed", "open", "open")
+	n.OnTransition("open", "closed", "close")
+	if len(errs) != 1 || errs[0] != (QueueFullError{}) {
+		t.Fatalf("expected QueueFullError, got %v", errs)
+	}
+
+	ctx := context.Background()
+	n.notify(ctx, <-n.queue)
+	if len(errs) != 2 || errs[1] != (StatusError{ts.URL, 400}) || s.posts != 1 {
+		t.Errorf("expected a status error without retries, got %v", errs)
+	}
+	n.notify(ctx, Payload{Event: "open"})
+	if len(errs) != 3 || errs[2] != (StatusError{ts.URL, 500}) || s.posts != 4 {
+		t.Errorf("expected a status error after 2 retries, got %v and %d posts", errs, s.posts)
+	}
+}
+
+func TestStatusError(t *testing.T) {
+	e := StatusError{URL: "http://example.com", StatusCode: 500}
+	if e.Error() != "webhook http://example.com: status 500" {
+		t.Error("StatusError string mismatch")
+	}
+}